@@ -9,6 +9,7 @@ replace github.com/ethereum/go-ethereum v1.14.11 => github.com/ethereum-optimism
 require (
 	github.com/ethereum-optimism/optimism v1.9.5-0.20241008153126-117c9a427168
 	github.com/ethereum/go-ethereum v1.14.11
+	github.com/google/pprof v0.0.0-20241009165004-a3522334989c
 	github.com/holiman/uint256 v1.3.1
 	github.com/pkg/errors v0.9.1
 	github.com/pkg/profile v1.7.0
@@ -77,7 +78,6 @@ require (
 	github.com/golang-jwt/jwt/v4 v4.5.1 // indirect
 	github.com/golang/snappy v0.0.5-0.20220116011046-fa5810519dcb // indirect
 	github.com/google/gopacket v1.1.19 // indirect
-	github.com/google/pprof v0.0.0-20241009165004-a3522334989c // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/graph-gophers/graphql-go v1.3.0 // indirect
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// RegWrite is a register write of a commit: Name is "x<n>", "f<n>", or "c<n>_<name>" for CSRs
+type RegWrite struct {
+	Name  string
+	Value uint64
+}
+
+// MemWrite is a memory write of a commit. Size is the number of bytes of Value.
+type MemWrite struct {
+	Addr  uint64
+	Value uint64
+	Size  uint64
+}
+
+// Commit is an instruction in a commit log, in the format of Spike's --log-commits:
+//
+//	core   0: 0 0x0000000000001000 (0x00113823) mem 0x0000000000003ff8 0x0000000000001004
+type Commit struct {
+	Priv   uint8
+	PC     uint64
+	Instr  uint32
+	Regs   []RegWrite
+	Loads  []uint64
+	Stores []MemWrite
+}
+
+func (c *Commit) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "core   0: %d 0x%016x ", c.Priv, c.PC)
+	if c.Instr&3 != 3 {
+		fmt.Fprintf(&out, "(0x%04x)", c.Instr)
+	} else {
+		fmt.Fprintf(&out, "(0x%08x)", c.Instr)
+	}
+	for _, r := range c.Regs {
+		fmt.Fprintf(&out, " %-3s 0x%016x", r.Name, r.Value)
+	}
+	for _, addr := range c.Loads {
+		fmt.Fprintf(&out, " mem 0x%016x", addr)
+	}
+	for _, w := range c.Stores {
+		fmt.Fprintf(&out, " mem 0x%016x 0x%0*x", w.Addr, 2*w.Size, w.Value)
+	}
+	return out.String()
+}
+
+// ParseCommit parses a commit log line. It returns false for lines that are not commits,
+// like the disassembly and exception lines of Spike.
+func ParseCommit(line string) (*Commit, bool, error) {
+	fields := strings.Fields(line)
+	// core, "<id>:", privilege, pc, (instruction)
+	if len(fields) < 5 || fields[0] != "core" || len(fields[2]) != 1 || fields[2][0] < '0' || fields[2][0] > '9' {
+		return nil, false, nil
+	}
+	c := &Commit{Priv: fields[2][0] - '0'}
+	pc, err := parseHex(fields[3])
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pc: %w", err)
+	}
+	c.PC = pc
+	instr := strings.TrimSuffix(strings.TrimPrefix(fields[4], "("), ")")
+	v, err := parseHex(instr)
+	if err != nil || v > 0xffff_ffff {
+		return nil, false, fmt.Errorf("invalid instruction %q", fields[4])
+	}
+	c.Instr = uint32(v)
+
+	for i := 5; i < len(fields); i++ {
+		name := fields[i]
+		switch {
+		case name == "mem":
+			if i+1 >= len(fields) {
+				return nil, false, fmt.Errorf("missing memory address")
+			}
+			addr, err := parseHex(fields[i+1])
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid memory address: %w", err)
+			}
+			i++
+			if i+1 < len(fields) && strings.HasPrefix(fields[i+1], "0x") {
+				value, err := parseHex(fields[i+1])
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid memory value: %w", err)
+				}
+				c.Stores = append(c.Stores, MemWrite{Addr: addr, Value: value, Size: uint64(len(fields[i+1])-2) / 2})
+				i++
+			} else {
+				c.Loads = append(c.Loads, addr)
+			}
+		case isRegName(name):
+			if i+1 >= len(fields) {
+				return nil, false, fmt.Errorf("missing value of %s", name)
+			}
+			// values wider than 64 bits, like vector registers, are not compared
+			if value, err := parseHex(fields[i+1]); err == nil {
+				c.Regs = append(c.Regs, RegWrite{Name: name, Value: value})
+			}
+			i++
+		}
+		// other tokens, like a trailing disassembly, are ignored
+	}
+	return c, true, nil
+}
+
+func isRegName(name string) bool {
+	if len(name) < 2 {
+		return false
+	}
+	switch name[0] {
+	case 'x', 'f', 'c', 'v':
+		return name[1] >= '0' && name[1] <= '9'
+	}
+	return false
+}
+
+func parseHex(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("%q is not hex", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
+
+// CommitLogReader reads the commits of a commit log, skipping the other lines
+type CommitLogReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewCommitLogReader(r io.Reader) *CommitLogReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	return &CommitLogReader{scanner: scanner}
+}
+
+// Next returns the next commit, and its raw line. It returns io.EOF at the end of the log.
+func (cr *CommitLogReader) Next() (*Commit, string, error) {
+	for cr.scanner.Scan() {
+		cr.line++
+		line := cr.scanner.Text()
+		c, ok, err := ParseCommit(line)
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: %w", cr.line, err)
+		}
+		if ok {
+			return c, line, nil
+		}
+	}
+	if err := cr.scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	return nil, "", io.EOF
+}
+
+// Line returns the line number of the last commit
+func (cr *CommitLogReader) Line() int {
+	return cr.line
+}
+
+// CommitLogWriter writes a commit log of the instructions that a fast.InstrumentedState executes,
+// in the format of Spike's --log-commits, to cross-validate a run against Spike.
+// Syscalls are logged as the ECALL instruction, with the registers and memory that the VM wrote.
+type CommitLogWriter struct {
+	state *fast.VMState
+	w     io.WriteCloser
+	buf   *bufio.Writer
+	// err is the first write error, the log stops there
+	err error
+
+	// the memory accesses of the current step
+	executed bool
+	loads    []uint64
+	stores   []MemWrite
+}
+
+func NewCommitLogWriter(state *fast.VMState, w io.WriteCloser) *CommitLogWriter {
+	return &CommitLogWriter{state: state, w: w, buf: bufio.NewWriter(w)}
+}
+
+// TraceMemory is a fast.MemoryTracer
+func (cw *CommitLogWriter) TraceMemory(addr uint64, size uint64, access uint8) {
+	switch access {
+	case riscv.ProtExec:
+		cw.executed = true
+	case riscv.ProtRead:
+		cw.loads = append(cw.loads, addr)
+	case riscv.ProtWrite:
+		cw.stores = append(cw.stores, MemWrite{Addr: addr, Size: size})
+	}
+}
+
+// Step wraps stepFn to log the instruction of every step.
+// Steps without an instruction, like thread switches, are not logged.
+func (cw *CommitLogWriter) Step(stepFn StepFn) StepFn {
+	return func(proof bool) (*fast.StepWitness, error) {
+		c := &Commit{PC: cw.state.PC, Instr: cw.state.Instr()}
+		threadID, regs, fpRegs := cw.state.ThreadID, cw.state.Registers, cw.state.FPRegisters
+		cw.executed, cw.loads, cw.stores = false, nil, nil
+
+		wit, err := stepFn(proof)
+		if err != nil || !cw.executed || cw.err != nil {
+			return wit, err
+		}
+		// the registers of another thread are not writes of this instruction
+		if cw.state.ThreadID == threadID {
+			for i := 1; i < len(regs); i++ {
+				if v := cw.state.Registers[i]; v != regs[i] {
+					c.Regs = append(c.Regs, RegWrite{Name: "x" + strconv.Itoa(i), Value: v})
+				}
+			}
+			for i := range fpRegs {
+				if v := cw.state.FPRegisters[i]; v != fpRegs[i] {
+					c.Regs = append(c.Regs, RegWrite{Name: "f" + strconv.Itoa(i), Value: v})
+				}
+			}
+		}
+		c.Loads = cw.loads
+		for _, w := range cw.stores {
+			c.Stores = append(c.Stores, cw.readStore(w.Addr, w.Size)...)
+		}
+		_, cw.err = fmt.Fprintln(cw.buf, c.String())
+		return wit, err
+	}
+}
+
+// readStore reads the stored memory back, split into double words since syscalls store larger ranges
+func (cw *CommitLogWriter) readStore(addr uint64, size uint64) []MemWrite {
+	var out []MemWrite
+	for size > 0 {
+		n := min(size, 8)
+		var dat [8]byte
+		cw.state.Memory.GetUnaligned(addr, dat[:n])
+		out = append(out, MemWrite{Addr: addr, Value: binary.LittleEndian.Uint64(dat[:]), Size: n})
+		addr += n
+		size -= n
+	}
+	return out
+}
+
+// Close flushes the log, and closes the underlying writer
+func (cw *CommitLogWriter) Close() error {
+	err := cw.err
+	if flushErr := cw.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := cw.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestCommitLogWriter(t *testing.T) {
+	a := riscv.NewAssembler(0x1000)
+	a.Addi(riscv.RegA0, riscv.RegZero, 5)
+	a.Sd(riscv.RegA0, riscv.RegSP, 8)
+	a.Ld(riscv.RegA1, riscv.RegSP, 8)
+	a.EmitCompressed(0x0505) // c.addi a0, 1
+	a.Syscall(riscv.SysExitGroup, 0)
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), Registers: [32]uint64{2: 0x2000}, MemoryRegions: fast.UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+
+	var buf bytes.Buffer
+	us := fast.NewInstrumentedState(state, nil, nil, nil)
+	cw := NewCommitLogWriter(state, nopCloser{&buf})
+	us.SetMemoryTracer(cw.TraceMemory)
+	stepFn := cw.Step(us.Step)
+	for !state.Exited {
+		_, err := stepFn(false)
+		require.NoError(t, err)
+	}
+	require.NoError(t, cw.Close())
+	require.Equal(t, []string{
+		"core   0: 0 0x0000000000001000 (0x00500513) x10 0x0000000000000005",
+		"core   0: 0 0x0000000000001004 (0x00a13423) mem 0x0000000000002008 0x0000000000000005",
+		"core   0: 0 0x0000000000001008 (0x00813583) x11 0x0000000000000005 mem 0x0000000000002008",
+		"core   0: 0 0x000000000000100c (0x0505) x10 0x0000000000000006",
+		"core   0: 0 0x000000000000100e (0x05e00893) x17 0x000000000000005e",
+		"core   0: 0 0x0000000000001012 (0x00000513) x10 0x0000000000000000",
+		"core   0: 0 0x0000000000001016 (0x00000073)",
+	}, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+}
+
+func TestParseCommit(t *testing.T) {
+	c, ok, err := ParseCommit("core   0: 3 0x0000000080000004 (0x34202573) x10 0x0000000000000008 c834_mcause 0x0000000000000008 " +
+		"f1  0x3ff0000000000000 mem 0x0000000080001000 mem 0x0000000080002000 0x0102")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &Commit{
+		Priv:  3,
+		PC:    0x8000_0004,
+		Instr: 0x34202573,
+		Regs: []RegWrite{
+			{Name: "x10", Value: 8},
+			{Name: "c834_mcause", Value: 8},
+			{Name: "f1", Value: 0x3ff0000000000000},
+		},
+		Loads:  []uint64{0x8000_1000},
+		Stores: []MemWrite{{Addr: 0x8000_2000, Value: 0x0102, Size: 2}},
+	}, c)
+	require.Equal(t, "core   0: 3 0x0000000080000004 (0x34202573) x10 0x0000000000000008 c834_mcause 0x0000000000000008 "+
+		"f1  0x3ff0000000000000 mem 0x0000000080001000 mem 0x0000000080002000 0x0102", c.String())
+
+	// disassembly and exception lines are not commits
+	for _, line := range []string{
+		"core   0: 0x0000000000010000 (0x00000073) ecall",
+		"core   0: exception trap_user_ecall, epc 0x0000000000010000",
+		"",
+	} {
+		_, ok, err := ParseCommit(line)
+		require.NoError(t, err)
+		require.False(t, ok, line)
+	}
+
+	_, _, err = ParseCommit("core   0: 0 0x1000 (0xzz)")
+	require.ErrorContains(t, err, "invalid instruction")
+}
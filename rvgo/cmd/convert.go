@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+var ConvertInputFlag = &cli.PathFlag{
+	Name:      "input",
+	Usage:     "Path of the state to convert, in the binary encoding if it ends in .bin or .bin.gz, else in JSON",
+	TakesFile: true,
+	Required:  true,
+}
+
+var ConvertOutputFlag = &cli.PathFlag{
+	Name:      "output",
+	Usage:     "Path to write the converted state to, in the binary encoding if it ends in .bin or .bin.gz, else in JSON",
+	TakesFile: true,
+	Required:  true,
+}
+
+var ConvertVersionFlag = &cli.StringFlag{
+	Name:  "version",
+	Usage: "State version to convert to, like v1, or latest",
+	Value: "latest",
+}
+
+var ConvertLossyFlag = &cli.BoolFlag{
+	Name:  "lossy",
+	Usage: "Drop the state that an older version cannot encode, such as the memory regions, instead of failing",
+}
+
+func Convert(ctx *cli.Context) error {
+	version, err := fast.ParseStateVersion(ctx.String(ConvertVersionFlag.Name))
+	if err != nil {
+		return err
+	}
+	input := ctx.Path(ConvertInputFlag.Name)
+	state, err := fast.LoadStateFromFile(input)
+	if err != nil {
+		return fmt.Errorf("invalid input state (%v): %w", input, err)
+	}
+	from := state.Version
+	err = state.Convert(version, false)
+	if err != nil && ctx.Bool(ConvertLossyFlag.Name) && !errors.Is(err, fast.ErrUnknownVersion) {
+		Logger(os.Stderr, slog.LevelInfo).Warn("Dropping the state that the version cannot encode", "err", err)
+		err = state.Convert(version, true)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert state from version %s to %s: %w", from, version, err)
+	}
+	if err := serialize.Write(ctx.Path(ConvertOutputFlag.Name), state, OutFilePerm); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+var ConvertCommand = &cli.Command{
+	Name:        "convert",
+	Usage:       "Convert an Asterisc state between versions, and between JSON and binary",
+	Description: "Convert an Asterisc JSON/binary state of any supported version into another version and encoding. Downgrading fails if the state uses what the older version cannot encode, unless --lossy is set.",
+	Action:      Convert,
+	Flags: []cli.Flag{
+		ConvertInputFlag,
+		ConvertOutputFlag,
+		ConvertVersionFlag,
+		ConvertLossyFlag,
+	},
+}
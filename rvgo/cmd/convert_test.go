@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+func TestConvert(t *testing.T) {
+	app := &cli.App{Commands: []*cli.Command{ConvertCommand}}
+	convert := func(args ...string) error {
+		return app.Run(append([]string{"asterisc", "convert"}, args...))
+	}
+	dir := t.TempDir()
+	v1Path := filepath.Join(dir, "v1.json")
+	latestPath := filepath.Join(dir, "latest.bin.gz")
+
+	state := fast.NewVMState()
+	state.PC = 0x1000
+	state.Registers[2] = 0x2000
+	state.MemoryRegions = fast.UnprotectedRegions()
+	require.NoError(t, state.SetWitnessAndStateHash())
+	require.NoError(t, serialize.Write(v1Path, &fast.VersionedState{Version: fast.StateVersionV1, VMState: state}, OutFilePerm))
+	_, err := fast.LoadVMStateFromFile(v1Path)
+	require.ErrorContains(t, err, "state version v1 is older than the latest version")
+
+	require.NoError(t, convert("--input", v1Path, "--output", latestPath))
+	upgraded, err := fast.LoadVMStateFromFile(latestPath)
+	require.NoError(t, err)
+	require.Equal(t, state.EncodeWitness(), upgraded.EncodeWitness())
+	require.Equal(t, []byte(upgraded.EncodeWitness()), upgraded.Witness)
+
+	upgraded.MemoryRegions[0] = fast.MemoryRegion{Start: 0x1000, End: 0x2000}
+	require.NoError(t, serialize.Write(latestPath, upgraded, OutFilePerm))
+	err = convert("--input", latestPath, "--output", v1Path, "--version", "v1")
+	require.ErrorContains(t, err, "failed to convert state from version v2 to v1: state version v1 cannot encode the memory regions")
+	require.NoError(t, convert("--input", latestPath, "--output", v1Path, "--version", "v1", "--lossy"))
+	downgraded, err := fast.LoadStateFromFile(v1Path)
+	require.NoError(t, err)
+	require.Equal(t, fast.StateVersionV1, downgraded.Version)
+	require.Equal(t, state.PC, downgraded.PC)
+	require.Equal(t, fast.UnprotectedRegions(), downgraded.MemoryRegions)
+
+	require.ErrorIs(t, convert("--input", v1Path, "--output", latestPath, "--version", "v9"), fast.ErrUnknownVersion)
+}
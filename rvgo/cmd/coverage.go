@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+// Coverage records the instructions that a program executes, to report the coverage of its source lines
+type Coverage struct {
+	state *fast.VMState
+	meta  *Metadata
+	// counts is the number of times each instruction ran, by PC
+	counts map[uint64]uint64
+}
+
+func NewCoverage(state *fast.VMState, meta *Metadata) (*Coverage, error) {
+	if len(meta.Lines) == 0 {
+		return nil, fmt.Errorf("no line table in the metadata, regenerate it with load-elf --meta-lines, or pass --elf")
+	}
+	return &Coverage{state: state, meta: meta, counts: make(map[uint64]uint64)}, nil
+}
+
+// Step wraps a step function, to count the instruction of every step
+func (c *Coverage) Step(stepFn StepFn) StepFn {
+	return func(proof bool) (*fast.StepWitness, error) {
+		pc := c.state.PC
+		wit, err := stepFn(proof)
+		if err == nil {
+			c.counts[pc]++
+		}
+		return wit, err
+	}
+}
+
+type sourceLine struct {
+	file string
+	line uint32
+}
+
+type LineCoverage struct {
+	File string
+	Line uint32
+	// Count is the number of times the most executed instruction of the line ran
+	Count uint64
+}
+
+// Lines reports the coverage of every source line with instructions, sorted by file and line
+func (c *Coverage) Lines() []LineCoverage {
+	counts := make(map[sourceLine]uint64)
+	for _, l := range c.meta.Lines {
+		if l.Line != 0 {
+			counts[sourceLine{file: c.meta.Files[l.File], line: l.Line}] = 0
+		}
+	}
+	for pc, n := range c.counts {
+		file, line, ok := c.meta.LookupLine(pc)
+		if !ok {
+			continue
+		}
+		key := sourceLine{file: file, line: line}
+		counts[key] = max(counts[key], n)
+	}
+	out := make([]LineCoverage, 0, len(counts))
+	for l, n := range counts {
+		out = append(out, LineCoverage{File: l.file, Line: l.line, Count: n})
+	}
+	slices.SortFunc(out, func(a, b LineCoverage) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+	return out
+}
+
+// writeLCOV writes the line coverage as an lcov tracefile
+func writeLCOV(w io.Writer, lines []LineCoverage) error {
+	bw := bufio.NewWriter(w)
+	var found, hit int
+	for i, l := range lines {
+		if i == 0 || lines[i-1].File != l.File {
+			_, _ = fmt.Fprintf(bw, "SF:%s\n", l.File)
+		}
+		_, _ = fmt.Fprintf(bw, "DA:%d,%d\n", l.Line, l.Count)
+		found++
+		if l.Count > 0 {
+			hit++
+		}
+		if i == len(lines)-1 || lines[i+1].File != l.File {
+			_, _ = fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", found, hit)
+			found, hit = 0, 0
+		}
+	}
+	return bw.Flush()
+}
+
+// writeGoCoverProfile writes the line coverage as a Go coverage profile in count mode,
+// with a block of one statement per line, for `go tool cover`
+func writeGoCoverProfile(w io.Writer, lines []LineCoverage) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(bw, "mode: count")
+	for _, l := range lines {
+		_, _ = fmt.Fprintf(bw, "%s:%d.1,%d.1 1 %d\n", l.File, l.Line, l.Line+1, l.Count)
+	}
+	return bw.Flush()
+}
+
+// Write writes the line coverage, as an lcov tracefile in the lcov format, or as a Go coverage profile in the go format
+func (c *Coverage) Write(w io.Writer, format string) error {
+	switch format {
+	case "lcov":
+		return writeLCOV(w, c.Lines())
+	case "go":
+		return writeGoCoverProfile(w, c.Lines())
+	default:
+		return fmt.Errorf("invalid coverage format %q", format)
+	}
+}
+
+// writeCoverage writes the line coverage so far to a file at path
+func writeCoverage(path string, format string, coverage *Coverage) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+	if err != nil {
+		return err
+	}
+	if err := coverage.Write(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestCoverage(t *testing.T) {
+	a := riscv.NewAssembler(0x1000)
+	a.Label("main")
+	a.Li(riscv.RegT0, 3)
+	a.Label("loop")
+	a.Addi(riscv.RegT0, riscv.RegT0, -1)
+	a.Bnez(riscv.RegT0, "loop")
+	a.Label("exit")
+	a.Syscall(riscv.SysExitGroup, 0)
+	a.Label("dead")
+	a.Addi(riscv.RegT0, riscv.RegT0, 1)
+	a.Label("end")
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), MemoryRegions: fast.UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+
+	addr := func(label string) uint64 {
+		out, ok := a.Addr(label)
+		require.True(t, ok)
+		return out
+	}
+	meta := &Metadata{
+		Files: []string{"main.go", "dead.go"},
+		Lines: []Line{
+			{Start: addr("main"), File: 0, Line: 10},
+			{Start: addr("loop"), File: 0, Line: 11},
+			{Start: addr("exit"), File: 0, Line: 12},
+			{Start: addr("dead"), File: 1, Line: 5},
+			{Start: addr("end")},
+		},
+	}
+
+	us := fast.NewInstrumentedState(state, nil, nil, nil)
+	coverage, err := NewCoverage(state, meta)
+	require.NoError(t, err)
+	stepFn := coverage.Step(us.Step)
+	for !state.Exited {
+		_, err := stepFn(false)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []LineCoverage{
+		{File: "dead.go", Line: 5},
+		{File: "main.go", Line: 10, Count: 1},
+		{File: "main.go", Line: 11, Count: 3},
+		{File: "main.go", Line: 12, Count: 1},
+	}, coverage.Lines())
+
+	var buf bytes.Buffer
+	require.NoError(t, coverage.Write(&buf, "lcov"))
+	require.Equal(t, "SF:dead.go\nDA:5,0\nLF:1\nLH:0\nend_of_record\n"+
+		"SF:main.go\nDA:10,1\nDA:11,3\nDA:12,1\nLF:3\nLH:3\nend_of_record\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, coverage.Write(&buf, "go"))
+	require.Equal(t, "mode: count\ndead.go:5.1,6.1 1 0\n"+
+		"main.go:10.1,11.1 1 1\nmain.go:11.1,12.1 1 3\nmain.go:12.1,13.1 1 1\n", buf.String())
+
+	_, err = NewCoverage(state, &Metadata{})
+	require.ErrorContains(t, err, "no line table")
+}
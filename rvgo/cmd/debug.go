@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/gdb"
+	cannon "github.com/ethereum-optimism/optimism/cannon/cmd"
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+)
+
+var DebugListenFlag = &cli.StringFlag{
+	Name:  "listen",
+	Usage: "Address to serve the GDB remote protocol on: tcp:<host>:<port>, or unix:<path>",
+	Value: "tcp:127.0.0.1:1234",
+}
+
+// parseListenAddr splits an address of the listen flag into network and address
+func parseListenAddr(addr string) (string, string, error) {
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok || (network != "tcp" && network != "unix") {
+		return "", "", fmt.Errorf("invalid listen address %q, expected tcp:<host>:<port> or unix:<path>", addr)
+	}
+	return network, address, nil
+}
+
+func Debug(ctx *cli.Context) error {
+	network, address, err := parseListenAddr(ctx.String(DebugListenFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	state, err := fast.LoadVMStateFromFile(ctx.Path(cannon.RunInputFlag.Name))
+	if err != nil {
+		return err
+	}
+	l := Logger(os.Stderr, slog.LevelInfo)
+	outLog := &LoggingWriter{Name: "program std-out", Log: l}
+	errLog := &LoggingWriter{Name: "program std-err", Log: l}
+
+	args := preimageServerArgs(ctx)
+	po, err := NewProcessPreimageOracle(args[0], args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to create pre-image oracle process: %w", err)
+	}
+	if err := po.Start(); err != nil {
+		return fmt.Errorf("failed to start pre-image oracle server: %w", err)
+	}
+	defer func() {
+		if err := po.Close(); err != nil {
+			l.Error("failed to close pre-image server", "err", err)
+		}
+	}()
+
+	us := fast.NewInstrumentedState(state, po, outLog, errLog)
+	server := gdb.NewServer(state, us)
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer listener.Close()
+	l.Info("waiting for debugger", "network", network, "address", listener.Addr())
+	accepted := make(chan struct{})
+	go func() { // stop waiting once interrupted
+		select {
+		case <-ctx.Context.Done():
+			_ = listener.Close()
+		case <-accepted:
+		}
+	}()
+	conn, err := listener.Accept()
+	close(accepted)
+	if err != nil {
+		if ctx.Context.Err() != nil {
+			return ctx.Context.Err()
+		}
+		return fmt.Errorf("failed to accept debugger connection: %w", err)
+	}
+	l.Info("debugger connected", "remote", conn.RemoteAddr())
+	err = server.Serve(ctx.Context, conn)
+	_ = conn.Close()
+	if err != nil { // the state is only written once the debugger detached, or killed the program
+		return fmt.Errorf("debugging session failed: %w", err)
+	}
+	if err := server.Err(); err != nil {
+		return fmt.Errorf("failed at step %d (PC: %08x): %w", state.Step, state.PC, err)
+	}
+	l.Info("debugger detached", "step", state.Step, "pc", HexU32(state.PC), "exited", state.Exited)
+
+	if err := state.SetWitnessAndStateHash(); err != nil {
+		return fmt.Errorf("failed to set witness and stateHash: %w", err)
+	}
+	if err := serialize.Write[*fast.VMState](ctx.Path(cannon.RunOutputFlag.Name), state, OutFilePerm); err != nil {
+		return fmt.Errorf("failed to write state output: %w", err)
+	}
+	return nil
+}
+
+var DebugCommand = &cli.Command{
+	Name:  "debug",
+	Usage: "Debug a VM state with GDB.",
+	Description: "Serve the GDB remote protocol for the program in a VM state, to debug it with GDB " +
+		"(e.g. gdb-multiarch, with 'target remote'). The pre-image server command follows '--', like for run.",
+	Action: Debug,
+	Flags: []cli.Flag{
+		cannon.RunInputFlag,
+		cannon.RunOutputFlag,
+		DebugListenFlag,
+	},
+}
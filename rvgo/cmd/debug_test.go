@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	network, address, err := parseListenAddr("tcp:127.0.0.1:1234")
+	require.NoError(t, err)
+	require.Equal(t, "tcp", network)
+	require.Equal(t, "127.0.0.1:1234", address)
+
+	network, address, err = parseListenAddr("unix:/tmp/asterisc.sock")
+	require.NoError(t, err)
+	require.Equal(t, "unix", network)
+	require.Equal(t, "/tmp/asterisc.sock", address)
+
+	_, _, err = parseListenAddr("127.0.0.1:1234")
+	require.ErrorContains(t, err, "invalid listen address")
+}
+
+// debugClient is a minimal GDB client, that turns off acknowledgements first
+type debugClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialDebug connects to the debug command once it listens on the unix socket
+func dialDebug(t *testing.T, socket string) *debugClient {
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("unix", socket)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { _ = conn.Close() })
+	c := &debugClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	require.Equal(t, "OK", c.request("QStartNoAckMode"))
+	return c
+}
+
+// request sends a packet, and returns the reply, skipping acknowledgements
+func (c *debugClient) request(packet string) string {
+	var sum uint8
+	for i := 0; i < len(packet); i++ {
+		sum += packet[i]
+	}
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", packet, sum)
+	require.NoError(c.t, err)
+	for {
+		b, err := c.r.ReadByte()
+		require.NoError(c.t, err)
+		if b == '$' {
+			break
+		}
+		require.Equal(c.t, byte('+'), b)
+	}
+	reply, err := c.r.ReadString('#')
+	require.NoError(c.t, err)
+	_, err = c.r.Discard(2) // checksum
+	require.NoError(c.t, err)
+	return strings.TrimSuffix(reply, "#")
+}
+
+func TestDebug(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "in.bin.gz")
+	state := fast.NewVMState()
+	state.PC = 0x1000
+	state.MemoryRegions = fast.UnprotectedRegions()
+	for i, insn := range []uint32{
+		0x00108093, // addi x1, x1, 1
+		0x00110113, // addi x2, x2, 1
+		0xff9ff06f, // j -8
+	} {
+		state.Memory.SetUnaligned(0x1000+uint64(i)*4, binary.LittleEndian.AppendUint32(nil, insn))
+	}
+	require.NoError(t, serialize.Write(inputPath, state, OutFilePerm))
+
+	debug := func(ctx context.Context, outputPath string, socket string) <-chan error {
+		app := &cli.App{Commands: []*cli.Command{DebugCommand}}
+		done := make(chan error, 1)
+		go func() {
+			done <- app.RunContext(ctx, []string{"asterisc", "debug",
+				"--input", inputPath, "--output", outputPath, "--listen", "unix:" + socket})
+		}()
+		return done
+	}
+
+	t.Run("detach", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "detach.bin.gz")
+		socket := filepath.Join(dir, "detach.sock")
+		done := debug(context.Background(), outputPath, socket)
+		c := dialDebug(t, socket)
+		require.Equal(t, "T05thread:2;", c.request("s"))
+		require.Equal(t, "0410000000000000", c.request("p20"))
+		require.Equal(t, "OK", c.request("Z0,1008,4"))
+		require.Equal(t, "T05swbreak:;thread:2;", c.request("c"))
+		require.Equal(t, "0810000000000000", c.request("p20"))
+		require.Equal(t, "OK", c.request("D"))
+		require.NoError(t, <-done)
+
+		out, err := fast.LoadVMStateFromFile(outputPath)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0x1008), out.PC)
+		require.Equal(t, uint64(2), out.Step)
+		require.Equal(t, uint64(1), out.Registers[1])
+		require.Equal(t, uint64(1), out.Registers[2])
+		require.Equal(t, []byte(out.EncodeWitness()), out.Witness)
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "disconnect.bin.gz")
+		socket := filepath.Join(dir, "disconnect.sock")
+		done := debug(context.Background(), outputPath, socket)
+		c := dialDebug(t, socket)
+		require.Equal(t, "T05thread:2;", c.request("s"))
+		require.NoError(t, c.conn.Close())
+		require.ErrorContains(t, <-done, "debugger disconnected without detaching")
+		_, err := os.Stat(outputPath)
+		require.ErrorIs(t, err, os.ErrNotExist) // the failed session does not write the state
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "interrupt.bin.gz")
+		socket := filepath.Join(dir, "interrupt.sock")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := debug(ctx, outputPath, socket)
+		dialDebug(t, socket)
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+		_, err := os.Stat(outputPath)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
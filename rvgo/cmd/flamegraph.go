@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// symbolName returns the symbol of addr, or the address itself if there are no symbols
+func symbolName(meta *Metadata, addr uint64) string {
+	if len(meta.Symbols) == 0 {
+		return fmt.Sprintf("%#x", addr)
+	}
+	return meta.LookupSymbol(addr)
+}
+
+// callStackNames returns the functions of a shadow call stack at pc, outermost first:
+// the caller of the first call, the called functions, and the function of pc if it was not called, like after a tail call.
+func callStackNames(meta *Metadata, stack []fast.CallFrame, pc uint64) []string {
+	names := make([]string, 0, len(stack)+2)
+	if len(stack) > 0 {
+		caller := stack[0].Return
+		if len(meta.Symbols) > 0 {
+			caller-- // the return address may be just past the end of the calling function
+		}
+		names = append(names, symbolName(meta, caller))
+	}
+	for _, f := range stack {
+		names = append(names, symbolName(meta, f.Entry))
+	}
+	if leaf := symbolName(meta, pc); len(names) == 0 || names[len(names)-1] != leaf {
+		names = append(names, leaf)
+	}
+	return names
+}
+
+// logCallStack logs the call stack of a failed step, if the error has one, with the inlined calls at pc
+func logCallStack(l log.Logger, symbolizer *Symbolizer, pc uint64, err error) {
+	var stackErr *fast.CallStackError
+	if errors.As(err, &stackErr) {
+		l.Error("call stack of the failed step", "stack", strings.Join(callStackNames(symbolizer.meta, stackErr.Stack, pc), " > "),
+			"at", symbolizer.Describe(pc))
+	}
+}
+
+// FlameGraph counts the instructions that run by call stack,
+// to write them as folded stacks, the input format of flamegraph.pl and speedscope.
+type FlameGraph struct {
+	state      *fast.VMState
+	callStacks *fast.CallStacks
+	meta       *Metadata
+	// instruction counts by folded stack, and the stacks in the order of their first occurrence
+	counts map[string]uint64
+	stacks []string
+}
+
+func NewFlameGraph(state *fast.VMState, callStacks *fast.CallStacks, meta *Metadata) *FlameGraph {
+	return &FlameGraph{state: state, callStacks: callStacks, meta: meta, counts: make(map[string]uint64)}
+}
+
+// Step wraps stepFn to count the instruction of every step by its call stack
+func (fg *FlameGraph) Step(stepFn StepFn) StepFn {
+	return func(proof bool) (*fast.StepWitness, error) {
+		// the stack is folded before the step, which may pop and push frames in place
+		folded := strings.Join(callStackNames(fg.meta, fg.callStacks.Stack(fg.state.ThreadID), fg.state.PC), ";")
+		instructions := fg.callStacks.Instructions()
+		wit, err := stepFn(proof)
+		if fg.callStacks.Instructions() != instructions {
+			if _, ok := fg.counts[folded]; !ok {
+				fg.stacks = append(fg.stacks, folded)
+			}
+			fg.counts[folded]++
+		}
+		return wit, err
+	}
+}
+
+// Write writes the folded stacks, one per line with the instruction count
+func (fg *FlameGraph) Write(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, folded := range fg.stacks {
+		if _, err := fmt.Fprintf(buf, "%s %d\n", folded, fg.counts[folded]); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// writeFlameGraph writes the folded stacks to a file at path
+func writeFlameGraph(path string, flamegraph *FlameGraph) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+	if err != nil {
+		return err
+	}
+	if err := flamegraph.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
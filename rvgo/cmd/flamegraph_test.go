@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+func TestFlameGraph(t *testing.T) {
+	state, meta := framePointerProgram(t)
+	us := fast.NewInstrumentedState(state, nil, nil, nil)
+	cs := fast.NewCallStacks()
+	us.SetCallStacks(cs)
+	fg := NewFlameGraph(state, cs, meta)
+	stepFn := fg.Step(us.Step)
+	for !state.Exited {
+		_, err := stepFn(false)
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, fg.Write(&buf))
+	// the return of g and f still count for them
+	require.Equal(t, "main 4\nmain;f 9\nmain;f;g 22\n", buf.String())
+}
+
+func TestCallStackNames(t *testing.T) {
+	meta := &Metadata{Symbols: []Symbol{{Name: "main", Start: 0x1000, Size: 0x10}, {Name: "f", Start: 0x1010, Size: 0x10}}}
+	stack := []fast.CallFrame{{Entry: 0x1010, Return: 0x1010}} // the call is the last instruction of main
+	require.Equal(t, []string{"main", "f"}, callStackNames(meta, stack, 0x1014))
+	require.Equal(t, []string{"main", "f", "main"}, callStackNames(meta, stack, 0x1008))
+	// without symbols, the caller is the return address
+	require.Equal(t, []string{"0x1010", "0x1010", "0x1014"}, callStackNames(&Metadata{}, stack, 0x1014))
+}
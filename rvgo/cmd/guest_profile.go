@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+// maxGuestStackDepth limits the frame pointer walk of a guest stack
+const maxGuestStackDepth = 128
+
+// guestStack returns the call stack of the program in the VM, leaf first: the PC, then the return addresses.
+// The caller of the current function is the return address register, and the callers above it
+// are found by walking the frame pointers (s0): the return address is saved at fp-8, the caller's fp at fp-16.
+// Programs without frame pointers, like Go on RISC-V, get the PC and its caller only.
+func guestStack(state *fast.VMState, meta *Metadata) []uint64 {
+	pc := state.PC
+	stack := []uint64{pc}
+	// with symbols, a return address must be in a function, which filters out s0 values that are not frame pointers
+	validRet := func(ret uint64) bool {
+		if ret == 0 || ret&1 != 0 {
+			return false
+		}
+		return len(meta.Symbols) == 0 || !strings.HasPrefix(meta.LookupSymbol(ret-1), "!")
+	}
+
+	// after a call returns, the return address register points into the current function itself
+	ra := state.Registers[1]
+	hasRA := validRet(ra) && (len(meta.Symbols) == 0 || meta.LookupSymbol(ra-1) != meta.LookupSymbol(pc))
+	if hasRA {
+		stack = append(stack, ra)
+	}
+
+	sp, fp := state.Registers[2], state.Registers[8]
+	for first := true; len(stack) < maxGuestStackDepth; first = false {
+		// the stack grows down, frames are above the stack pointer and 16 byte aligned
+		if fp < sp+16 || fp&15 != 0 {
+			break
+		}
+		var frame [16]byte
+		state.Memory.GetUnaligned(fp-16, frame[:])
+		prevFP, ret := binary.LittleEndian.Uint64(frame[:8]), binary.LittleEndian.Uint64(frame[8:])
+		if !validRet(ret) {
+			break
+		}
+		// a function that did not make a call yet still has its return address in ra, and saved it in its frame.
+		// Further up, the same return address repeats with every level of a recursion.
+		if !first || !hasRA || ret != ra {
+			stack = append(stack, ret)
+		}
+		if prevFP <= fp {
+			break
+		}
+		sp, fp = fp, prevFP
+	}
+	return stack
+}
+
+type guestSample struct {
+	stack []uint64
+	count int64
+}
+
+// GuestProfiler samples the call stack of the program in the VM every rate steps,
+// to profile which guest functions consume the steps. The profile is in the pprof format.
+type GuestProfiler struct {
+	state *fast.VMState
+	meta  *Metadata
+	rate  uint64
+	// binary is the path of the ELF, for the mapping of the profile
+	binary string
+	// samples in the order of their first occurrence, and by stack, with the addresses of the stack as key
+	samples []*guestSample
+	byStack map[string]*guestSample
+}
+
+func NewGuestProfiler(state *fast.VMState, meta *Metadata, rate uint64, binary string) *GuestProfiler {
+	return &GuestProfiler{state: state, meta: meta, rate: rate, binary: binary, byStack: make(map[string]*guestSample)}
+}
+
+// Step wraps stepFn to sample the stack before every rate-th step
+func (gp *GuestProfiler) Step(stepFn StepFn) StepFn {
+	return func(proof bool) (*fast.StepWitness, error) {
+		if gp.state.Step%gp.rate == 0 {
+			gp.Sample()
+		}
+		return stepFn(proof)
+	}
+}
+
+// Sample adds the current stack to the profile
+func (gp *GuestProfiler) Sample() {
+	stack := guestStack(gp.state, gp.meta)
+	key := make([]byte, 8*len(stack))
+	for i, addr := range stack {
+		binary.LittleEndian.PutUint64(key[8*i:], addr)
+	}
+	s, ok := gp.byStack[string(key)]
+	if !ok {
+		s = &guestSample{stack: stack}
+		gp.byStack[string(key)] = s
+		gp.samples = append(gp.samples, s)
+	}
+	s.count++
+}
+
+// Profile builds the profile of the samples so far, with the functions of the metadata symbols.
+// Every sample counts for rate steps.
+func (gp *GuestProfiler) Profile() *profile.Profile {
+	mapping := &profile.Mapping{ID: 1, Limit: ^uint64(0), File: gp.binary, HasFunctions: true}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "steps", Unit: "count"},
+		},
+		DefaultSampleType: "steps",
+		PeriodType:        &profile.ValueType{Type: "steps", Unit: "count"},
+		Period:            int64(gp.rate),
+		Mapping:           []*profile.Mapping{mapping},
+	}
+
+	type locationKey struct {
+		addr   uint64
+		caller bool
+	}
+	locations := make(map[locationKey]*profile.Location)
+	functions := make(map[string]*profile.Function)
+	location := func(addr uint64, caller bool) *profile.Location {
+		key := locationKey{addr, caller}
+		if loc, ok := locations[key]; ok {
+			return loc
+		}
+		// a return address may be just past the end of the calling function
+		symAddr := addr
+		if caller {
+			symAddr--
+		}
+		name := gp.meta.LookupSymbol(symAddr)
+		fn, ok := functions[name]
+		if !ok {
+			fn = &profile.Function{ID: uint64(len(p.Function) + 1), Name: name, SystemName: name}
+			functions[name] = fn
+			p.Function = append(p.Function, fn)
+		}
+		loc := &profile.Location{
+			ID:      uint64(len(p.Location) + 1),
+			Mapping: mapping,
+			Address: addr,
+			Line:    []profile.Line{{Function: fn}},
+		}
+		locations[key] = loc
+		p.Location = append(p.Location, loc)
+		return loc
+	}
+
+	for _, s := range gp.samples {
+		sample := &profile.Sample{Value: []int64{s.count, s.count * int64(gp.rate)}}
+		for i, addr := range s.stack {
+			sample.Location = append(sample.Location, location(addr, i > 0))
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	return p
+}
+
+// Write writes the gzipped profile.proto of the samples so far, for go tool pprof
+func (gp *GuestProfiler) Write(w io.Writer) error {
+	return gp.Profile().Write(w)
+}
+
+// writeGuestProfile writes the profile to a file at path
+func writeGuestProfile(path string, profiler *GuestProfiler) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+	if err != nil {
+		return err
+	}
+	if err := profiler.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
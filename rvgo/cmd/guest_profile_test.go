@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// framePointerProgram is main calling f calling the leaf g, with frame pointers like gcc -fno-omit-frame-pointer
+func framePointerProgram(t *testing.T) (*fast.VMState, *Metadata) {
+	a := riscv.NewAssembler(0x1000)
+	a.Label("main")
+	a.Call("f")
+	a.Syscall(riscv.SysExitGroup, 0)
+	a.Label("f")
+	a.Addi(riscv.RegSP, riscv.RegSP, -16)
+	a.Sd(riscv.RegRA, riscv.RegSP, 8)
+	a.Sd(riscv.RegS0, riscv.RegSP, 0)
+	a.Addi(riscv.RegS0, riscv.RegSP, 16)
+	a.Call("g")
+	a.Ld(riscv.RegRA, riscv.RegSP, 8)
+	a.Ld(riscv.RegS0, riscv.RegSP, 0)
+	a.Addi(riscv.RegSP, riscv.RegSP, 16)
+	a.Ret()
+	a.Label("g")
+	a.Li(riscv.RegT0, 10)
+	a.Label("loop")
+	a.Addi(riscv.RegT0, riscv.RegT0, -1)
+	a.Bnez(riscv.RegT0, "loop")
+	a.Ret()
+	a.Label("end")
+
+	meta := &Metadata{}
+	names := []string{"main", "f", "g", "end"}
+	for i, name := range names[:3] {
+		start, _ := a.Addr(name)
+		end, _ := a.Addr(names[i+1])
+		meta.Symbols = append(meta.Symbols, Symbol{Name: name, Start: start, Size: end - start})
+	}
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), Registers: [32]uint64{2: 0x8000}, MemoryRegions: fast.UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+	return state, meta
+}
+
+func TestGuestProfiler(t *testing.T) {
+	state, meta := framePointerProgram(t)
+	us := fast.NewInstrumentedState(state, nil, nil, nil)
+	gp := NewGuestProfiler(state, meta, 1, "program.elf")
+	stepFn := gp.Step(us.Step)
+	for !state.Exited {
+		_, err := stepFn(false)
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, gp.Write(&buf))
+	p, err := profile.Parse(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "steps", p.DefaultSampleType)
+
+	// steps by folded stack, root first
+	steps := make(map[string]int64)
+	for _, s := range p.Sample {
+		var frames []string
+		for _, loc := range s.Location {
+			frames = append([]string{loc.Line[0].Function.Name}, frames...)
+		}
+		steps[strings.Join(frames, ";")] += s.Value[1]
+	}
+	require.Equal(t, map[string]int64{
+		"main":     4, // the call, and the exit syscall
+		"main;f":   9, // the prologue and epilogue
+		"main;f;g": 22,
+	}, steps)
+	require.Equal(t, uint64(4+9+22), state.Step)
+}
+
+func TestGuestStackRecursion(t *testing.T) {
+	// main calls r, r calls itself at retR, and calls the leaf g at retG
+	meta := &Metadata{Symbols: []Symbol{
+		{Name: "main", Start: 0x1000, Size: 0x100},
+		{Name: "r", Start: 0x1100, Size: 0x100},
+		{Name: "g", Start: 0x1200, Size: 0x100},
+	}}
+	const retMain, retR, retG = 0x1010, 0x1150, 0x1180
+
+	cases := []struct {
+		name     string
+		pc, ra   uint64
+		rets     []uint64 // the return addresses saved in the frames, innermost first
+		expected []uint64
+	}{
+		{name: "leaf without frame", pc: 0x1210, ra: retG, rets: []uint64{retR, retR, retMain},
+			expected: []uint64{0x1210, retG, retR, retR, retMain}},
+		{name: "leaf with frame", pc: 0x1210, ra: retG, rets: []uint64{retG, retR, retR, retMain},
+			expected: []uint64{0x1210, retG, retR, retR, retMain}},
+		// the return address register points into r itself, and is not a caller
+		{name: "before the call", pc: 0x1110, ra: retR, rets: []uint64{retR, retR, retMain},
+			expected: []uint64{0x1110, retR, retR, retMain}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			const sp = 0x8000
+			state := &fast.VMState{PC: c.pc, Memory: fast.NewMemory(), Registers: [32]uint64{1: c.ra, 2: sp, 8: sp + 0x20},
+				MemoryRegions: fast.UnprotectedRegions()}
+			for i, ret := range c.rets {
+				fp := uint64(sp + 0x20*(i+1))
+				prevFP := fp + 0x20
+				if i == len(c.rets)-1 {
+					prevFP = 0
+				}
+				state.Memory.SetUnaligned(fp-16, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, prevFP), ret))
+			}
+			require.Equal(t, c.expected, guestStack(state, meta))
+		})
+	}
+}
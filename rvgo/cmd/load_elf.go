@@ -13,6 +13,24 @@ import (
 	"github.com/ethereum-optimism/asterisc/rvgo/fast"
 )
 
+var LoadELFClockEpochFlag = &cli.Uint64Flag{
+	Name:  "clock-epoch",
+	Usage: "Time of CLOCK_REALTIME at the start of the program, in nanoseconds since the Unix epoch",
+	Value: 0,
+}
+
+var LoadELFRandomSeedFlag = &cli.Uint64Flag{
+	Name:  "random-seed",
+	Usage: "Seed of the PRNG that getrandom and AT_RANDOM draw from",
+	Value: 0,
+}
+
+var LoadELFMetaLinesFlag = &cli.BoolFlag{
+	Name:  "meta-lines",
+	Usage: "Include the line table of the program in the metadata, for coverage reports and source lines in logs",
+	Value: false,
+}
+
 func LoadELF(ctx *cli.Context) error {
 	elfPath := ctx.Path(cannon.LoadELFPathFlag.Name)
 	elfProgram, err := elf.Open(elfPath)
@@ -26,11 +44,13 @@ func LoadELF(ctx *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to load ELF data into VM state: %w", err)
 	}
+	state.ClockEpoch = ctx.Uint64(LoadELFClockEpochFlag.Name)
+	state.RandomState = ctx.Uint64(LoadELFRandomSeedFlag.Name)
 	err = fast.PatchVM(elfProgram, state)
 	if err != nil {
 		return fmt.Errorf("failed to patch VM")
 	}
-	meta, err := MakeMetadata(elfProgram)
+	meta, err := MakeMetadata(elfProgram, ctx.Bool(LoadELFMetaLinesFlag.Name))
 	if err != nil {
 		return fmt.Errorf("failed to compute program metadata: %w", err)
 	}
@@ -53,5 +73,8 @@ var LoadELFCommand = &cli.Command{
 		cannon.LoadELFPathFlag,
 		cannon.LoadELFOutFlag,
 		cannon.LoadELFMetaFlag,
+		LoadELFClockEpochFlag,
+		LoadELFRandomSeedFlag,
+		LoadELFMetaLinesFlag,
 	},
 }
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// stackSize is the size of the memory below the initial stack pointer that counts as the stack of the main thread
+const stackSize = 1 << 30
+
+// reportTop is the number of hottest pages and allocating functions in a memory report
+const reportTop = 20
+
+// protString formats memory permissions like ls does, e.g. r-x
+func protString(prot uint8) string {
+	out := []byte("---")
+	if prot&riscv.ProtRead != 0 {
+		out[0] = 'r'
+	}
+	if prot&riscv.ProtWrite != 0 {
+		out[1] = 'w'
+	}
+	if prot&riscv.ProtExec != 0 {
+		out[2] = 'x'
+	}
+	return string(out)
+}
+
+// memoryArea classifies an address into an area of the memory layout of LoadELF and PatchVM:
+// the ELF segments by their permissions, the Go heap arena hints, the mmap area from fast.HeapStart,
+// and the stack of the main thread below fast.InitialSP.
+// Threads that the program creates have their stacks in the mmap area.
+func memoryArea(state *fast.VMState, addr uint64) string {
+	switch {
+	case addr >= fast.InitialSP-stackSize && addr < fast.InitialSP+fast.PageSize:
+		return "stack"
+	case addr < fast.GoArenaHintStart:
+		return "elf " + protString(state.ProtAt(addr))
+	case addr < fast.HeapStart:
+		return "go-heap"
+	case addr < state.Heap:
+		return "mmap"
+	default:
+		return "other"
+	}
+}
+
+type pageAccess struct {
+	reads  uint64
+	writes uint64
+	// allocatedBy is the PC of the store that allocated the page, if it was allocated during the run
+	allocatedBy uint64
+	allocated   bool
+}
+
+// MemoryReport counts the reads and writes of every page during a run, and the code that allocates pages,
+// to report the memory usage of a program by area.
+type MemoryReport struct {
+	state *fast.VMState
+	meta  *Metadata
+	pages map[uint64]*pageAccess
+}
+
+func NewMemoryReport(state *fast.VMState, meta *Metadata) *MemoryReport {
+	return &MemoryReport{state: state, meta: meta, pages: make(map[uint64]*pageAccess)}
+}
+
+// TraceMemory is a fast.MemoryTracer. Accesses that span two pages count for both.
+func (mr *MemoryReport) TraceMemory(addr uint64, size uint64, access uint8) {
+	if size == 0 || access == riscv.ProtExec {
+		return
+	}
+	first, last := addr>>fast.PageAddrSize, (addr+size-1)>>fast.PageAddrSize
+	for pageIndex := first; pageIndex <= last; pageIndex++ {
+		p, ok := mr.pages[pageIndex]
+		if !ok {
+			p = &pageAccess{}
+			mr.pages[pageIndex] = p
+		}
+		if access == riscv.ProtWrite {
+			p.writes++
+			// the tracer runs before the store, which allocates the page just in time
+			if !p.allocated && !mr.state.Memory.HasPage(pageIndex) {
+				p.allocated, p.allocatedBy = true, mr.state.PC
+			}
+		} else {
+			p.reads++
+		}
+	}
+}
+
+type MemoryAreaUsage struct {
+	Area   string `json:"area"`
+	Pages  uint64 `json:"pages"`
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+type PageUsage struct {
+	Addr   uint64 `json:"addr"`
+	Area   string `json:"area"`
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+type AllocationUsage struct {
+	Symbol string `json:"symbol"`
+	Pages  uint64 `json:"pages"`
+}
+
+// MemoryUsage is the memory usage of a program: the allocated pages by area, the most accessed pages,
+// and the functions that allocated the most pages during the run
+type MemoryUsage struct {
+	Pages       uint64            `json:"pages"`
+	Areas       []MemoryAreaUsage `json:"areas"`
+	Hottest     []PageUsage       `json:"hottest"`
+	AllocatedBy []AllocationUsage `json:"allocatedBy"`
+}
+
+// Usage reports the memory usage so far. Areas include pages that were accessed but never allocated.
+func (mr *MemoryReport) Usage() *MemoryUsage {
+	out := &MemoryUsage{Pages: uint64(mr.state.Memory.PageCount())}
+	areas := make(map[string]*MemoryAreaUsage)
+	area := func(pageIndex uint64) *MemoryAreaUsage {
+		name := memoryArea(mr.state, pageIndex<<fast.PageAddrSize)
+		a, ok := areas[name]
+		if !ok {
+			a = &MemoryAreaUsage{Area: name}
+			areas[name] = a
+		}
+		return a
+	}
+	_ = mr.state.Memory.ForEachPage(func(pageIndex uint64, _ *fast.Page) error {
+		area(pageIndex).Pages++
+		return nil
+	})
+	allocations := make(map[string]uint64)
+	for pageIndex, p := range mr.pages {
+		a := area(pageIndex)
+		a.Reads += p.reads
+		a.Writes += p.writes
+		out.Hottest = append(out.Hottest, PageUsage{
+			Addr: pageIndex << fast.PageAddrSize, Area: a.Area, Reads: p.reads, Writes: p.writes,
+		})
+		if p.allocated {
+			allocations[symbolName(mr.meta, p.allocatedBy)]++
+		}
+	}
+
+	for _, a := range areas {
+		out.Areas = append(out.Areas, *a)
+	}
+	slices.SortFunc(out.Areas, func(a, b MemoryAreaUsage) int {
+		return cmp.Or(cmp.Compare(b.Pages, a.Pages), cmp.Compare(a.Area, b.Area))
+	})
+	slices.SortFunc(out.Hottest, func(a, b PageUsage) int {
+		return cmp.Or(cmp.Compare(b.Reads+b.Writes, a.Reads+a.Writes), cmp.Compare(a.Addr, b.Addr))
+	})
+	out.Hottest = out.Hottest[:min(len(out.Hottest), reportTop)]
+	for symbol, pages := range allocations {
+		out.AllocatedBy = append(out.AllocatedBy, AllocationUsage{Symbol: symbol, Pages: pages})
+	}
+	slices.SortFunc(out.AllocatedBy, func(a, b AllocationUsage) int {
+		return cmp.Or(cmp.Compare(b.Pages, a.Pages), cmp.Compare(a.Symbol, b.Symbol))
+	})
+	out.AllocatedBy = out.AllocatedBy[:min(len(out.AllocatedBy), reportTop)]
+	return out
+}
+
+// Write writes the memory usage, as a table in the text format, or as JSON in the json format
+func (u *MemoryUsage) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(u)
+	case "text":
+	default:
+		return fmt.Errorf("invalid memory report format %q", format)
+	}
+	// a table per section, so the columns of one do not widen those of the others
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "area\tpages\tsize\treads\twrites\n")
+	for _, a := range u.Areas {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\n", a.Area, a.Pages, fast.FormatSize(a.Pages*fast.PageSize), a.Reads, a.Writes)
+	}
+	_, _ = fmt.Fprintf(tw, "total\t%d\t%s\n", u.Pages, fast.FormatSize(u.Pages*fast.PageSize))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(tw, "\nhottest page\tarea\treads\twrites\n")
+	for _, p := range u.Hottest {
+		_, _ = fmt.Fprintf(tw, "%016x\t%s\t%d\t%d\n", p.Addr, p.Area, p.Reads, p.Writes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(tw, "\nallocated by\tpages\tsize\n")
+	for _, a := range u.AllocatedBy {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\n", a.Symbol, a.Pages, fast.FormatSize(a.Pages*fast.PageSize))
+	}
+	return tw.Flush()
+}
+
+// writeMemoryReport writes the memory usage so far to a file at path
+func writeMemoryReport(path string, format string, report *MemoryReport) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+	if err != nil {
+		return err
+	}
+	if err := report.Usage().Write(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
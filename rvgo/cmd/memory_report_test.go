@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestMemoryReport(t *testing.T) {
+	a := riscv.NewAssembler(0x1000)
+	a.Li(riscv.RegA0, fast.HeapStart)
+	a.Sd(riscv.RegA1, riscv.RegA0, 0)
+	a.Sd(riscv.RegA1, riscv.RegA0, 8)
+	a.Li(riscv.RegSP, fast.InitialSP-16)
+	a.Sd(riscv.RegA1, riscv.RegSP, 0)
+	a.Ld(riscv.RegA2, riscv.RegSP, 0)
+	a.Syscall(riscv.SysExitGroup, 0)
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), Heap: fast.HeapStart + 1<<20, MemoryRegions: fast.UnprotectedRegions()}
+	state.MemoryRegions[0] = fast.MemoryRegion{Start: 0, End: 0x2000, Prot: riscv.ProtRead | riscv.ProtExec}
+	require.NoError(t, a.WriteMemory(state.Memory))
+	meta := &Metadata{Symbols: []Symbol{{Name: "main", Start: 0x1000, Size: 0x100}}}
+
+	us := fast.NewInstrumentedState(state, nil, nil, nil)
+	report := NewMemoryReport(state, meta)
+	us.SetMemoryTracer(report.TraceMemory)
+	for !state.Exited {
+		_, err := us.Step(false)
+		require.NoError(t, err)
+	}
+
+	usage := report.Usage()
+	require.Equal(t, &MemoryUsage{
+		Pages: 3,
+		Areas: []MemoryAreaUsage{
+			{Area: "elf r-x", Pages: 1},
+			{Area: "mmap", Pages: 1, Writes: 2},
+			{Area: "stack", Pages: 1, Reads: 1, Writes: 1},
+		},
+		Hottest: []PageUsage{
+			{Addr: fast.HeapStart, Area: "mmap", Writes: 2},
+			{Addr: fast.InitialSP - fast.PageSize, Area: "stack", Reads: 1, Writes: 1},
+		},
+		AllocatedBy: []AllocationUsage{{Symbol: "main", Pages: 2}},
+	}, usage)
+
+	var buf bytes.Buffer
+	require.NoError(t, usage.Write(&buf, "text"))
+	require.Equal(t, `area     pages  size     reads  writes
+elf r-x  1      4.0 KiB  0      0
+mmap     1      4.0 KiB  0      2
+stack    1      4.0 KiB  1      1
+total    3      12.0 KiB
+
+hottest page      area   reads  writes
+00007f0000000000  mmap   0      2
+0ffffffffffff000  stack  1      1
+
+allocated by  pages  size
+main          2      8.0 KiB
+`, buf.String())
+	require.ErrorContains(t, usage.Write(&buf, "xml"), "invalid memory report format")
+}
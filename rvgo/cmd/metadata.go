@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"cmp"
+	"debug/dwarf"
 	"debug/elf"
+	"debug/gosym"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-service/jsonutil"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 type Symbol struct {
@@ -12,13 +21,37 @@ type Symbol struct {
 	Size  uint64 `json:"size"`
 }
 
+// Line maps the instructions from Start up to the Start of the next line to a line of a source file.
+// Line 0 marks instructions without a source line, e.g. at the end of a sequence of instructions.
+type Line struct {
+	Start uint64 `json:"start"`
+	File  uint32 `json:"file"`
+	Line  uint32 `json:"line"`
+}
+
 type Metadata struct {
 	Symbols []Symbol `json:"symbols"`
+	// Files are the source files that Lines refer to
+	Files []string `json:"files,omitempty"`
+	// Lines is the line table of the program, sorted by Start
+	Lines []Line `json:"lines,omitempty"`
 }
 
-func MakeMetadata(elfProgram *elf.File) (*Metadata, error) {
+// MakeMetadata loads the symbols of a program, and its line table if withLines is set.
+// The line table comes from the DWARF data, or from the Go pclntab for stripped binaries,
+// which also provides the symbols of functions if there is no symbol table.
+// The line table is large, about ten times the size of the symbols of a Go program.
+func MakeMetadata(elfProgram *elf.File, withLines bool) (*Metadata, error) {
 	syms, err := elfProgram.Symbols()
-	if err != nil {
+	if errors.Is(err, elf.ErrNoSymbols) {
+		funcs, tabErr := loadGoFuncs(elfProgram)
+		if tabErr != nil {
+			return nil, fmt.Errorf("failed to load symbols table: %w", tabErr)
+		}
+		for _, fn := range funcs {
+			syms = append(syms, elf.Symbol{Name: fn.Name, Value: fn.Entry, Size: fn.End - fn.Entry})
+		}
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to load symbols table: %w", err)
 	}
 	// Make sure the table is sorted, Go outputs mostly sorted data, except some internal functions
@@ -29,9 +62,158 @@ func MakeMetadata(elfProgram *elf.File) (*Metadata, error) {
 	for i, s := range syms {
 		out.Symbols[i] = Symbol{Name: s.Name, Start: s.Value, Size: s.Size}
 	}
+	if !withLines {
+		return out, nil
+	}
+	// the line table is optional, programs without debug info or pclntab have none
+	if err := out.loadDWARFLines(elfProgram); err != nil {
+		out.Files, out.Lines = nil, nil
+		if err := out.loadGoLines(elfProgram); err != nil {
+			out.Files, out.Lines = nil, nil
+		}
+	}
 	return out, nil
 }
 
+// addLine adds a line of a file to the line table
+func (m *Metadata) addLine(files map[string]uint32, start uint64, file string, line int) {
+	if line <= 0 {
+		m.Lines = append(m.Lines, Line{Start: start})
+		return
+	}
+	index, ok := files[file]
+	if !ok {
+		index = uint32(len(m.Files))
+		files[file] = index
+		m.Files = append(m.Files, file)
+	}
+	m.Lines = append(m.Lines, Line{Start: start, File: index, Line: uint32(line)})
+}
+
+// sortLines sorts the line table, and merges the lines that continue the line before them.
+// Of the lines that start at the same address, the last one with a source line applies.
+func (m *Metadata) sortLines() {
+	slices.SortStableFunc(m.Lines, func(a, b Line) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(min(a.Line, 1), min(b.Line, 1)))
+	})
+	out := m.Lines[:0]
+	for _, l := range m.Lines {
+		if len(out) > 0 && out[len(out)-1].Start == l.Start {
+			out = out[:len(out)-1]
+		}
+		if len(out) > 0 && out[len(out)-1].File == l.File && out[len(out)-1].Line == l.Line {
+			continue
+		}
+		out = append(out, l)
+	}
+	m.Lines = out
+}
+
+// loadDWARFLines loads the line table from the DWARF data of the program
+func (m *Metadata) loadDWARFLines(elfProgram *elf.File) error {
+	data, err := elfProgram.DWARF()
+	if err != nil {
+		return err
+	}
+	files := make(map[string]uint32)
+	r := data.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := data.LineReader(entry)
+		if err != nil {
+			return err
+		}
+		r.SkipChildren()
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			if err := lr.Next(&le); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			if le.EndSequence || le.File == nil {
+				m.addLine(files, le.Address, "", 0)
+			} else {
+				m.addLine(files, le.Address, le.File.Name, le.Line)
+			}
+		}
+	}
+	if len(m.Lines) == 0 {
+		return errors.New("no DWARF line table")
+	}
+	m.sortLines()
+	return nil
+}
+
+// loadGoFuncs loads the functions of the Go pclntab of the program
+func loadGoFuncs(elfProgram *elf.File) ([]gosym.Func, error) {
+	tab, err := loadPclntab(elfProgram)
+	if err != nil {
+		return nil, err
+	}
+	return tab.Funcs, nil
+}
+
+// loadGoLines loads the line table from the Go pclntab of the program
+func (m *Metadata) loadGoLines(elfProgram *elf.File) error {
+	tab, err := loadPclntab(elfProgram)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]uint32)
+	for i := range tab.Funcs {
+		m.addFuncLines(files, tab, &tab.Funcs[i])
+	}
+	m.sortLines()
+	return nil
+}
+
+// addFuncLines adds the lines of the instructions of a function in the Go pclntab to the line table
+func (m *Metadata) addFuncLines(files map[string]uint32, tab *pclntab, fn *gosym.Func) {
+	tab.lines(fn, func(start uint64, file string, line int) {
+		m.addLine(files, start, file, line)
+	})
+	m.addLine(files, fn.End, "", 0)
+}
+
+// LookupLine returns the file and line of the instruction at addr, or false if it has no source line
+func (m *Metadata) LookupLine(addr uint64) (string, uint32, bool) {
+	i := sort.Search(len(m.Lines), func(i int) bool {
+		return m.Lines[i].Start > addr
+	})
+	if i == 0 || m.Lines[i-1].Line == 0 {
+		return "", 0, false
+	}
+	l := &m.Lines[i-1]
+	return m.Files[l.File], l.Line, true
+}
+
+// loadMetadata loads the metadata file, or returns empty metadata if there is no file
+func loadMetadata(l log.Logger, metaPath string) (*Metadata, error) {
+	if metaPath == "" {
+		l.Info("no metadata file specified, defaulting to empty metadata")
+		return &Metadata{Symbols: nil}, nil // provide empty metadata by default
+	}
+	m, err := jsonutil.LoadJSON[Metadata](metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	return m, nil
+}
+
 func (m *Metadata) LookupSymbol(addr uint64) string {
 	if len(m.Symbols) == 0 {
 		return "!unknown"
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"debug/elf"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataLines(t *testing.T) {
+	// the stripped program has no symbols and no DWARF data, only the Go pclntab
+	elfProgram, dir := buildProgram(t, symbolizerProgram, "-s -w")
+	meta, err := MakeMetadata(elfProgram, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, meta.Lines)
+	for i := 1; i < len(meta.Lines); i++ {
+		require.Less(t, meta.Lines[i-1].Start, meta.Lines[i].Start)
+	}
+	tab, err := loadPclntab(elfProgram)
+	require.NoError(t, err)
+	entry := tab.LookupFunc("main.caller").Entry
+	file, line, ok := meta.LookupLine(entry)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "main.go"), file)
+	require.Equal(t, uint32(8), line)
+	require.Equal(t, "main.caller", meta.LookupSymbol(entry))
+	_, _, ok = meta.LookupLine(0)
+	require.False(t, ok)
+
+	// the line table is opt-in
+	symMeta, err := MakeMetadata(elfProgram, false)
+	require.NoError(t, err)
+	require.Equal(t, meta.Symbols, symMeta.Symbols)
+	require.Empty(t, symMeta.Lines)
+	require.Empty(t, symMeta.Files)
+
+	// the lines of the pclntab are those that debug/gosym finds, also where lines of functions are merged
+	for i := range tab.Funcs {
+		fn := &tab.Funcs[i]
+		for pc := fn.Entry; pc < fn.End; pc++ {
+			wantFile, wantLine, _ := tab.PCToLine(pc)
+			file, line, ok := meta.LookupLine(pc)
+			require.Equal(t, wantLine > 0, ok, "%s+%d", fn.Name, pc-fn.Entry)
+			if ok {
+				require.Equal(t, wantFile, file, "%s+%d", fn.Name, pc-fn.Entry)
+				require.Equal(t, uint32(wantLine), line, "%s+%d", fn.Name, pc-fn.Entry)
+			}
+		}
+	}
+
+	// with DWARF data, the lines come from there
+	elfProgram, dir = buildProgram(t, symbolizerProgram, "")
+	meta, err = MakeMetadata(elfProgram, true)
+	require.NoError(t, err)
+	entry, ok = elfSymbol(elfProgram, "main.caller")
+	require.True(t, ok)
+	file, line, ok = meta.LookupLine(entry)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "main.go"), file)
+	require.Equal(t, uint32(8), line)
+}
+
+func TestLoadPclntabTextStart(t *testing.T) {
+	elfProgram, _ := buildProgram(t, symbolizerProgram, "")
+	tab, err := loadPclntab(elfProgram)
+	require.NoError(t, err)
+	textStart, ok := elfSymbol(elfProgram, "runtime.text")
+	require.True(t, ok)
+	require.Equal(t, textStart, tab.textStart)
+
+	// without symbols, the functions are relative to the start of .text
+	stripped, _ := buildProgram(t, symbolizerProgram, "-s")
+	tab, err = loadPclntab(stripped)
+	require.NoError(t, err)
+	require.Equal(t, stripped.Section(".text").Addr, tab.textStart)
+	require.Equal(t, "main.main", tab.PCToFunc(tab.LookupFunc("main.main").Entry).Name)
+
+	// without runtime.text or .text, the functions can not be located
+	stripped.Sections = slices.DeleteFunc(slices.Clone(stripped.Sections), func(s *elf.Section) bool {
+		return s.Name == ".text"
+	})
+	_, err = loadPclntab(stripped)
+	require.ErrorContains(t, err, "no runtime.text symbol or .text section")
+
+	// an external linker puts C code before runtime.text, which can not be located without symbols
+	if _, err := exec.LookPath("gcc"); err == nil {
+		external, _ := buildProgram(t, symbolizerProgram, "-s -linkmode=external")
+		_, err = loadPclntab(external)
+		require.ErrorContains(t, err, "external linker")
+	}
+}
+
+func TestSortLines(t *testing.T) {
+	m := &Metadata{Lines: []Line{
+		{Start: 0x10, Line: 2},
+		{Start: 0x20}, // end of a sequence, where the next one starts
+		{Start: 0x00, Line: 1},
+		{Start: 0x08, Line: 1},
+		{Start: 0x20, Line: 3},
+		{Start: 0x30},
+	}}
+	m.sortLines()
+	require.Equal(t, []Line{{Start: 0x00, Line: 1}, {Start: 0x10, Line: 2}, {Start: 0x20, Line: 3}, {Start: 0x30}}, m.Lines)
+}
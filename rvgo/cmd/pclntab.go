@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// magic numbers of the pclntab formats of Go 1.18 and 1.20, which share the layout that pclntab reads
+const (
+	go118PclntabMagic = 0xfffffff0
+	go120PclntabMagic = 0xfffffff1
+)
+
+// pclntab is the function table of a Go program, which maps PCs to functions, files and lines.
+// The runtime needs it for stack traces, so stripped binaries keep it too.
+// debug/gosym decodes the functions, files and lines. The inline trees, which debug/gosym does not decode,
+// are read from the pcdata and funcdata of the functions, see the layout in runtime/symtab.go, pcHeader and _func.
+type pclntab struct {
+	*gosym.Table
+
+	order     binary.ByteOrder
+	magic     uint32
+	quantum   uint64
+	textStart uint64
+	nfunc     int
+
+	funcnametab []byte
+	pctab       []byte
+	functab     []byte
+}
+
+// loadPclntab loads the pclntab of a Go program
+func loadPclntab(elfProgram *elf.File) (*pclntab, error) {
+	section := elfProgram.Section(".gopclntab")
+	if section == nil {
+		return nil, errors.New("no Go pclntab")
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Go pclntab: %w", err)
+	}
+	tab, err := parsePclntab(data, elfProgram.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	// the functions are relative to runtime.text, which is the start of the text section with the Go linker
+	textStart, hasSymbol := elfSymbol(elfProgram, "runtime.text")
+	if !hasSymbol {
+		text := elfProgram.Section(".text")
+		if text == nil {
+			return nil, errors.New("no runtime.text symbol or .text section to locate the functions of the Go pclntab")
+		}
+		textStart = text.Addr
+	}
+	tab.textStart = textStart
+	tab.Table, err = gosym.NewTable(nil, gosym.NewLineTable(data, tab.textStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Go pclntab: %w", err)
+	}
+	// an external linker puts other code before runtime.text, and starts the program there instead of the Go entry point
+	if fn := tab.PCToFunc(elfProgram.Entry); !hasSymbol && (fn == nil || !strings.HasPrefix(fn.Name, "_rt0_")) {
+		return nil, errors.New("no runtime.text symbol to locate the functions of the Go pclntab, in a program of an external linker")
+	}
+	return tab, nil
+}
+
+// elfSymbol returns the address of a symbol, or false if the program has no such symbol
+func elfSymbol(elfProgram *elf.File, name string) (uint64, bool) {
+	syms, err := elfProgram.Symbols()
+	if err != nil {
+		return 0, false
+	}
+	for _, sym := range syms {
+		if sym.Name == name {
+			return sym.Value, true
+		}
+	}
+	return 0, false
+}
+
+// parsePclntab reads the header of the pclntab, for the tables that the inline trees need
+func parsePclntab(data []byte, order binary.ByteOrder) (*pclntab, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated Go pclntab")
+	}
+	magic := order.Uint32(data)
+	if magic != go118PclntabMagic && magic != go120PclntabMagic {
+		return nil, fmt.Errorf("unsupported Go pclntab magic 0x%08x, expected a program built with Go 1.18 or later", magic)
+	}
+	tab := &pclntab{order: order, magic: magic, quantum: uint64(data[6])}
+	ptrSize := int(data[7])
+	if ptrSize != 4 && ptrSize != 8 {
+		return nil, fmt.Errorf("invalid Go pclntab pointer size %d", ptrSize)
+	}
+	word := func(i int) uint64 {
+		if ptrSize == 4 {
+			return uint64(order.Uint32(data[8+i*ptrSize:]))
+		}
+		return order.Uint64(data[8+i*ptrSize:])
+	}
+	if len(data) < 8+8*ptrSize {
+		return nil, errors.New("truncated Go pclntab")
+	}
+	nfunc := word(0)
+	var tables [3][]byte
+	// the offsets of funcnametab, pctab and functab, after nfunc, nfiles, textStart, and the offsets of cutab and filetab
+	for i, field := range []int{3, 6, 7} {
+		offset := word(field)
+		if offset > uint64(len(data)) {
+			return nil, errors.New("truncated Go pclntab")
+		}
+		tables[i] = data[offset:]
+	}
+	tab.funcnametab, tab.pctab, tab.functab = tables[0], tables[1], tables[2]
+	if uint64(len(tab.functab)) < (2*nfunc+1)*4 {
+		return nil, errors.New("truncated Go pclntab")
+	}
+	tab.nfunc = int(nfunc)
+	return tab, nil
+}
+
+// string reads a NUL terminated string at the offset of a table
+func (t *pclntab) string(table []byte, offset uint32) string {
+	if uint64(offset) >= uint64(len(table)) {
+		return ""
+	}
+	s := table[offset:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// offsets of the fields of the _func struct
+const (
+	funcNpcdata   = 28
+	funcNfuncdata = 43
+	funcPcdata    = 44
+)
+
+// funcData returns the _func struct of a function from functab, followed by the offsets of its pcdata tables and funcdata,
+// or nil if the function table has no such function
+func (t *pclntab) funcData(fn *gosym.Func) []byte {
+	entryOff := fn.Entry - t.textStart
+	i := sort.Search(t.nfunc, func(i int) bool {
+		return uint64(t.order.Uint32(t.functab[i*8:])) >= entryOff
+	})
+	if i == t.nfunc || uint64(t.order.Uint32(t.functab[i*8:])) != entryOff {
+		return nil
+	}
+	funcOff := uint64(t.order.Uint32(t.functab[i*8+4:]))
+	if funcOff+funcPcdata > uint64(len(t.functab)) {
+		return nil
+	}
+	data := t.functab[funcOff:]
+	if funcPcdata+4*(uint64(t.order.Uint32(data[funcNpcdata:]))+uint64(data[funcNfuncdata])) > uint64(len(data)) {
+		return nil
+	}
+	return data
+}
+
+// pcdata returns the offset of a pcdata table of a function in pctab, or 0 if it has none
+func (t *pclntab) pcdata(data []byte, table uint32) uint32 {
+	if table >= t.order.Uint32(data[funcNpcdata:]) {
+		return 0
+	}
+	return t.order.Uint32(data[funcPcdata+4*table:])
+}
+
+// funcdata returns the offset of a funcdata symbol of a function from go:func.*, or false if it has none
+func (t *pclntab) funcdata(data []byte, index uint8) (uint32, bool) {
+	if index >= data[funcNfuncdata] {
+		return 0, false
+	}
+	off := t.order.Uint32(data[funcPcdata+4*t.order.Uint32(data[funcNpcdata:])+4*uint32(index):])
+	return off, off != ^uint32(0)
+}
+
+// pcvalueAt returns the value at pc of the pcvalue table at an offset of pctab for a function,
+// or -1 if the table does not cover pc. The table holds pairs of a zig-zag value delta and a PC delta,
+// in units of the PC quantum, until a zero value delta.
+func (t *pclntab) pcvalueAt(fn *gosym.Func, offset uint32, pc uint64) int32 {
+	if offset == 0 || uint64(offset) >= uint64(len(t.pctab)) {
+		return -1
+	}
+	p := t.pctab[offset:]
+	start, value := fn.Entry, int32(-1)
+	for first := true; ; first = false {
+		uvdelta, n := binary.Uvarint(p)
+		if n <= 0 || (uvdelta == 0 && !first) {
+			return -1
+		}
+		p = p[n:]
+		pcdelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return -1
+		}
+		p = p[n:]
+		if uvdelta&1 != 0 {
+			value += int32(^(uvdelta >> 1))
+		} else {
+			value += int32(uvdelta >> 1)
+		}
+		end := start + pcdelta*t.quantum
+		if pc >= start && pc < end {
+			return value
+		}
+		start = end
+	}
+}
+
+// lines calls yield with the file and line of the instructions of a function from start,
+// up to the start of the next line. The padding after the tables has line 0.
+func (t *pclntab) lines(fn *gosym.Func, yield func(start uint64, file string, line int)) {
+	lastFile, lastLine := "", -1
+	for pc := fn.Entry; pc < fn.End; pc += t.quantum {
+		file, line := t.fileLine(pc)
+		if file != lastFile || line != lastLine {
+			yield(pc, file, line)
+			lastFile, lastLine = file, line
+		}
+	}
+}
+
+// fileLine returns the file and line of the instruction at pc, with line 0 if it has none
+func (t *pclntab) fileLine(pc uint64) (string, int) {
+	file, line, fn := t.PCToLine(pc)
+	if fn == nil || line <= 0 {
+		return "", 0
+	}
+	return file, line
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	cannon "github.com/ethereum-optimism/optimism/cannon/cmd"
+	"github.com/ethereum-optimism/optimism/op-service/ioutil"
+	"github.com/ethereum-optimism/optimism/op-service/jsonutil"
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+)
+
+const replHelp = `commands:
+  step [n]                 run n steps (default 1)
+  until pc <addr>          run until the PC is addr
+  until sym <name>         run until the PC is in the symbol
+  until syscall [name|num] run until the next ECALL, of the given syscall if any
+  regs                     print the integer registers
+  fregs                    print the floating point registers
+  insn                     print the instruction at the PC
+  mem <addr> [len]         print len bytes of memory at addr (default 64)
+  info                     print the step, PC, symbol and threads
+  snapshot <path>          write the state to path
+  proof [path]             run the next step with proof generation, and write the proof to path (default: print it)
+  help                     print this help
+  quit                     exit the REPL
+`
+
+// Repl is an interactive step debugger for a VM state
+type Repl struct {
+	state  *fast.VMState
+	stepFn StepFn
+	meta   *Metadata
+	out    io.Writer
+}
+
+func NewRepl(state *fast.VMState, stepFn StepFn, meta *Metadata, out io.Writer) *Repl {
+	return &Repl{state: state, stepFn: stepFn, meta: meta, out: out}
+}
+
+// Exec runs a command line. It returns true once the REPL should quit.
+func (r *Repl) Exec(ctx context.Context, line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "quit", "exit", "q":
+		return true, nil
+	case "help", "h":
+		_, err := io.WriteString(r.out, replHelp)
+		return false, err
+	case "step", "s":
+		n := uint64(1)
+		if len(args) > 0 {
+			v, err := strconv.ParseUint(args[0], 0, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid step count: %w", err)
+			}
+			n = v
+		}
+		return false, r.run(ctx, n, func() bool { return false })
+	case "until", "u":
+		stop, err := r.untilCondition(args)
+		if err != nil {
+			return false, err
+		}
+		return false, r.run(ctx, ^uint64(0), stop)
+	case "regs", "r":
+		r.printRegisters()
+		return false, nil
+	case "fregs":
+		for i, name := range riscv.FloatRegisterNames {
+			fmt.Fprintf(r.out, "%-4s f%-2d %016x\n", name, i, r.state.FPRegisters[i])
+		}
+		fmt.Fprintf(r.out, "fcsr     %016x\n", r.state.FCSR)
+		return false, nil
+	case "insn", "i":
+		r.printLocation()
+		return false, nil
+	case "mem", "x":
+		if len(args) == 0 {
+			return false, errors.New("missing address")
+		}
+		addr, err := strconv.ParseUint(args[0], 0, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid address: %w", err)
+		}
+		size := uint64(64)
+		if len(args) > 1 {
+			if size, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+				return false, fmt.Errorf("invalid length: %w", err)
+			}
+		}
+		r.printMemory(addr, size)
+		return false, nil
+	case "info":
+		r.printInfo()
+		return false, nil
+	case "snapshot":
+		if len(args) != 1 {
+			return false, errors.New("expected a path")
+		}
+		if err := serialize.Write(args[0], r.state, OutFilePerm); err != nil {
+			return false, fmt.Errorf("failed to write state snapshot: %w", err)
+		}
+		fmt.Fprintf(r.out, "wrote snapshot of step %d to %s\n", r.state.Step, args[0])
+		return false, nil
+	case "proof":
+		if r.state.Exited {
+			return false, errors.New("the program exited")
+		}
+		proof, err := ProveStep(&fast.VersionedState{Version: fast.LatestStateVersion, VMState: r.state}, r.stepFn)
+		if err != nil {
+			return false, err
+		}
+		if len(args) > 0 {
+			if err := jsonutil.WriteJSON(proof, ioutil.ToStdOutOrFileOrNoop(args[0], OutFilePerm)); err != nil {
+				return false, fmt.Errorf("failed to write proof data: %w", err)
+			}
+			fmt.Fprintf(r.out, "wrote proof of step %d to %s\n", proof.Step, args[0])
+		} else {
+			data, err := json.MarshalIndent(proof, "", "  ")
+			if err != nil {
+				return false, err
+			}
+			fmt.Fprintf(r.out, "%s\n", data)
+		}
+		r.printLocation()
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, see help", cmd)
+	}
+}
+
+// untilCondition parses the arguments of the until command
+func (r *Repl) untilCondition(args []string) (func() bool, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected pc, sym or syscall")
+	}
+	switch args[0] {
+	case "pc":
+		if len(args) != 2 {
+			return nil, errors.New("expected an address")
+		}
+		addr, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address: %w", err)
+		}
+		return func() bool { return r.state.PC == addr }, nil
+	case "sym":
+		if len(args) != 2 {
+			return nil, errors.New("expected a symbol")
+		}
+		matcher := r.meta.SymbolMatcher(args[1])
+		return func() bool { return matcher(r.state.PC) }, nil
+	case "syscall":
+		num, anySyscall := uint64(0), true
+		if len(args) > 1 {
+			anySyscall = false
+			if v, ok := riscv.SyscallNum(args[1]); ok {
+				num = v
+			} else if v, err := strconv.ParseUint(args[1], 0, 64); err == nil {
+				num = v
+			} else {
+				return nil, fmt.Errorf("unknown syscall %q", args[1])
+			}
+		}
+		return func() bool {
+			// a thread that waits on a futex is past its ECALL
+			return r.state.FutexAddr == 0 && r.state.Instr() == 0x73 && (anySyscall || r.state.Registers[17] == num)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown condition %q", args[0])
+	}
+}
+
+// run runs at least one step, and at most n steps, until stop returns true or the program exits
+func (r *Repl) run(ctx context.Context, n uint64, stop func() bool) error {
+	for i := uint64(0); i < n && !r.state.Exited; i++ {
+		if i%100 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if i > 0 && stop() {
+			break
+		}
+		step := r.state.Step
+		if _, err := r.stepFn(false); err != nil {
+			return fmt.Errorf("failed at step %d (PC: %08x): %w", step, r.state.PC, err)
+		}
+	}
+	r.printLocation()
+	return nil
+}
+
+func (r *Repl) printLocation() {
+	if r.state.Exited {
+		fmt.Fprintf(r.out, "step %d: exited with code %d\n", r.state.Step, r.state.ExitCode)
+		return
+	}
+	instr := r.state.Instr()
+	raw := fmt.Sprintf("%08x", instr)
+	if instr&3 != 3 { // compressed
+		raw = fmt.Sprintf("%04x", instr)
+	}
+	fmt.Fprintf(r.out, "step %d: pc %016x <%s>: %s  %s\n", r.state.Step, r.state.PC,
+		r.meta.LookupSymbol(r.state.PC), raw, riscv.Disassemble(instr, r.state.PC))
+}
+
+func (r *Repl) printRegisters() {
+	fmt.Fprintf(r.out, "pc        %016x\n", r.state.PC)
+	for i, name := range riscv.IntRegisterNames {
+		fmt.Fprintf(r.out, "%-4s x%-2d  %016x\n", name, i, r.state.Registers[i])
+	}
+}
+
+func (r *Repl) printInfo() {
+	s := r.state
+	fmt.Fprintf(r.out, "step %d, pc %016x <%s>, thread %d", s.Step, s.PC, r.meta.LookupSymbol(s.PC), s.ThreadID)
+	if s.FutexAddr != 0 {
+		fmt.Fprintf(r.out, " (waiting on futex %016x)", s.FutexAddr)
+	}
+	fmt.Fprintf(r.out, ", %d suspended threads, heap %016x", len(s.LeftThreads)+len(s.RightThreads), s.Heap)
+	if s.Exited {
+		fmt.Fprintf(r.out, ", exited with code %d", s.ExitCode)
+	}
+	fmt.Fprintln(r.out)
+}
+
+// printMemory prints a hex dump, 16 bytes per line
+func (r *Repl) printMemory(addr uint64, size uint64) {
+	for offset := uint64(0); offset < size; offset += 16 {
+		line := make([]byte, min(16, size-offset))
+		r.state.Memory.GetUnaligned(addr+offset, line)
+		fmt.Fprintf(r.out, "%016x  %s\n", addr+offset, hex.EncodeToString(line))
+	}
+}
+
+func RunRepl(ctx *cli.Context) error {
+	state, err := fast.LoadVMStateFromFile(ctx.Path(cannon.RunInputFlag.Name))
+	if err != nil {
+		return err
+	}
+	l := Logger(os.Stderr, slog.LevelInfo)
+	outLog := &LoggingWriter{Name: "program std-out", Log: l}
+	errLog := &LoggingWriter{Name: "program std-err", Log: l}
+
+	meta, err := loadMetadata(l, ctx.Path(cannon.RunMetaFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	args := preimageServerArgs(ctx)
+	po, err := NewProcessPreimageOracle(args[0], args[1:])
+	if err != nil {
+		return fmt.Errorf("failed to create pre-image oracle process: %w", err)
+	}
+	if err := po.Start(); err != nil {
+		return fmt.Errorf("failed to start pre-image oracle server: %w", err)
+	}
+	defer func() {
+		if err := po.Close(); err != nil {
+			l.Error("failed to close pre-image server", "err", err)
+		}
+	}()
+
+	us := fast.NewInstrumentedState(state, po, outLog, errLog)
+	stepFn := us.Step
+	if po.cmd != nil {
+		stepFn = Guard(po.cmd.ProcessState, stepFn)
+	}
+	repl := NewRepl(state, stepFn, meta, os.Stdout)
+	repl.printLocation()
+
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !in.Scan() {
+			return in.Err()
+		}
+		quit, err := repl.Exec(ctx.Context, in.Text())
+		if err != nil {
+			if ctxErr := ctx.Context.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			fmt.Printf("error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+var ReplCommand = &cli.Command{
+	Name:  "repl",
+	Usage: "Step through a VM state interactively.",
+	Description: "Step through a VM state interactively: run steps, inspect registers, instructions and memory, " +
+		"and write snapshots and proofs. The pre-image server command follows '--', like for run.",
+	Action: RunRepl,
+	Flags: []cli.Flag{
+		cannon.RunInputFlag,
+		cannon.RunMetaFlag,
+	},
+}
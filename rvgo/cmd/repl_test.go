@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestRepl(t *testing.T) {
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), MemoryRegions: fast.UnprotectedRegions()}
+	for i, insn := range []uint32{
+		0x00108093, // addi ra, ra, 1
+		0x00113023, // sd ra, 0(sp)
+		0x05d00893, // li a7, 93 (exit)
+		0x00000073, // ecall
+	} {
+		state.Memory.SetUnaligned(0x1000+uint64(i)*4, binary.LittleEndian.AppendUint32(nil, insn))
+	}
+	state.Registers[2] = 0x2000
+	meta := &Metadata{Symbols: []Symbol{{Name: "main.main", Start: 0x1000, Size: 0x10}}}
+	var out bytes.Buffer
+	repl := NewRepl(state, fast.NewInstrumentedState(state, nil, nil, nil).Step, meta, &out)
+
+	exec := func(line string) string {
+		out.Reset()
+		quit, err := repl.Exec(context.Background(), line)
+		require.NoError(t, err)
+		require.False(t, quit)
+		return out.String()
+	}
+
+	require.Equal(t, "step 1: pc 0000000000001004 <main.main>: 00113023  sd ra, 0(sp)\n",
+		exec("step"))
+	require.Contains(t, exec("regs"), "ra   x1   0000000000000001\n")
+	require.Equal(t, "step 2: pc 0000000000001008 <main.main>: 05d00893  addi a7, zero, 93\n",
+		exec("step"))
+	require.Equal(t, "0000000000002000  0100000000000000\n", exec("mem 0x2000 8"))
+	require.Equal(t, "step 3: pc 000000000000100c <main.main>: 00000073  ecall\n",
+		exec("until syscall exit"))
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	require.Equal(t, "wrote snapshot of step 3 to "+snapshot+"\n", exec("snapshot "+snapshot))
+	loaded, err := fast.LoadVMStateFromFile(snapshot)
+	require.NoError(t, err)
+	require.Equal(t, state.EncodeWitness(), loaded.EncodeWitness())
+
+	proofOut := exec("proof")
+	proofJSON, location, ok := strings.Cut(proofOut, "}\n")
+	require.True(t, ok)
+	var proof Proof
+	require.NoError(t, json.Unmarshal([]byte(proofJSON+"}"), &proof))
+	require.Equal(t, uint64(3), proof.Step)
+	require.Equal(t, loaded.EncodeWitness(), fast.StateWitness(proof.StateData))
+	require.Equal(t, "step 4: exited with code 0\n", location)
+
+	_, err = repl.Exec(context.Background(), "proof")
+	require.ErrorContains(t, err, "exited")
+	_, err = repl.Exec(context.Background(), "until syscall nosuchcall")
+	require.ErrorContains(t, err, "unknown syscall")
+
+	quit, err := repl.Exec(context.Background(), "quit")
+	require.NoError(t, err)
+	require.True(t, quit)
+	require.Equal(t, uint64(riscv.SysExit), state.Registers[17])
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"debug/elf"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -13,6 +15,7 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
 	cannon "github.com/ethereum-optimism/optimism/cannon/cmd"
 	preimage "github.com/ethereum-optimism/optimism/op-preimage"
 	"github.com/ethereum-optimism/optimism/op-service/ioutil"
@@ -21,6 +24,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 type Proof struct {
@@ -55,19 +59,140 @@ func Guard(proc *os.ProcessState, fn StepFn) StepFn {
 	}
 }
 
+var RunStrictSyscallsFlag = &cli.BoolFlag{
+	Name:  "strict-syscalls",
+	Usage: "Stop at syscalls that the VM ignores (no-op), except the allowed syscalls",
+}
+
+var RunAllowSyscallsFlag = &cli.Uint64SliceFlag{
+	Name:  "allow-syscalls",
+	Usage: "Syscall numbers that stay no-ops with --strict-syscalls. Defaults to those that op-program makes",
+	Value: cli.NewUint64Slice(fast.IgnoredSyscalls...),
+}
+
+var RunTraceSyscallsFlag = &cli.PathFlag{
+	Name:  "trace-syscalls",
+	Usage: "Path of the file to trace every syscall to, with its arguments and result",
+}
+
+var RunTraceSyscallsFmtFlag = &cli.StringFlag{
+	Name:  "trace-syscalls-fmt",
+	Usage: "Format of the syscall trace: 'text' for strace-like lines, or 'json' for JSON lines",
+	Value: "text",
+}
+
+var RunTraceOutFlag = &cli.PathFlag{
+	Name:  "trace-out",
+	Usage: "Path of the file to write a commit log of every instruction to, in the format of Spike's --log-commits",
+}
+
+var RunPProfGuestFlag = &cli.PathFlag{
+	Name:  "pprof.guest",
+	Usage: "Path of the file to write a pprof profile of the program in the VM to, with the functions that consume the steps",
+}
+
+var RunPProfGuestRateFlag = &cli.Uint64Flag{
+	Name:  "pprof.guest-rate",
+	Usage: "Number of steps between the samples of the guest profile",
+	Value: 1000,
+}
+
+var RunPProfGuestELFFlag = &cli.PathFlag{
+	Name:  "pprof.guest-elf",
+	Usage: "Path of the ELF binary to symbolize the guest profile with, instead of the --meta symbols",
+}
+
+var RunCallStackFlag = &cli.BoolFlag{
+	Name:  "call-stack",
+	Usage: "Track a shadow call stack of every thread, to show the call stack of a failed step",
+}
+
+var RunFlamegraphFlag = &cli.PathFlag{
+	Name:  "flamegraph",
+	Usage: "Path of the file to write the folded call stacks to, weighted by instruction count, for flamegraph.pl. Implies --call-stack",
+}
+
+var RunStatsFlag = &cli.PathFlag{
+	Name:  "stats",
+	Usage: "Path of the file to write instruction, syscall and memory access statistics to at exit, as JSON. '-' for stdout",
+}
+
+var RunMemoryReportFlag = &cli.PathFlag{
+	Name:  "memory-report",
+	Usage: "Path of the file to write a report of the memory usage to at exit: the pages by area, the most accessed pages, and the functions that allocate pages",
+}
+
+var RunMemoryReportFmtFlag = &cli.StringFlag{
+	Name:  "memory-report-fmt",
+	Usage: "Format of the memory report: 'text' for tables, or 'json'",
+	Value: "text",
+}
+
+var RunCoverageFlag = &cli.PathFlag{
+	Name:  "coverage",
+	Usage: "Path of the file to write the coverage of the source lines to at exit, from the line table of the --meta file (see load-elf --meta-lines) or the --elf binary",
+}
+
+var RunCoverageFmtFlag = &cli.StringFlag{
+	Name:  "coverage-fmt",
+	Usage: "Format of the coverage report: 'lcov' for an lcov tracefile, or 'go' for a Go coverage profile",
+	Value: "lcov",
+}
+
+var RunELFFlag = &cli.PathFlag{
+	Name:  "elf",
+	Usage: "Path of the ELF binary of the program, to describe PCs in logs and errors with the functions, inlined calls, files and lines of its Go pclntab. Stripped binaries have no inlined calls",
+}
+
 var _ fast.PreimageOracle = (*ProcessPreimageOracle)(nil)
 
 var OutFilePerm = os.FileMode(0o755)
 
+// preimageServerArgs returns the command of the pre-image server: the CLI args after the first '--'.
+// The command is empty if there are none.
+func preimageServerArgs(ctx *cli.Context) []string {
+	args := ctx.Args().Slice()
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	return args
+}
+
+// latestVersionFlags are the flags that use the tracing hooks of the VM, which only the VM of the latest version has
+var latestVersionFlags = []cli.Flag{
+	RunStrictSyscallsFlag,
+	RunTraceSyscallsFlag,
+	RunTraceOutFlag,
+	RunCallStackFlag,
+	RunFlamegraphFlag,
+	RunStatsFlag,
+	RunMemoryReportFlag,
+}
+
 func Run(ctx *cli.Context) error {
 	if ctx.Bool(cannon.RunPProfCPU.Name) {
 		defer profile.Start(profile.NoShutdownHook, profile.ProfilePath("."), profile.CPUProfile).Stop()
 	}
 
-	state, err := fast.LoadVMStateFromFile(ctx.Path(cannon.RunInputFlag.Name))
+	vs, err := fast.LoadStateFromFile(ctx.Path(cannon.RunInputFlag.Name))
 	if err != nil {
 		return err
 	}
+	if vs.Version != fast.LatestStateVersion {
+		for _, flag := range latestVersionFlags {
+			if name := flag.Names()[0]; ctx.IsSet(name) {
+				return fmt.Errorf("--%s needs a state of the latest version %s, but the state is of version %s",
+					name, fast.LatestStateVersion, vs.Version)
+			}
+		}
+	}
+	state := vs.VMState
 	l := Logger(os.Stderr, slog.LevelInfo)
 	outLog := &LoggingWriter{Name: "program std-out", Log: l}
 	errLog := &LoggingWriter{Name: "program std-err", Log: l}
@@ -111,18 +236,7 @@ func Run(ctx *cli.Context) error {
 	}
 	stopAtPreimageLargerThan := ctx.Int(cannon.RunStopAtPreimageLargerThanFlag.Name)
 
-	// split CLI args after first '--'
-	args := ctx.Args().Slice()
-	for i, arg := range args {
-		if arg == "--" {
-			args = args[i+1:]
-			break
-		}
-	}
-	if len(args) == 0 {
-		args = []string{""}
-	}
-
+	args := preimageServerArgs(ctx)
 	po, err := NewProcessPreimageOracle(args[0], args[1:])
 	if err != nil {
 		return fmt.Errorf("failed to create pre-image oracle process: %w", err)
@@ -141,19 +255,48 @@ func Run(ctx *cli.Context) error {
 	snapshotAt := ctx.Generic(cannon.RunSnapshotAtFlag.Name).(*cannon.StepMatcherFlag).Matcher()
 	infoAt := ctx.Generic(cannon.RunInfoAtFlag.Name).(*cannon.StepMatcherFlag).Matcher()
 
-	var meta *Metadata
-	if metaPath := ctx.Path(cannon.RunMetaFlag.Name); metaPath == "" {
-		l.Info("no metadata file specified, defaulting to empty metadata")
-		meta = &Metadata{Symbols: nil} // provide empty metadata by default
-	} else {
-		if m, err := jsonutil.LoadJSON[Metadata](metaPath); err != nil {
-			return fmt.Errorf("failed to load metadata: %w", err)
-		} else {
-			meta = m
+	meta, err := loadMetadata(l, ctx.Path(cannon.RunMetaFlag.Name))
+	if err != nil {
+		return err
+	}
+	var elfProgram *elf.File
+	if elfPath := ctx.Path(RunELFFlag.Name); elfPath != "" {
+		elfProgram, err = elf.Open(elfPath)
+		if err != nil {
+			return fmt.Errorf("failed to open ELF file %q: %w", elfPath, err)
 		}
+		defer elfProgram.Close()
+		// without metadata, or without its line table, the reports use the symbols and lines of the ELF
+		if len(meta.Symbols) == 0 || len(meta.Lines) == 0 {
+			if meta, err = MakeMetadata(elfProgram, true); err != nil {
+				return fmt.Errorf("failed to load ELF symbols: %w", err)
+			}
+		}
+	}
+	symbolizer, err := NewSymbolizer(meta, elfProgram)
+	if err != nil {
+		return fmt.Errorf("failed to load Go pclntab: %w", err)
 	}
 
-	us := fast.NewInstrumentedState(state, po, outLog, errLog)
+	us := vs.CreateVM(po, outLog, errLog)
+	us.SetStrictSyscalls(ctx.Bool(RunStrictSyscallsFlag.Name), ctx.Uint64Slice(RunAllowSyscallsFlag.Name))
+	if tracePath := ctx.Path(RunTraceSyscallsFlag.Name); tracePath != "" {
+		traceFile, err := os.OpenFile(tracePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create syscall trace file: %w", err)
+		}
+		tracer, err := NewSyscallTraceWriter(traceFile, ctx.String(RunTraceSyscallsFmtFlag.Name))
+		if err != nil {
+			_ = traceFile.Close()
+			return err
+		}
+		defer func() {
+			if err := tracer.Close(); err != nil {
+				l.Error("failed to write syscall trace", "err", err)
+			}
+		}()
+		us.SetSyscallTracer(tracer.Trace)
+	}
 	proofFmt := ctx.String(cannon.RunProofFmtFlag.Name)
 	snapshotFmt := ctx.String(cannon.RunSnapshotFmtFlag.Name)
 
@@ -161,6 +304,110 @@ func Run(ctx *cli.Context) error {
 	if po.cmd != nil {
 		stepFn = Guard(po.cmd.ProcessState, stepFn)
 	}
+	// the memory tracers of the reports, in the order they are added
+	var memoryTracers []fast.MemoryTracer
+	if tracePath := ctx.Path(RunTraceOutFlag.Name); tracePath != "" {
+		traceFile, err := os.OpenFile(tracePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, OutFilePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create commit log file: %w", err)
+		}
+		commitLog := NewCommitLogWriter(state, traceFile)
+		defer func() {
+			if err := commitLog.Close(); err != nil {
+				l.Error("failed to write commit log", "err", err)
+			}
+		}()
+		memoryTracers = append(memoryTracers, commitLog.TraceMemory)
+		stepFn = commitLog.Step(stepFn)
+	}
+	if reportPath := ctx.Path(RunMemoryReportFlag.Name); reportPath != "" {
+		reportFmt := ctx.String(RunMemoryReportFmtFlag.Name)
+		if reportFmt != "text" && reportFmt != "json" {
+			return fmt.Errorf("invalid memory report format %q", reportFmt)
+		}
+		report := NewMemoryReport(state, meta)
+		defer func() {
+			if err := writeMemoryReport(reportPath, reportFmt, report); err != nil {
+				l.Error("failed to write memory report", "err", err)
+			}
+		}()
+		memoryTracers = append(memoryTracers, report.TraceMemory)
+	}
+	switch len(memoryTracers) {
+	case 0:
+	case 1:
+		us.SetMemoryTracer(memoryTracers[0])
+	default:
+		us.SetMemoryTracer(func(addr uint64, size uint64, access uint8) {
+			for _, t := range memoryTracers {
+				t(addr, size, access)
+			}
+		})
+	}
+	if coveragePath := ctx.Path(RunCoverageFlag.Name); coveragePath != "" {
+		coverageFmt := ctx.String(RunCoverageFmtFlag.Name)
+		if coverageFmt != "lcov" && coverageFmt != "go" {
+			return fmt.Errorf("invalid coverage format %q", coverageFmt)
+		}
+		coverage, err := NewCoverage(state, meta)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := writeCoverage(coveragePath, coverageFmt, coverage); err != nil {
+				l.Error("failed to write coverage", "err", err)
+			}
+		}()
+		stepFn = coverage.Step(stepFn)
+	}
+	if statsPath := ctx.Path(RunStatsFlag.Name); statsPath != "" {
+		stats := fast.NewStats()
+		us.SetStats(stats)
+		defer func() {
+			if err := jsonutil.WriteJSON(stats, ioutil.ToStdOutOrFileOrNoop(statsPath, OutFilePerm)); err != nil {
+				l.Error("failed to write stats", "err", err)
+			}
+		}()
+	}
+	if ctx.Bool(RunCallStackFlag.Name) || ctx.Path(RunFlamegraphFlag.Name) != "" {
+		callStacks := fast.NewCallStacks()
+		us.SetCallStacks(callStacks)
+		if flamegraphPath := ctx.Path(RunFlamegraphFlag.Name); flamegraphPath != "" {
+			flamegraph := NewFlameGraph(state, callStacks, meta)
+			defer func() {
+				if err := writeFlameGraph(flamegraphPath, flamegraph); err != nil {
+					l.Error("failed to write flamegraph", "err", err)
+				}
+			}()
+			stepFn = flamegraph.Step(stepFn)
+		}
+	}
+	if profilePath := ctx.Path(RunPProfGuestFlag.Name); profilePath != "" {
+		rate := ctx.Uint64(RunPProfGuestRateFlag.Name)
+		if rate == 0 {
+			return fmt.Errorf("invalid %v: 0", RunPProfGuestRateFlag.Name)
+		}
+		profileMeta := meta
+		elfPath := ctx.Path(RunPProfGuestELFFlag.Name)
+		if elfPath != "" {
+			elfProgram, err := elf.Open(elfPath)
+			if err != nil {
+				return fmt.Errorf("failed to open ELF file %q: %w", elfPath, err)
+			}
+			profileMeta, err = MakeMetadata(elfProgram, false)
+			_ = elfProgram.Close()
+			if err != nil {
+				return fmt.Errorf("failed to load ELF symbols: %w", err)
+			}
+		}
+		profiler := NewGuestProfiler(state, profileMeta, rate, elfPath)
+		defer func() {
+			if err := writeGuestProfile(profilePath, profiler); err != nil {
+				l.Error("failed to write guest profile", "err", err)
+			}
+		}()
+		stepFn = profiler.Step(stepFn)
+	}
 
 	start := time.Now()
 	startStep := state.Step
@@ -179,11 +426,11 @@ func Run(ctx *cli.Context) error {
 			l.Info("processing",
 				"step", step,
 				"pc", HexU32(state.PC),
-				"insn", HexU32(state.Instr()),
+				"insn", riscv.Disassemble(state.Instr(), state.PC),
 				"ips", float64(step-startStep)/(float64(delta)/float64(time.Second)),
 				"pages", state.Memory.PageCount(),
 				"mem", state.Memory.Usage(),
-				"name", meta.LookupSymbol(state.PC),
+				"name", symbolizer.Describe(state.PC),
 			)
 		}
 
@@ -192,35 +439,17 @@ func Run(ctx *cli.Context) error {
 		}
 
 		if snapshotAt(state) {
-			if err := serialize.Write(fmt.Sprintf(snapshotFmt, step), state, OutFilePerm); err != nil {
+			if err := serialize.Write(fmt.Sprintf(snapshotFmt, step), vs, OutFilePerm); err != nil {
 				return fmt.Errorf("failed to write state snapshot: %w", err)
 			}
 		}
 
 		if proofAt(state) {
-			preStateHash, err := state.EncodeWitness().StateHash()
-			if err != nil {
-				return fmt.Errorf("failed to hash prestate witness: %w", err)
-			}
-			witness, err := stepFn(true)
+			proof, err := ProveStep(vs, stepFn)
 			if err != nil {
-				return fmt.Errorf("failed at proof-gen step %d (PC: %08x): %w", step, state.PC, err)
-			}
-			postStateHash, err := state.EncodeWitness().StateHash()
-			if err != nil {
-				return fmt.Errorf("failed to hash poststate witness: %w", err)
-			}
-			proof := &Proof{
-				Step:      step,
-				Pre:       preStateHash,
-				Post:      postStateHash,
-				StateData: witness.State,
-				ProofData: witness.MemProof,
-			}
-			if witness.HasPreimage() {
-				proof.OracleKey = witness.PreimageKey[:]
-				proof.OracleValue = witness.PreimageValue
-				proof.OracleOffset = witness.PreimageOffset
+				logUnsupportedSyscall(l, symbolizer, step, err)
+				logCallStack(l, symbolizer, state.PC, err)
+				return fmt.Errorf("in %s: %w", symbolizer.Describe(state.PC), err)
 			}
 			if err := jsonutil.WriteJSON(proof, ioutil.ToStdOutOrFileOrNoop(fmt.Sprintf(proofFmt, step), OutFilePerm)); err != nil {
 				return fmt.Errorf("failed to write proof data: %w", err)
@@ -228,7 +457,9 @@ func Run(ctx *cli.Context) error {
 		} else {
 			_, err = stepFn(false)
 			if err != nil {
-				return fmt.Errorf("failed at step %d (PC: %08x): %w", step, state.PC, err)
+				logUnsupportedSyscall(l, symbolizer, step, err)
+				logCallStack(l, symbolizer, state.PC, err)
+				return fmt.Errorf("failed at step %d (PC: %08x in %s): %w", step, state.PC, symbolizer.Describe(state.PC), err)
 			}
 		}
 
@@ -252,16 +483,59 @@ func Run(ctx *cli.Context) error {
 		}
 	}
 
-	if err := state.SetWitnessAndStateHash(); err != nil {
+	if err := vs.SetWitnessAndStateHash(); err != nil {
 		return fmt.Errorf("failed to set witness and stateHash: %w", err)
 	}
 
-	if err := serialize.Write[*fast.VMState](ctx.Path(cannon.RunOutputFlag.Name), state, OutFilePerm); err != nil {
+	if err := serialize.Write(ctx.Path(cannon.RunOutputFlag.Name), vs, OutFilePerm); err != nil {
 		return fmt.Errorf("failed to write state output: %w", err)
 	}
 	return nil
 }
 
+// ProveStep runs the next step of the state with proof generation, and returns the proof of the step,
+// with the state hashes in the witness layout of the version of the state
+func ProveStep(state *fast.VersionedState, stepFn StepFn) (*Proof, error) {
+	step := state.Step
+	preStateHash, err := state.EncodeWitness().StateHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash prestate witness: %w", err)
+	}
+	witness, err := stepFn(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed at proof-gen step %d (PC: %08x): %w", step, state.PC, err)
+	}
+	postStateHash, err := state.EncodeWitness().StateHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash poststate witness: %w", err)
+	}
+	proof := &Proof{
+		Step:      step,
+		Pre:       preStateHash,
+		Post:      postStateHash,
+		StateData: witness.State,
+		ProofData: witness.ProofData(),
+	}
+	if witness.HasPreimage() {
+		proof.OracleKey = witness.PreimageKey[:]
+		proof.OracleValue = witness.PreimageValue
+		proof.OracleOffset = witness.PreimageOffset
+	}
+	return proof, nil
+}
+
+// logUnsupportedSyscall reports the syscall that a step failed on in strict syscall mode
+func logUnsupportedSyscall(l log.Logger, symbolizer *Symbolizer, step uint64, err error) {
+	var syscallErr *fast.UnsupportedSyscallErr
+	if errors.As(err, &syscallErr) {
+		ctx := []any{"step", step, "syscall", syscallErr.SyscallNum}
+		if syscallErr.PC != 0 { // the error of a syscall that always reverts has no PC
+			ctx = append(ctx, "pc", HexU32(syscallErr.PC), "name", symbolizer.Describe(syscallErr.PC))
+		}
+		l.Error("unsupported syscall", ctx...)
+	}
+}
+
 var RunCommand = &cli.Command{
 	Name:        "run",
 	Usage:       "Run VM step(s) and generate proof data to replicate onchain.",
@@ -281,5 +555,21 @@ var RunCommand = &cli.Command{
 		cannon.RunMetaFlag,
 		cannon.RunInfoAtFlag,
 		cannon.RunPProfCPU,
+		RunStrictSyscallsFlag,
+		RunAllowSyscallsFlag,
+		RunTraceSyscallsFlag,
+		RunTraceSyscallsFmtFlag,
+		RunTraceOutFlag,
+		RunPProfGuestFlag,
+		RunPProfGuestRateFlag,
+		RunPProfGuestELFFlag,
+		RunCallStackFlag,
+		RunFlamegraphFlag,
+		RunStatsFlag,
+		RunMemoryReportFlag,
+		RunMemoryReportFmtFlag,
+		RunCoverageFlag,
+		RunCoverageFmtFlag,
+		RunELFFlag,
 	},
 }
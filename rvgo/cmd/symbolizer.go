@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// pcdataInlTreeIndex is the pcdata table of the index in the inline tree, see internal/abi
+	pcdataInlTreeIndex = 2
+	// funcdataInlTree is the funcdata symbol of the inline tree, see internal/abi
+	funcdataInlTree = 3
+	// inlinedCallSize is the size of an entry of the inline tree, see runtime/symtabinl.go
+	inlinedCallSize = 16
+)
+
+// Frame is the source location of an instruction, in a function that may be inlined into the next frame
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Inlined  bool
+}
+
+func (f Frame) String() string {
+	if f.Line == 0 {
+		return f.Function
+	}
+	return fmt.Sprintf("%s (%s:%d)", f.Function, path.Base(f.File), f.Line)
+}
+
+// Symbolizer finds the source locations of PCs, from the Go pclntab of a program:
+// the function, file and line, and the calls that the compiler inlined.
+// The pclntab is kept by stripped binaries too. Without it, or for PCs outside Go functions,
+// the Symbolizer falls back to the symbols and lines of the metadata.
+type Symbolizer struct {
+	meta *Metadata
+	tab  *pclntab
+	// goFunc is the address of go:func.*, which the inline trees are relative to, or 0 if it was not found
+	goFunc   uint64
+	sections []*elf.Section
+}
+
+// NewSymbolizer creates a symbolizer from the metadata, and the ELF program if it is not nil
+func NewSymbolizer(meta *Metadata, elfProgram *elf.File) (*Symbolizer, error) {
+	s := &Symbolizer{meta: meta}
+	if elfProgram == nil {
+		return s, nil
+	}
+	tab, err := loadPclntab(elfProgram)
+	if err != nil {
+		return nil, err
+	}
+	s.tab = tab
+	for _, section := range elfProgram.Sections {
+		if section.Type == elf.SHT_PROGBITS && section.Flags&elf.SHF_ALLOC != 0 {
+			s.sections = append(s.sections, section)
+		}
+	}
+	// the inline trees have the layout of Go 1.20 and later, and are located with the symbol table,
+	// stripped binaries only have the functions, files and lines
+	if tab.magic == go120PclntabMagic {
+		s.goFunc, _ = elfSymbol(elfProgram, "go:func.*")
+	}
+	return s, nil
+}
+
+// read reads n bytes of the program at addr
+func (s *Symbolizer) read(addr uint64, n uint64) ([]byte, bool) {
+	for _, section := range s.sections {
+		if addr >= section.Addr && addr+n <= section.Addr+section.Size {
+			out := make([]byte, n)
+			if _, err := section.ReadAt(out, int64(addr-section.Addr)); err != nil {
+				return nil, false
+			}
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+// lookupFunc returns the Go function of pc, or nil if pc is not in a Go function
+func (s *Symbolizer) lookupFunc(pc uint64) *gosym.Func {
+	if s.tab == nil {
+		return nil
+	}
+	return s.tab.PCToFunc(pc)
+}
+
+// Frames returns the source locations of pc, the innermost inlined call first, and the function of pc last
+func (s *Symbolizer) Frames(pc uint64) []Frame {
+	fn := s.lookupFunc(pc)
+	if fn == nil {
+		out := Frame{Function: s.meta.LookupSymbol(pc)}
+		if file, line, ok := s.meta.LookupLine(pc); ok {
+			out.File, out.Line = file, int(line)
+		}
+		return []Frame{out}
+	}
+	var frames []Frame
+	if data := s.tab.funcData(fn); data != nil && s.goFunc != 0 {
+		if inlTree, ok := s.tab.funcdata(data, funcdataInlTree); ok {
+			indexTable := s.tab.pcdata(data, pcdataInlTreeIndex)
+			for index := s.tab.pcvalueAt(fn, indexTable, pc); index >= 0; index = s.tab.pcvalueAt(fn, indexTable, pc) {
+				call, ok := s.read(s.goFunc+uint64(inlTree)+uint64(index)*inlinedCallSize, inlinedCallSize)
+				// a corrupt inline tree may loop, while the calls are at most one per byte of the function
+				if !ok || len(frames) >= int(fn.End-fn.Entry) {
+					break
+				}
+				file, line := s.tab.fileLine(pc)
+				frames = append(frames, Frame{
+					Function: s.tab.string(s.tab.funcnametab, s.tab.order.Uint32(call[4:])),
+					File:     file,
+					Line:     line,
+					Inlined:  true,
+				})
+				pc = fn.Entry + uint64(int32(s.tab.order.Uint32(call[8:])))
+			}
+		}
+	}
+	file, line := s.tab.fileLine(pc)
+	return append(frames, Frame{Function: fn.Name, File: file, Line: line})
+}
+
+// Function returns the function that the instruction at pc is in, the callee of an inlined call if it is inlined
+func (s *Symbolizer) Function(pc uint64) string {
+	return s.Frames(pc)[0].Function
+}
+
+// Describe describes the instruction at pc, with its function, file and line, and the functions that it is inlined into
+func (s *Symbolizer) Describe(pc uint64) string {
+	frames := s.Frames(pc)
+	out := make([]string, len(frames))
+	for i, f := range frames {
+		out[i] = f.String()
+	}
+	return strings.Join(out, " inlined into ")
+}
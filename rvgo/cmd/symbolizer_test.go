@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// symbolizerProgram is a Go program with an inlined call
+const symbolizerProgram = `package main
+
+func inlined(x int) int {
+	return x*x + 3
+}
+
+//go:noinline
+func caller(x int) int {
+	return inlined(x) * 7
+}
+
+func main() {
+	println(caller(5))
+}
+`
+
+// buildProgram builds a Go program with the Go linker and the given linker flags, and opens the ELF binary.
+// It returns the directory of the source file main.go too.
+func buildProgram(t *testing.T, source string, ldflags string) (*elf.File, string) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool to build the program")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0o644))
+	build := exec.Command(goTool, "build", "-ldflags="+ldflags, "-o", "program", "main.go")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOOS=linux", "GOFLAGS=")
+	out, err := build.CombinedOutput()
+	require.NoError(t, err, string(out))
+	elfProgram, err := elf.Open(filepath.Join(dir, "program"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = elfProgram.Close() })
+	return elfProgram, dir
+}
+
+func TestSymbolizer(t *testing.T) {
+	elfProgram, dir := buildProgram(t, symbolizerProgram, "")
+	s, err := NewSymbolizer(&Metadata{}, elfProgram)
+	require.NoError(t, err)
+	require.NotZero(t, s.goFunc)
+
+	entry, ok := elfSymbol(elfProgram, "main.caller")
+	require.True(t, ok)
+	fn := s.lookupFunc(entry)
+	require.NotNil(t, fn)
+	require.Equal(t, entry, fn.Entry)
+	require.Equal(t, "main.caller", s.Function(entry))
+
+	var inlinedFrames []Frame
+	for pc := fn.Entry; pc < fn.End && inlinedFrames == nil; pc++ {
+		if frames := s.Frames(pc); len(frames) == 2 {
+			inlinedFrames = frames
+			require.Equal(t, "main.inlined (main.go:4) inlined into main.caller (main.go:9)", s.Describe(pc))
+		}
+	}
+	require.NotNil(t, inlinedFrames, "no inlined call in main.caller")
+	require.Equal(t, "main.inlined", inlinedFrames[0].Function)
+	require.Equal(t, filepath.Join(dir, "main.go"), inlinedFrames[0].File)
+	require.Equal(t, 4, inlinedFrames[0].Line)
+	require.True(t, inlinedFrames[0].Inlined)
+	require.Equal(t, "main.caller", inlinedFrames[1].Function)
+	require.Equal(t, 9, inlinedFrames[1].Line)
+	require.False(t, inlinedFrames[1].Inlined)
+}
+
+func TestSymbolizerStripped(t *testing.T) {
+	// a stripped program, like release prestates, has the functions, files and lines of the pclntab,
+	// but not the symbols to find the inline trees
+	elfProgram, dir := buildProgram(t, symbolizerProgram, "-s -w")
+	s, err := NewSymbolizer(&Metadata{}, elfProgram)
+	require.NoError(t, err)
+	require.Zero(t, s.goFunc)
+
+	fn := s.tab.LookupFunc("main.caller")
+	require.NotNil(t, fn)
+	require.Equal(t, []Frame{{Function: "main.caller", File: filepath.Join(dir, "main.go"), Line: 8}}, s.Frames(fn.Entry))
+	for pc := fn.Entry; pc < fn.End; pc++ {
+		require.Len(t, s.Frames(pc), 1)
+	}
+}
+
+func TestSymbolizerMetadata(t *testing.T) {
+	// without an ELF program, the symbolizer describes PCs with the symbols and lines of the metadata
+	meta := &Metadata{
+		Symbols: []Symbol{{Name: "main.main", Start: 0x1000, Size: 0x100}},
+		Files:   []string{"/src/main.go"},
+		Lines:   []Line{{Start: 0x1000, Line: 10}, {Start: 0x1010, Line: 11}, {Start: 0x1100}},
+	}
+	s, err := NewSymbolizer(meta, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Frame{{Function: "main.main", File: "/src/main.go", Line: 11}}, s.Frames(0x1014))
+	require.Equal(t, "main.main (main.go:11)", s.Describe(0x1014))
+	require.Equal(t, "!gap", s.Describe(0x1200))
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+// SyscallTraceWriter writes the syscalls of a fast.InstrumentedState,
+// one per line: like strace in the text format, or as JSON objects in the json format.
+type SyscallTraceWriter struct {
+	w    io.WriteCloser
+	buf  *bufio.Writer
+	json bool
+	// err is the first write error, the trace stops there
+	err error
+}
+
+func NewSyscallTraceWriter(w io.WriteCloser, format string) (*SyscallTraceWriter, error) {
+	switch format {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid syscall trace format %q", format)
+	}
+	return &SyscallTraceWriter{w: w, buf: bufio.NewWriter(w), json: format == "json"}, nil
+}
+
+// Trace is a fast.SyscallTracer
+func (tw *SyscallTraceWriter) Trace(t *fast.SyscallTrace) {
+	if tw.err != nil {
+		return
+	}
+	if tw.json {
+		// the encoder ends every object with a newline
+		tw.err = json.NewEncoder(tw.buf).Encode(t)
+	} else {
+		_, tw.err = fmt.Fprintln(tw.buf, t.String())
+	}
+}
+
+// Close flushes the trace, and closes the underlying writer
+func (tw *SyscallTraceWriter) Close() error {
+	err := tw.err
+	if flushErr := tw.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := tw.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestSyscallTraceWriter(t *testing.T) {
+	trace := &fast.SyscallTrace{Step: 3, PC: 0x100, ThreadID: 1, Num: 25, Name: "fcntl",
+		Args: []string{"9", "F_GETFL", "0"}, Status: fast.SyscallReturned, Errno: 0x4d, Error: "EBADFD"}
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw, err := NewSyscallTraceWriter(nopCloser{&buf}, "text")
+		require.NoError(t, err)
+		tw.Trace(trace)
+		tw.Trace(trace)
+		require.NoError(t, tw.Close())
+		line := "3 [tid 1] 0000000000000100 fcntl(9, F_GETFL, 0) = -1 EBADFD\n"
+		require.Equal(t, line+line, buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw, err := NewSyscallTraceWriter(nopCloser{&buf}, "json")
+		require.NoError(t, err)
+		tw.Trace(trace)
+		require.NoError(t, tw.Close())
+		require.Equal(t, `{"step":3,"pc":256,"tid":1,"num":25,"name":"fcntl","args":["9","F_GETFL","0"],`+
+			`"status":"returned","ret":0,"errno":77,"error":"EBADFD"}`+"\n", buf.String())
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := NewSyscallTraceWriter(nopCloser{io.Discard}, "xml")
+		require.ErrorContains(t, err, "invalid syscall trace format")
+	})
+}
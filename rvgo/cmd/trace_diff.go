@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	cannon "github.com/ethereum-optimism/optimism/cannon/cmd"
+)
+
+var TraceDiffAsteriscFlag = &cli.PathFlag{
+	Name:      "asterisc",
+	Usage:     "Path of the commit log of asterisc, written by run --trace-out",
+	TakesFile: true,
+	Required:  true,
+}
+
+var TraceDiffSpikeFlag = &cli.PathFlag{
+	Name:      "spike",
+	Usage:     "Path of the commit log of Spike, written by spike --log-commits",
+	TakesFile: true,
+	Required:  true,
+}
+
+// ecallInstr is the ECALL instruction. Spike does not commit it when it traps to the proxy kernel.
+const ecallInstr = 0x00000073
+
+// Divergence is the first difference between two commit logs
+type Divergence struct {
+	// Index is the index of the asterisc instruction, from the start of the log
+	Index    uint64
+	Reason   string
+	PC       uint64
+	Asterisc string
+	Spike    string
+	// AsteriscLine and SpikeLine are the line numbers of the commits in their logs
+	AsteriscLine int
+	SpikeLine    int
+}
+
+// spikeCommit is a commit of the privilege level of asterisc,
+// with the register writes of the other privilege levels before it, like those of a trap handler.
+type spikeCommit struct {
+	*Commit
+	raw  string
+	line int
+	trap []RegWrite
+}
+
+type spikeLog struct {
+	r    *CommitLogReader
+	priv uint8
+}
+
+func (sl *spikeLog) next() (*spikeCommit, error) {
+	var trap []RegWrite
+	for {
+		c, raw, err := sl.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if c.Priv == sl.priv {
+			return &spikeCommit{Commit: c, raw: raw, line: sl.r.Line(), trap: trap}, nil
+		}
+		trap = append(trap, c.Regs...)
+	}
+}
+
+func applyRegs(regs map[string]uint64, writes []RegWrite) {
+	for _, w := range writes {
+		regs[w.Name] = w.Value
+	}
+}
+
+// diffRegs compares the registers that either side wrote, when both values are known.
+// CSRs and vector registers are not compared.
+func diffRegs(asteriscRegs, spikeRegs map[string]uint64, written ...[]RegWrite) string {
+	for _, writes := range written {
+		for _, w := range writes {
+			if w.Name[0] != 'x' && w.Name[0] != 'f' {
+				continue
+			}
+			a, aok := asteriscRegs[w.Name]
+			s, sok := spikeRegs[w.Name]
+			if aok && sok && a != s {
+				return fmt.Sprintf("register %s: asterisc 0x%016x, spike 0x%016x", w.Name, a, s)
+			}
+		}
+	}
+	return ""
+}
+
+func formatList[T any](v []T, format func(T) string) string {
+	out := make([]string, len(v))
+	for i, x := range v {
+		out[i] = format(x)
+	}
+	return "[" + strings.Join(out, " ") + "]"
+}
+
+func formatLoad(addr uint64) string {
+	return fmt.Sprintf("%#x", addr)
+}
+
+func formatStore(w MemWrite) string {
+	return fmt.Sprintf("%#x=0x%0*x", w.Addr, 2*w.Size, w.Value)
+}
+
+// diffCommit compares the PC, instruction and memory accesses of two commits.
+// The memory accesses of syscalls are not compared, since the kernels differ.
+func diffCommit(a *Commit, s *Commit) string {
+	if a.PC != s.PC {
+		return fmt.Sprintf("pc: asterisc 0x%016x, spike 0x%016x", a.PC, s.PC)
+	}
+	if a.Instr != s.Instr {
+		return fmt.Sprintf("instruction: asterisc 0x%08x, spike 0x%08x", a.Instr, s.Instr)
+	}
+	if a.Instr == ecallInstr {
+		return ""
+	}
+	if !slices.Equal(a.Loads, s.Loads) {
+		return fmt.Sprintf("loads: asterisc %s, spike %s", formatList(a.Loads, formatLoad), formatList(s.Loads, formatLoad))
+	}
+	if !slices.Equal(a.Stores, s.Stores) {
+		return fmt.Sprintf("stores: asterisc %s, spike %s", formatList(a.Stores, formatStore), formatList(s.Stores, formatStore))
+	}
+	return ""
+}
+
+// DiffCommitLogs compares an asterisc commit log with a Spike commit log, and returns the first divergence.
+// The Spike log is aligned to the first asterisc commit, and commits of other privilege levels than that of
+// asterisc, like those of the proxy kernel, are skipped. It returns the number of instructions that match,
+// and a nil divergence if the logs agree until one of them ends.
+func DiffCommitLogs(asterisc io.Reader, spike io.Reader) (*Divergence, uint64, error) {
+	ar := NewCommitLogReader(asterisc)
+	a, aRaw, err := ar.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("asterisc log: %w", err)
+	}
+
+	sl := &spikeLog{r: NewCommitLogReader(spike), priv: a.Priv}
+	asteriscRegs, spikeRegs := make(map[string]uint64), make(map[string]uint64)
+	var s *spikeCommit
+	for {
+		s, err = sl.next()
+		if errors.Is(err, io.EOF) {
+			return nil, 0, fmt.Errorf("spike log does not reach pc 0x%016x", a.PC)
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("spike log: %w", err)
+		}
+		// the registers before the first instruction are known, but not compared
+		applyRegs(spikeRegs, s.trap)
+		s.trap = nil
+		if s.PC == a.PC {
+			break
+		}
+		applyRegs(spikeRegs, s.Regs)
+	}
+
+	var index uint64
+	for {
+		applyRegs(asteriscRegs, a.Regs)
+		var reason string
+		consumed := true
+		if a.Instr == ecallInstr && s.PC != a.PC && s.trap != nil {
+			// Spike does not commit an ECALL that traps: compare it with the register writes of the trap handler
+			applyRegs(spikeRegs, s.trap)
+			reason = diffRegs(asteriscRegs, spikeRegs, a.Regs, s.trap)
+			s.trap = nil
+			consumed = false
+		} else {
+			applyRegs(spikeRegs, s.trap)
+			applyRegs(spikeRegs, s.Regs)
+			reason = diffCommit(a, s.Commit)
+			if reason == "" {
+				reason = diffRegs(asteriscRegs, spikeRegs, a.Regs, s.Regs)
+			}
+		}
+		if reason != "" {
+			return &Divergence{
+				Index:        index,
+				Reason:       reason,
+				PC:           a.PC,
+				Asterisc:     aRaw,
+				Spike:        s.raw,
+				AsteriscLine: ar.Line(),
+				SpikeLine:    s.line,
+			}, index, nil
+		}
+		index++
+
+		if consumed {
+			s, err = sl.next()
+			if errors.Is(err, io.EOF) {
+				return nil, index, nil
+			} else if err != nil {
+				return nil, index, fmt.Errorf("spike log: %w", err)
+			}
+		}
+		a, aRaw, err = ar.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, index, nil
+		} else if err != nil {
+			return nil, index, fmt.Errorf("asterisc log: %w", err)
+		}
+	}
+}
+
+func TraceDiff(ctx *cli.Context) error {
+	asteriscFile, err := os.Open(ctx.Path(TraceDiffAsteriscFlag.Name))
+	if err != nil {
+		return fmt.Errorf("failed to open asterisc log: %w", err)
+	}
+	defer asteriscFile.Close()
+	spikeFile, err := os.Open(ctx.Path(TraceDiffSpikeFlag.Name))
+	if err != nil {
+		return fmt.Errorf("failed to open spike log: %w", err)
+	}
+	defer spikeFile.Close()
+
+	meta, err := loadMetadata(Logger(os.Stderr, slog.LevelInfo), ctx.Path(cannon.RunMetaFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	d, matched, err := DiffCommitLogs(asteriscFile, spikeFile)
+	if err != nil {
+		return err
+	}
+	out := ctx.App.Writer
+	if d == nil {
+		_, err := fmt.Fprintf(out, "no divergence in %d instructions\n", matched)
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "divergence at instruction %d, pc 0x%016x <%s>: %s\n", d.Index, d.PC, meta.LookupSymbol(d.PC), d.Reason)
+	_, _ = fmt.Fprintf(out, "  asterisc line %d: %s\n", d.AsteriscLine, d.Asterisc)
+	_, _ = fmt.Fprintf(out, "  spike line %d: %s\n", d.SpikeLine, d.Spike)
+	return fmt.Errorf("traces diverge at instruction %d", d.Index)
+}
+
+var TraceDiffCommand = &cli.Command{
+	Name:  "trace-diff",
+	Usage: "Report the first divergence between an asterisc and a Spike commit log.",
+	Description: "Compare the commit log of 'run --trace-out' with that of 'spike --log-commits' on the same ELF, " +
+		"and report the first instruction where the PC, instruction, register writes or memory accesses differ. " +
+		"Syscalls are compared by the registers they write.",
+	Action: TraceDiff,
+	Flags: []cli.Flag{
+		TraceDiffAsteriscFlag,
+		TraceDiffSpikeFlag,
+		cannon.RunMetaFlag,
+	},
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSpikeLog = `core   0: 3 0x0000000000001000 (0x00000297) x5  0x0000000000001000
+core   0: 1 0x0000000080000000 (0x10500073)
+core   0: 0 0x0000000000010000 (0x00500513) x10 0x0000000000000005
+core   0: 0 0x0000000000010004 (0x00a13423) mem 0x0000000000002008 0x0000000000000005
+core   0: exception trap_user_ecall, epc 0x0000000000010008
+core   0: 1 0x0000000080000100 (0x00053503) x10 0x0000000000000007 mem 0x0000000080008000
+core   0: 1 0x0000000080000104 (0x10200073) c256_sstatus 0x0000000200000020
+core   0: 0 0x000000000001000c (0x00813583) x11 0x0000000000000005 mem 0x0000000000002008
+core   0: 0 0x0000000000010010 (0x0505) x10 0x0000000000000008
+`
+
+func TestDiffCommitLogs(t *testing.T) {
+	asteriscLog := `core   0: 0 0x0000000000010000 (0x00500513) x10 0x0000000000000005
+core   0: 0 0x0000000000010004 (0x00a13423) mem 0x0000000000002008 0x0000000000000005
+core   0: 0 0x0000000000010008 (0x00000073) x10 0x0000000000000007
+core   0: 0 0x000000000001000c (0x00813583) x11 0x0000000000000005 mem 0x0000000000002008
+`
+	t.Run("match", func(t *testing.T) {
+		d, n, err := DiffCommitLogs(strings.NewReader(asteriscLog), strings.NewReader(testSpikeLog))
+		require.NoError(t, err)
+		require.Nil(t, d)
+		require.Equal(t, uint64(4), n)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		log := asteriscLog + "core   0: 0 0x0000000000010010 (0x0505) x10 0x0000000000000006\n"
+		d, n, err := DiffCommitLogs(strings.NewReader(log), strings.NewReader(testSpikeLog))
+		require.NoError(t, err)
+		require.Equal(t, uint64(4), n)
+		require.Equal(t, &Divergence{
+			Index:        4,
+			Reason:       "register x10: asterisc 0x0000000000000006, spike 0x0000000000000008",
+			PC:           0x10010,
+			Asterisc:     "core   0: 0 0x0000000000010010 (0x0505) x10 0x0000000000000006",
+			Spike:        "core   0: 0 0x0000000000010010 (0x0505) x10 0x0000000000000008",
+			AsteriscLine: 5,
+			SpikeLine:    9,
+		}, d)
+	})
+
+	t.Run("syscall", func(t *testing.T) {
+		log := strings.Replace(asteriscLog, "(0x00000073) x10 0x0000000000000007", "(0x00000073) x10 0x0000000000000009", 1)
+		d, _, err := DiffCommitLogs(strings.NewReader(log), strings.NewReader(testSpikeLog))
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), d.Index)
+		require.Equal(t, "register x10: asterisc 0x0000000000000009, spike 0x0000000000000007", d.Reason)
+	})
+
+	t.Run("store", func(t *testing.T) {
+		log := strings.Replace(asteriscLog, "mem 0x0000000000002008 0x0000000000000005", "mem 0x0000000000002008 0x0000000000000006", 1)
+		d, _, err := DiffCommitLogs(strings.NewReader(log), strings.NewReader(testSpikeLog))
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), d.Index)
+		require.Equal(t, "stores: asterisc [0x2008=0x0000000000000006], spike [0x2008=0x0000000000000005]", d.Reason)
+	})
+
+	t.Run("missing start", func(t *testing.T) {
+		_, _, err := DiffCommitLogs(strings.NewReader("core   0: 0 0x0000000000020000 (0x00000013)\n"), strings.NewReader(testSpikeLog))
+		require.EqualError(t, err, "spike log does not reach pc 0x0000000000020000")
+	})
+}
@@ -26,7 +26,8 @@ type WitnessOutput struct {
 func Witness(ctx *cli.Context) error {
 	input := ctx.Path(cannon.WitnessInputFlag.Name)
 	witnessOutput := ctx.Path(cannon.WitnessOutputFlag.Name)
-	state, err := fast.LoadVMStateFromFile(input)
+	// the witness is in the layout of the version of the state, for the RISCV.sol of that version
+	state, err := fast.LoadStateFromFile(input)
 	if err != nil {
 		return fmt.Errorf("invalid input state (%v): %w", input, err)
 	}
@@ -18,7 +18,7 @@ import (
 //go:embed test_data/state.json
 var testState []byte
 
-var asteriscWitnessLen = 362
+var asteriscWitnessLen = 931
 
 func TestLoadState(t *testing.T) {
 	t.Run("Uncompressed", func(t *testing.T) {
@@ -114,7 +114,7 @@ func validateStateHash(state *fast.VMState) error {
 func validateWitness(state *fast.VMState) error {
 	witnessLen := len(state.Witness)
 	if witnessLen != asteriscWitnessLen {
-		return fmt.Errorf("invalid witness: Length must be 362 but got %d", witnessLen)
+		return fmt.Errorf("invalid witness: Length must be 931 but got %d", witnessLen)
 	}
 	return nil
 }
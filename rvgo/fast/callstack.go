@@ -0,0 +1,87 @@
+package fast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCallDepth bounds a shadow call stack, the outermost calls are dropped beyond it
+const maxCallDepth = 4096
+
+// CallFrame is a call on a shadow call stack
+type CallFrame struct {
+	// Entry is the address of the called function
+	Entry uint64
+	// Return is the return address of the call, right after the call instruction
+	Return uint64
+}
+
+// CallStacks are the shadow call stacks of the threads of the VM, by thread ID.
+// They follow the calls and returns of the RISC-V calling convention:
+// a JAL or JALR that links ra (or t0) is a call, and a JALR to ra (or t0) that does not link is a return.
+// A return pops the call that it returns to, with the calls above it: stack switches, like those of goroutines,
+// leave the frames of the other stack in place until it returns to them.
+type CallStacks struct {
+	threads map[uint64][]CallFrame
+	// instructions is the number of instructions that ran
+	instructions uint64
+}
+
+func NewCallStacks() *CallStacks {
+	return &CallStacks{threads: make(map[uint64][]CallFrame)}
+}
+
+// Stack returns the call stack of a thread, outermost call first
+func (cs *CallStacks) Stack(threadID uint64) []CallFrame {
+	return cs.threads[threadID]
+}
+
+// Instructions returns the number of instructions that ran while the call stacks were tracked.
+// Steps that only switch threads or check a futex run no instruction.
+func (cs *CallStacks) Instructions() uint64 {
+	return cs.instructions
+}
+
+// isLink returns if the register is a link register: ra or t0
+func isLink(reg uint64) bool {
+	return reg == 1 || reg == 5
+}
+
+// jump updates the call stack of a thread on a JAL or JALR, rs1 is 0 for a JAL
+func (cs *CallStacks) jump(threadID uint64, rd uint64, rs1 uint64, target uint64, ret uint64) {
+	stack := cs.threads[threadID]
+	if isLink(rs1) && rd != rs1 {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].Return == target {
+				stack = stack[:i]
+				break
+			}
+		}
+	}
+	if isLink(rd) {
+		if len(stack) >= maxCallDepth {
+			stack = append(stack[:0], stack[1:]...)
+		}
+		stack = append(stack, CallFrame{Entry: target, Return: ret})
+	}
+	cs.threads[threadID] = stack
+}
+
+// CallStackError is a failed step, with the call stack of the thread that failed
+type CallStackError struct {
+	Err error
+	// Stack is the call stack, outermost call first
+	Stack []CallFrame
+}
+
+func (e *CallStackError) Error() string {
+	entries := make([]string, len(e.Stack))
+	for i, f := range e.Stack {
+		entries[i] = fmt.Sprintf("%#x", f.Entry)
+	}
+	return fmt.Sprintf("%v (call stack: %s)", e.Err, strings.Join(entries, " > "))
+}
+
+func (e *CallStackError) Unwrap() error {
+	return e.Err
+}
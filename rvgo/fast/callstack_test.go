@@ -0,0 +1,60 @@
+package fast
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestCallStacks(t *testing.T) {
+	a := riscv.NewAssembler(0x1000)
+	a.Call("f")
+	a.Call("fail")
+	a.Label("f")
+	a.Mv(riscv.RegS1, riscv.RegRA)
+	a.Call("g")
+	a.Mv(riscv.RegRA, riscv.RegS1)
+	a.Ret()
+	a.Label("g")
+	a.Jump("h") // tail call
+	a.Label("h")
+	a.Ret()
+	a.Label("fail")
+	a.Emit(0xffffffff)
+	addr := func(label string) uint64 {
+		v, ok := a.Addr(label)
+		require.True(t, ok)
+		return v
+	}
+
+	state := &VMState{PC: 0x1000, Memory: NewMemory(), ThreadID: 1, MemoryRegions: UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+	us := NewInstrumentedState(state, nil, nil, nil)
+	cs := NewCallStacks()
+	us.SetCallStacks(cs)
+
+	for state.PC != addr("h") {
+		_, err := us.Step(false)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []CallFrame{{Entry: addr("f"), Return: 0x1004}, {Entry: addr("g"), Return: addr("f") + 8}}, cs.Stack(1))
+
+	// h returns to f, and f to the first call
+	for state.PC != 0x1004 {
+		_, err := us.Step(false)
+		require.NoError(t, err)
+	}
+	require.Empty(t, cs.Stack(1))
+
+	_, err := us.Step(false)
+	require.NoError(t, err)
+	_, err = us.Step(false)
+	var stackErr *CallStackError
+	require.True(t, errors.As(err, &stackErr))
+	require.Equal(t, []CallFrame{{Entry: addr("fail"), Return: 0x1008}}, stackErr.Stack)
+	require.ErrorContains(t, err, "(call stack: 0x1020)")
+	require.Equal(t, uint64(9), cs.Instructions()) // including the failed instruction
+}
@@ -7,6 +7,17 @@ import (
 	"fmt"
 	"io"
 	"sort"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+const (
+	// GoArenaHintStart is the first address that the Go runtime hints for its heap arenas on riscv64
+	GoArenaHintStart = 0xc0_00_00_00_00
+	// HeapStart is the initial Heap, where mmap starts to allocate memory
+	HeapStart = 0x7f_00_00_00_00_00
+	// InitialSP is the stack pointer of the main thread that PatchVM sets up, the stack grows down from it
+	InitialSP = 0x10_00_00_00_00_00_00_00
 )
 
 func LoadELF(f *elf.File) (*VMState, error) {
@@ -20,12 +31,16 @@ func LoadELF(f *elf.File) (*VMState, error) {
 		// (c0 << 32) and range to 7f_00_00_00_00_00  (7f << 40) and specifies these with mmap hints.
 		// Go imposes no address space limits on riscv64 however (based on malloc.go heapAddrBits).
 		// So we grow the heap starting from this address, to not overlap with any hinted data
-		Heap: 0x7f_00_00_00_00_00,
+		Heap: HeapStart,
+		// the main thread, any threads created with clone get subsequent IDs
+		ThreadID:     1,
+		NextThreadID: 2,
 	}
 
 	// statically prepare VM state:
 	out.PC = f.Entry
 
+	var segments []MemoryRegion
 	for i, prog := range f.Progs {
 		//fmt.Printf("prog %d: paddr: %x range %016x - %016x  (mem %016x)  type: %s\n", i, prog.Paddr, prog.Vaddr, prog.Vaddr+prog.Memsz, prog.Memsz, prog.Type.String())
 		if prog.Type == 0x70000003 {
@@ -52,25 +67,92 @@ func LoadELF(f *elf.File) (*VMState, error) {
 		if err := out.Memory.SetMemoryRange(prog.Vaddr, r); err != nil {
 			return nil, fmt.Errorf("failed to read program segment %d: %w", i, err)
 		}
+
+		if prog.Type == elf.PT_LOAD && prog.Memsz != 0 {
+			segment, err := segmentRegion(prog)
+			if err != nil {
+				return nil, fmt.Errorf("program segment %d: %w", i, err)
+			}
+			segments = append(segments, segment)
+		}
+	}
+	if err := protectSegments(out, segments); err != nil {
+		return nil, err
 	}
 	return out, nil
 }
 
+// segmentRegion returns the pages of a loaded segment, with the permissions from the flags of the segment.
+// Segments that are both writable and executable are rejected.
+func segmentRegion(prog *elf.Prog) (MemoryRegion, error) {
+	var prot uint8
+	if prog.Flags&elf.PF_R != 0 {
+		prot |= riscv.ProtRead
+	}
+	if prog.Flags&elf.PF_W != 0 {
+		prot |= riscv.ProtWrite
+	}
+	if prog.Flags&elf.PF_X != 0 {
+		prot |= riscv.ProtExec
+	}
+	if prot&(riscv.ProtWrite|riscv.ProtExec) == riscv.ProtWrite|riscv.ProtExec {
+		return MemoryRegion{}, fmt.Errorf("segment is writable and executable (%s)", prog.Flags)
+	}
+	start := prog.Vaddr &^ PageAddrMask
+	end := (prog.Vaddr + prog.Memsz + PageAddrMask) &^ PageAddrMask
+	if end <= start {
+		return MemoryRegion{}, fmt.Errorf("segment range %016x - %016x overflows", prog.Vaddr, prog.Vaddr+prog.Memsz)
+	}
+	return MemoryRegion{Start: start, End: end, Prot: prot}, nil
+}
+
+// protectSegments sets a memory region for every segment with other permissions than riscv.ProtDefault,
+// from its flags. All other memory, like the data, the heap and the stack, needs no region.
+// Adjacent segments with the same permissions share a region. Segments with different permissions must not share a page.
+func protectSegments(state *VMState, segments []MemoryRegion) error {
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+	var merged []MemoryRegion
+	for _, s := range segments {
+		n := len(merged)
+		if n == 0 || merged[n-1].End < s.Start || (merged[n-1].End == s.Start && merged[n-1].Prot != s.Prot) {
+			merged = append(merged, s)
+			continue
+		}
+		if prev := merged[n-1]; prev.Prot != s.Prot {
+			return fmt.Errorf("segments %016x - %016x and %016x - %016x with different permissions share a page",
+				prev.Start, prev.End, s.Start, s.End)
+		}
+		merged[n-1].End = max(merged[n-1].End, s.End)
+	}
+	var regions []MemoryRegion
+	for _, r := range merged {
+		if r.Prot != riscv.ProtDefault {
+			regions = append(regions, r)
+		}
+	}
+	if len(regions) > riscv.MemoryRegionCount {
+		return fmt.Errorf("segments need %d memory regions, more than %d", len(regions), riscv.MemoryRegionCount)
+	}
+	state.MemoryRegions = [riscv.MemoryRegionCount]MemoryRegion{}
+	copy(state.MemoryRegions[:], regions)
+	return nil
+}
+
+// PatchVM patches out functions that cannot run in the VM, and sets up the initial stack.
+// The AT_RANDOM bytes are drawn from the PRNG, so vmState.RandomState must be set to the seed first.
 func PatchVM(f *elf.File, vmState *VMState) error {
 	symbols, err := f.Symbols()
 	if err != nil {
 		return fmt.Errorf("failed to read symbols data, cannot patch program: %w", err)
 	}
 	for _, s := range symbols {
-		// Disable Golang GC by patching the functions that enable the GC to a no-op function.
+		// Patch out functions that cannot run in the VM, by replacing them with a no-op function.
+		// The Go GC, sysmon and forcegchelper run as-is: the VM schedules the threads of the Go runtime.
 		switch s.Name {
-		case "runtime.gcenable",
-			"runtime.init.5",            // patch out: init() { go forcegchelper() }
-			"runtime.main.func1",        // patch out: main.func() { newm(sysmon, ....) }
-			"runtime.deductSweepCredit", // uses floating point nums and interacts with gc we disabled
-			"runtime.(*gcControllerState).commit",
-			// these prometheus packages rely on concurrent background things. We cannot run those.
-			"github.com/prometheus/client_golang/prometheus.init",
+		// these prometheus packages rely on concurrent background things. We cannot run those.
+		case "github.com/prometheus/client_golang/prometheus.init",
 			"github.com/prometheus/client_golang/prometheus.init.0",
 			"github.com/prometheus/procfs.init",
 			"github.com/prometheus/common/model.init",
@@ -78,9 +160,7 @@ func PatchVM(f *elf.File, vmState *VMState) error {
 			"github.com/prometheus/client_model/go.init.0",
 			"github.com/prometheus/client_model/go.init.1",
 			// skip flag pkg init, we need to debug arg-processing more to see why this fails
-			"flag.init",
-			// We need to patch this out, we don't pass float64nan because we don't support floats
-			"runtime.check":
+			"flag.init":
 			// RISCV patch: ret (pseudo instruction)
 			// 00008067 = jalr zero, ra, 0
 			// Jump And Link Register, but rd=zero so no linking, and thus only jumping to the return address.
@@ -88,11 +168,7 @@ func PatchVM(f *elf.File, vmState *VMState) error {
 			if err := vmState.Memory.SetMemoryRange(s.Value, bytes.NewReader([]byte{
 				0x67, 0x80, 0x00, 0x00,
 			})); err != nil {
-				return fmt.Errorf("failed to patch Go runtime.gcenable: %w", err)
-			}
-		case "runtime.MemProfileRate":
-			if err := vmState.Memory.SetMemoryRange(s.Value, bytes.NewReader(make([]byte, 8))); err != nil { // disable mem profiling, to avoid a lot of unnecessary floating point ops
-				return err
+				return fmt.Errorf("failed to patch %s: %w", s.Name, err)
 			}
 		}
 	}
@@ -103,7 +179,7 @@ func PatchVM(f *elf.File, vmState *VMState) error {
 	// now insert the initial stack
 
 	// setup stack pointer
-	sp := uint64(0x10_00_00_00_00_00_00_00)
+	sp := uint64(InitialSP)
 	vmState.Registers[2] = sp
 
 	storeMem := func(addr uint64, v uint64) {
@@ -112,17 +188,23 @@ func PatchVM(f *elf.File, vmState *VMState) error {
 		_ = vmState.Memory.SetMemoryRange(addr, bytes.NewReader(dat[:]))
 	}
 
+	// draw the AT_RANDOM bytes from the PRNG, getrandom continues with the values after these
+	nextRandom := func() uint64 {
+		vmState.RandomState = nextRandomState(vmState.RandomState)
+		return randomValue(vmState.RandomState)
+	}
+
 	// init argc, argv, aux on stack
-	storeMem(sp+8*1, 0x42)                // argc = 0 (argument count)
-	storeMem(sp+8*2, 0x35)                // argv[n] = 0 (terminating argv)
-	storeMem(sp+8*3, 0)                   // envp[term] = 0 (no env vars)
-	storeMem(sp+8*4, 6)                   // auxv[0] = _AT_PAGESZ = 6 (key)
-	storeMem(sp+8*5, 4096)                // auxv[1] = page size of 4 KiB (value) - (== minPhysPageSize)
-	storeMem(sp+8*6, 25)                  // auxv[2] = AT_RANDOM
-	storeMem(sp+8*7, sp+8*9)              // auxv[3] = address of 16 bytes containing random value
-	storeMem(sp+8*8, 0)                   // auxv[term] = 0
-	storeMem(sp+8*9, 0x6f727020646e6172)  // randomness 8/16
-	storeMem(sp+8*10, 0x6164626d616c6f74) // randomness 16/16
+	storeMem(sp+8*1, 0x42)          // argc = 0 (argument count)
+	storeMem(sp+8*2, 0x35)          // argv[n] = 0 (terminating argv)
+	storeMem(sp+8*3, 0)             // envp[term] = 0 (no env vars)
+	storeMem(sp+8*4, 6)             // auxv[0] = _AT_PAGESZ = 6 (key)
+	storeMem(sp+8*5, 4096)          // auxv[1] = page size of 4 KiB (value) - (== minPhysPageSize)
+	storeMem(sp+8*6, 25)            // auxv[2] = AT_RANDOM
+	storeMem(sp+8*7, sp+8*9)        // auxv[3] = address of 16 bytes containing random value
+	storeMem(sp+8*8, 0)             // auxv[term] = 0
+	storeMem(sp+8*9, nextRandom())  // randomness 8/16
+	storeMem(sp+8*10, nextRandom()) // randomness 16/16
 
 	// entrypoint is set as part of elf load function
 	return nil
@@ -0,0 +1,63 @@
+package fast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestProtectSegments(t *testing.T) {
+	const rx = riscv.ProtRead | riscv.ProtExec
+
+	t.Run("go binary", func(t *testing.T) {
+		state := &VMState{}
+		err := protectSegments(state, []MemoryRegion{
+			{Start: 0x10000, End: 0x90000, Prot: rx},
+			{Start: 0x90000, End: 0x120000, Prot: riscv.ProtRead},
+			{Start: 0x120000, End: 0x140000, Prot: riscv.ProtDefault},
+		})
+		require.NoError(t, err)
+		require.Equal(t, [riscv.MemoryRegionCount]MemoryRegion{
+			{Start: 0x10000, End: 0x90000, Prot: rx},
+			{Start: 0x90000, End: 0x120000, Prot: riscv.ProtRead},
+		}, state.MemoryRegions)
+		require.Equal(t, uint8(riscv.ProtDefault), state.ProtAt(0x130000))
+		require.Equal(t, uint8(riscv.ProtDefault), state.ProtAt(^uint64(0)))
+	})
+
+	t.Run("unsorted segments sharing a page", func(t *testing.T) {
+		state := &VMState{}
+		err := protectSegments(state, []MemoryRegion{
+			{Start: 0x3000, End: 0x5000, Prot: rx},
+			{Start: 0x2000, End: 0x4000, Prot: rx},
+		})
+		require.NoError(t, err)
+		require.Equal(t, [riscv.MemoryRegionCount]MemoryRegion{
+			{Start: 0x2000, End: 0x5000, Prot: rx},
+		}, state.MemoryRegions)
+	})
+
+	t.Run("different permissions sharing a page", func(t *testing.T) {
+		err := protectSegments(&VMState{}, []MemoryRegion{
+			{Start: 0x1000, End: 0x3000, Prot: rx},
+			{Start: 0x2000, End: 0x4000, Prot: riscv.ProtRead},
+		})
+		require.ErrorContains(t, err, "share a page")
+		err = protectSegments(&VMState{}, []MemoryRegion{
+			{Start: 0x1000, End: 0x3000, Prot: rx},
+			{Start: 0x2000, End: 0x4000, Prot: riscv.ProtDefault},
+		})
+		require.ErrorContains(t, err, "share a page")
+	})
+
+	t.Run("too many regions", func(t *testing.T) {
+		var segments []MemoryRegion
+		for i := uint64(0); i <= riscv.MemoryRegionCount; i++ {
+			segments = append(segments, MemoryRegion{Start: 0x2000 * (i + 1), End: 0x2000*(i+1) + 0x1000, Prot: rx})
+		}
+		err := protectSegments(&VMState{}, segments)
+		require.ErrorContains(t, err, "memory regions")
+	})
+}
@@ -0,0 +1,35 @@
+package fast
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// FreeRange is a page-aligned range of memory below the heap that was unmapped, and that mmap can allocate again.
+// A range with riscv.FreeRangeMapped set in its address is a mapped range instead: MAP_FIXED mapped it after the
+// free ranges below it on the stack were unmapped, and they may overlap it.
+type FreeRange struct {
+	Addr uint64 `json:"addr"`
+	Size uint64 `json:"size"`
+}
+
+const FREE_RANGE_WITNESS_SIZE = 16                         // FREE_RANGE_WITNESS_SIZE is the size of the free range witness encoding in bytes.
+const FREE_RANGE_PROOF_SIZE = FREE_RANGE_WITNESS_SIZE + 32 // free range witness, followed by the root of the free range stack below it
+
+func (r *FreeRange) EncodeWitness() []byte {
+	out := make([]byte, 0, FREE_RANGE_WITNESS_SIZE)
+	out = binary.BigEndian.AppendUint64(out, r.Addr)
+	out = binary.BigEndian.AppendUint64(out, r.Size)
+	return out
+}
+
+// freeRangeStackRoot computes the commitment to a stack of free ranges, ordered from bottom to top.
+// The empty stack is the zero hash, and pushing a range hashes the root with the hash of the range witness.
+func freeRangeStackRoot(ranges []FreeRange) (root common.Hash) {
+	for i := range ranges {
+		root = crypto.Keccak256Hash(root[:], crypto.Keccak256(ranges[i].EncodeWitness()))
+	}
+	return
+}
@@ -13,8 +13,15 @@ type PreimageOracle interface {
 
 const memProofSize = (64 - 5 + 1) * 32
 
+// MemoryTracer receives the memory accesses of the VM that have the required permission:
+// access is riscv.ProtRead for loads, riscv.ProtWrite for stores and riscv.ProtExec for instruction fetches.
+// Reads and writes of syscalls are included, except for the data that write copies out of the VM.
+type MemoryTracer func(addr uint64, size uint64, access uint8)
+
 type InstrumentedState struct {
 	state *VMState
+	// version selects the VM that runs the state, and the layout of its witness
+	version StateVersion
 
 	stdOut io.Writer
 	stdErr io.Writer
@@ -22,9 +29,27 @@ type InstrumentedState struct {
 	memProofEnabled bool
 	memProofs       [][memProofSize]byte
 	memAccess       []uint64
+	threadProof     []byte
+	freeRangeProof  []byte
 
 	preimageOracle PreimageOracle
 
+	// handles the ECALL instructions, the built-in syscalls if nil
+	syscallHandler SyscallHandler
+
+	// receives every syscall, if not nil
+	syscallTracer SyscallTracer
+	// receives every memory access, if not nil
+	memoryTracer MemoryTracer
+	// tracks the calls and returns of every thread, if not nil
+	callStacks *CallStacks
+	// counts the instructions, syscalls and memory accesses, if not nil
+	stats *Stats
+
+	// fail the step on syscalls that are ignored, unless allowed
+	strictSyscalls  bool
+	allowedSyscalls map[uint64]bool
+
 	// cached pre-image data, including 8 byte length prefix
 	lastPreimage []byte
 	// key for above preimage
@@ -33,34 +58,83 @@ type InstrumentedState struct {
 	lastPreimageOffset uint64
 }
 
+// NewInstrumentedState runs the state with the VM of the latest version, see VersionedState.CreateVM for the others
 func NewInstrumentedState(state *VMState, po PreimageOracle, stdOut, stdErr io.Writer) *InstrumentedState {
 	return &InstrumentedState{
 		state:          state,
+		version:        LatestStateVersion,
 		stdOut:         stdOut,
 		stdErr:         stdErr,
 		preimageOracle: po,
 	}
 }
 
+// SetSyscallHandler replaces the handling of ECALL instructions. A nil handler restores the DefaultSyscallHandler.
+func (m *InstrumentedState) SetSyscallHandler(h SyscallHandler) {
+	m.syscallHandler = h
+}
+
+// SetSyscallTracer traces every syscall that the VM runs, including those of a SyscallHandler.
+// A nil tracer disables tracing.
+func (m *InstrumentedState) SetSyscallTracer(t SyscallTracer) {
+	m.syscallTracer = t
+}
+
+// SetMemoryTracer traces every memory access of the VM. A nil tracer disables tracing.
+func (m *InstrumentedState) SetMemoryTracer(t MemoryTracer) {
+	m.memoryTracer = t
+}
+
+// SetCallStacks tracks the calls and returns of every thread in cs, and adds the call stack to the errors
+// of failed steps, see CallStackError. A nil cs disables tracking.
+func (m *InstrumentedState) SetCallStacks(cs *CallStacks) {
+	m.callStacks = cs
+}
+
+// SetStats counts the instructions, syscalls and memory accesses of the VM in st. A nil st disables counting.
+func (m *InstrumentedState) SetStats(st *Stats) {
+	m.stats = st
+}
+
+// SetStrictSyscalls makes a step fail with an UnsupportedSyscallErr on syscalls that the VM ignores (no-op),
+// instead of returning success. The allowed syscalls stay no-ops, see IgnoredSyscalls for those of op-program.
+// The state is left mid-step: it cannot be stepped further after such an error.
+func (m *InstrumentedState) SetStrictSyscalls(strict bool, allowed []uint64) {
+	m.strictSyscalls = strict
+	m.allowedSyscalls = make(map[uint64]bool, len(allowed))
+	for _, num := range allowed {
+		m.allowedSyscalls[num] = true
+	}
+}
+
 func (m *InstrumentedState) Step(proof bool) (wit *StepWitness, err error) {
 	m.memProofEnabled = proof
 	m.memAccess = m.memAccess[:0]
 	m.memProofs = m.memProofs[:0]
+	m.threadProof = nil
+	m.freeRangeProof = nil
 	m.lastPreimageOffset = ^uint64(0)
 
 	if proof {
 		wit = &StepWitness{
-			State: m.state.EncodeWitness(), // we need the pre-state as wit-ness
+			State: (&VersionedState{Version: m.version, VMState: m.state}).EncodeWitness(), // we need the pre-state as wit-ness
 		}
 	}
 
-	err = m.riscvStep()
+	switch m.version {
+	case StateVersionV1:
+		err = m.riscvStepV1()
+	default:
+		err = m.riscvStep()
+	}
 
 	if proof {
 		wit.MemProof = make([]byte, 0, len(m.memProofs)*memProofSize)
 		for i := range m.memProofs {
 			wit.MemProof = append(wit.MemProof, m.memProofs[i][:]...)
 		}
+		wit.ThreadProof = m.threadProof
+		wit.FreeRangeProof = m.freeRangeProof
 		if m.lastPreimageOffset != ^uint64(0) {
 			wit.PreimageOffset = m.lastPreimageOffset
 			wit.PreimageKey = m.lastPreimageKey
@@ -119,6 +193,32 @@ func (m *InstrumentedState) verifyMemChange(effAddr uint64, proofIndex uint8) {
 	}
 }
 
+// trackThreadPop remembers the witness of a thread that is popped from a thread stack to run next,
+// together with the root of the remaining threads on the stack.
+func (m *InstrumentedState) trackThreadPop(t *ThreadState, stack []ThreadState) {
+	if !m.memProofEnabled {
+		return
+	}
+	if m.threadProof != nil {
+		panic("cannot pop more than one thread per step")
+	}
+	root := threadStackRoot(stack)
+	m.threadProof = append(t.EncodeWitness(), root[:]...)
+}
+
+// trackFreeRangePop remembers the witness of a free range that is popped from the free range stack,
+// together with the root of the remaining ranges on the stack. A step pops at most two free ranges.
+func (m *InstrumentedState) trackFreeRangePop(r *FreeRange, stack []FreeRange) {
+	if !m.memProofEnabled {
+		return
+	}
+	if len(m.freeRangeProof) >= 2*FREE_RANGE_PROOF_SIZE {
+		panic("cannot pop more than two free ranges per step")
+	}
+	root := freeRangeStackRoot(stack)
+	m.freeRangeProof = append(append(m.freeRangeProof, r.EncodeWitness()...), root[:]...)
+}
+
 func (m *InstrumentedState) LastPreimage() ([32]byte, []byte, uint64) {
 	return m.lastPreimageKey, m.lastPreimage, m.lastPreimageOffset
 }
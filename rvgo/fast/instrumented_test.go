@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
 )
 
 type MockPreimageOracle struct {
@@ -41,3 +43,37 @@ func TestReadPreimage(t *testing.T) {
 	_, err := instState.Step(true)
 	require.NoError(t, err)
 }
+
+func TestMemoryTracer(t *testing.T) {
+	type access struct {
+		addr, size uint64
+		prot       uint8
+	}
+	// read 8 bytes of the random seed into the buffer at 0x2010
+	state := newSyscallState(riscv.SysGetRandom, 0x2010, 8)
+	var accesses []access
+	inst := NewInstrumentedState(state, nil, nil, nil)
+	inst.SetMemoryTracer(func(addr, size uint64, prot uint8) {
+		accesses = append(accesses, access{addr, size, prot})
+	})
+	_, err := inst.Step(false)
+	require.NoError(t, err)
+	require.Equal(t, []access{
+		{0x100, 4, riscv.ProtExec},
+		{0x2010, 8, riscv.ProtWrite},
+	}, accesses)
+}
+
+func TestRevertDisassembly(t *testing.T) {
+	state := &VMState{PC: 0x100, Memory: NewMemory(), MemoryRegions: UnprotectedRegions()}
+	state.Memory.SetUnaligned(0x100, []byte{0x2f, 0x35, 0xb6, 0x28}) // amoadd.d with an unknown funct5
+	state.Memory.SetUnaligned(0x104, []byte{0x2f, 0x35, 0xb6, 0x00}) // amoadd.d a0, a1, (a2)
+	inst := NewInstrumentedState(state, nil, nil, nil)
+	_, err := inst.Step(false)
+	require.ErrorContains(t, err, "revert at pc 0000000000000100 (.4byte 0x28b6352f): unknown atomic operation 5")
+
+	state.PC = 0x104
+	state.Registers[12] = 1 // misaligned
+	_, err = inst.Step(false)
+	require.ErrorContains(t, err, "revert at pc 0000000000000104 (amoadd.d a0, a1, (a2)): addr 1 not aligned with 4 bytes")
+}
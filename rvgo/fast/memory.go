@@ -41,8 +41,7 @@ type Memory struct {
 	radix         *L1
 	branchFactors [6]uint64
 
-	// Note: since we don't de-alloc pages, we don't do ref-counting.
-	// Once a page exists, it doesn't leave memory
+	// Pages are allocated just in time, and only leave memory when they are unmapped, see FreePage.
 	pages map[uint64]*CachedPage
 
 	// two caches: we often read instructions from one page, and do memory things with another page.
@@ -95,6 +94,37 @@ func (m *Memory) pageLookup(pageIndex uint64) (*CachedPage, bool) {
 	return p, ok
 }
 
+// FreePage removes the page with the given index from memory, if it exists.
+// The page then reads as zeroes, and no longer takes up space: its part of the merkle tree is a zero-hash.
+func (m *Memory) FreePage(pageIndex uint64) {
+	if _, ok := m.pages[pageIndex]; !ok {
+		return
+	}
+	delete(m.pages, pageIndex)
+	for i := range m.lastPageKeys {
+		if m.lastPageKeys[i] == pageIndex {
+			m.lastPageKeys[i] = ^uint64(0)
+			m.lastPage[i] = nil
+		}
+	}
+	m.invalidateRadixPath(pageIndex << PageAddrSize)
+}
+
+// FreePages removes the count pages from the given page index on from memory, see FreePage.
+func (m *Memory) FreePages(pageIndex uint64, count uint64) {
+	if count > uint64(len(m.pages)) {
+		for i := range m.pages {
+			if i-pageIndex < count {
+				m.FreePage(i)
+			}
+		}
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		m.FreePage(pageIndex + i)
+	}
+}
+
 func (m *Memory) SetUnaligned(addr uint64, dat []byte) {
 	if len(dat) > 32 {
 		panic("cannot set more than 32 bytes")
@@ -309,8 +339,18 @@ func (m *Memory) ReadMemoryRange(addr uint64, count uint64) io.Reader {
 	return &memReader{m: m, addr: addr, count: count}
 }
 
+// HasPage returns whether the page is allocated
+func (m *Memory) HasPage(pageIndex uint64) bool {
+	_, ok := m.pageLookup(pageIndex)
+	return ok
+}
+
 func (m *Memory) Usage() string {
-	total := uint64(len(m.pages)) * PageSize
+	return FormatSize(uint64(len(m.pages)) * PageSize)
+}
+
+// FormatSize formats a number of bytes with a binary unit, like 1.5 MiB
+func FormatSize(total uint64) string {
 	const unit = 1024
 	if total < unit {
 		return fmt.Sprintf("%d B", total)
@@ -335,6 +335,47 @@ func TestMemoryMerkleRoot(t *testing.T) {
 	})
 }
 
+func TestMemoryFreePage(t *testing.T) {
+	t.Run("only page", func(t *testing.T) {
+		m := NewMemory()
+		m.SetUnaligned(0xF004, []byte{1})
+		require.NotEqual(t, zeroHashes[64-5], m.MerkleRoot(), "non-zero")
+		m.FreePage(0xF)
+		require.Equal(t, 0, m.PageCount())
+		require.Equal(t, zeroHashes[64-5], m.MerkleRoot(), "zero after the page is freed")
+		var dat [4]byte
+		m.GetUnaligned(0xF004, dat[:])
+		require.Equal(t, [4]byte{}, dat, "freed page reads as zeroes")
+	})
+	t.Run("other pages remain", func(t *testing.T) {
+		m := NewMemory()
+		m.SetUnaligned(PageSize*3, []byte{1})
+		expected := m.MerkleRoot()
+		m.SetUnaligned(PageSize*5, []byte{42})
+		_ = m.MerkleRoot() // cache the hashes, to check they are invalidated
+		m.FreePage(5)
+		require.Equal(t, 1, m.PageCount())
+		require.Equal(t, expected, m.MerkleRoot())
+	})
+	t.Run("missing page", func(t *testing.T) {
+		m := NewMemory()
+		m.SetUnaligned(PageSize*3, []byte{1})
+		expected := m.MerkleRoot()
+		m.FreePage(4)
+		require.Equal(t, 1, m.PageCount())
+		require.Equal(t, expected, m.MerkleRoot())
+	})
+	t.Run("write after free", func(t *testing.T) {
+		m := NewMemory()
+		m.SetUnaligned(PageSize*5, []byte{42})
+		m.FreePage(5)
+		m.SetUnaligned(PageSize*5+1, []byte{7})
+		var dat [2]byte
+		m.GetUnaligned(PageSize*5, dat[:])
+		require.Equal(t, [2]byte{0, 7}, dat, "page is allocated again with zeroes")
+	})
+}
+
 func TestMemoryReadWrite(t *testing.T) {
 	t.Run("large random", func(t *testing.T) {
 		m := NewMemory()
@@ -293,7 +293,7 @@ func (m *Memory) MerkleizeNode(addr, gindex uint64) [32]byte {
 	if p, ok := m.pages[pageIndex]; ok {
 		return p.MerkleRoot()
 	} else {
-		return zeroHashes[64-5+1-(depth-1+52)]
+		return zeroHashes[64-5+1-(depth+52)] // a page of zeroes
 	}
 }
 
@@ -427,7 +427,11 @@ func (m *Memory) Invalidate(addr uint64) {
 	} else {
 		return
 	}
+	m.invalidateRadixPath(addr)
+}
 
+// invalidateRadixPath invalidates the cached hashes of the radix trie nodes along the path to the specified address.
+func (m *Memory) invalidateRadixPath(addr uint64) {
 	branchPaths := m.addressToRadixPaths(addr)
 
 	currentLevel1 := m.radix
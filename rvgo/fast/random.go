@@ -0,0 +1,18 @@
+package fast
+
+import "github.com/ethereum-optimism/asterisc/rvgo/riscv"
+
+// Functions of the SplitMix64 PRNG, that getrandom and AT_RANDOM draw from.
+// These should 1:1 match with the same definitions in the slow package.
+
+// nextRandomState advances the PRNG state, to draw the next value
+func nextRandomState(state U64) U64 {
+	return add64(state, riscv.RandomGamma)
+}
+
+// randomValue mixes the PRNG state into a pseudo-random value
+func randomValue(state U64) U64 {
+	z := mul64(xor64(state, shr64(byteToU64(30), state)), riscv.RandomMix1)
+	z = mul64(xor64(z, shr64(byteToU64(27), z)), riscv.RandomMix2)
+	return xor64(z, shr64(byteToU64(31), z))
+}
@@ -0,0 +1,43 @@
+package fast
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// MemoryRegion is a page-aligned range of memory [Start, End) with the permissions Prot,
+// a combination of riscv.ProtRead, riscv.ProtWrite and riscv.ProtExec.
+// Memory outside any region is readable and writable, with riscv.ProtDefault. A region with Start == End is unused.
+type MemoryRegion struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	Prot  uint8  `json:"prot"`
+}
+
+const MEMORY_REGION_WITNESS_SIZE = 8 + 8 + 1 // MEMORY_REGION_WITNESS_SIZE is the size of the memory region witness encoding in bytes.
+
+func (r *MemoryRegion) EncodeWitness() []byte {
+	out := make([]byte, 0, MEMORY_REGION_WITNESS_SIZE)
+	out = binary.BigEndian.AppendUint64(out, r.Start)
+	out = binary.BigEndian.AppendUint64(out, r.End)
+	out = append(out, r.Prot)
+	return out
+}
+
+// UnprotectedRegions returns the memory regions of a state without memory protection, as of StateVersionV1:
+// one region gives all memory all permissions, except the last page, which the exclusive end of a region cannot include.
+func UnprotectedRegions() (out [riscv.MemoryRegionCount]MemoryRegion) {
+	out[0] = MemoryRegion{Start: 0, End: ^uint64(0) &^ PageAddrMask, Prot: riscv.ProtAll}
+	return out
+}
+
+// ProtAt returns the permissions of the memory at the given address.
+func (state *VMState) ProtAt(addr uint64) uint8 {
+	for i := range state.MemoryRegions {
+		if r := &state.MemoryRegions[i]; r.Start <= addr && addr < r.End {
+			return r.Prot
+		}
+	}
+	return riscv.ProtDefault
+}
@@ -0,0 +1,675 @@
+package fast
+
+// Functions to emulate the F and D floating point extensions, with IEEE-754 arithmetic in software.
+// Floating point values are represented by their raw bits, and all computations are done with integer math,
+// so results are bit-exact and deterministic regardless of the host.
+// The format argument d is 0 for single precision, and 1 for double precision.
+// These should 1:1 match with the same definitions in the slow package.
+//
+// Exception flags, as accrued in fflags:
+//   0x10 = NV (invalid operation), 0x08 = DZ (divide by zero), 0x04 = OF (overflow),
+//   0x02 = UF (underflow), 0x01 = NX (inexact)
+// Rounding modes:
+//   0 = RNE (to nearest, ties to even), 1 = RTZ (towards zero), 2 = RDN (down), 3 = RUP (up),
+//   4 = RMM (to nearest, ties to max magnitude)
+//
+// Finite non-zero values are unpacked to a sign, an unbiased exponent e and a significand sig,
+// such that the value is sig * 2**(e-62), with the leading significand bit at bit 62.
+// Intermediate results of up to 256 bits are represented as sig * 2**(e-124).
+
+func fpFracBits(d U64) U64 {
+	switch d {
+	case 0:
+		return byteToU64(23)
+	default:
+		return byteToU64(52)
+	}
+}
+
+func fpExpMask(d U64) U64 {
+	switch d {
+	case 0:
+		return byteToU64(0xff)
+	default:
+		return shortToU64(0x7ff)
+	}
+}
+
+func fpBias(d U64) U64 {
+	switch d {
+	case 0:
+		return byteToU64(127)
+	default:
+		return shortToU64(1023)
+	}
+}
+
+func fpSignShift(d U64) U64 {
+	switch d {
+	case 0:
+		return byteToU64(31)
+	default:
+		return byteToU64(63)
+	}
+}
+
+func fpCanonicalNaN(d U64) U64 {
+	return or64(shl64(fpFracBits(d), fpExpMask(d)), shl64(sub64(fpFracBits(d), byteToU64(1)), byteToU64(1)))
+}
+
+func fpInf(sign U64, d U64) U64 {
+	return or64(shl64(fpSignShift(d), sign), shl64(fpFracBits(d), fpExpMask(d)))
+}
+
+func fpZero(sign U64, d U64) U64 {
+	return shl64(fpSignShift(d), sign)
+}
+
+// fpBox NaN-boxes a single precision value, to store it in a 64 bit floating point register
+func fpBox(v U64, d U64) U64 {
+	switch d {
+	case 0:
+		return or64(v, shl64(byteToU64(32), u32Mask()))
+	default:
+		return v
+	}
+}
+
+// fpUnbox reads a value of the given format from a 64 bit floating point register.
+// Single precision values that are not properly NaN-boxed are read as the canonical NaN.
+func fpUnbox(v U64, d U64) U64 {
+	switch d {
+	case 0:
+		if eq64(shr64(byteToU64(32), v), u32Mask()) == 0 {
+			return fpCanonicalNaN(d)
+		}
+		return and64(v, u32Mask())
+	default:
+		return v
+	}
+}
+
+func fpSign(v U64, d U64) U64 {
+	return and64(shr64(fpSignShift(d), v), byteToU64(1))
+}
+
+func fpExp(v U64, d U64) U64 {
+	return and64(shr64(fpFracBits(d), v), fpExpMask(d))
+}
+
+func fpFrac(v U64, d U64) U64 {
+	return and64(v, sub64(shl64(fpFracBits(d), byteToU64(1)), byteToU64(1)))
+}
+
+func fpIsNaN(v U64, d U64) U64 {
+	return and64(eq64(fpExp(v, d), fpExpMask(d)), gt64(fpFrac(v, d), byteToU64(0)))
+}
+
+func fpIsSNaN(v U64, d U64) U64 {
+	// signaling NaNs have the most significant fraction bit unset
+	return and64(fpIsNaN(v, d), iszero64U(shr64(sub64(fpFracBits(d), byteToU64(1)), fpFrac(v, d))))
+}
+
+func fpIsInf(v U64, d U64) U64 {
+	return and64(eq64(fpExp(v, d), fpExpMask(d)), eq64(fpFrac(v, d), byteToU64(0)))
+}
+
+func fpIsZero(v U64, d U64) U64 {
+	return eq64(and64(v, not64(shl64(fpSignShift(d), byteToU64(1)))), byteToU64(0))
+}
+
+// fpInvalidIfSNaN returns the invalid-operation flag if any of the given values is a signaling NaN
+func fpInvalidIfSNaN(x U64, y U64, d U64) U64 {
+	return shl64(byteToU64(4), or64(fpIsSNaN(x, d), fpIsSNaN(y, d)))
+}
+
+func iszero64U(v U64) U64 {
+	return eq64(v, byteToU64(0))
+}
+
+// msb64 returns the index of the most significant set bit of a non-zero value
+func msb64(x U64) (n U64) {
+	for i := uint8(32); i > 0; i = i >> 1 {
+		if shr64(byteToU64(i), x) != 0 {
+			x = shr64(byteToU64(i), x)
+			n = add64(n, byteToU64(i))
+		}
+	}
+	return
+}
+
+// msb256 returns the index of the most significant set bit of a non-zero value
+func msb256(x U256) (n U64) {
+	for i := uint8(128); i > 0; i = i >> 1 {
+		if !iszero(shr(byteToU256(i), x)) {
+			x = shr(byteToU256(i), x)
+			n = add64(n, byteToU64(i))
+		}
+	}
+	return
+}
+
+// shiftRightJam64 shifts x right by n bits, and sets the lowest bit if any of the shifted out bits were set
+func shiftRightJam64(x U64, n U64) (out U64) {
+	switch lt64(n, byteToU64(64)) {
+	case 0:
+		out = gt64(x, byteToU64(0))
+	default:
+		out = or64(shr64(n, x), gt64(shl64(sub64(byteToU64(64), n), x), byteToU64(0)))
+	}
+	return
+}
+
+// shiftRightJam256 shifts x right by n bits, and sets the lowest bit if any of the shifted out bits were set
+func shiftRightJam256(x U256, n U64) (out U256) {
+	switch lt64(n, shortToU64(256)) {
+	case 0:
+		out = gt(x, byteToU256(0))
+	default:
+		out = or(shr(u64ToU256(n), x), gt(shl(u64ToU256(sub64(shortToU64(256), n)), x), byteToU256(0)))
+	}
+	return
+}
+
+// fpUnpack returns the exponent and significand of a finite non-zero value, normalized to a leading bit at bit 62
+func fpUnpack(v U64, d U64) (e U64, sig U64) {
+	sig = fpFrac(v, d)
+	switch fpExp(v, d) {
+	case 0: // subnormal
+		e = sub64(byteToU64(1), fpBias(d))
+	default:
+		e = sub64(fpExp(v, d), fpBias(d))
+		sig = or64(sig, shl64(fpFracBits(d), byteToU64(1)))
+	}
+	n := msb64(sig)
+	e = sub64(add64(e, n), fpFracBits(d))
+	sig = shl64(sub64(byteToU64(62), n), sig)
+	return
+}
+
+// fpRoundIncrement returns what to add to a value before truncating the bits in mask, to round it
+func fpRoundIncrement(rm U64, sign U64, mask U64) (inc U64) {
+	switch rm {
+	case 0: // RNE
+		inc = add64(shr64(byteToU64(1), mask), byteToU64(1))
+	case 2: // RDN
+		if sign != 0 {
+			inc = mask
+		}
+	case 3: // RUP
+		if sign == 0 {
+			inc = mask
+		}
+	case 4: // RMM
+		inc = add64(shr64(byteToU64(1), mask), byteToU64(1))
+	}
+	return
+}
+
+// fpRoundShift shifts sig right by n bits (1 <= n <= 63, sig < 2**63), rounding the result with the given rounding mode.
+// The inexact flag is returned if any of the shifted out bits were set.
+func fpRoundShift(sig U64, n U64, rm U64, sign U64) (out U64, inexact U64) {
+	mask := sub64(shl64(n, byteToU64(1)), byteToU64(1))
+	out = shr64(n, add64(sig, fpRoundIncrement(rm, sign, mask)))
+	if and64(iszero64U(rm), eq64(and64(sig, mask), add64(shr64(byteToU64(1), mask), byteToU64(1)))) != 0 {
+		out = and64(out, not64(byteToU64(1))) // ties to even
+	}
+	inexact = gt64(and64(sig, mask), byteToU64(0))
+	return
+}
+
+// fpRoundsToMax returns 1 if an overflow rounds to the largest finite number instead of infinity
+func fpRoundsToMax(rm U64, sign U64) (out U64) {
+	switch rm {
+	case 1: // RTZ
+		out = byteToU64(1)
+	case 2: // RDN
+		out = iszero64U(sign)
+	case 3: // RUP
+		out = sign
+	}
+	return
+}
+
+// fpTiny returns the underflow flag if a subnormal result is tiny:
+// tininess is detected after rounding, as if the exponent range was unbounded.
+// exp is the biased exponent minus one, and negative for subnormal results.
+func fpTiny(sign U64, exp U64, sig U64, rm U64, d U64) U64 {
+	if slt64(exp, u64Mask()) != 0 { // more than one binade below the normal range
+		return byteToU64(2)
+	}
+	inc := fpRoundIncrement(rm, sign, sub64(shl64(sub64(byteToU64(62), fpFracBits(d)), byteToU64(1)), byteToU64(1)))
+	return shl64(byteToU64(1), lt64(add64(sig, inc), shl64(byteToU64(63), byteToU64(1))))
+}
+
+// fpRoundPack rounds the value sig * 2**(e-62), with the leading significand bit at bit 62, to the given format
+func fpRoundPack(sign U64, e U64, sig U64, rm U64, d U64) (out U64, flags U64) {
+	// the biased exponent, minus one: the leading significand bit is added to the exponent field when packing
+	exp := sub64(add64(e, fpBias(d)), byteToU64(1))
+	if slt64(exp, byteToU64(0)) != 0 { // subnormal
+		flags = fpTiny(sign, exp, sig, rm, d)
+		sig = shiftRightJam64(sig, sub64(byteToU64(0), exp))
+		exp = byteToU64(0)
+	}
+	sig, inexact := fpRoundShift(sig, sub64(byteToU64(62), fpFracBits(d)), rm, sign)
+	if inexact == 0 { // underflow is only signaled if the result is also inexact
+		flags = byteToU64(0)
+	}
+	flags = or64(flags, inexact)
+	out = add64(shl64(fpFracBits(d), exp), sig)
+	if gt64(shr64(fpFracBits(d), out), sub64(fpExpMask(d), byteToU64(1))) != 0 { // overflow
+		flags = byteToU64(0x05) // OF | NX
+		out = sub64(fpInf(byteToU64(0), d), fpRoundsToMax(rm, sign))
+	}
+	out = or64(out, fpZero(sign, d))
+	return
+}
+
+// fpRoundPack256 rounds the non-zero value sig * 2**(e-124) to the given format
+func fpRoundPack256(sign U64, e U64, sig U256, rm U64, d U64) (out U64, flags U64) {
+	n := msb256(sig)
+	e = sub64(add64(e, n), byteToU64(124))
+	switch gt64(n, byteToU64(62)) {
+	case 0:
+		sig = shl(u64ToU256(sub64(byteToU64(62), n)), sig)
+	default:
+		sig = shiftRightJam256(sig, sub64(n, byteToU64(62)))
+	}
+	return fpRoundPack(sign, e, u256ToU64(sig), rm, d)
+}
+
+// fpAddSig adds the non-zero values sig * 2**(e-124) and z with the given sign, and rounds the result
+func fpAddSig(sign U64, e U64, sig U256, z U64, rm U64, d U64) (out U64, flags U64) {
+	eZ, sigZ64 := fpUnpack(z, d)
+	sigZ := shl(byteToU256(62), u64ToU256(sigZ64))
+	// align the value with the smallest exponent to the other value
+	switch slt64(e, eZ) {
+	case 0:
+		sigZ = shiftRightJam256(sigZ, sub64(e, eZ))
+	default:
+		sig = shiftRightJam256(sig, sub64(eZ, e))
+		e = eZ
+	}
+	switch eq64(sign, fpSign(z, d)) {
+	case 1:
+		sig = add(sig, sigZ)
+	default:
+		switch u256ToU64(lt(sig, sigZ)) {
+		case 0:
+			sig = sub(sig, sigZ)
+		default:
+			sign = fpSign(z, d)
+			sig = sub(sigZ, sig)
+		}
+	}
+	if iszero(sig) { // exact zero: negative only when rounding down
+		return fpZero(eq64(rm, byteToU64(2)), d), byteToU64(0)
+	}
+	return fpRoundPack256(sign, e, sig, rm, d)
+}
+
+// fpAdd returns x + y
+func fpAdd(x U64, y U64, rm U64, d U64) (out U64, flags U64) {
+	if or64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		return fpCanonicalNaN(d), fpInvalidIfSNaN(x, y, d)
+	}
+	if fpIsInf(x, d) != 0 {
+		if and64(fpIsInf(y, d), xor64(fpSign(x, d), fpSign(y, d))) != 0 { // inf - inf
+			return fpCanonicalNaN(d), byteToU64(0x10)
+		}
+		return x, byteToU64(0)
+	}
+	if fpIsInf(y, d) != 0 {
+		return y, byteToU64(0)
+	}
+	if fpIsZero(x, d) != 0 {
+		if and64(fpIsZero(y, d), xor64(fpSign(x, d), fpSign(y, d))) != 0 { // zeroes of opposite sign
+			return fpZero(eq64(rm, byteToU64(2)), d), byteToU64(0)
+		}
+		return y, byteToU64(0)
+	}
+	if fpIsZero(y, d) != 0 {
+		return x, byteToU64(0)
+	}
+	e, sig := fpUnpack(x, d)
+	return fpAddSig(fpSign(x, d), e, shl(byteToU256(62), u64ToU256(sig)), y, rm, d)
+}
+
+// fpMulSig returns the exact product of the finite non-zero values x and y, as sig * 2**(e-124)
+func fpMulSig(x U64, y U64, d U64) (e U64, sig U256) {
+	eX, sigX := fpUnpack(x, d)
+	eY, sigY := fpUnpack(y, d)
+	return add64(eX, eY), mul(u64ToU256(sigX), u64ToU256(sigY))
+}
+
+// fpMul returns x * y
+func fpMul(x U64, y U64, rm U64, d U64) (out U64, flags U64) {
+	if or64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		return fpCanonicalNaN(d), fpInvalidIfSNaN(x, y, d)
+	}
+	sign := xor64(fpSign(x, d), fpSign(y, d))
+	if or64(fpIsInf(x, d), fpIsInf(y, d)) != 0 {
+		if or64(fpIsZero(x, d), fpIsZero(y, d)) != 0 { // inf * 0
+			return fpCanonicalNaN(d), byteToU64(0x10)
+		}
+		return fpInf(sign, d), byteToU64(0)
+	}
+	if or64(fpIsZero(x, d), fpIsZero(y, d)) != 0 {
+		return fpZero(sign, d), byteToU64(0)
+	}
+	e, sig := fpMulSig(x, y, d)
+	return fpRoundPack256(sign, e, sig, rm, d)
+}
+
+// fpDivSig returns the quotient of the finite non-zero values x and y, as sig * 2**(e-124).
+// The quotient has at least 123 bits, and the lowest bit is set if the division is inexact.
+func fpDivSig(x U64, y U64, d U64) (e U64, sig U256) {
+	eX, sigX := fpUnpack(x, d)
+	eY, sigY := fpUnpack(y, d)
+	num := shl(byteToU256(124), u64ToU256(sigX))
+	sig = or(div(num, u64ToU256(sigY)), gt(mod(num, u64ToU256(sigY)), byteToU256(0)))
+	return sub64(eX, eY), sig
+}
+
+// fpDiv returns x / y
+func fpDiv(x U64, y U64, rm U64, d U64) (out U64, flags U64) {
+	if or64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		return fpCanonicalNaN(d), fpInvalidIfSNaN(x, y, d)
+	}
+	sign := xor64(fpSign(x, d), fpSign(y, d))
+	if fpIsInf(x, d) != 0 {
+		if fpIsInf(y, d) != 0 { // inf / inf
+			return fpCanonicalNaN(d), byteToU64(0x10)
+		}
+		return fpInf(sign, d), byteToU64(0)
+	}
+	if fpIsInf(y, d) != 0 {
+		return fpZero(sign, d), byteToU64(0)
+	}
+	if fpIsZero(y, d) != 0 {
+		if fpIsZero(x, d) != 0 { // 0 / 0
+			return fpCanonicalNaN(d), byteToU64(0x10)
+		}
+		return fpInf(sign, d), byteToU64(0x08)
+	}
+	if fpIsZero(x, d) != 0 {
+		return fpZero(sign, d), byteToU64(0)
+	}
+	e, sig := fpDivSig(x, y, d)
+	return fpRoundPack256(sign, e, sig, rm, d)
+}
+
+// isqrt256 returns the integer square root of x < 2**252, with the lowest bit set if the root is inexact
+func isqrt256(x U256) (out U256) {
+	for i := uint8(126); i > 0; i-- {
+		t := or(out, shl(byteToU256(i-1), byteToU256(1)))
+		if iszero(gt(mul(t, t), x)) {
+			out = t
+		}
+	}
+	out = or(out, gt(sub(x, mul(out, out)), byteToU256(0)))
+	return
+}
+
+// fpSqrt returns the square root of x
+func fpSqrt(x U64, rm U64, d U64) (out U64, flags U64) {
+	if fpIsNaN(x, d) != 0 {
+		return fpCanonicalNaN(d), fpInvalidIfSNaN(x, x, d)
+	}
+	if fpIsZero(x, d) != 0 {
+		return x, byteToU64(0)
+	}
+	if fpSign(x, d) != 0 { // negative, including -inf
+		return fpCanonicalNaN(d), byteToU64(0x10)
+	}
+	if fpIsInf(x, d) != 0 {
+		return x, byteToU64(0)
+	}
+	e, sig := fpUnpack(x, d)
+	// scale the significand such that the remaining exponent is even, and the root has its leading bit at bit 124
+	shift := add64(byteToU64(186), and64(e, byteToU64(1)))
+	e = add64(byteToU64(124), sar64(byteToU64(1), sub64(sub64(e, byteToU64(62)), shift)))
+	return fpRoundPack256(byteToU64(0), e, isqrt256(shl(u64ToU256(shift), u64ToU256(sig))), rm, d)
+}
+
+// fpMulAdd returns x * y + z, with a single rounding.
+// The negated variants are computed by flipping the sign of x and/or z.
+func fpMulAdd(x U64, y U64, z U64, rm U64, d U64) (out U64, flags U64) {
+	if or64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		return fpCanonicalNaN(d), or64(fpInvalidIfSNaN(x, y, d), fpInvalidIfSNaN(z, z, d))
+	}
+	if or64(and64(fpIsInf(x, d), fpIsZero(y, d)), and64(fpIsZero(x, d), fpIsInf(y, d))) != 0 { // inf * 0
+		return fpCanonicalNaN(d), byteToU64(0x10)
+	}
+	if fpIsNaN(z, d) != 0 {
+		return fpCanonicalNaN(d), fpInvalidIfSNaN(z, z, d)
+	}
+	sign := xor64(fpSign(x, d), fpSign(y, d))
+	if or64(fpIsInf(x, d), fpIsInf(y, d)) != 0 {
+		if and64(fpIsInf(z, d), xor64(sign, fpSign(z, d))) != 0 { // inf - inf
+			return fpCanonicalNaN(d), byteToU64(0x10)
+		}
+		return fpInf(sign, d), byteToU64(0)
+	}
+	if fpIsInf(z, d) != 0 {
+		return z, byteToU64(0)
+	}
+	if or64(fpIsZero(x, d), fpIsZero(y, d)) != 0 {
+		if and64(fpIsZero(z, d), xor64(sign, fpSign(z, d))) != 0 { // zeroes of opposite sign
+			return fpZero(eq64(rm, byteToU64(2)), d), byteToU64(0)
+		}
+		return z, byteToU64(0)
+	}
+	e, sig := fpMulSig(x, y, d)
+	if fpIsZero(z, d) != 0 {
+		return fpRoundPack256(sign, e, sig, rm, d)
+	}
+	return fpAddSig(sign, e, sig, z, rm, d)
+}
+
+// fpLess returns 1 if x < y, for non-NaN values. If orderZeroes is set, -0 is considered less than +0.
+func fpLess(x U64, y U64, orderZeroes U64, d U64) U64 {
+	if and64(fpIsZero(x, d), fpIsZero(y, d)) != 0 {
+		return and64(orderZeroes, gt64(fpSign(x, d), fpSign(y, d)))
+	}
+	if xor64(fpSign(x, d), fpSign(y, d)) != 0 {
+		return fpSign(x, d)
+	}
+	switch fpSign(x, d) {
+	case 0:
+		return lt64(x, y)
+	default:
+		return gt64(x, y)
+	}
+}
+
+// fpMinMax returns the minimum of x and y, or the maximum if takeMax is set
+func fpMinMax(x U64, y U64, takeMax U64, d U64) (out U64, flags U64) {
+	flags = fpInvalidIfSNaN(x, y, d)
+	if and64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		return fpCanonicalNaN(d), flags
+	}
+	if fpIsNaN(x, d) != 0 {
+		return y, flags
+	}
+	if fpIsNaN(y, d) != 0 {
+		return x, flags
+	}
+	if eq64(fpLess(x, y, byteToU64(1), d), takeMax) != 0 {
+		return y, flags
+	}
+	return x, flags
+}
+
+// fpCompare returns the result of x == y (op 2), x < y (op 1) or x <= y (op 0).
+// Equality is a quiet comparison, the other comparisons signal an invalid operation on any NaN input.
+func fpCompare(x U64, y U64, op U64, d U64) (out U64, flags U64) {
+	if or64(fpIsNaN(x, d), fpIsNaN(y, d)) != 0 {
+		switch op {
+		case 2:
+			return byteToU64(0), fpInvalidIfSNaN(x, y, d)
+		default:
+			return byteToU64(0), byteToU64(0x10)
+		}
+	}
+	equal := or64(eq64(x, y), and64(fpIsZero(x, d), fpIsZero(y, d)))
+	switch op {
+	case 2:
+		out = equal
+	case 1:
+		out = fpLess(x, y, byteToU64(0), d)
+	default:
+		out = or64(fpLess(x, y, byteToU64(0), d), equal)
+	}
+	return
+}
+
+// fpClass returns the class of x, as a 10 bit mask. The bits, from low to high, are set for:
+// -inf, negative normal, negative subnormal, -0, +0, positive subnormal, positive normal, +inf, signaling NaN, quiet NaN.
+func fpClass(x U64, d U64) U64 {
+	n := byteToU64(6) // normal
+	if iszero64(fpExp(x, d)) {
+		n = sub64(byteToU64(5), fpIsZero(x, d)) // subnormal or zero
+	}
+	if fpIsInf(x, d) != 0 {
+		n = byteToU64(7)
+	}
+	if fpSign(x, d) != 0 { // the negative classes mirror the positive classes
+		n = sub64(byteToU64(7), n)
+	}
+	if fpIsNaN(x, d) != 0 {
+		n = sub64(byteToU64(9), fpIsSNaN(x, d))
+	}
+	return shl64(n, byteToU64(1))
+}
+
+// fpSignInject returns x with the sign of y (op 0), the negated sign of y (op 1), or the xor of both signs (op 2)
+func fpSignInject(x U64, y U64, op U64, d U64) (out U64) {
+	sign := fpSign(y, d)
+	switch op {
+	case 1:
+		sign = xor64(sign, byteToU64(1))
+	case 2:
+		sign = xor64(sign, fpSign(x, d))
+	}
+	return or64(and64(x, not64(fpZero(byteToU64(1), d))), fpZero(sign, d))
+}
+
+// fpConvert converts x from the given source format to the other format
+func fpConvert(x U64, rm U64, from U64) (out U64, flags U64) {
+	to := xor64(from, byteToU64(1))
+	if fpIsNaN(x, from) != 0 {
+		return fpCanonicalNaN(to), fpInvalidIfSNaN(x, x, from)
+	}
+	if fpIsInf(x, from) != 0 {
+		return fpInf(fpSign(x, from), to), byteToU64(0)
+	}
+	if fpIsZero(x, from) != 0 {
+		return fpZero(fpSign(x, from), to), byteToU64(0)
+	}
+	e, sig := fpUnpack(x, from)
+	return fpRoundPack(fpSign(x, from), e, sig, rm, to)
+}
+
+// fpIntMaxMag returns the magnitude of the largest integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3)
+func fpIntMaxMag(op U64) (out U64) {
+	switch op {
+	case 0:
+		out = shr64(byteToU64(33), u64Mask())
+	case 1:
+		out = u32Mask()
+	case 2:
+		out = shr64(byteToU64(1), u64Mask())
+	default:
+		out = u64Mask()
+	}
+	return
+}
+
+// fpIntMinMag returns the magnitude of the smallest integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3)
+func fpIntMinMag(op U64) (out U64) {
+	switch op {
+	case 0:
+		out = shl64(byteToU64(31), byteToU64(1))
+	case 2:
+		out = shl64(byteToU64(63), byteToU64(1))
+	}
+	return
+}
+
+// mask32Signed64IfW sign-extends the 32 bit results of integer types W (op 0) and WU (op 1)
+func mask32Signed64IfW(v U64, op U64) U64 {
+	switch shr64(byteToU64(1), op) {
+	case 0:
+		return mask32Signed64(v)
+	default:
+		return v
+	}
+}
+
+// fpRoundToInt rounds the magnitude of the finite non-zero value x to an integer.
+// The overflow flag is returned if the magnitude does not fit in 64 bits.
+func fpRoundToInt(x U64, rm U64, d U64) (mag U64, inexact U64, overflow U64) {
+	e, sig := fpUnpack(x, d)
+	switch slt64(e, byteToU64(62)) {
+	case 0: // no fraction bits
+		overflow = gt64(e, byteToU64(63))
+		mag = shl64(and64(sub64(e, byteToU64(62)), byteToU64(1)), sig)
+	default:
+		n := sub64(byteToU64(62), e) // number of fraction bits
+		if gt64(n, byteToU64(63)) != 0 {
+			sig = byteToU64(1) // less than a half: only remember that the value is not zero
+			n = byteToU64(63)
+		}
+		mag, inexact = fpRoundShift(sig, n, rm, fpSign(x, d))
+	}
+	return
+}
+
+// fpToInt converts x to an integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3).
+// 32 bit results are sign-extended, NaN and out of range inputs saturate.
+func fpToInt(x U64, rm U64, op U64, d U64) (out U64, flags U64) {
+	if fpIsNaN(x, d) != 0 {
+		return mask32Signed64IfW(fpIntMaxMag(op), op), byteToU64(0x10)
+	}
+	if fpIsZero(x, d) != 0 {
+		return byteToU64(0), byteToU64(0)
+	}
+	overflow := fpIsInf(x, d)
+	mag := byteToU64(0)
+	if overflow == 0 {
+		mag, flags, overflow = fpRoundToInt(x, rm, d)
+	}
+	switch fpSign(x, d) {
+	case 0:
+		if or64(overflow, gt64(mag, fpIntMaxMag(op))) != 0 {
+			return mask32Signed64IfW(fpIntMaxMag(op), op), byteToU64(0x10)
+		}
+		out = mag
+	default:
+		if or64(overflow, gt64(mag, fpIntMinMag(op))) != 0 {
+			return mask32Signed64IfW(sub64(byteToU64(0), fpIntMinMag(op)), op), byteToU64(0x10)
+		}
+		out = sub64(byteToU64(0), mag)
+	}
+	return mask32Signed64IfW(out, op), flags
+}
+
+// fpFromInt converts the integer v of type W (op 0), WU (op 1), L (op 2) or LU (op 3) to the given format
+func fpFromInt(v U64, rm U64, op U64, d U64) (out U64, flags U64) {
+	switch op {
+	case 0:
+		v = mask32Signed64(v)
+	case 1:
+		v = and64(v, u32Mask())
+	}
+	sign := byteToU64(0)
+	if and64(iszero64U(and64(op, byteToU64(1))), shr64(byteToU64(63), v)) != 0 { // negative signed integer
+		sign = byteToU64(1)
+		v = sub64(byteToU64(0), v)
+	}
+	if iszero64(v) {
+		return byteToU64(0), byteToU64(0)
+	}
+	return fpRoundPack256(sign, byteToU64(124), u64ToU256(v), rm, d)
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/ethereum-optimism/optimism/op-service/jsonutil"
 	"github.com/ethereum-optimism/optimism/op-service/serialize"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
 )
 
 type VMState struct {
@@ -21,20 +22,71 @@ type VMState struct {
 
 	PC uint64 `json:"pc"`
 
-	//0xF14: mhartid  - riscv tests use this. Always hart 0, no parallelism supported
-	//CSR [4096]uint64 // 12 bit addressing space
-
 	ExitCode uint8 `json:"exit"`
 	Exited   bool  `json:"exited"`
 
 	Step uint64 `json:"step"`
 
-	Heap uint64 `json:"heap"` // for mmap to keep allocating new anon memory
+	Heap uint64 `json:"heap"` // for mmap to keep allocating new anon memory, all memory above it is unmapped
 
 	LoadReservation uint64 `json:"loadReservation"`
 
 	Registers [32]uint64 `json:"registers"`
 
+	// FPRegisters are the floating point registers of the F and D extensions.
+	// Single precision values are NaN-boxed.
+	FPRegisters [32]uint64 `json:"fpRegisters"`
+	// FCSR is the floating point control and status register:
+	// the rounding mode in bits 7:5, and the accrued exception flags in bits 4:0.
+	FCSR uint64 `json:"fcsr"`
+
+	// PC, Registers, FPRegisters and FCSR above, and ThreadID up to FutexTimeoutStep below,
+	// are the state of the running thread.
+	ThreadID uint64 `json:"threadID"`
+	// FutexAddr is the address that the running thread waits on with FUTEX_WAIT, or 0 if it is not waiting.
+	// The thread wakes up once the 32-bit value at FutexAddr differs from FutexVal,
+	// or once the step counter passes FutexTimeoutStep.
+	FutexAddr        uint64 `json:"futexAddr"`
+	FutexVal         uint64 `json:"futexVal"`
+	FutexTimeoutStep uint64 `json:"futexTimeoutStep"`
+	// StepsSinceContextSwitch counts the instructions that the running thread ran since it was switched to.
+	// It is only counted while there are other threads to switch to.
+	StepsSinceContextSwitch uint64 `json:"stepsSinceContextSwitch"`
+	// NextThreadID is the ID of the next thread created with clone.
+	NextThreadID uint64 `json:"nextThreadID"`
+
+	// The virtual clock advances by one nanosecond per step, and by the duration of every nanosleep.
+	// ClockEpoch is the time of CLOCK_REALTIME at step 0, in nanoseconds since the Unix epoch.
+	ClockEpoch uint64 `json:"clockEpoch"`
+	// ClockOffset is the total time that threads slept, in nanoseconds.
+	ClockOffset uint64 `json:"clockOffset"`
+
+	// RandomState is the state of the SplitMix64 PRNG that getrandom and AT_RANDOM draw from.
+	// It starts at the seed of the program, and advances with every value that is drawn.
+	RandomState uint64 `json:"randomState"`
+
+	// The suspended threads are kept in two stacks, ordered from bottom to top,
+	// and are scheduled round-robin: the next thread is popped from the stack that is traversed,
+	// and a preempted thread is pushed onto the other stack.
+	// When the traversed stack is empty, the direction is reversed.
+	// The witness commits to each stack with a hash-onion, see threadStackRoot.
+	TraverseRight bool          `json:"traverseRight"`
+	LeftThreads   []ThreadState `json:"leftThreads"`
+	RightThreads  []ThreadState `json:"rightThreads"`
+
+	// FreeRanges are the ranges below Heap that were unmapped with munmap, and that mmap allocates from
+	// before it grows the heap. They are kept in a stack, ordered from bottom to top,
+	// and mmap only allocates from the range at the top. The stack also holds the ranges that MAP_FIXED mapped
+	// over the free ranges below them, which mmap carves out of those before it allocates.
+	// The witness commits to the stack with a hash-onion, see freeRangeStackRoot.
+	FreeRanges []FreeRange `json:"freeRanges"`
+
+	// MemoryRegions are the ranges of memory with other permissions than riscv.ProtDefault, such as the
+	// read-only and executable segments of the program. Memory outside any region is readable and writable.
+	// The regions do not overlap, and unused regions are zero.
+	// An access without the required permission ends the program with riscv.ExitCodeFault.
+	MemoryRegions [riscv.MemoryRegionCount]MemoryRegion `json:"memoryRegions"`
+
 	// LastHint is optional metadata, and not part of the VM state itself.
 	// It is used to remember the last pre-image hint,
 	// so a VM can start from any state without fetching prior pre-images,
@@ -53,13 +105,18 @@ type VMState struct {
 
 func NewVMState() *VMState {
 	return &VMState{
-		Memory: NewMemory(),
-		Heap:   1 << 28, // 0.25 GiB of program code space
+		Memory:       NewMemory(),
+		Heap:         1 << 28, // 0.25 GiB of program code space
+		ThreadID:     1,
+		NextThreadID: 2,
 	}
 }
 
 func (state *VMState) SetWitnessAndStateHash() error {
-	witness := state.EncodeWitness()
+	return state.setWitnessAndStateHash(state.EncodeWitness())
+}
+
+func (state *VMState) setWitnessAndStateHash(witness StateWitness) error {
 	state.Witness = witness
 	stateHash, err := witness.StateHash()
 	if err != nil {
@@ -71,6 +128,7 @@ func (state *VMState) SetWitnessAndStateHash() error {
 
 func (state *VMState) GetStep() uint64 { return state.Step }
 
+// EncodeWitness encodes the state in the witness layout of the latest version, see VersionedState.EncodeWitness
 func (state *VMState) EncodeWitness() StateWitness {
 	out := make([]byte, 0)
 	memRoot := state.Memory.MerkleRoot()
@@ -90,18 +148,57 @@ func (state *VMState) EncodeWitness() StateWitness {
 	for _, r := range state.Registers {
 		out = binary.BigEndian.AppendUint64(out, r)
 	}
+	for _, r := range state.FPRegisters {
+		out = binary.BigEndian.AppendUint64(out, r)
+	}
+	out = binary.BigEndian.AppendUint64(out, state.FCSR)
+	out = binary.BigEndian.AppendUint64(out, state.ThreadID)
+	out = binary.BigEndian.AppendUint64(out, state.FutexAddr)
+	out = binary.BigEndian.AppendUint64(out, state.FutexVal)
+	out = binary.BigEndian.AppendUint64(out, state.FutexTimeoutStep)
+	out = binary.BigEndian.AppendUint64(out, state.StepsSinceContextSwitch)
+	out = binary.BigEndian.AppendUint64(out, state.NextThreadID)
+	out = binary.BigEndian.AppendUint64(out, state.ClockEpoch)
+	out = binary.BigEndian.AppendUint64(out, state.ClockOffset)
+	out = binary.BigEndian.AppendUint64(out, state.RandomState)
+	if state.TraverseRight {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	leftRoot := threadStackRoot(state.LeftThreads)
+	out = append(out, leftRoot[:]...)
+	rightRoot := threadStackRoot(state.RightThreads)
+	out = append(out, rightRoot[:]...)
+	freeRangeRoot := freeRangeStackRoot(state.FreeRanges)
+	out = append(out, freeRangeRoot[:]...)
+	for i := range state.MemoryRegions {
+		out = append(out, state.MemoryRegions[i].EncodeWitness()...)
+	}
 	return out
 }
 
+// Instr returns the raw instruction at the current PC.
+// Compressed instructions are returned as-is, without the next instruction in the upper 16 bits.
 func (state *VMState) Instr() uint32 {
+	return state.InstrAt(state.PC)
+}
+
+// InstrAt returns the raw instruction at the given address, like Instr.
+func (state *VMState) InstrAt(pc uint64) uint32 {
 	var out [4]byte
-	state.Memory.GetUnaligned(state.PC, out[:])
-	return binary.LittleEndian.Uint32(out[:])
+	state.Memory.GetUnaligned(pc, out[:])
+	instr := binary.LittleEndian.Uint32(out[:])
+	if instr&3 != 3 {
+		instr &= 0xFFFF
+	}
+	return instr
 }
 
 type StateWitness []byte
 
-const STATE_WITNESS_SIZE = 362                  // STATE_WITNESS_SIZE is the size of the state witness encoding in bytes.
+const STATE_WITNESS_SIZE = 931                  // STATE_WITNESS_SIZE is the size of the state witness encoding in bytes.
+const STATE_WITNESS_SIZE_V1 = 362               // STATE_WITNESS_SIZE_V1 is the size of the state witness encoding of StateVersionV1.
 const EXITCODE_WITNESS_OFFSET = 32 + 32 + 8 + 8 // mem-root, preimage-key, preimage-offset, PC
 
 const (
@@ -112,8 +209,10 @@ const (
 )
 
 func (sw StateWitness) StateHash() (common.Hash, error) {
-	if len(sw) != STATE_WITNESS_SIZE {
-		return common.Hash{}, fmt.Errorf("invalid witness length. got %d, expected %d", len(sw), STATE_WITNESS_SIZE)
+	// the exit code has the same offset in the witnesses of all versions
+	if len(sw) != STATE_WITNESS_SIZE && len(sw) != STATE_WITNESS_SIZE_V1 {
+		return common.Hash{}, fmt.Errorf("invalid witness length. got %d, expected %d, or %d for state version %s",
+			len(sw), STATE_WITNESS_SIZE, STATE_WITNESS_SIZE_V1, StateVersionV1)
 	}
 
 	hash := crypto.Keccak256Hash(sw)
@@ -138,8 +237,8 @@ func vmStatus(exited bool, exitCode uint8) uint8 {
 	}
 }
 
-// Serialize writes the state in a simple binary format which can be read again using Deserialize
-// The format is a simple concatenation of fields, with prefixed item count for repeating items and using big endian
+// serializeV2 writes the state in the binary layout of StateVersionV2, which deserializeV2 reads.
+// The layout is a simple concatenation of fields, with prefixed item count for repeating items and using big endian
 // encoding for numbers.
 //
 // Memory                      As per Memory.Serialize
@@ -152,12 +251,31 @@ func vmStatus(exited bool, exitCode uint8) uint8 {
 // Heap                        uint64
 // LoadReservation			   uint64
 // Registers. 				   [32]uint64
+// FPRegisters				   [32]uint64
+// FCSR						   uint64
+// ThreadID					   uint64
+// FutexAddr				   uint64
+// FutexVal					   uint64
+// FutexTimeoutStep			   uint64
+// StepsSinceContextSwitch	   uint64
+// NextThreadID				   uint64
+// ClockEpoch				   uint64
+// ClockOffset				   uint64
+// RandomState				   uint64
+// TraverseRight			   bool - 0 for false, 1 for true
+// len(LeftThreads)			   uint64
+// LeftThreads				   []ThreadState, each as per ThreadState.Serialize
+// len(RightThreads)		   uint64
+// RightThreads				   []ThreadState, each as per ThreadState.Serialize
+// len(FreeRanges)			   uint64
+// FreeRanges				   []FreeRange, each as Addr and Size uint64
+// MemoryRegions			   [8]MemoryRegion, each as Start and End uint64, and Prot uint8
 // len(LastHint)			   uint64 (0 when LastHint is nil)
 // LastHint 				   []byte
 // len(Witness)				   uint64 (0 when Witness is nil)
 // Witness					   []byte
 // StateHash				   [32]byte
-func (s *VMState) Serialize(out io.Writer) error {
+func (s *VMState) serializeV2(out io.Writer) error {
 	bout := serialize.NewBinaryWriter(out)
 
 	if err := s.Memory.Serialize(out); err != nil {
@@ -192,6 +310,76 @@ func (s *VMState) Serialize(out io.Writer) error {
 			return err
 		}
 	}
+	for _, r := range s.FPRegisters {
+		if err := bout.WriteUInt(r); err != nil {
+			return err
+		}
+	}
+	if err := bout.WriteUInt(s.FCSR); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.ThreadID); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.FutexAddr); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.FutexVal); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.FutexTimeoutStep); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.StepsSinceContextSwitch); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.NextThreadID); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.ClockEpoch); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.ClockOffset); err != nil {
+		return err
+	}
+	if err := bout.WriteUInt(s.RandomState); err != nil {
+		return err
+	}
+	if err := bout.WriteBool(s.TraverseRight); err != nil {
+		return err
+	}
+	for _, threads := range [][]ThreadState{s.LeftThreads, s.RightThreads} {
+		if err := bout.WriteUInt(uint64(len(threads))); err != nil {
+			return err
+		}
+		for i := range threads {
+			if err := threads[i].Serialize(out); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bout.WriteUInt(uint64(len(s.FreeRanges))); err != nil {
+		return err
+	}
+	for _, r := range s.FreeRanges {
+		if err := bout.WriteUInt(r.Addr); err != nil {
+			return err
+		}
+		if err := bout.WriteUInt(r.Size); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.MemoryRegions {
+		if err := bout.WriteUInt(r.Start); err != nil {
+			return err
+		}
+		if err := bout.WriteUInt(r.End); err != nil {
+			return err
+		}
+		if err := bout.WriteUInt(r.Prot); err != nil {
+			return err
+		}
+	}
 	if err := bout.WriteBytes(s.LastHint); err != nil {
 		return err
 	}
@@ -205,7 +393,7 @@ func (s *VMState) Serialize(out io.Writer) error {
 	return nil
 }
 
-func (s *VMState) Deserialize(in io.Reader) error {
+func (s *VMState) deserializeV2(in io.Reader) error {
 	bin := serialize.NewBinaryReader(in)
 	s.Memory = NewMemory()
 	if err := s.Memory.Deserialize(in); err != nil {
@@ -240,6 +428,85 @@ func (s *VMState) Deserialize(in io.Reader) error {
 			return err
 		}
 	}
+	for i := range s.FPRegisters {
+		if err := bin.ReadUInt(&s.FPRegisters[i]); err != nil {
+			return err
+		}
+	}
+	if err := bin.ReadUInt(&s.FCSR); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.ThreadID); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.FutexAddr); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.FutexVal); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.FutexTimeoutStep); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.StepsSinceContextSwitch); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.NextThreadID); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.ClockEpoch); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.ClockOffset); err != nil {
+		return err
+	}
+	if err := bin.ReadUInt(&s.RandomState); err != nil {
+		return err
+	}
+	if err := bin.ReadBool(&s.TraverseRight); err != nil {
+		return err
+	}
+	for _, threads := range []*[]ThreadState{&s.LeftThreads, &s.RightThreads} {
+		var count uint64
+		if err := bin.ReadUInt(&count); err != nil {
+			return err
+		}
+		*threads = nil
+		for i := uint64(0); i < count; i++ {
+			var t ThreadState
+			if err := t.Deserialize(in); err != nil {
+				return err
+			}
+			*threads = append(*threads, t)
+		}
+	}
+	var freeRangeCount uint64
+	if err := bin.ReadUInt(&freeRangeCount); err != nil {
+		return err
+	}
+	s.FreeRanges = nil
+	for i := uint64(0); i < freeRangeCount; i++ {
+		var r FreeRange
+		if err := bin.ReadUInt(&r.Addr); err != nil {
+			return err
+		}
+		if err := bin.ReadUInt(&r.Size); err != nil {
+			return err
+		}
+		s.FreeRanges = append(s.FreeRanges, r)
+	}
+	for i := range s.MemoryRegions {
+		r := &s.MemoryRegions[i]
+		if err := bin.ReadUInt(&r.Start); err != nil {
+			return err
+		}
+		if err := bin.ReadUInt(&r.End); err != nil {
+			return err
+		}
+		if err := bin.ReadUInt(&r.Prot); err != nil {
+			return err
+		}
+	}
 	if err := bin.ReadBytes((*[]byte)(&s.LastHint)); err != nil {
 		return err
 	}
@@ -253,9 +520,44 @@ func (s *VMState) Deserialize(in io.Reader) error {
 	return nil
 }
 
+// Serialize writes the state in the binary encoding of the latest version, see VersionedState.Serialize
+func (s *VMState) Serialize(out io.Writer) error {
+	return (&VersionedState{Version: LatestStateVersion, VMState: s}).Serialize(out)
+}
+
+// Deserialize reads a state in the binary encoding of the latest version, see VersionedState.Deserialize
+func (s *VMState) Deserialize(in io.Reader) error {
+	vs := &VersionedState{VMState: s}
+	if err := vs.Deserialize(in); err != nil {
+		return err
+	}
+	return vs.checkLatest()
+}
+
+// MarshalJSON encodes the state in the JSON encoding of the latest version, see VersionedState.MarshalJSON
+func (s *VMState) MarshalJSON() ([]byte, error) {
+	return (&VersionedState{Version: LatestStateVersion, VMState: s}).MarshalJSON()
+}
+
+// UnmarshalJSON decodes a state in the JSON encoding of the latest version, see VersionedState.UnmarshalJSON
+func (s *VMState) UnmarshalJSON(data []byte) error {
+	vs := &VersionedState{VMState: s}
+	if err := vs.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	return vs.checkLatest()
+}
+
+// LoadVMStateFromFile loads a state of the latest version, in the binary encoding if path ends in .bin or .bin.gz,
+// and in the JSON encoding otherwise. Older versions must be upgraded first,
+// or be loaded with LoadStateFromFile and run with VersionedState.CreateVM.
 func LoadVMStateFromFile(path string) (*VMState, error) {
-	if !serialize.IsBinaryFile(path) {
-		return jsonutil.LoadJSON[VMState](path)
+	vs, err := LoadStateFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := vs.checkLatest(); err != nil {
+		return nil, err
 	}
-	return serialize.LoadSerializedBinary[VMState](path)
+	return vs.VMState, nil
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
 )
 
 func TestSerializeStateRoundTrip(t *testing.T) {
@@ -34,6 +36,34 @@ func TestSerializeStateRoundTrip(t *testing.T) {
 			0xbadc0de,
 			0xdeaddead,
 		},
+		FPRegisters: [32]uint64{
+			0xffffffff3f800000,
+			0x3ff0000000000000,
+			0x7ff8000000000000,
+		},
+		FCSR:                    0x21,
+		ThreadID:                3,
+		FutexAddr:               0x1000,
+		FutexVal:                0xabcd,
+		FutexTimeoutStep:        0xdeadc0de,
+		StepsSinceContextSwitch: 77,
+		NextThreadID:            5,
+		ClockEpoch:              1_700_000_000_000_000_000,
+		ClockOffset:             20_000,
+		RandomState:             0x5eed,
+		TraverseRight:           true,
+		LeftThreads: []ThreadState{
+			{ThreadID: 1, PC: 0x100, Registers: [32]uint64{2: 0x8000}},
+			{ThreadID: 2, FutexAddr: 0x2000, FutexVal: 1, FutexTimeoutStep: ^uint64(0), PC: 0x104},
+		},
+		RightThreads: []ThreadState{
+			{ThreadID: 4, PC: 0x200, FPRegisters: [32]uint64{1: 0x3ff0000000000000}, FCSR: 0x1},
+		},
+		FreeRanges: []FreeRange{{Addr: 0x1000_0000, Size: 0x3000}, {Addr: 0x2000_0000, Size: PageSize}},
+		MemoryRegions: [riscv.MemoryRegionCount]MemoryRegion{
+			{Start: 0x1_0000, End: 0x8_0000, Prot: riscv.ProtRead | riscv.ProtExec},
+			{Start: 0x8_0000, End: 0x9_0000, Prot: riscv.ProtRead},
+		},
 		LastHint:  hexutil.Bytes{1, 2, 3, 4, 5},
 		Witness:   hexutil.Bytes{6, 7, 8, 9, 10},
 		StateHash: common.Hash{0x12},
@@ -0,0 +1,200 @@
+package fast
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// opcodeNames are the names of the major opcodes in the RISC-V opcode map
+var opcodeNames = map[uint8]string{
+	0x03: "LOAD",
+	0x07: "LOAD-FP",
+	0x0F: "MISC-MEM",
+	0x13: "OP-IMM",
+	0x17: "AUIPC",
+	0x1B: "OP-IMM-32",
+	0x23: "STORE",
+	0x27: "STORE-FP",
+	0x2F: "AMO",
+	0x33: "OP",
+	0x37: "LUI",
+	0x3B: "OP-32",
+	0x43: "MADD",
+	0x47: "MSUB",
+	0x4B: "NMSUB",
+	0x4F: "NMADD",
+	0x53: "OP-FP",
+	0x63: "BRANCH",
+	0x67: "JALR",
+	0x6F: "JAL",
+	0x73: "SYSTEM",
+}
+
+// InstrClass is a class of instructions: the opcode, with the funct3 and funct7 fields that select the operation.
+// Fields that are immediates, register numbers or rounding modes for the opcode are zero.
+type InstrClass struct {
+	Opcode uint8
+	Funct3 uint8
+	Funct7 uint8
+}
+
+func instrClass(opcode, funct3, funct7 uint8) InstrClass {
+	switch opcode {
+	case 0x37, 0x17, 0x6F: // LUI, AUIPC, JAL
+		return InstrClass{Opcode: opcode}
+	case 0x13: // OP-IMM: the shifts and the bit manipulation with shift immediates, with a 6 bit shift amount
+		if funct3 == 1 || funct3 == 5 {
+			return InstrClass{Opcode: opcode, Funct3: funct3, Funct7: funct7 &^ 1}
+		}
+		return InstrClass{Opcode: opcode, Funct3: funct3}
+	case 0x1B: // OP-IMM-32
+		if funct3 == 1 || funct3 == 5 {
+			return InstrClass{Opcode: opcode, Funct3: funct3, Funct7: funct7}
+		}
+		return InstrClass{Opcode: opcode, Funct3: funct3}
+	case 0x33, 0x3B: // OP, OP-32
+		return InstrClass{Opcode: opcode, Funct3: funct3, Funct7: funct7}
+	case 0x2F: // AMO: funct5, without the aq and rl bits
+		return InstrClass{Opcode: opcode, Funct3: funct3, Funct7: funct7 &^ 3}
+	case 0x43, 0x47, 0x4B, 0x4F: // fused multiply-add: the format, funct3 is the rounding mode
+		return InstrClass{Opcode: opcode, Funct7: funct7 & 3}
+	case 0x53: // OP-FP: funct3 is the rounding mode, except for the operations that it selects
+		switch funct7 >> 2 {
+		case 0x04, 0x05, 0x14, 0x1C, 0x1E: // sign injection, min/max, compare, move/classify
+			return InstrClass{Opcode: opcode, Funct3: funct3, Funct7: funct7}
+		}
+		return InstrClass{Opcode: opcode, Funct7: funct7}
+	default:
+		return InstrClass{Opcode: opcode, Funct3: funct3}
+	}
+}
+
+// Stats are statistics of the instructions that the VM runs, and of their memory accesses,
+// to see which instructions, syscalls and accesses a program relies on.
+type Stats struct {
+	Instructions uint64
+	// Compressed is the number of instructions that are compressed
+	Compressed uint64
+	Classes    map[InstrClass]uint64
+	// Syscalls counts the syscalls by number
+	Syscalls map[uint64]uint64
+	// Loads and Stores count the memory accesses by size, including those of syscalls
+	Loads  map[uint64]uint64
+	Stores map[uint64]uint64
+	// Unaligned is the number of loads and stores that are not aligned to their size
+	Unaligned uint64
+	// CrossLeaf is the number of loads and stores that span two 32 byte leaves, and need two memory proofs
+	CrossLeaf uint64
+	// CrossLeafFetches is the number of instructions that span two 32 byte leaves
+	CrossLeafFetches uint64
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		Classes:  make(map[InstrClass]uint64),
+		Syscalls: make(map[uint64]uint64),
+		Loads:    make(map[uint64]uint64),
+		Stores:   make(map[uint64]uint64),
+	}
+}
+
+func (st *Stats) instruction(opcode, funct3, funct7 uint64, compressed bool) {
+	st.Instructions++
+	if compressed {
+		st.Compressed++
+	}
+	st.Classes[instrClass(uint8(opcode), uint8(funct3), uint8(funct7))]++
+}
+
+func (st *Stats) syscall(num uint64) {
+	st.Syscalls[num]++
+}
+
+func (st *Stats) memAccess(addr uint64, size uint64, prot uint64) {
+	if size == 0 {
+		return
+	}
+	crossLeaf := (addr+size-1)&^31 != addr&^31
+	switch prot {
+	case riscv.ProtExec:
+		if crossLeaf {
+			st.CrossLeafFetches++
+		}
+		return
+	case riscv.ProtRead:
+		st.Loads[size]++
+	case riscv.ProtWrite:
+		st.Stores[size]++
+	}
+	// syscalls access larger ranges, which have no natural alignment
+	if size <= 8 && size&(size-1) == 0 && addr&(size-1) != 0 {
+		st.Unaligned++
+	}
+	if crossLeaf {
+		st.CrossLeaf++
+	}
+}
+
+type classStats struct {
+	Opcode string `json:"opcode"`
+	Name   string `json:"name"`
+	Funct3 uint8  `json:"funct3"`
+	Funct7 string `json:"funct7"`
+	Count  uint64 `json:"count"`
+}
+
+type syscallStats struct {
+	Num   uint64 `json:"num"`
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// MarshalJSON encodes the statistics with the names of the opcodes and syscalls, most frequent first
+func (st *Stats) MarshalJSON() ([]byte, error) {
+	classes := make([]classStats, 0, len(st.Classes))
+	for c, count := range st.Classes {
+		classes = append(classes, classStats{
+			Opcode: fmt.Sprintf("0x%02x", c.Opcode),
+			Name:   opcodeNames[c.Opcode],
+			Funct3: c.Funct3,
+			Funct7: fmt.Sprintf("0x%02x", c.Funct7),
+			Count:  count,
+		})
+	}
+	slices.SortFunc(classes, func(a, b classStats) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Opcode, b.Opcode),
+			cmp.Compare(a.Funct3, b.Funct3), cmp.Compare(a.Funct7, b.Funct7))
+	})
+	syscalls := make([]syscallStats, 0, len(st.Syscalls))
+	for num, count := range st.Syscalls {
+		syscalls = append(syscalls, syscallStats{Num: num, Name: riscv.SyscallName(num), Count: count})
+	}
+	slices.SortFunc(syscalls, func(a, b syscallStats) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Num, b.Num))
+	})
+	return json.Marshal(&struct {
+		Instructions     uint64            `json:"instructions"`
+		Compressed       uint64            `json:"compressed"`
+		Classes          []classStats      `json:"classes"`
+		Syscalls         []syscallStats    `json:"syscalls"`
+		Loads            map[uint64]uint64 `json:"loads"`
+		Stores           map[uint64]uint64 `json:"stores"`
+		Unaligned        uint64            `json:"unaligned"`
+		CrossLeaf        uint64            `json:"crossLeaf"`
+		CrossLeafFetches uint64            `json:"crossLeafFetches"`
+	}{
+		Instructions:     st.Instructions,
+		Compressed:       st.Compressed,
+		Classes:          classes,
+		Syscalls:         syscalls,
+		Loads:            st.Loads,
+		Stores:           st.Stores,
+		Unaligned:        st.Unaligned,
+		CrossLeaf:        st.CrossLeaf,
+		CrossLeafFetches: st.CrossLeafFetches,
+	})
+}
@@ -0,0 +1,77 @@
+package fast
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestStats(t *testing.T) {
+	a := riscv.NewAssembler(0x1000)
+	a.Li(riscv.RegA0, 0x201d)
+	a.Sd(riscv.RegA1, riscv.RegA0, 0) // unaligned, across the leaf at 0x2020
+	a.Lw(riscv.RegA2, riscv.RegA0, 1) // unaligned, across the leaf too
+	a.Add(riscv.RegA2, riscv.RegA2, riscv.RegA1)
+	a.Mul(riscv.RegA2, riscv.RegA2, riscv.RegA1)
+	a.EmitCompressed(0x0505) // c.addi a0, 1
+	a.Li(riscv.RegA4, 0x2000)
+	a.AmoW(riscv.AmoAdd, riscv.RegA3, riscv.RegA1, riscv.RegA4)
+	a.Syscall(riscv.SysExitGroup, 0)
+
+	state := &VMState{PC: 0x1000, Memory: NewMemory(), ThreadID: 1, MemoryRegions: UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+	us := NewInstrumentedState(state, nil, nil, nil)
+	st := NewStats()
+	us.SetStats(st)
+	for !state.Exited {
+		_, err := us.Step(false)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, uint64(12), st.Instructions)
+	require.Equal(t, uint64(1), st.Compressed)
+	require.Equal(t, map[InstrClass]uint64{
+		{Opcode: 0x37}:            2, // lui
+		{Opcode: 0x1B}:            1, // addiw
+		{Opcode: 0x13}:            3, // c.addi, and addi for the syscall
+		{Opcode: 0x23, Funct3: 3}: 1, // sd
+		{Opcode: 0x03, Funct3: 2}: 1, // lw
+		{Opcode: 0x33}:            1, // add
+		{Opcode: 0x33, Funct7: 1}: 1, // mul
+		{Opcode: 0x2F, Funct3: 2}: 1, // amoadd.w
+		{Opcode: 0x73}:            1, // ecall
+	}, st.Classes)
+	require.Equal(t, map[uint64]uint64{riscv.SysExitGroup: 1}, st.Syscalls)
+	require.Equal(t, map[uint64]uint64{4: 2}, st.Loads) // lw, and the load of amoadd.w
+	require.Equal(t, map[uint64]uint64{8: 1, 4: 1}, st.Stores)
+	require.Equal(t, uint64(2), st.Unaligned)
+	require.Equal(t, uint64(2), st.CrossLeaf)
+
+	out, err := json.Marshal(st)
+	require.NoError(t, err)
+	require.Contains(t, string(out), `{"opcode":"0x13","name":"OP-IMM","funct3":0,"funct7":"0x00","count":3}`)
+	require.Contains(t, string(out), `"syscalls":[{"num":94,"name":"exit_group","count":1}]`)
+	require.Contains(t, string(out), `"loads":{"4":2},"stores":{"4":1,"8":1}`)
+}
+
+func TestInstrClass(t *testing.T) {
+	cases := []struct {
+		opcode, funct3, funct7 uint8
+		want                   InstrClass
+	}{
+		{0x13, 1, 0x01, InstrClass{0x13, 1, 0x00}}, // slli with shamt >= 32
+		{0x13, 5, 0x21, InstrClass{0x13, 5, 0x20}}, // srai with shamt >= 32
+		{0x13, 0, 0x7f, InstrClass{0x13, 0, 0x00}}, // addi with a negative immediate
+		{0x2F, 3, 0x03, InstrClass{0x2F, 3, 0x00}}, // amoadd.d.aqrl
+		{0x53, 1, 0x01, InstrClass{0x53, 0, 0x01}}, // fadd.d with rtz
+		{0x53, 1, 0x11, InstrClass{0x53, 1, 0x11}}, // fsgnjn.d
+		{0x43, 7, 0x45, InstrClass{0x43, 0, 0x01}}, // fmadd.d
+		{0x6F, 5, 0x12, InstrClass{Opcode: 0x6F}},  // jal
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.want, instrClass(tc.opcode, tc.funct3, tc.funct7))
+	}
+}
@@ -0,0 +1,122 @@
+package fast
+
+import "github.com/ethereum-optimism/asterisc/rvgo/riscv"
+
+// SyscallHandler handles the ECALL instructions of the fast VM.
+//
+// A handler that changes how a syscall behaves diverges from the slow and on-chain VMs:
+// steps with such a syscall cannot be proven on-chain. It is meant for prototyping new syscalls.
+type SyscallHandler interface {
+	// HandleSyscall handles the syscall with the number in register A7.
+	// The PC already points to the instruction after the ECALL.
+	HandleSyscall(env *SyscallEnv)
+}
+
+// SyscallHandlerFunc is a SyscallHandler function
+type SyscallHandlerFunc func(env *SyscallEnv)
+
+func (f SyscallHandlerFunc) HandleSyscall(env *SyscallEnv) {
+	f(env)
+}
+
+// IgnoredSyscalls are the syscalls that op-program makes, and that the VM ignores (no-op):
+// strict syscall mode allows them by default.
+var IgnoredSyscalls = []uint64{
+	riscv.SysSchedGetaffinity, // hardcoded to indicate affinity with any cpu-set mask
+	riscv.SysRtSigprocmask,    // sigset changes are ignored
+	riscv.SysSigaltstack,      // no signals are sent, so no alternative signal stack is needed
+	riscv.SysRtSigaction,      // no signals are sent, so no signal handlers are needed
+	riscv.SysMadvise,
+	riscv.SysEpollCreate1,
+	riscv.SysEpollCtl,
+	riscv.SysPipe2,
+	riscv.SysReadlinnkat,
+	riscv.SysNewfstatat,
+	riscv.SysNewuname,
+	riscv.SysIoctl,
+	riscv.SysGetcwd,
+	riscv.SysGetuid,
+	riscv.SysGetgid,
+}
+
+// DefaultSyscallHandler handles every syscall like the slow and on-chain VMs do
+var DefaultSyscallHandler SyscallHandler = SyscallHandlerFunc(func(env *SyscallEnv) {
+	env.Default()
+})
+
+// SyscallEnv gives a SyscallHandler access to the VM during a single syscall.
+//
+// Memory is accessed with the proof index of each 32-byte leaf: proof index 0 is taken by the instruction,
+// so syscalls count from 1, in the order of the accesses, and a leaf that is written after it is read reuses
+// the proof index of the read.
+// The memory permissions apply, like for any load or store: an access that lacks the permission ends the program.
+type SyscallEnv struct {
+	state *VMState
+
+	getRegister    func(reg U64) U64
+	setRegister    func(reg U64, v U64)
+	loadMem        func(addr U64, size U64, signed bool, proofIndexL uint8, proofIndexR uint8) U64
+	storeMem       func(addr U64, size U64, value U64, proofIndexL uint8, proofIndexR uint8, verifyL bool, verifyR bool)
+	trackMemAccess func(addr U64, proofIndex uint8)
+	defaultSyscall func()
+}
+
+// State returns the VM state. Changes to the memory must go through the memory functions of the environment,
+// so they are proven.
+func (env *SyscallEnv) State() *VMState {
+	return env.state
+}
+
+// Num returns the syscall number, in register A7
+func (env *SyscallEnv) Num() uint64 {
+	return env.getRegister(17)
+}
+
+// Arg returns the syscall argument i, in register A0 to A5
+func (env *SyscallEnv) Arg(i int) uint64 {
+	if i < 0 || i > 5 {
+		panic("syscall argument index out of range")
+	}
+	return env.getRegister(U64(10 + i))
+}
+
+// Register returns the value of the integer register reg
+func (env *SyscallEnv) Register(reg int) uint64 {
+	return env.getRegister(U64(reg))
+}
+
+// SetRegister sets the integer register reg. Writes to register zero are ignored.
+func (env *SyscallEnv) SetRegister(reg int, v uint64) {
+	env.setRegister(U64(reg), v)
+}
+
+// Return sets the result of the syscall: the return value in A0, and the error code in A1
+func (env *SyscallEnv) Return(v uint64, errCode uint64) {
+	env.setRegister(10, v)
+	env.setRegister(11, errCode)
+}
+
+// LoadMem loads a little-endian integer of 1 to 8 bytes, optionally sign-extended.
+// The right proof index is only used if the bytes span two leaves.
+func (env *SyscallEnv) LoadMem(addr uint64, size uint64, signed bool, proofIndexL uint8, proofIndexR uint8) uint64 {
+	return env.loadMem(addr, size, signed, proofIndexL, proofIndexR)
+}
+
+// StoreMem stores a little-endian integer of 1 to 8 bytes.
+// The right proof index is only used if the bytes span two leaves.
+// verifyL and verifyR add the memory proof of the left and right leaf first: they are false for a leaf that was
+// already proven with the same proof index, by a load before the store.
+func (env *SyscallEnv) StoreMem(addr uint64, size uint64, value uint64, proofIndexL uint8, proofIndexR uint8, verifyL bool, verifyR bool) {
+	env.storeMem(addr, size, value, proofIndexL, proofIndexR, verifyL, verifyR)
+}
+
+// TrackMemAccess adds the memory proof of the 32-byte aligned leaf at addr, with the given proof index.
+// A handler that reads memory directly from the state proves the leaves it read with this.
+func (env *SyscallEnv) TrackMemAccess(addr uint64, proofIndex uint8) {
+	env.trackMemAccess(addr, proofIndex)
+}
+
+// Default handles the syscall like the slow and on-chain VMs do
+func (env *SyscallEnv) Default() {
+	env.defaultSyscall()
+}
@@ -0,0 +1,130 @@
+package fast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// newSyscallState returns a state that runs an ECALL with the given syscall number and arguments
+func newSyscallState(num uint64, args ...uint64) *VMState {
+	state := &VMState{PC: 0x100, Memory: NewMemory(), MemoryRegions: UnprotectedRegions()}
+	state.Memory.SetUnaligned(0x100, []byte{0x73, 0x00, 0x00, 0x00})
+	state.Registers[17] = num
+	copy(state.Registers[10:], args)
+	return state
+}
+
+func TestDefaultSyscallHandler(t *testing.T) {
+	// getrandom writes memory, and updates the PRNG
+	builtin := newSyscallState(riscv.SysGetRandom, 0x2010, 8)
+	builtinWit, err := NewInstrumentedState(builtin, nil, nil, nil).Step(true)
+	require.NoError(t, err)
+
+	state := newSyscallState(riscv.SysGetRandom, 0x2010, 8)
+	inst := NewInstrumentedState(state, nil, nil, nil)
+	inst.SetSyscallHandler(DefaultSyscallHandler)
+	wit, err := inst.Step(true)
+	require.NoError(t, err)
+
+	require.Equal(t, builtinWit, wit)
+	require.Equal(t, builtin.EncodeWitness(), state.EncodeWitness())
+}
+
+func TestCustomSyscallHandler(t *testing.T) {
+	const sysSwap = 0x7000
+	// swap exchanges A1 with the 8 bytes at A0, and returns the old value
+	handler := SyscallHandlerFunc(func(env *SyscallEnv) {
+		if env.Num() != sysSwap {
+			env.Default()
+			return
+		}
+		addr := env.Arg(0)
+		old := env.LoadMem(addr, 8, false, 1, 2)
+		env.StoreMem(addr, 8, env.Arg(1), 1, 2, false, false)
+		env.Return(old, 0)
+	})
+
+	state := newSyscallState(sysSwap, 0x2010, 0xdead_beef)
+	state.Memory.SetUnaligned(0x2010, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	instrProof := state.Memory.MerkleProof(0x100)
+	leafProof := state.Memory.MerkleProof(0x2000)
+
+	inst := NewInstrumentedState(state, nil, nil, nil)
+	inst.SetSyscallHandler(handler)
+	wit, err := inst.Step(true)
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(0x0807_0605_0403_0201), state.Registers[10])
+	require.Equal(t, uint64(0), state.Registers[11])
+	require.Equal(t, uint64(0x104), state.PC)
+	var dat [8]byte
+	state.Memory.GetUnaligned(0x2010, dat[:])
+	require.Equal(t, []byte{0xef, 0xbe, 0xad, 0xde, 0, 0, 0, 0}, dat[:])
+
+	// the proofs of the instruction and of the swapped leaf, against the pre-state memory
+	require.Equal(t, append(instrProof[:], leafProof[:]...), wit.MemProof)
+
+	t.Run("other syscalls", func(t *testing.T) {
+		state := newSyscallState(riscv.SysGettid)
+		state.ThreadID = 3
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetSyscallHandler(handler)
+		_, err := inst.Step(true)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), state.Registers[10])
+	})
+
+	t.Run("memory permissions", func(t *testing.T) {
+		state := newSyscallState(sysSwap, 0x2010, 0xdead_beef)
+		state.MemoryRegions[0] = MemoryRegion{Start: 0x2000, End: 0x3000, Prot: riscv.ProtRead}
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetSyscallHandler(handler)
+		_, err := inst.Step(true)
+		require.NoError(t, err)
+		require.True(t, state.Exited)
+		require.Equal(t, uint8(riscv.ExitCodeFault), state.ExitCode)
+	})
+}
+
+func TestStrictSyscalls(t *testing.T) {
+	t.Run("ignored syscall", func(t *testing.T) {
+		state := newSyscallState(riscv.SysMadvise)
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetStrictSyscalls(true, nil)
+		_, err := inst.Step(false)
+		var syscallErr *UnsupportedSyscallErr
+		require.ErrorAs(t, err, &syscallErr)
+		require.Equal(t, uint64(riscv.SysMadvise), syscallErr.SyscallNum)
+		require.Equal(t, uint64(0x100), syscallErr.PC)
+	})
+
+	t.Run("allowed syscall", func(t *testing.T) {
+		state := newSyscallState(riscv.SysMadvise)
+		state.Registers[10] = 0x1234
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetStrictSyscalls(true, IgnoredSyscalls)
+		_, err := inst.Step(false)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Equal(t, uint64(0x104), state.PC)
+	})
+
+	t.Run("unknown syscall", func(t *testing.T) {
+		state := newSyscallState(0x7000)
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetStrictSyscalls(true, IgnoredSyscalls)
+		_, err := inst.Step(false)
+		require.ErrorContains(t, err, "unsupported system call: 28672 at pc 0000000000000100")
+	})
+
+	t.Run("supported syscall", func(t *testing.T) {
+		state := newSyscallState(riscv.SysGettid)
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetStrictSyscalls(true, nil)
+		_, err := inst.Step(false)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,279 @@
+package fast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// SyscallTracer receives every syscall that the VM runs, see InstrumentedState.SetSyscallTracer
+type SyscallTracer func(t *SyscallTrace)
+
+// SyscallStatus is how a traced syscall ended
+type SyscallStatus string
+
+const (
+	// SyscallReturned syscalls returned Ret and Errno
+	SyscallReturned SyscallStatus = "returned"
+	// SyscallBlocked syscalls wait for a futex: they are traced again once resumed
+	SyscallBlocked SyscallStatus = "blocked"
+	// SyscallResumed syscalls waited for a futex, and returned Ret and Errno
+	SyscallResumed SyscallStatus = "resumed"
+	// SyscallExited syscalls ended the thread or the program, they do not return
+	SyscallExited SyscallStatus = "exited"
+	// SyscallReverted syscalls failed the step with Revert, like unsupported syscalls in strict mode
+	SyscallReverted SyscallStatus = "reverted"
+)
+
+// SyscallTrace is a single syscall, like a line of strace
+type SyscallTrace struct {
+	// Step is the step of the ECALL, or the step that resumed a blocked syscall
+	Step     uint64        `json:"step"`
+	PC       uint64        `json:"pc"`
+	ThreadID uint64        `json:"tid"`
+	Num      uint64        `json:"num"`
+	Name     string        `json:"name"`
+	Args     []string      `json:"args,omitempty"`
+	Status   SyscallStatus `json:"status"`
+	Ret      uint64        `json:"ret"`
+	Errno    uint64        `json:"errno"`
+	// Error is the name of the Errno, if not 0
+	Error string `json:"error,omitempty"`
+	// Revert is the error of the step, if the syscall reverted
+	Revert string `json:"revert,omitempty"`
+}
+
+// String formats the syscall like strace does
+func (t *SyscallTrace) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d [tid %d] %016x ", t.Step, t.ThreadID, t.PC)
+	if t.Status == SyscallResumed {
+		fmt.Fprintf(&out, "<... %s resumed>", t.Name)
+	} else {
+		fmt.Fprintf(&out, "%s(%s)", t.Name, strings.Join(t.Args, ", "))
+	}
+	switch t.Status {
+	case SyscallBlocked:
+		out.WriteString(" <unfinished ...>")
+	case SyscallExited:
+		out.WriteString(" = ?")
+	case SyscallReverted:
+		fmt.Fprintf(&out, " = ? <%s>", t.Revert)
+	default:
+		if t.Errno != 0 {
+			fmt.Fprintf(&out, " = -1 %s", t.Error)
+		} else if t.Num == riscv.SysMmap || t.Num == riscv.SysBrk {
+			fmt.Fprintf(&out, " = %#x", t.Ret)
+		} else {
+			fmt.Fprintf(&out, " = %d", int64(t.Ret))
+		}
+	}
+	return out.String()
+}
+
+// syscallArg is how a syscall argument is decoded
+type syscallArg uint8
+
+const (
+	argInt syscallArg = iota
+	argUint
+	argAddr
+	argProt
+	argMapFlags
+	argFcntlCmd
+	argFutexOp
+	argClockID
+)
+
+var syscallArgs = map[uint64][]syscallArg{
+	riscv.SysExit:             {argInt},
+	riscv.SysExitGroup:        {argInt},
+	riscv.SysBrk:              {argAddr},
+	riscv.SysMmap:             {argAddr, argUint, argProt, argMapFlags, argInt, argUint},
+	riscv.SysMunmap:           {argAddr, argUint},
+	riscv.SysMprotect:         {argAddr, argUint, argProt},
+	riscv.SysRead:             {argInt, argAddr, argUint},
+	riscv.SysWrite:            {argInt, argAddr, argUint},
+	riscv.SysFcntl:            {argInt, argFcntlCmd, argUint},
+	riscv.SysOpenat:           {argInt, argAddr, argAddr, argAddr},
+	riscv.SysSchedGetaffinity: {argInt, argUint, argAddr},
+	riscv.SysSchedYield:       {},
+	riscv.SysClockGettime:     {argClockID, argAddr},
+	riscv.SysRtSigprocmask:    {argInt, argAddr, argAddr, argUint},
+	riscv.SysSigaltstack:      {argAddr, argAddr},
+	riscv.SysGettid:           {},
+	riscv.SysRtSigaction:      {argInt, argAddr, argAddr, argUint},
+	riscv.SysClone:            {argAddr, argAddr, argAddr, argAddr, argAddr},
+	riscv.SysGetrlimit:        {argInt, argAddr},
+	riscv.SysMadvise:          {argAddr, argUint, argInt},
+	riscv.SysEpollCreate1:     {argAddr},
+	riscv.SysEpollCtl:         {argInt, argInt, argInt, argAddr},
+	riscv.SysPipe2:            {argAddr, argAddr},
+	riscv.SysReadlinnkat:      {argInt, argAddr, argAddr, argUint},
+	riscv.SysNewfstatat:       {argInt, argAddr, argAddr, argAddr},
+	riscv.SysNewuname:         {argAddr},
+	riscv.SysGetRandom:        {argAddr, argUint, argAddr},
+	riscv.SysPrlimit64:        {argInt, argInt, argAddr, argAddr},
+	riscv.SysFutex:            {argAddr, argFutexOp, argUint, argAddr},
+	riscv.SysNanosleep:        {argAddr, argAddr},
+	riscv.SysGetcwd:           {argAddr, argUint},
+	riscv.SysIoctl:            {argInt, argAddr, argAddr},
+	riscv.SysGetuid:           {},
+	riscv.SysGetgid:           {},
+}
+
+// unknownSyscallArgs are the arguments of syscalls without a known signature: all argument registers
+var unknownSyscallArgs = []syscallArg{argAddr, argAddr, argAddr, argAddr, argAddr, argAddr}
+
+var errnoNames = map[uint64]string{
+	0x1:  "EPERM",
+	0x2:  "ENOENT",
+	0x4:  "EINTR",
+	0x9:  "EBADF",
+	0xb:  "EAGAIN",
+	0xc:  "ENOMEM",
+	0xd:  "EACCES",
+	0xe:  "EFAULT",
+	0x16: "EINVAL",
+	0x26: "ENOSYS",
+	0x4d: "EBADFD",
+	0x6e: "ETIMEDOUT",
+}
+
+func errnoName(errno uint64) string {
+	if name, ok := errnoNames[errno]; ok {
+		return name
+	}
+	return fmt.Sprintf("errno %d", errno)
+}
+
+// flagNames formats the set bits of v with their names, and any remaining bits in hex
+func flagNames(v uint64, names []string, none string) string {
+	var parts []string
+	for i, name := range names {
+		if bit := uint64(1) << i; name != "" && v&bit != 0 {
+			parts = append(parts, name)
+			v &^= bit
+		}
+	}
+	if v != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", v))
+	}
+	if len(parts) == 0 {
+		return none
+	}
+	return strings.Join(parts, "|")
+}
+
+func decodeSyscallArg(kind syscallArg, v uint64) string {
+	switch kind {
+	case argInt:
+		return fmt.Sprintf("%d", int64(v))
+	case argUint:
+		return fmt.Sprintf("%d", v)
+	case argProt:
+		return flagNames(v, []string{"PROT_READ", "PROT_WRITE", "PROT_EXEC"}, "PROT_NONE")
+	case argMapFlags:
+		return flagNames(v, []string{"MAP_SHARED", "MAP_PRIVATE", "", "", "MAP_FIXED", "MAP_ANONYMOUS"}, "0")
+	case argFcntlCmd:
+		switch v {
+		case 0x0:
+			return "F_DUPFD"
+		case 0x1:
+			return "F_GETFD"
+		case 0x2:
+			return "F_SETFD"
+		case 0x3:
+			return "F_GETFL"
+		case 0x4:
+			return "F_SETFL"
+		}
+		return fmt.Sprintf("%d", v)
+	case argFutexOp:
+		var name string
+		switch v & riscv.FutexCmdMask {
+		case riscv.FutexWait:
+			name = "FUTEX_WAIT"
+		case riscv.FutexWake:
+			name = "FUTEX_WAKE"
+		default:
+			name = fmt.Sprintf("%d", v&riscv.FutexCmdMask)
+		}
+		if v&0x80 != 0 {
+			name += "_PRIVATE"
+		}
+		return name
+	case argClockID:
+		switch v {
+		case riscv.ClockRealtime:
+			return "CLOCK_REALTIME"
+		case 0x1:
+			return "CLOCK_MONOTONIC"
+		case riscv.ClockRealtimeCoarse:
+			return "CLOCK_REALTIME_COARSE"
+		case 0x6:
+			return "CLOCK_MONOTONIC_COARSE"
+		}
+		return fmt.Sprintf("%d", v)
+	default:
+		return fmt.Sprintf("%#x", v)
+	}
+}
+
+// startSyscallTrace decodes the syscall of the ECALL at pc, before it runs
+func startSyscallTrace(s *VMState, pc uint64) *SyscallTrace {
+	num := s.Registers[17]
+	kinds, ok := syscallArgs[num]
+	if !ok {
+		kinds = unknownSyscallArgs
+	}
+	args := make([]string, len(kinds))
+	for i, kind := range kinds {
+		args[i] = decodeSyscallArg(kind, s.Registers[10+i])
+	}
+	return &SyscallTrace{
+		Step:     s.Step - 1,
+		PC:       pc,
+		ThreadID: s.ThreadID,
+		Num:      num,
+		Name:     riscv.SyscallName(num),
+		Args:     args,
+	}
+}
+
+// finishSyscallTrace sets how the syscall ended, once it ran
+func finishSyscallTrace(s *VMState, t *SyscallTrace) {
+	switch {
+	case s.Exited || s.ThreadID != t.ThreadID:
+		t.Status = SyscallExited
+	case s.FutexAddr != 0:
+		t.Status = SyscallBlocked
+	default:
+		t.Status = SyscallReturned
+		setSyscallTraceResult(s, t)
+	}
+}
+
+// resumedSyscallTrace traces the end of a FUTEX_WAIT, once the running thread is woken up
+func resumedSyscallTrace(s *VMState) *SyscallTrace {
+	t := &SyscallTrace{
+		Step:     s.Step - 1,
+		PC:       s.PC - 4, // the PC points after the ECALL
+		ThreadID: s.ThreadID,
+		Num:      riscv.SysFutex,
+		Name:     riscv.SyscallName(riscv.SysFutex),
+		Status:   SyscallResumed,
+	}
+	setSyscallTraceResult(s, t)
+	return t
+}
+
+// setSyscallTraceResult sets the return value and error of the running thread
+func setSyscallTraceResult(s *VMState, t *SyscallTrace) {
+	t.Ret = s.Registers[10]
+	t.Errno = s.Registers[11]
+	if t.Errno != 0 {
+		t.Error = errnoName(t.Errno)
+	}
+}
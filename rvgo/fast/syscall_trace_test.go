@@ -0,0 +1,107 @@
+package fast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func TestSyscallTrace(t *testing.T) {
+	traceStep := func(t *testing.T, state *VMState) []*SyscallTrace {
+		var traces []*SyscallTrace
+		inst := NewInstrumentedState(state, nil, nil, nil)
+		inst.SetSyscallTracer(func(trace *SyscallTrace) {
+			traces = append(traces, trace)
+		})
+		_, err := inst.Step(false)
+		require.NoError(t, err)
+		return traces
+	}
+
+	t.Run("mmap", func(t *testing.T) {
+		state := newSyscallState(riscv.SysMmap, 0, 0x2000, riscv.ProtRead|riscv.ProtWrite, riscv.MapAnonymous|0x2, ^uint64(0), 0)
+		state.Heap = 0x10_0000
+		state.Step = 7
+		traces := traceStep(t, state)
+		require.Len(t, traces, 1)
+		require.Equal(t, &SyscallTrace{
+			Step:   7,
+			PC:     0x100,
+			Num:    riscv.SysMmap,
+			Name:   "mmap",
+			Args:   []string{"0x0", "8192", "PROT_READ|PROT_WRITE", "MAP_PRIVATE|MAP_ANONYMOUS", "-1", "0"},
+			Status: SyscallReturned,
+			Ret:    0x10_0000,
+		}, traces[0])
+		require.Equal(t, "7 [tid 0] 0000000000000100 mmap(0x0, 8192, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS, -1, 0) = 0x100000",
+			traces[0].String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		traces := traceStep(t, newSyscallState(riscv.SysFcntl, 9, 3))
+		require.Len(t, traces, 1)
+		require.Equal(t, "0 [tid 0] 0000000000000100 fcntl(9, F_GETFL, 0) = -1 EBADFD", traces[0].String())
+	})
+
+	t.Run("unknown syscall", func(t *testing.T) {
+		traces := traceStep(t, newSyscallState(0x7000, 1, 2))
+		require.Len(t, traces, 1)
+		require.Equal(t, "syscall_28672", traces[0].Name)
+		require.Equal(t, []string{"0x1", "0x2", "0x0", "0x0", "0x0", "0x0"}, traces[0].Args)
+	})
+
+	t.Run("exit", func(t *testing.T) {
+		traces := traceStep(t, newSyscallState(riscv.SysExitGroup, 3))
+		require.Len(t, traces, 1)
+		require.Equal(t, "0 [tid 0] 0000000000000100 exit_group(3) = ?", traces[0].String())
+	})
+
+	t.Run("revert", func(t *testing.T) {
+		var traces []*SyscallTrace
+		inst := NewInstrumentedState(newSyscallState(riscv.SysPrlimit64, 0, 7), nil, nil, nil)
+		inst.SetSyscallTracer(func(trace *SyscallTrace) {
+			traces = append(traces, trace)
+		})
+		_, err := inst.Step(false)
+		require.Error(t, err)
+		require.Len(t, traces, 1)
+		require.Equal(t, SyscallReverted, traces[0].Status)
+		require.Equal(t, err.Error(), traces[0].Revert)
+		require.Equal(t, "0 [tid 0] 0000000000000100 prlimit64(0, 7, 0x0, 0x0) = ? <"+err.Error()+">", traces[0].String())
+	})
+
+	t.Run("strict syscalls", func(t *testing.T) {
+		var traces []*SyscallTrace
+		inst := NewInstrumentedState(newSyscallState(0x7000, 1, 2), nil, nil, nil)
+		inst.SetStrictSyscalls(true, nil)
+		inst.SetSyscallTracer(func(trace *SyscallTrace) {
+			traces = append(traces, trace)
+		})
+		_, err := inst.Step(false)
+		var syscallErr *UnsupportedSyscallErr
+		require.ErrorAs(t, err, &syscallErr)
+		require.Len(t, traces, 1)
+		require.Equal(t, SyscallReverted, traces[0].Status)
+		require.Equal(t, uint64(0x7000), traces[0].Num)
+		require.Equal(t, err.Error(), traces[0].Revert)
+	})
+
+	t.Run("futex wait", func(t *testing.T) {
+		state := newSyscallState(riscv.SysFutex, 0x2000, riscv.FutexWait|0x80, 1, 0)
+		state.Memory.SetUnaligned(0x2000, []byte{1, 0, 0, 0})
+		traces := traceStep(t, state)
+		require.Len(t, traces, 1)
+		require.Equal(t, SyscallBlocked, traces[0].Status)
+		require.Equal(t, "0 [tid 0] 0000000000000100 futex(0x2000, FUTEX_WAIT_PRIVATE, 1, 0x0) <unfinished ...>", traces[0].String())
+
+		// the thread keeps waiting
+		require.Empty(t, traceStep(t, state))
+
+		state.Memory.SetUnaligned(0x2000, []byte{2, 0, 0, 0})
+		traces = traceStep(t, state)
+		require.Len(t, traces, 1)
+		require.Equal(t, "2 [tid 0] 0000000000000100 <... futex resumed> = 0", traces[0].String())
+	})
+}
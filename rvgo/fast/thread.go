@@ -0,0 +1,133 @@
+package fast
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ThreadState is the state of a suspended thread.
+// The running thread is not a ThreadState: its state is part of the VMState itself.
+type ThreadState struct {
+	ThreadID         uint64     `json:"threadID"`
+	FutexAddr        uint64     `json:"futexAddr"`
+	FutexVal         uint64     `json:"futexVal"`
+	FutexTimeoutStep uint64     `json:"futexTimeoutStep"`
+	PC               uint64     `json:"pc"`
+	Registers        [32]uint64 `json:"registers"`
+	FPRegisters      [32]uint64 `json:"fpRegisters"`
+	FCSR             uint64     `json:"fcsr"`
+}
+
+const THREAD_WITNESS_SIZE = 560                    // THREAD_WITNESS_SIZE is the size of the thread witness encoding in bytes.
+const THREAD_PROOF_SIZE = THREAD_WITNESS_SIZE + 32 // thread witness, followed by the root of the thread stack below it
+
+func (t *ThreadState) EncodeWitness() []byte {
+	out := make([]byte, 0, THREAD_WITNESS_SIZE)
+	out = binary.BigEndian.AppendUint64(out, t.ThreadID)
+	out = binary.BigEndian.AppendUint64(out, t.FutexAddr)
+	out = binary.BigEndian.AppendUint64(out, t.FutexVal)
+	out = binary.BigEndian.AppendUint64(out, t.FutexTimeoutStep)
+	out = binary.BigEndian.AppendUint64(out, t.PC)
+	for _, r := range t.Registers {
+		out = binary.BigEndian.AppendUint64(out, r)
+	}
+	for _, r := range t.FPRegisters {
+		out = binary.BigEndian.AppendUint64(out, r)
+	}
+	out = binary.BigEndian.AppendUint64(out, t.FCSR)
+	return out
+}
+
+// Serialize writes the thread in the binary format of the thread witness, see EncodeWitness.
+func (t *ThreadState) Serialize(out io.Writer) error {
+	bout := serialize.NewBinaryWriter(out)
+	for _, v := range []uint64{t.ThreadID, t.FutexAddr, t.FutexVal, t.FutexTimeoutStep, t.PC} {
+		if err := bout.WriteUInt(v); err != nil {
+			return err
+		}
+	}
+	for _, r := range t.Registers {
+		if err := bout.WriteUInt(r); err != nil {
+			return err
+		}
+	}
+	for _, r := range t.FPRegisters {
+		if err := bout.WriteUInt(r); err != nil {
+			return err
+		}
+	}
+	return bout.WriteUInt(t.FCSR)
+}
+
+func (t *ThreadState) Deserialize(in io.Reader) error {
+	bin := serialize.NewBinaryReader(in)
+	for _, v := range []*uint64{&t.ThreadID, &t.FutexAddr, &t.FutexVal, &t.FutexTimeoutStep, &t.PC} {
+		if err := bin.ReadUInt(v); err != nil {
+			return err
+		}
+	}
+	for i := range t.Registers {
+		if err := bin.ReadUInt(&t.Registers[i]); err != nil {
+			return err
+		}
+	}
+	for i := range t.FPRegisters {
+		if err := bin.ReadUInt(&t.FPRegisters[i]); err != nil {
+			return err
+		}
+	}
+	return bin.ReadUInt(&t.FCSR)
+}
+
+// threadStackRoot computes the commitment to a stack of threads, ordered from bottom to top.
+// The empty stack is the zero hash, and pushing a thread hashes the root with the hash of the thread witness.
+func threadStackRoot(threads []ThreadState) (root common.Hash) {
+	for i := range threads {
+		root = crypto.Keccak256Hash(root[:], crypto.Keccak256(threads[i].EncodeWitness()))
+	}
+	return
+}
+
+// activeThread returns a copy of the state of the running thread.
+func (state *VMState) activeThread() ThreadState {
+	return ThreadState{
+		ThreadID:         state.ThreadID,
+		FutexAddr:        state.FutexAddr,
+		FutexVal:         state.FutexVal,
+		FutexTimeoutStep: state.FutexTimeoutStep,
+		PC:               state.PC,
+		Registers:        state.Registers,
+		FPRegisters:      state.FPRegisters,
+		FCSR:             state.FCSR,
+	}
+}
+
+// setActiveThread makes the given thread the running thread.
+func (state *VMState) setActiveThread(t *ThreadState) {
+	state.ThreadID = t.ThreadID
+	state.FutexAddr = t.FutexAddr
+	state.FutexVal = t.FutexVal
+	state.FutexTimeoutStep = t.FutexTimeoutStep
+	state.PC = t.PC
+	state.Registers = t.Registers
+	state.FPRegisters = t.FPRegisters
+	state.FCSR = t.FCSR
+}
+
+// threadStack returns the left or right stack of suspended threads.
+func (state *VMState) threadStack(right bool) *[]ThreadState {
+	if right {
+		return &state.RightThreads
+	}
+	return &state.LeftThreads
+}
+
+// ThreadCount returns the number of threads, including the running thread.
+func (state *VMState) ThreadCount() int {
+	return 1 + len(state.LeftThreads) + len(state.RightThreads)
+}
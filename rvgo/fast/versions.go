@@ -0,0 +1,424 @@
+package fast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-service/jsonutil"
+	"github.com/ethereum-optimism/optimism/op-service/serialize"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// StateVersion is the version of the layout of the VM state, in its binary and JSON encodings.
+type StateVersion uint8
+
+const (
+	// StateVersionV1 is the state of the first release: a single thread with the integer registers.
+	// Its binary encoding has no header, and its JSON encoding has no version.
+	StateVersionV1 StateVersion = 1
+	// StateVersionV2 adds the floating point registers, threads, the virtual clock, the PRNG,
+	// the free ranges of mmap and the memory regions.
+	StateVersionV2 StateVersion = 2
+
+	// LatestStateVersion is the version that new states are written in, and the only one that all tools run.
+	LatestStateVersion = StateVersionV2
+)
+
+// StateVersions are the supported versions, oldest first
+var StateVersions = []StateVersion{StateVersionV1, StateVersionV2}
+
+var ErrUnknownVersion = errors.New("unknown state version")
+
+func (v StateVersion) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+// ParseStateVersion parses a version like v2 or 2, or latest
+func ParseStateVersion(s string) (StateVersion, error) {
+	if s == "latest" {
+		return LatestStateVersion, nil
+	}
+	for _, v := range StateVersions {
+		if s == v.String() || s == strconv.Itoa(int(v)) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, s)
+}
+
+// stateMagic starts the binary encoding of the states from StateVersionV2 on.
+// The encoding of StateVersionV1 starts with the big endian page count of the memory, so with a zero byte instead.
+var stateMagic = [4]byte{'A', 'S', 'T', 'S'}
+
+var stateChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// VersionedState is a state, with the version of its encoding.
+// The VMState is in the layout of the latest version: older versions are upgraded when they are read,
+// with the defaults of a single threaded program for the newer fields, and are downgraded when they are written.
+type VersionedState struct {
+	Version StateVersion
+	*VMState
+}
+
+// LoadStateFromFile loads a state of any supported version, in the binary encoding if path ends in .bin or .bin.gz,
+// and in the JSON encoding otherwise.
+func LoadStateFromFile(path string) (*VersionedState, error) {
+	if !serialize.IsBinaryFile(path) {
+		return jsonutil.LoadJSON[VersionedState](path)
+	}
+	return serialize.LoadSerializedBinary[VersionedState](path)
+}
+
+// CreateVM runs the state with the VM of its version, with the riscvStep and the witness layout of that version,
+// so that its proofs match the RISCV.sol of the version.
+// The tracing hooks of the InstrumentedState, such as SetSyscallTracer, only apply to the latest version.
+func (s *VersionedState) CreateVM(po PreimageOracle, stdOut, stdErr io.Writer) *InstrumentedState {
+	m := NewInstrumentedState(s.VMState, po, stdOut, stdErr)
+	m.version = s.Version
+	return m
+}
+
+// EncodeWitness encodes the state in the witness layout of its version
+func (s *VersionedState) EncodeWitness() StateWitness {
+	if s.Version == StateVersionV1 {
+		return s.encodeWitnessV1()
+	}
+	return s.VMState.EncodeWitness()
+}
+
+// SetWitnessAndStateHash caches the witness and state hash of the state, in the witness layout of its version
+func (s *VersionedState) SetWitnessAndStateHash() error {
+	return s.setWitnessAndStateHash(s.EncodeWitness())
+}
+
+// checkLatest returns an error if the state is not of the latest version, for the tools that only run that version
+func (s *VersionedState) checkLatest() error {
+	if s.Version != LatestStateVersion {
+		return fmt.Errorf("state version %s is older than the latest version %s, upgrade it with asterisc convert",
+			s.Version, LatestStateVersion)
+	}
+	return nil
+}
+
+// checkEncodable returns an error if the state has data that the version cannot encode
+func (s *VersionedState) checkEncodable(version StateVersion) error {
+	switch version {
+	case StateVersionV1:
+		if unsupported := s.unsupportedV1(); len(unsupported) > 0 {
+			return fmt.Errorf("state version %s cannot encode the %s of the state", version, strings.Join(unsupported, ", "))
+		}
+		return nil
+	case StateVersionV2:
+		return nil
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+}
+
+// Convert changes the version of the state. Downgrading fails if the state has data that the older version
+// cannot encode, unless lossy is set, which drops that data.
+// A cached witness and state hash are recomputed in the witness layout of the new version.
+func (s *VersionedState) Convert(version StateVersion, lossy bool) error {
+	if err := s.checkEncodable(version); err != nil {
+		if !lossy || errors.Is(err, ErrUnknownVersion) {
+			return err
+		}
+		s.resetV2()
+	}
+	if version == s.Version {
+		return nil
+	}
+	s.Version = version
+	if s.Witness != nil {
+		return s.SetWitnessAndStateHash()
+	}
+	return nil
+}
+
+// Serialize writes the state in the binary encoding of its version:
+//
+// magic       [4]byte "ASTS"
+// version     uint8
+// state       As per VMState.serializeV2
+// checksum    uint32 - CRC-32C of the magic, version and state
+//
+// StateVersionV1 has no header and no checksum, and is the state alone, as per VMState.serializeV1.
+func (s *VersionedState) Serialize(out io.Writer) error {
+	if err := s.checkEncodable(s.Version); err != nil {
+		return err
+	}
+	if s.Version == StateVersionV1 {
+		return s.serializeV1(out)
+	}
+	checksum := crc32.New(stateChecksumTable)
+	w := io.MultiWriter(out, checksum)
+	if _, err := w.Write(append(stateMagic[:], byte(s.Version))); err != nil {
+		return err
+	}
+	if err := s.serializeV2(w); err != nil {
+		return err
+	}
+	return binary.Write(out, binary.BigEndian, checksum.Sum32())
+}
+
+// Deserialize reads a state in the binary encoding of any supported version
+func (s *VersionedState) Deserialize(in io.Reader) error {
+	if s.VMState == nil {
+		s.VMState = &VMState{}
+	}
+	var header [5]byte
+	if _, err := io.ReadFull(in, header[:4]); err != nil {
+		return err
+	}
+	if [4]byte(header[:4]) != stateMagic {
+		s.Version = StateVersionV1
+		return s.deserializeV1(io.MultiReader(bytes.NewReader(header[:4]), in))
+	}
+	if _, err := io.ReadFull(in, header[4:]); err != nil {
+		return err
+	}
+	s.Version = StateVersion(header[4])
+	checksum := crc32.New(stateChecksumTable)
+	_, _ = checksum.Write(header[:])
+	r := io.TeeReader(in, checksum)
+	switch s.Version {
+	case StateVersionV2:
+		if err := s.deserializeV2(r); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, s.Version)
+	}
+	var want uint32
+	if err := binary.Read(in, binary.BigEndian, &want); err != nil {
+		return fmt.Errorf("failed to read state checksum: %w", err)
+	}
+	if got := checksum.Sum32(); got != want {
+		return fmt.Errorf("invalid state checksum %08x, computed %08x", want, got)
+	}
+	return nil
+}
+
+// vmStateJSON is VMState without its methods, for the JSON encoding of its fields
+type vmStateJSON VMState
+
+type versionedStateJSON struct {
+	Version StateVersion `json:"version"`
+	*vmStateJSON
+}
+
+// vmStateV1JSON is the JSON encoding of StateVersionV1
+type vmStateV1JSON struct {
+	Memory          *Memory       `json:"memory"`
+	PreimageKey     common.Hash   `json:"preimageKey"`
+	PreimageOffset  uint64        `json:"preimageOffset"`
+	PC              uint64        `json:"pc"`
+	ExitCode        uint8         `json:"exit"`
+	Exited          bool          `json:"exited"`
+	Step            uint64        `json:"step"`
+	Heap            uint64        `json:"heap"`
+	LoadReservation uint64        `json:"loadReservation"`
+	Registers       [32]uint64    `json:"registers"`
+	LastHint        hexutil.Bytes `json:"lastHint,omitempty"`
+	Witness         []byte        `json:"witness,omitempty"`
+	StateHash       common.Hash   `json:"stateHash,omitempty"`
+}
+
+// MarshalJSON encodes the state in the JSON encoding of its version: the fields of the state and the version,
+// or for StateVersionV1 only the fields that it has, without a version.
+func (s *VersionedState) MarshalJSON() ([]byte, error) {
+	if err := s.checkEncodable(s.Version); err != nil {
+		return nil, err
+	}
+	if s.Version == StateVersionV1 {
+		return json.Marshal(&vmStateV1JSON{
+			Memory:          s.Memory,
+			PreimageKey:     s.PreimageKey,
+			PreimageOffset:  s.PreimageOffset,
+			PC:              s.PC,
+			ExitCode:        s.ExitCode,
+			Exited:          s.Exited,
+			Step:            s.Step,
+			Heap:            s.Heap,
+			LoadReservation: s.LoadReservation,
+			Registers:       s.Registers,
+			LastHint:        s.LastHint,
+			Witness:         s.Witness,
+			StateHash:       s.StateHash,
+		})
+	}
+	return json.Marshal(&versionedStateJSON{Version: s.Version, vmStateJSON: (*vmStateJSON)(s.VMState)})
+}
+
+// UnmarshalJSON decodes a state in the JSON encoding of any supported version
+func (s *VersionedState) UnmarshalJSON(data []byte) error {
+	if s.VMState == nil {
+		s.VMState = &VMState{}
+	}
+	// the fields of StateVersionV1 have the same names in the later versions
+	aux := &versionedStateJSON{vmStateJSON: (*vmStateJSON)(s.VMState)}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	switch aux.Version {
+	case 0, StateVersionV1:
+		s.Version = StateVersionV1
+		s.resetV2()
+	case StateVersionV2:
+		s.Version = aux.Version
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, aux.Version)
+	}
+	return nil
+}
+
+// resetV2 sets the state that StateVersionV1 does not have to that of a single threaded program that did not use it
+func (s *VMState) resetV2() {
+	s.FPRegisters, s.FCSR = [32]uint64{}, 0
+	s.ThreadID, s.NextThreadID = 1, 2
+	s.FutexAddr, s.FutexVal, s.FutexTimeoutStep, s.StepsSinceContextSwitch = 0, 0, 0, 0
+	s.TraverseRight, s.LeftThreads, s.RightThreads = false, nil, nil
+	s.ClockEpoch, s.ClockOffset, s.RandomState = 0, 0, 0
+	s.FreeRanges = nil
+	s.MemoryRegions = UnprotectedRegions()
+}
+
+// unsupportedV1 lists the state that StateVersionV1 cannot encode, as it differs from that of resetV2
+func (s *VMState) unsupportedV1() []string {
+	var out []string
+	add := func(name string, set bool) {
+		if set {
+			out = append(out, name)
+		}
+	}
+	add("floating point registers", s.FPRegisters != [32]uint64{} || s.FCSR != 0)
+	add("threads", s.ThreadID != 1 || s.NextThreadID != 2 ||
+		s.FutexAddr != 0 || s.FutexVal != 0 || s.FutexTimeoutStep != 0 || s.StepsSinceContextSwitch != 0 ||
+		s.TraverseRight || len(s.LeftThreads) != 0 || len(s.RightThreads) != 0)
+	add("clock", s.ClockEpoch != 0 || s.ClockOffset != 0)
+	add("random state", s.RandomState != 0)
+	add("free ranges", len(s.FreeRanges) != 0)
+	add("memory regions", s.MemoryRegions != UnprotectedRegions())
+	return out
+}
+
+// encodeWitnessV1 encodes the state in the witness layout of StateVersionV1, the prefix of that of the later versions
+// up to the integer registers
+func (s *VMState) encodeWitnessV1() StateWitness {
+	out := make([]byte, 0, STATE_WITNESS_SIZE_V1)
+	memRoot := s.Memory.MerkleRoot()
+	out = append(out, memRoot[:]...)
+	out = append(out, s.PreimageKey[:]...)
+	out = binary.BigEndian.AppendUint64(out, s.PreimageOffset)
+	out = binary.BigEndian.AppendUint64(out, s.PC)
+	out = append(out, s.ExitCode)
+	if s.Exited {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	out = binary.BigEndian.AppendUint64(out, s.Step)
+	out = binary.BigEndian.AppendUint64(out, s.Heap)
+	out = binary.BigEndian.AppendUint64(out, s.LoadReservation)
+	for _, r := range s.Registers {
+		out = binary.BigEndian.AppendUint64(out, r)
+	}
+	return out
+}
+
+// serializeV1 writes the state in the binary layout of StateVersionV1, which deserializeV1 reads.
+// The layout is the same as that of serializeV2, without the fields that StateVersionV2 added:
+//
+// Memory                      As per Memory.Serialize
+// PreimageKey                 [32]byte
+// PreimageOffset              uint64
+// PC                          uint64
+// ExitCode                    uint8
+// Exited                      bool - 0 for false, 1 for true
+// Step                        uint64
+// Heap                        uint64
+// LoadReservation             uint64
+// Registers                   [32]uint64
+// len(LastHint)               uint64 (0 when LastHint is nil)
+// LastHint                    []byte
+// len(Witness)                uint64 (0 when Witness is nil)
+// Witness                     []byte
+// StateHash                   [32]byte
+func (s *VMState) serializeV1(out io.Writer) error {
+	bout := serialize.NewBinaryWriter(out)
+	if err := s.Memory.Serialize(out); err != nil {
+		return err
+	}
+	if err := bout.WriteHash(s.PreimageKey); err != nil {
+		return err
+	}
+	for _, v := range []any{s.PreimageOffset, s.PC, s.ExitCode} {
+		if err := bout.WriteUInt(v); err != nil {
+			return err
+		}
+	}
+	if err := bout.WriteBool(s.Exited); err != nil {
+		return err
+	}
+	for _, v := range append([]uint64{s.Step, s.Heap, s.LoadReservation}, s.Registers[:]...) {
+		if err := bout.WriteUInt(v); err != nil {
+			return err
+		}
+	}
+	if err := bout.WriteBytes(s.LastHint); err != nil {
+		return err
+	}
+	if err := bout.WriteBytes(s.Witness); err != nil {
+		return err
+	}
+	return bout.WriteHash(s.StateHash)
+}
+
+func (s *VMState) deserializeV1(in io.Reader) error {
+	bin := serialize.NewBinaryReader(in)
+	s.Memory = NewMemory()
+	if err := s.Memory.Deserialize(in); err != nil {
+		return err
+	}
+	if err := bin.ReadHash(&s.PreimageKey); err != nil {
+		return err
+	}
+	for _, v := range []any{&s.PreimageOffset, &s.PC, &s.ExitCode} {
+		if err := bin.ReadUInt(v); err != nil {
+			return err
+		}
+	}
+	if err := bin.ReadBool(&s.Exited); err != nil {
+		return err
+	}
+	for _, v := range []*uint64{&s.Step, &s.Heap, &s.LoadReservation} {
+		if err := bin.ReadUInt(v); err != nil {
+			return err
+		}
+	}
+	for i := range s.Registers {
+		if err := bin.ReadUInt(&s.Registers[i]); err != nil {
+			return err
+		}
+	}
+	if err := bin.ReadBytes((*[]byte)(&s.LastHint)); err != nil {
+		return err
+	}
+	if err := bin.ReadBytes((*[]byte)(&s.Witness)); err != nil {
+		return err
+	}
+	if err := bin.ReadHash(&s.StateHash); err != nil {
+		return err
+	}
+	s.resetV2()
+	return nil
+}
@@ -0,0 +1,170 @@
+package fast
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+func testVersionedState(version StateVersion) *VersionedState {
+	mem := NewMemory()
+	mem.AllocPage(7).Data[3] = 0x42
+	state := &VMState{
+		Memory:          mem,
+		PreimageKey:     common.Hash{0xaa},
+		PreimageOffset:  8,
+		PC:              0x1004,
+		Step:            100,
+		Heap:            1 << 28,
+		LoadReservation: ^uint64(0),
+		Registers:       [32]uint64{1: 0x1000, 2: 0x2000, 10: 7},
+		LastHint:        hexutil.Bytes{0, 0, 0, 1, 9},
+	}
+	state.resetV2()
+	if version >= StateVersionV2 {
+		state.FPRegisters[3] = 0x3ff0000000000000
+		state.ClockEpoch = 1_700_000_000_000_000_000
+		state.LeftThreads = []ThreadState{{ThreadID: 2, PC: 0x2000}}
+		state.NextThreadID = 3
+		state.MemoryRegions[0] = MemoryRegion{Start: 0x1000, End: 0x2000, Prot: riscv.ProtRead | riscv.ProtExec}
+	}
+	return &VersionedState{Version: version, VMState: state}
+}
+
+func TestVersionedStateRoundTrip(t *testing.T) {
+	for _, version := range StateVersions {
+		t.Run(version.String(), func(t *testing.T) {
+			state := testVersionedState(version)
+
+			var bin bytes.Buffer
+			require.NoError(t, state.Serialize(&bin))
+			// only the states after StateVersionV1 have a header
+			require.Equal(t, version != StateVersionV1, bytes.HasPrefix(bin.Bytes(), []byte("ASTS")))
+			fromBin := &VersionedState{}
+			require.NoError(t, fromBin.Deserialize(&bin))
+			require.Equal(t, state, fromBin)
+
+			data, err := json.Marshal(state)
+			require.NoError(t, err)
+			fromJSON := &VersionedState{}
+			require.NoError(t, json.Unmarshal(data, fromJSON))
+			require.Equal(t, state, fromJSON)
+		})
+	}
+}
+
+func TestVersionedStateLegacy(t *testing.T) {
+	state := testVersionedState(StateVersionV1)
+	var bin bytes.Buffer
+	require.NoError(t, state.serializeV1(&bin))
+	var legacy VersionedState
+	require.NoError(t, legacy.Deserialize(bytes.NewReader(bin.Bytes())))
+	require.Equal(t, StateVersionV1, legacy.Version)
+	require.Equal(t, state, &legacy)
+
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"version"`)
+	require.NotContains(t, string(data), `"threadID"`)
+
+	// the VM only runs the latest version
+	require.ErrorContains(t, new(VMState).Deserialize(bytes.NewReader(bin.Bytes())), "upgrade it with asterisc convert")
+	require.ErrorContains(t, json.Unmarshal(data, new(VMState)), "upgrade it with asterisc convert")
+}
+
+func TestVersionedStateBaselineV1(t *testing.T) {
+	// the states were written by the first release: load-elf of rv64ui-p-add, run up to step 100
+	for _, name := range []string{"v1-step100.json", "v1-step100.bin.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("test_data", name)
+			state, err := LoadStateFromFile(path)
+			require.NoError(t, err)
+			require.Equal(t, StateVersionV1, state.Version)
+			require.Equal(t, uint64(0x8000_0200), state.PC)
+			require.Equal(t, uint64(100), state.Step)
+			require.Equal(t, UnprotectedRegions(), state.MemoryRegions)
+			witness := state.EncodeWitness()
+			require.Len(t, witness, STATE_WITNESS_SIZE_V1)
+			stateHash, err := witness.StateHash()
+			require.NoError(t, err)
+			require.Equal(t, common.HexToHash("0x03becc82df120e826c6b58fa0f77499b945b7faf16432aa7dcb3977d12f5a822"), stateHash)
+
+			if name == "v1-step100.bin.gz" { // the state is written back as it was
+				f, err := os.Open(path)
+				require.NoError(t, err)
+				defer f.Close()
+				gz, err := gzip.NewReader(f)
+				require.NoError(t, err)
+				want, err := io.ReadAll(gz)
+				require.NoError(t, err)
+				var bin bytes.Buffer
+				require.NoError(t, state.Serialize(&bin))
+				require.Equal(t, want, bin.Bytes())
+			} else {
+				require.Equal(t, []byte(witness), state.Witness)
+			}
+		})
+	}
+}
+
+func TestVersionedStateChecksum(t *testing.T) {
+	var bin bytes.Buffer
+	require.NoError(t, testVersionedState(LatestStateVersion).Serialize(&bin))
+	data := bin.Bytes()
+	data[len(data)/2] ^= 1
+	require.ErrorContains(t, new(VersionedState).Deserialize(bytes.NewReader(data)), "invalid state checksum")
+
+	data[len(data)/2] ^= 1
+	data[4] = 0xff
+	require.ErrorIs(t, new(VersionedState).Deserialize(bytes.NewReader(data)), ErrUnknownVersion)
+}
+
+func TestVersionedStateConvert(t *testing.T) {
+	state := testVersionedState(StateVersionV2)
+	require.NoError(t, state.SetWitnessAndStateHash())
+
+	err := state.Convert(StateVersionV1, false)
+	require.ErrorContains(t, err, "state version v1 cannot encode the floating point registers, threads, clock, memory regions of the state")
+	require.Equal(t, StateVersionV2, state.Version)
+
+	require.NoError(t, state.Convert(StateVersionV1, true))
+	want := testVersionedState(StateVersionV1)
+	require.NoError(t, want.SetWitnessAndStateHash())
+	// the memory caches the merkle tree of the witness
+	want.Memory = state.Memory
+	require.Equal(t, want, state)
+	require.Len(t, state.Witness, STATE_WITNESS_SIZE_V1)
+	v1Witness := state.Witness
+
+	require.NoError(t, state.Convert(StateVersionV2, false))
+	require.Equal(t, StateVersionV2, state.Version)
+	require.Equal(t, state.EncodeWitness(), StateWitness(state.Witness))
+	// the fields of the v2 witness extend the ones of v1
+	require.Equal(t, v1Witness, state.Witness[:STATE_WITNESS_SIZE_V1])
+
+	state.Witness = nil
+	require.NoError(t, state.Convert(StateVersionV1, false))
+	require.Nil(t, state.Witness)
+
+	require.ErrorIs(t, state.Convert(3, true), ErrUnknownVersion)
+}
+
+func TestParseStateVersion(t *testing.T) {
+	for s, want := range map[string]StateVersion{"v1": StateVersionV1, "2": StateVersionV2, "latest": LatestStateVersion} {
+		v, err := ParseStateVersion(s)
+		require.NoError(t, err)
+		require.Equal(t, want, v)
+	}
+	_, err := ParseStateVersion("v9")
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
@@ -4,15 +4,21 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
 )
 
 type UnsupportedSyscallErr struct {
 	SyscallNum U64
+	// PC is the address of the ECALL, if known
+	PC U64
 }
 
 func (e *UnsupportedSyscallErr) Error() string {
+	if e.PC != 0 {
+		return fmt.Sprintf("unsupported system call: %d at pc %016x", e.SyscallNum, e.PC)
+	}
 	return fmt.Sprintf("unsupported system call: %d", e.SyscallNum)
 }
 
@@ -32,22 +38,48 @@ func (e *UnrecognizedResourceErr) Error() string {
 	return fmt.Sprintf("unrecognized resource limit lookup: %d", e.Resource)
 }
 
+// memoryFault unwinds a step that ended the program, because it accessed memory without the required permission
+type memoryFault struct{}
+
 // riscvStep runs a single instruction
 // Note: errors are only returned in debugging/tooling modes, not in production use.
 func (inst *InstrumentedState) riscvStep() (outErr error) {
 	var revertCode uint64
+	// the PC of the instruction of this step, once fetched, to disassemble it in revert errors
+	var instrPC *U64
+	// the trace of the syscall of this step until it is emitted, to also emit it if the syscall does not complete
+	var syscallTrace *SyscallTrace
 	defer func() {
 		if errInterface := recover(); errInterface != nil {
+			if _, ok := errInterface.(memoryFault); ok { // the step completed with the fault
+				if syscallTrace != nil {
+					finishSyscallTrace(inst.state, syscallTrace)
+					inst.syscallTracer(syscallTrace)
+				}
+				return
+			}
+			revert := "revert"
+			if instrPC != nil {
+				revert = fmt.Sprintf("revert at pc %016x (%s)", *instrPC, riscv.Disassemble(inst.state.InstrAt(*instrPC), *instrPC))
+			}
 			if err, ok := errInterface.(error); ok {
-				outErr = fmt.Errorf("revert: %w", err)
+				outErr = fmt.Errorf("%s: %w", revert, err)
 			} else {
-				outErr = fmt.Errorf("revert: %v", err) // nolint:errorlint
+				outErr = fmt.Errorf("%s: %v", revert, err) // nolint:errorlint
 			}
 
 		}
 		if revertCode != 0 {
 			outErr = fmt.Errorf("revert %x: %w", revertCode, outErr)
 		}
+		if syscallTrace != nil && outErr != nil {
+			syscallTrace.Status = SyscallReverted
+			syscallTrace.Revert = outErr.Error()
+			inst.syscallTracer(syscallTrace)
+		}
+		if outErr != nil && inst.callStacks != nil {
+			outErr = &CallStackError{Err: outErr, Stack: slices.Clone(inst.callStacks.Stack(inst.state.ThreadID))}
+		}
 	}()
 
 	revertWithCode := func(code uint64, err error) {
@@ -156,19 +188,332 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		s.Registers[reg] = v
 	}
 
+	getFPRegister := func(reg U64) U64 {
+		if reg > 31 {
+			revertWithCode(riscv.ErrInvalidRegister, fmt.Errorf("cannot load invalid floating point register: %d", reg))
+		}
+		return s.FPRegisters[reg]
+	}
+	setFPRegister := func(reg U64, v U64) {
+		if reg >= 32 {
+			panic(fmt.Errorf("unknown floating point register %d, cannot write %x", reg, v))
+		}
+		s.FPRegisters[reg] = v
+	}
+
+	getFCSR := func() U64 {
+		return s.FCSR
+	}
+	setFCSR := func(v U64) {
+		s.FCSR = v
+	}
+
+	getThreadID := func() U64 {
+		return s.ThreadID
+	}
+
+	getFutexAddr := func() U64 {
+		return s.FutexAddr
+	}
+	setFutexAddr := func(addr U64) {
+		s.FutexAddr = addr
+	}
+
+	getFutexVal := func() U64 {
+		return s.FutexVal
+	}
+	setFutexVal := func(v U64) {
+		s.FutexVal = v
+	}
+
+	getFutexTimeoutStep := func() U64 {
+		return s.FutexTimeoutStep
+	}
+	setFutexTimeoutStep := func(v U64) {
+		s.FutexTimeoutStep = v
+	}
+
+	getStepsSinceContextSwitch := func() U64 {
+		return s.StepsSinceContextSwitch
+	}
+	setStepsSinceContextSwitch := func(v U64) {
+		s.StepsSinceContextSwitch = v
+	}
+
+	getNextThreadID := func() U64 {
+		return s.NextThreadID
+	}
+	setNextThreadID := func(v U64) {
+		s.NextThreadID = v
+	}
+
+	getClockEpoch := func() U64 {
+		return s.ClockEpoch
+	}
+
+	getClockOffset := func() U64 {
+		return s.ClockOffset
+	}
+	setClockOffset := func(v U64) {
+		s.ClockOffset = v
+	}
+
+	getRandomState := func() U64 {
+		return s.RandomState
+	}
+	setRandomState := func(v U64) {
+		s.RandomState = v
+	}
+
+	getTraverseRight := func() bool {
+		return s.TraverseRight
+	}
+	setTraverseRight := func(right bool) {
+		s.TraverseRight = right
+	}
+
+	//
+	// Clock
+	//
+
+	// getMonotonicTime returns the time of the virtual clock in nanoseconds:
+	// one nanosecond for every step before the current one, plus the time that threads slept.
+	getMonotonicTime := func() U64 {
+		return add64(sub64(getStep(), byteToU64(1)), getClockOffset())
+	}
+
+	//
+	// Threads
+	//
+	// The running thread is part of the state. All other threads are suspended on two stacks:
+	// the scheduler pops the next thread to run from one stack, and pushes the preempted thread onto the other.
+	// Once the stack of threads to run is empty, the stacks swap roles by flipping the traversal direction.
+	//
+
+	threadStackEmpty := func(right bool) bool {
+		return len(*s.threadStack(right)) == 0
+	}
+
+	pushThread := func(right bool, t ThreadState) {
+		stack := s.threadStack(right)
+		*stack = append(*stack, t)
+	}
+
+	// popThread resumes the thread at the top of the given stack, replacing the running thread
+	popThread := func(right bool) {
+		stack := s.threadStack(right)
+		n := len(*stack)
+		if n == 0 {
+			revertWithCode(riscv.ErrBadThreadProof, fmt.Errorf("cannot pop a thread from an empty thread stack"))
+		}
+		t := (*stack)[n-1]
+		*stack = (*stack)[:n-1]
+		inst.trackThreadPop(&t, *stack)
+		s.setActiveThread(&t)
+	}
+
+	// preemptThread suspends the running thread, and resumes the next thread, if there is any other thread.
+	// If there is no thread left to run in the current traversal direction, the direction is flipped first.
+	preemptThread := func() {
+		right := getTraverseRight()
+		if threadStackEmpty(right) {
+			if threadStackEmpty(!right) { // the only thread keeps running
+				return
+			}
+			right = !right
+			setTraverseRight(right)
+		}
+		pushThread(!right, s.activeThread())
+		popThread(right)
+		setStepsSinceContextSwitch(byteToU64(0))
+		setLoadReservation(byteToU64(0))
+	}
+
+	// exitThread drops the running thread, and resumes the next thread. There must be another thread.
+	exitThread := func() {
+		right := getTraverseRight()
+		if threadStackEmpty(right) {
+			right = !right
+			setTraverseRight(right)
+		}
+		popThread(right)
+		setStepsSinceContextSwitch(byteToU64(0))
+		setLoadReservation(byteToU64(0))
+	}
+
+	// yieldThread makes the running thread get preempted at the start of the next step
+	yieldThread := func() {
+		setStepsSinceContextSwitch(riscv.SchedQuantum)
+	}
+
+	// wakeFutex ends the FUTEX_WAIT of the running thread, with the given syscall return values
+	wakeFutex := func(ret U64, errCode U64) {
+		setFutexAddr(byteToU64(0))
+		setFutexVal(byteToU64(0))
+		setFutexTimeoutStep(byteToU64(0))
+		setRegister(byteToU64(10), ret)
+		setRegister(byteToU64(11), errCode)
+	}
+
 	//
 	// Parse - functions to parse RISC-V instructions - see parse.go
 	//
 
+	//
+	// Memory permissions
+	//
+	// Memory is readable and writable, with riscv.ProtDefault, except in the memory regions of the state.
+	// The regions are page-aligned and do not overlap, and unused regions are zero.
+	//
+
+	getMemoryRegion := func(i uint64) (start U64, end U64, prot U64) {
+		r := &s.MemoryRegions[i]
+		return r.Start, r.End, U64(r.Prot)
+	}
+	setMemoryRegion := func(i uint64, start U64, end U64, prot U64) {
+		s.MemoryRegions[i] = MemoryRegion{Start: start, End: end, Prot: uint8(prot)}
+	}
+
+	// addMemoryRegion uses the first unused memory region for the given range. There must be an unused region.
+	addMemoryRegion := func(start U64, end U64, prot U64) {
+		for i := uint64(0); i < riscv.MemoryRegionCount; i++ {
+			if rStart, rEnd, _ := getMemoryRegion(i); lt64(rStart, rEnd) == 0 {
+				setMemoryRegion(i, start, end, prot)
+				return
+			}
+		}
+	}
+
+	// getProt returns the permissions of the memory at the given address
+	getProt := func(addr U64) U64 {
+		for i := uint64(0); i < riscv.MemoryRegionCount; i++ {
+			if start, end, prot := getMemoryRegion(i); lt64(addr, start) == 0 && lt64(addr, end) != 0 {
+				return prot
+			}
+		}
+		return riscv.ProtDefault
+	}
+
+	// traceMemAccess reports a memory access that passed checkMemAccess to the memory tracer, if any
+	traceMemAccess := func(addr U64, size U64, prot U64) {
+		if inst.memoryTracer != nil {
+			inst.memoryTracer(addr, size, uint8(prot))
+		}
+		if inst.stats != nil {
+			inst.stats.memAccess(addr, size, prot)
+		}
+	}
+
+	// checkMemAccess ends the program with a fault, unless the size bytes at addr all have the given permissions.
+	// Regions are page-aligned, so it is enough to check the first and the last byte.
+	checkMemAccess := func(addr U64, size U64, prot U64) {
+		last := add64(addr, sub64(size, byteToU64(1)))
+		if and64(getProt(addr), prot) != prot || and64(getProt(last), prot) != prot {
+			setExitCode(riscv.ExitCodeFault)
+			setExited()
+			panic(memoryFault{})
+		}
+	}
+
+	// protectRange sets the permissions of the non-empty page-aligned range [start, end).
+	// Regions that overlap the range are cut back, and a region that extends on both sides of the range is split.
+	// It returns false, without any change, if there are not enough unused regions.
+	protectRange := func(start U64, end U64, prot U64) bool {
+		available := byteToU64(0)
+		needed := byteToU64(0)
+		if prot != riscv.ProtDefault {
+			needed = byteToU64(1)
+		}
+		for i := uint64(0); i < riscv.MemoryRegionCount; i++ {
+			rStart, rEnd, rProt := getMemoryRegion(i)
+			if lt64(rStart, rEnd) == 0 || (lt64(rStart, start) == 0 && lt64(end, rEnd) == 0) { // unused, or covered
+				available = add64(available, byteToU64(1))
+			} else if lt64(start, rStart) == 0 && lt64(rEnd, end) == 0 { // the region contains the range
+				if rProt == prot {
+					return true
+				}
+				if lt64(rStart, start) != 0 && lt64(end, rEnd) != 0 {
+					needed = add64(needed, byteToU64(1))
+				}
+			}
+		}
+		if lt64(available, needed) != 0 {
+			return false
+		}
+		// a split region only gets its upper part back after the covered regions are cleared
+		splitEnd, splitProt := byteToU64(0), byteToU64(0)
+		for i := uint64(0); i < riscv.MemoryRegionCount; i++ {
+			rStart, rEnd, rProt := getMemoryRegion(i)
+			if lt64(rStart, end) == 0 || lt64(start, rEnd) == 0 { // no overlap, or unused
+				continue
+			}
+			if lt64(rStart, start) != 0 {
+				setMemoryRegion(i, rStart, start, rProt)
+				if lt64(end, rEnd) != 0 {
+					splitEnd, splitProt = rEnd, rProt
+				}
+			} else if lt64(end, rEnd) != 0 {
+				setMemoryRegion(i, end, rEnd, rProt)
+			} else {
+				setMemoryRegion(i, byteToU64(0), byteToU64(0), byteToU64(0))
+			}
+		}
+		if splitEnd != 0 {
+			addMemoryRegion(end, splitEnd, splitProt)
+		}
+		if prot != riscv.ProtDefault {
+			addMemoryRegion(start, end, prot)
+		}
+		return true
+	}
+
+	// unusedMemoryRegions returns the number of unused memory regions
+	unusedMemoryRegions := func() (out U64) {
+		for i := uint64(0); i < riscv.MemoryRegionCount; i++ {
+			if start, end, _ := getMemoryRegion(i); lt64(start, end) == 0 {
+				out = add64(out, byteToU64(1))
+			}
+		}
+		return
+	}
+
+	// mapProt returns the permissions for the prot argument of mmap and mprotect.
+	// PROT_NONE only reserves memory, which the program maps again before it uses it:
+	// reserved memory gets the permissions of data, which need no region.
+	mapProt := func(prot U64) U64 {
+		prot = and64(prot, byteToU64(riscv.ProtRead|riscv.ProtWrite|riscv.ProtExec))
+		if iszero64(prot) {
+			return riscv.ProtDefault
+		}
+		return prot
+	}
+
+	// isWritableExec returns whether the permissions allow both writes and execution, which W^X forbids
+	isWritableExec := func(prot U64) bool {
+		return and64(prot, byteToU64(riscv.ProtWrite|riscv.ProtExec)) == riscv.ProtWrite|riscv.ProtExec
+	}
+
 	//
 	// Memory functions
 	//
 
+	// A 4-byte instruction that straddles two leaves is fetched with an additional memory proof,
+	// and the proofs of any data memory accesses are then shifted by one.
+	memProofOffset := uint8(0)
+
+	trackMemAccess := func(addr U64, proofIndex uint8) {
+		inst.trackMemAccess(addr, memProofOffset+proofIndex)
+	}
+
+	verifyMemChange := func(addr U64, proofIndex uint8) {
+		inst.verifyMemChange(addr, memProofOffset+proofIndex)
+	}
+
 	getMemoryB32 := func(addr U64, proofIndex uint8) (out [32]byte) {
 		if addr&31 != 0 { // quick addr alignment check
 			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("addr %d not aligned with 32 bytes", addr))
 		}
-		inst.trackMemAccess(addr, proofIndex)
+		trackMemAccess(addr, proofIndex)
 		s.Memory.GetUnaligned(addr, out[:])
 		return
 	}
@@ -177,7 +522,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		if addr&31 != 0 {
 			panic(fmt.Errorf("addr %d not aligned with 32 bytes", addr))
 		}
-		inst.verifyMemChange(addr, proofIndex)
+		verifyMemChange(addr, proofIndex)
 		s.Memory.SetUnaligned(addr, v[:])
 	}
 
@@ -186,12 +531,14 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		if size > 8 {
 			revertWithCode(riscv.ErrLoadExceeds8Bytes, fmt.Errorf("cannot load more than 8 bytes: %d", size))
 		}
-		inst.trackMemAccess(addr&^31, proofIndexL)
+		checkMemAccess(addr, size, riscv.ProtRead)
+		traceMemAccess(addr, size, riscv.ProtRead)
+		trackMemAccess(addr&^31, proofIndexL)
 		if (addr+size-1)&^31 != addr&^31 {
 			if proofIndexR == 0xff {
 				revertWithCode(riscv.ErrUnexpectedRProofLoad, fmt.Errorf("unexpected need for right-side proof %d in loadMem", proofIndexR))
 			}
-			inst.trackMemAccess((addr+size-1)&^31, proofIndexR)
+			trackMemAccess((addr+size-1)&^31, proofIndexR)
 		}
 		var v [8]byte
 		s.Memory.GetUnaligned(addr, v[:size])
@@ -208,6 +555,8 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		if size > 32 {
 			revertWithCode(riscv.ErrStoreExceeds32Bytes, fmt.Errorf("cannot store more than 32 bytes: %d", size))
 		}
+		checkMemAccess(addr, size, riscv.ProtWrite)
+		traceMemAccess(addr, size, riscv.ProtWrite)
 		var bytez [32]byte
 		binary.LittleEndian.PutUint64(bytez[:8], value[0])
 		binary.LittleEndian.PutUint64(bytez[8:16], value[1])
@@ -216,9 +565,9 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 
 		leftAddr := addr &^ 31
 		if verifyL {
-			inst.trackMemAccess(leftAddr, proofIndexL)
+			trackMemAccess(leftAddr, proofIndexL)
 		}
-		inst.verifyMemChange(leftAddr, proofIndexL)
+		verifyMemChange(leftAddr, proofIndexL)
 		if (addr+size-1)&^31 == addr&^31 { // if aligned
 			s.Memory.SetUnaligned(addr, bytez[:size])
 			return
@@ -231,9 +580,9 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		leftSize := rightAddr - addr
 		s.Memory.SetUnaligned(addr, bytez[:leftSize])
 		if verifyR {
-			inst.trackMemAccess(rightAddr, proofIndexR)
+			trackMemAccess(rightAddr, proofIndexR)
 		}
-		inst.verifyMemChange(rightAddr, proofIndexR)
+		verifyMemChange(rightAddr, proofIndexR)
 		s.Memory.SetUnaligned(rightAddr, bytez[leftSize:size])
 	}
 
@@ -241,13 +590,15 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		if size > 8 {
 			revertWithCode(riscv.ErrStoreExceeds8Bytes, fmt.Errorf("cannot store more than 8 bytes: %d", size))
 		}
+		checkMemAccess(addr, size, riscv.ProtWrite)
+		traceMemAccess(addr, size, riscv.ProtWrite)
 		var bytez [8]byte
 		binary.LittleEndian.PutUint64(bytez[:], value)
 		leftAddr := addr &^ 31
 		if verifyL {
-			inst.trackMemAccess(leftAddr, proofIndexL)
+			trackMemAccess(leftAddr, proofIndexL)
 		}
-		inst.verifyMemChange(leftAddr, proofIndexL)
+		verifyMemChange(leftAddr, proofIndexL)
 		if (addr+size-1)&^31 == addr&^31 { // if aligned
 			s.Memory.SetUnaligned(addr, bytez[:size])
 			return
@@ -260,12 +611,220 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		leftSize := rightAddr - addr
 		s.Memory.SetUnaligned(addr, bytez[:leftSize])
 		if verifyR {
-			inst.trackMemAccess(rightAddr, proofIndexR)
+			trackMemAccess(rightAddr, proofIndexR)
 		}
-		inst.verifyMemChange(rightAddr, proofIndexR)
+		verifyMemChange(rightAddr, proofIndexR)
 		s.Memory.SetUnaligned(rightAddr, bytez[leftSize:size])
 	}
 
+	// zeroMemoryBlock zeroes the aligned block of 2**sizeBits bytes at the given address, a block of at least a page.
+	// The memory proof of the first leaf of the block also proves the block: the siblings above it are the same.
+	zeroMemoryBlock := func(addr U64, sizeBits U64, proofIndex uint8) {
+		trackMemAccess(addr, proofIndex)
+		s.Memory.FreePages(shr64(byteToU64(PageAddrSize), addr), shl64(sub64(sizeBits, byteToU64(PageAddrSize)), byteToU64(1)))
+	}
+
+	// loadTimespec loads the seconds and nanoseconds of a timespec struct, starting at the given proof index.
+	// The nanoseconds are loaded with the memory proofs after the ones used for the seconds.
+	loadTimespec := func(addr U64, proofIndex uint8) (sec U64, nsec U64) {
+		sec = loadMem(addr, byteToU64(8), false, proofIndex, proofIndex+1)
+		if and64(add64(addr, byteToU64(7)), not64(byteToU64(31))) != and64(addr, not64(byteToU64(31))) {
+			proofIndex++ // the seconds span two leaves
+		}
+		nsec = loadMem(add64(addr, byteToU64(8)), byteToU64(8), false, proofIndex+1, proofIndex+2)
+		return
+	}
+
+	// validTimespec returns whether the seconds and nanoseconds of a timespec struct are a valid duration
+	validTimespec := func(sec U64, nsec U64) bool {
+		return shr64(byteToU64(63), sec) == 0 && lt64(nsec, riscv.NanosPerSecond) != 0
+	}
+
+	// futexWaitSteps returns the number of steps a FUTEX_WAIT with the given timeout of a timespec struct waits,
+	// one step per nanosecond of the virtual clock, up to FutexTimeoutSteps.
+	// The clock jumps over the rest of the timeout once the wait times out.
+	futexWaitSteps := func(sec U64, nsec U64) U64 {
+		timeout := add64(mul64(sec, riscv.NanosPerSecond), nsec)
+		if lt64(timeout, riscv.FutexTimeoutSteps) != 0 {
+			return timeout
+		}
+		return riscv.FutexTimeoutSteps
+	}
+
+	//
+	// Memory allocation
+	//
+	// mmap allocates from the free range at the top of the free range stack if it fits, and grows the heap otherwise.
+	// munmap releases the largest aligned block of the range per step, and pushes the block onto the free range stack,
+	// or extends the range at the top of the stack if the block directly follows it.
+	//
+	// MAP_FIXED below the heap carves its range out of the free range at the top of the stack, and pushes a mapped
+	// range, marked with riscv.FreeRangeMapped in its address, between them: the free ranges below a mapped range
+	// may overlap it. mmap carves a mapped range out of the free range below it before it allocates, one range per
+	// step, and mapped ranges that meet on the stack merge into the range that spans them both.
+	//
+
+	freeRangeStackEmpty := func() bool {
+		return len(s.FreeRanges) == 0
+	}
+
+	pushFreeRange := func(addr U64, size U64) {
+		s.FreeRanges = append(s.FreeRanges, FreeRange{Addr: addr, Size: size})
+	}
+
+	// popFreeRange removes the range at the top of the free range stack
+	popFreeRange := func() (addr U64, size U64) {
+		n := len(s.FreeRanges)
+		if n == 0 {
+			revertWithCode(riscv.ErrBadFreeRangeProof, fmt.Errorf("cannot pop a range from an empty free range stack"))
+		}
+		r := s.FreeRanges[n-1]
+		s.FreeRanges = s.FreeRanges[:n-1]
+		inst.trackFreeRangePop(&r, s.FreeRanges)
+		return r.Addr, r.Size
+	}
+
+	// mapRange maps the page-aligned range at the given address.
+	// If the range ends above the heap, the heap grows to its end, and any gap below the range becomes free.
+	mapRange := func(addr U64, length U64) {
+		heap := getHeap()
+		end := add64(addr, length)
+		if lt64(heap, end) != 0 {
+			if lt64(heap, addr) != 0 {
+				pushFreeRange(heap, sub64(addr, heap))
+			}
+			setHeap(end)
+		}
+	}
+
+	isMappedRange := func(addr U64) bool {
+		return and64(addr, byteToU64(riscv.FreeRangeMapped)) != 0
+	}
+
+	// pushMappedRange pushes the mapped range from addr to end, merged with the mapped range at mergeAddr and mergeEnd
+	pushMappedRange := func(addr U64, end U64, mergeAddr U64, mergeEnd U64) {
+		if lt64(mergeAddr, addr) != 0 {
+			addr = mergeAddr
+		}
+		if lt64(end, mergeEnd) != 0 {
+			end = mergeEnd
+		}
+		pushFreeRange(or64(addr, byteToU64(riscv.FreeRangeMapped)), sub64(end, addr))
+	}
+
+	// pushCarvedRange pushes what remains of the free range at rangeAddr with rangeSize, without the range from addr to end
+	pushCarvedRange := func(rangeAddr U64, rangeSize U64, addr U64, end U64) {
+		rangeEnd := add64(rangeAddr, rangeSize)
+		if lt64(rangeAddr, addr) != 0 {
+			leftEnd := addr
+			if lt64(rangeEnd, addr) != 0 {
+				leftEnd = rangeEnd
+			}
+			pushFreeRange(rangeAddr, sub64(leftEnd, rangeAddr))
+		}
+		if lt64(end, rangeEnd) != 0 {
+			rightAddr := end
+			if lt64(end, rangeAddr) != 0 {
+				rightAddr = rangeAddr
+			}
+			pushFreeRange(rightAddr, sub64(rangeEnd, rightAddr))
+		}
+	}
+
+	// carveFixedRange carves the range from addr to end, that MAP_FIXED maps, out of the free ranges below the heap
+	carveFixedRange := func(addr U64, end U64) {
+		heap := getHeap()
+		if lt64(addr, heap) == 0 || freeRangeStackEmpty() {
+			return
+		}
+		if lt64(heap, end) != 0 { // all memory above the heap is free, and not on the stack
+			end = heap
+		}
+		rangeAddr, rangeSize := popFreeRange()
+		if isMappedRange(rangeAddr) {
+			rangeAddr = xor64(rangeAddr, byteToU64(riscv.FreeRangeMapped))
+			pushMappedRange(addr, end, rangeAddr, add64(rangeAddr, rangeSize))
+			return
+		}
+		if !freeRangeStackEmpty() { // the free ranges further below are carved when mmap reaches them
+			pushMappedRange(addr, end, addr, end)
+		}
+		pushCarvedRange(rangeAddr, rangeSize, addr, end)
+	}
+
+	// allocRange allocates a page-aligned range of the given length, and returns its address.
+	// If a mapped range is at the top of the free range stack, it carves that out of the range below it instead,
+	// and returns retry: the syscall has to run again.
+	allocRange := func(length U64) (addr U64, errCode U64, retry bool) {
+		if !freeRangeStackEmpty() {
+			rangeAddr, rangeSize := popFreeRange()
+			if isMappedRange(rangeAddr) {
+				rangeAddr = xor64(rangeAddr, byteToU64(riscv.FreeRangeMapped))
+				rangeEnd := add64(rangeAddr, rangeSize)
+				if !freeRangeStackEmpty() { // a mapped range at the bottom of the stack is dropped
+					belowAddr, belowSize := popFreeRange()
+					if isMappedRange(belowAddr) {
+						belowAddr = xor64(belowAddr, byteToU64(riscv.FreeRangeMapped))
+						pushMappedRange(rangeAddr, rangeEnd, belowAddr, add64(belowAddr, belowSize))
+					} else {
+						if !freeRangeStackEmpty() {
+							pushMappedRange(rangeAddr, rangeEnd, rangeAddr, rangeEnd)
+						}
+						pushCarvedRange(belowAddr, belowSize, rangeAddr, rangeEnd)
+					}
+				}
+				return u64Mask(), byteToU64(0), true
+			}
+			if lt64(rangeSize, length) == 0 { // the range fits, the remainder stays free
+				if rangeSize != length {
+					pushFreeRange(add64(rangeAddr, length), sub64(rangeSize, length))
+				}
+				return rangeAddr, byteToU64(0), false
+			}
+			pushFreeRange(rangeAddr, rangeSize) // too small, keep it for smaller allocations
+		}
+		heap := getHeap()
+		if lt64(add64(heap, length), heap) != 0 {
+			return u64Mask(), byteToU64(0xc), false // ENOMEM
+		}
+		setHeap(add64(heap, length))
+		return heap, byteToU64(0), false
+	}
+
+	// freeRange makes the unmapped page-aligned range at the given address free, as far as it is below the heap
+	freeRange := func(addr U64, size U64) {
+		heap := getHeap()
+		if lt64(addr, heap) == 0 { // all memory above the heap is free already
+			return
+		}
+		if lt64(sub64(heap, addr), size) != 0 {
+			size = sub64(heap, addr)
+		}
+		if !freeRangeStackEmpty() {
+			rangeAddr, rangeSize := popFreeRange()
+			if add64(rangeAddr, rangeSize) == addr { // a mapped range has an odd address, and never matches
+				pushFreeRange(rangeAddr, add64(rangeSize, size))
+				return
+			}
+			pushFreeRange(rangeAddr, rangeSize)
+		}
+		pushFreeRange(addr, size)
+	}
+
+	// unmapBlockBits returns the size bits of the block that munmap releases in a step: the largest aligned block at
+	// the page-aligned address that fits in the length, or the page at the address if the length is less than a page.
+	unmapBlockBits := func(addr U64, length U64) (bits U64) {
+		bits = byteToU64(PageAddrSize)
+		for lt64(bits, byteToU64(63)) != 0 {
+			next := shl64(add64(bits, byteToU64(1)), byteToU64(1))
+			if and64(addr, sub64(next, byteToU64(1))) != 0 || lt64(length, next) != 0 {
+				break
+			}
+			bits = add64(bits, byteToU64(1))
+		}
+		return
+	}
+
 	//
 	// Preimage oracle interactions
 	//
@@ -277,6 +836,8 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			count = maxData
 		}
 
+		checkMemAccess(addr, byteToU64(1), riscv.ProtRead) // the leaf is within a page
+		traceMemAccess(addr, count, riscv.ProtRead)
 		dat := b32asBEWord(getMemoryB32(sub64(addr, alignment), 1))
 		// shift out leading bits
 		dat = shl(u64ToU256(shl64(byteToU64(3), alignment)), dat)
@@ -309,14 +870,16 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		if iszero64(pdatlen) { // EOF
 			return byteToU64(0)
 		}
-		alignment := and64(addr, byteToU64(31))    // how many bytes addr is offset from being left-aligned
-		maxData := sub64(byteToU64(32), alignment) // higher alignment leaves less room for data this step
+		checkMemAccess(addr, byteToU64(1), riscv.ProtWrite) // the leaf is within a page
+		alignment := and64(addr, byteToU64(31))             // how many bytes addr is offset from being left-aligned
+		maxData := sub64(byteToU64(32), alignment)          // higher alignment leaves less room for data this step
 		if gt64(count, maxData) != 0 {
 			count = maxData
 		}
 		if gt64(count, pdatlen) != 0 { // cannot read more than pdatlen
 			count = pdatlen
 		}
+		traceMemAccess(addr, count, riscv.ProtWrite)
 
 		bits := shl64(byteToU64(3), sub64(byteToU64(32), count))             // 32-count, in bits
 		mask := not(sub(shl(u64ToU256(bits), byteToU256(1)), byteToU256(1))) // left-aligned mask for count bytes
@@ -341,11 +904,15 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 	sysCall := func() {
 		a7 := getRegister(byteToU64(17))
 		switch a7 {
-		case riscv.SysExit: // exit the calling thread. No multi-thread support yet, so just exit.
-			a0 := getRegister(byteToU64(10))
-			setExitCode(uint8(a0))
-			setExited()
-			// program stops here, no need to change registers.
+		case riscv.SysExit: // exit the calling thread
+			if threadStackEmpty(false) && threadStackEmpty(true) { // the last thread exits the program
+				a0 := getRegister(byteToU64(10))
+				setExitCode(uint8(a0))
+				setExited()
+				// program stops here, no need to change registers.
+			} else {
+				exitThread()
+			}
 		case riscv.SysExitGroup: // exit-group
 			a0 := getRegister(byteToU64(10))
 			setExitCode(uint8(a0))
@@ -362,7 +929,8 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			addr := getRegister(byteToU64(10))
 			// A1 = n (length)
 			length := getRegister(byteToU64(11))
-			// A2 = prot (memory protection type, can ignore)
+			// A2 = prot (memory permissions)
+			prot := mapProt(getRegister(byteToU64(12)))
 			// A3 = flags (shared with other process and or written back to file)
 			flags := getRegister(byteToU64(13))
 			// A4 = fd (file descriptor, can ignore because we support anon memory only)
@@ -370,32 +938,110 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			// A5 = offset (offset in file, we don't support any non-anon memory, so we can ignore this)
 
 			errCode := byteToU64(0)
+			retry := false
 
+			// Increase the length to align it with the page size if necessary.
+			// A length that overflows when aligned becomes 0, and is invalid.
+			length = and64(add64(length, shortToU64(PageAddrMask)), not64(shortToU64(PageAddrMask)))
+			end := add64(addr, length)
 			// ensure MAP_ANONYMOUS is set and fd == -1
-			if (flags&0x20) == 0 || fd != u64Mask() {
+			if and64(flags, byteToU64(riscv.MapAnonymous)) == 0 || fd != u64Mask() {
 				addr = u64Mask()
 				errCode = byteToU64(0x4d) // EBADF
+			} else if length == 0 {
+				addr = u64Mask()
+				errCode = byteToU64(0x16) // EINVAL
+			} else if isWritableExec(prot) {
+				addr = u64Mask()
+				errCode = byteToU64(0xd) // EACCES
+			} else if and64(flags, byteToU64(riscv.MapFixed)) != 0 {
+				// map exactly at the address. Any existing mapping is replaced, but keeps its contents:
+				// the Go runtime only maps fixed ranges that it reserved before, and that are still zero.
+				if and64(addr, shortToU64(PageAddrMask)) != 0 || lt64(end, addr) != 0 {
+					addr = u64Mask()
+					errCode = byteToU64(0x16) // EINVAL
+				} else if !protectRange(addr, end, prot) {
+					addr = u64Mask()
+					errCode = byteToU64(0xc) // ENOMEM
+				} else {
+					carveFixedRange(addr, end)
+					mapRange(addr, length)
+				}
+			} else if lt64(unusedMemoryRegions(), byteToU64(2)) != 0 {
+				// the range may split a memory region: keep an unused region for that, and one for the range
+				addr = u64Mask()
+				errCode = byteToU64(0xc) // ENOMEM
 			} else {
-				// ignore: prot, flags, fd, offset
-				switch addr {
-				case 0:
-					// No hint, allocate it ourselves, by as much as the requested length.
-					// Increase the length to align it with desired page size if necessary.
-					align := and64(length, shortToU64(4095))
-					if align != 0 {
-						length = add64(length, sub64(shortToU64(4096), align))
-					}
-					prevHeap := getHeap()
-					addr = prevHeap
-					setHeap(add64(prevHeap, length)) // increment heap with length
-					//fmt.Printf("mmap: 0x%016x (+ 0x%x increase)\n", s.Heap, length)
-				default:
-					// allow hinted memory address (leave it in A0 as return argument)
-					//fmt.Printf("mmap: 0x%016x (0x%x allowed)\n", addr, length)
+				if addr != 0 && and64(addr, shortToU64(PageAddrMask)) == 0 && lt64(addr, getHeap()) == 0 && lt64(end, addr) == 0 {
+					// the hint is above the heap, where nothing is mapped: allow the hinted memory address
+					mapRange(addr, length)
+				} else {
+					// No usable hint, allocate it ourselves, by as much as the requested length.
+					addr, errCode, retry = allocRange(length)
+				}
+				// the check above kept enough unused regions for this
+				if errCode == 0 && !retry {
+					protectRange(addr, add64(addr, length), prot)
 				}
 			}
-			setRegister(byteToU64(10), addr)
-			setRegister(byteToU64(11), errCode)
+			if retry {
+				// a mapped range was carved out of the free ranges: run the ecall again, with the same arguments
+				setPC(sub64(getPC(), byteToU64(4)))
+			} else {
+				setRegister(byteToU64(10), addr)
+				setRegister(byteToU64(11), errCode)
+			}
+		case riscv.SysMunmap: // munmap - releases one aligned block per step, the syscall restarts until the range is released
+			addr := getRegister(byteToU64(10))   // A0 = addr
+			length := getRegister(byteToU64(11)) // A1 = length
+			// the end of the range, aligned up. It is not above addr if the length is zero, or if the range overflows.
+			end := and64(add64(add64(addr, length), shortToU64(PageAddrMask)), not64(shortToU64(PageAddrMask)))
+			if and64(addr, shortToU64(PageAddrMask)) != 0 || lt64(addr, end) == 0 {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+			} else if !protectRange(addr, end, riscv.ProtDefault) {
+				// the released range gets the permissions of data again, which may split a region.
+				// When the syscall restarts, the rest of the range has them already.
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0xc)) // ENOMEM
+			} else {
+				sizeBits := unmapBlockBits(addr, length)
+				size := shl64(sizeBits, byteToU64(1))
+				zeroMemoryBlock(addr, sizeBits, 1)
+				freeRange(addr, size)
+				if lt64(size, length) != 0 {
+					// continue with the next block: run the ecall again, with the remaining range
+					setRegister(byteToU64(10), add64(addr, size))
+					setRegister(byteToU64(11), sub64(length, size))
+					setPC(sub64(getPC(), byteToU64(4)))
+				} else {
+					setRegister(byteToU64(10), byteToU64(0))
+					setRegister(byteToU64(11), byteToU64(0))
+				}
+			}
+		case riscv.SysMprotect: // mprotect
+			addr := getRegister(byteToU64(10))          // A0 = addr
+			length := getRegister(byteToU64(11))        // A1 = length
+			prot := mapProt(getRegister(byteToU64(12))) // A2 = prot
+			alignedLength := and64(add64(length, shortToU64(PageAddrMask)), not64(shortToU64(PageAddrMask)))
+			end := add64(addr, alignedLength)
+			if and64(addr, shortToU64(PageAddrMask)) != 0 {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+			} else if isWritableExec(prot) {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0xd)) // EACCES
+			} else if lt64(end, addr) != 0 || lt64(alignedLength, length) != 0 {
+				// the range overflows
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0xc)) // ENOMEM
+			} else if alignedLength != 0 && !protectRange(addr, end, prot) {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0xc)) // ENOMEM
+			} else {
+				setRegister(byteToU64(10), byteToU64(0))
+				setRegister(byteToU64(11), byteToU64(0))
+			}
 		case riscv.SysRead: // read
 			fd := getRegister(byteToU64(10))    // A0 = fd
 			addr := getRegister(byteToU64(11))  // A1 = *buf addr
@@ -520,15 +1166,38 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			setRegister(byteToU64(10), u64Mask())
 			setRegister(byteToU64(11), byteToU64(0xd)) // EACCES - no access allowed
 		case riscv.SysClockGettime: // clock_gettime
-			addr := getRegister(byteToU64(11)) // addr of timespec struct
-			// write 1337s + 42ns as time
-			value := or(shortToU256(1337), shl(shortToU256(64), byteToU256(42)))
+			clockID := getRegister(byteToU64(10)) // A0 = clock ID
+			addr := getRegister(byteToU64(11))    // A1 = addr of timespec struct
+			t := getMonotonicTime()
+			if eq64(clockID, byteToU64(riscv.ClockRealtime)) != 0 || eq64(clockID, byteToU64(riscv.ClockRealtimeCoarse)) != 0 {
+				t = add64(t, getClockEpoch())
+			}
+			// write the seconds, and the nanoseconds within the second
+			sec := div64(t, riscv.NanosPerSecond)
+			nsec := mod64(t, riscv.NanosPerSecond)
+			value := or(u64ToU256(sec), shl(byteToU256(64), u64ToU256(nsec)))
 			storeMemUnaligned(addr, byteToU64(16), value, 1, 2, true, true)
 			setRegister(byteToU64(10), byteToU64(0))
 			setRegister(byteToU64(11), byteToU64(0))
-		case riscv.SysClone: // clone - not supported
-			setRegister(byteToU64(10), byteToU64(1))
-			setRegister(byteToU64(11), byteToU64(0))
+		case riscv.SysClone: // clone - only threads are supported, with the flags that the Go runtime uses
+			flags := getRegister(byteToU64(10)) // A0 = flags
+			stack := getRegister(byteToU64(11)) // A1 = stack pointer of the new thread
+			if flags != riscv.CloneThreadFlags {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+			} else {
+				// the child continues after the ecall, like the parent, but on the new stack
+				child := s.activeThread()
+				child.ThreadID = getNextThreadID()
+				child.Registers[2] = stack
+				child.Registers[10] = 0 // the child sees clone return 0
+				child.Registers[11] = 0
+				// the child runs next, it is pushed onto the stack of threads to run
+				pushThread(getTraverseRight(), child)
+				setNextThreadID(add64(getNextThreadID(), byteToU64(1)))
+				setRegister(byteToU64(10), child.ThreadID)
+				setRegister(byteToU64(11), byteToU64(0))
+			}
 		case riscv.SysGetrlimit: // getrlimit
 			res := getRegister(byteToU64(10))
 			addr := getRegister(byteToU64(11))
@@ -544,24 +1213,310 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			}
 		case riscv.SysPrlimit64: // prlimit64 -- unsupported, we have getrlimit, is prlimit64 even called?
 			revertWithCode(riscv.ErrInvalidSyscall, &UnsupportedSyscallErr{SyscallNum: a7})
-		case riscv.SysFutex: // futex - not supported, for now
-			revertWithCode(riscv.ErrInvalidSyscall, &UnsupportedSyscallErr{SyscallNum: a7})
-		case riscv.SysNanosleep: // nanosleep - not supported, for now
-			revertWithCode(riscv.ErrInvalidSyscall, &UnsupportedSyscallErr{SyscallNum: a7})
+		case riscv.SysFutex: // futex - only wait and wake are supported
+			addr := getRegister(byteToU64(10))    // A0 = *uaddr
+			op := getRegister(byteToU64(11))      // A1 = futex_op
+			val := getRegister(byteToU64(12))     // A2 = val
+			timeout := getRegister(byteToU64(13)) // A3 = *timeout, or 0 to wait without timeout
+			switch and64(op, byteToU64(riscv.FutexCmdMask)) {
+			case riscv.FutexWait:
+				if addr == 0 {
+					setRegister(byteToU64(10), u64Mask())
+					setRegister(byteToU64(11), byteToU64(0xe)) // EFAULT
+				} else if and64(addr, byteToU64(3)) != 0 {
+					setRegister(byteToU64(10), u64Mask())
+					setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+				} else if loadMem(addr, byteToU64(4), false, 1, 0xff) != and64(val, u32Mask()) {
+					setRegister(byteToU64(10), u64Mask())
+					setRegister(byteToU64(11), byteToU64(0xb)) // EAGAIN
+				} else if timeout == 0 {
+					// the thread blocks: the return values are set once it is woken up
+					setFutexAddr(addr)
+					setFutexVal(and64(val, u32Mask()))
+					setFutexTimeoutStep(u64Mask())
+				} else if sec, nsec := loadTimespec(timeout, 2); !validTimespec(sec, nsec) {
+					setRegister(byteToU64(10), u64Mask())
+					setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+				} else {
+					// the thread blocks until it is woken up, or until the wait times out
+					setFutexAddr(addr)
+					setFutexVal(and64(val, u32Mask()))
+					setFutexTimeoutStep(add64(getStep(), futexWaitSteps(sec, nsec)))
+				}
+			case riscv.FutexWake:
+				// waiting threads check their futex when they are scheduled, yield to let them run
+				setRegister(byteToU64(10), byteToU64(0))
+				setRegister(byteToU64(11), byteToU64(0))
+				yieldThread()
+			default:
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+			}
+		case riscv.SysNanosleep: // nanosleep - advance the clock by the duration, and yield to other threads
+			// threads are interleaved on a single hart: waiting for the clock to reach the end of the sleep
+			// would only spend steps, the clock jumps ahead instead.
+			sec, nsec := loadTimespec(getRegister(byteToU64(10)), 1) // A0 = addr of timespec struct with the duration
+			if !validTimespec(sec, nsec) {
+				setRegister(byteToU64(10), u64Mask())
+				setRegister(byteToU64(11), byteToU64(0x16)) // EINVAL
+			} else {
+				setClockOffset(add64(getClockOffset(), add64(mul64(sec, riscv.NanosPerSecond), nsec)))
+				setRegister(byteToU64(10), byteToU64(0))
+				setRegister(byteToU64(11), byteToU64(0))
+				yieldThread()
+			}
+		case riscv.SysSchedYield: // sched_yield
+			setRegister(byteToU64(10), byteToU64(0))
+			setRegister(byteToU64(11), byteToU64(0))
+			yieldThread()
+		case riscv.SysGetRandom: // getrandom - fill the buffer with the next value of the PRNG
+			addr := getRegister(byteToU64(10))  // A0 = *buf addr
+			count := getRegister(byteToU64(11)) // A1 = count
+			// A2 = flags, can ignore: the PRNG never blocks
+			// fill at most one value, the caller retries for the remaining bytes, like with a partial read
+			n := count
+			if lt64(byteToU64(riscv.RandomMaxBytes), n) != 0 {
+				n = byteToU64(riscv.RandomMaxBytes)
+			}
+			if n != 0 {
+				state := nextRandomState(getRandomState())
+				setRandomState(state)
+				storeMem(addr, n, randomValue(state), 1, 2, true, true)
+			}
+			setRegister(byteToU64(10), n)
+			setRegister(byteToU64(11), byteToU64(0))
+		case riscv.SysGettid: // gettid
+			setRegister(byteToU64(10), getThreadID())
+			setRegister(byteToU64(11), byteToU64(0))
 		default:
+			if inst.strictSyscalls && !inst.allowedSyscalls[a7] {
+				// the PC already points after the ECALL, which is never compressed
+				panic(&UnsupportedSyscallErr{SyscallNum: a7, PC: sub64(getPC(), byteToU64(4))})
+			}
 			// Ignore(no-op) unsupported system calls
 			setRegister(byteToU64(10), byteToU64(0))
 			setRegister(byteToU64(11), byteToU64(0))
 			// List of ignored(no-op) syscalls used by op-program:
 			// sched_getaffinity - hardcode to indicate affinity with any cpu-set mask
-			// sched_yield - nothing to yield, synchronous execution only, for now
 			// rt_sigprocmask - ignore any sigset changes
 			// sigaltstack - ignore any hints of an alternative signal receiving stack addr
-			// gettid - hardcode to 0
 			// rt_sigaction - no-op, we never send signals, and thus need no sig handler info
-			// madvise, epoll_create1, epoll_ctl, pipe2, readlinkat, newfstatat, newuname, munmap,
-			// getrandom, ioctl, getcwd, getuid, getgid
+			// madvise, epoll_create1, epoll_ctl, pipe2, readlinkat, newfstatat, newuname,
+			// ioctl, getcwd, getuid, getgid
+		}
+	}
+
+	//
+	// Floating point - arithmetic is implemented in software, see softfloat.go
+	//
+
+	// getRoundingMode returns the rounding mode of an instruction, reading the dynamic rounding mode (7) from fcsr
+	getRoundingMode := func(rm U64) U64 {
+		if eq64(rm, byteToU64(7)) != 0 {
+			rm = and64(shr64(byteToU64(5), getFCSR()), byteToU64(7)) // frm
+		}
+		if gt64(rm, byteToU64(4)) != 0 {
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid rounding mode %d", rm))
+		}
+		return rm
+	}
+
+	// accrueFPFlags sets the given exception flags in the fflags field of fcsr
+	accrueFPFlags := func(flags U64) {
+		setFCSR(or64(getFCSR(), flags))
+	}
+
+	getFPFormat := func(funct7 U64) U64 {
+		fpFmt := and64(funct7, byteToU64(3)) // 00 = S, 01 = D
+		if gt64(fpFmt, byteToU64(1)) != 0 {
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: unsupported floating point format %d", fpFmt))
+		}
+		return fpFmt
+	}
+
+	// execFloatMulAdd executes FMADD, FMSUB, FNMSUB and FNMADD
+	execFloatMulAdd := func(instr U64) {
+		fpFmt := getFPFormat(parseFunct7(instr))
+		rm := getRoundingMode(parseFunct3(instr))
+		// the opcode bits 3:2 select the variant: bit 2 negates the addend, bit 3 negates the product
+		x := xor64(fpUnbox(getFPRegister(parseRs1(instr)), fpFmt), fpZero(and64(shr64(byteToU64(3), instr), byteToU64(1)), fpFmt))
+		z := xor64(fpUnbox(getFPRegister(parseRs3(instr)), fpFmt), fpZero(and64(shr64(byteToU64(2), instr), byteToU64(1)), fpFmt))
+		out, flags := fpMulAdd(x, fpUnbox(getFPRegister(parseRs2(instr)), fpFmt), z, rm, fpFmt)
+		setFPRegister(parseRd(instr), fpBox(out, fpFmt))
+		accrueFPFlags(flags)
+	}
+
+	// execFloatOp executes the OP-FP instructions: arithmetic, conversions, comparisons and moves
+	execFloatOp := func(instr U64) {
+		rd := parseRd(instr)
+		funct3 := parseFunct3(instr) // rounding mode, or the variant of the operation
+		rs2 := parseRs2(instr)
+		fpFmt := getFPFormat(parseFunct7(instr))
+		x := fpUnbox(getFPRegister(parseRs1(instr)), fpFmt)
+		y := fpUnbox(getFPRegister(rs2), fpFmt)
+		var out, flags U64
+		switch shr64(byteToU64(2), parseFunct7(instr)) {
+		case 0x00: // 00000 = FADD
+			out, flags = fpAdd(x, y, getRoundingMode(funct3), fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x01: // 00001 = FSUB
+			out, flags = fpAdd(x, xor64(y, fpZero(byteToU64(1), fpFmt)), getRoundingMode(funct3), fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x02: // 00010 = FMUL
+			out, flags = fpMul(x, y, getRoundingMode(funct3), fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x03: // 00011 = FDIV
+			out, flags = fpDiv(x, y, getRoundingMode(funct3), fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x0B: // 01011 = FSQRT
+			if rs2 != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			out, flags = fpSqrt(x, getRoundingMode(funct3), fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x04: // 00100 = FSGNJ, FSGNJN, FSGNJX
+			if gt64(funct3, byteToU64(2)) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for FSGNJ", funct3))
+			}
+			setFPRegister(rd, fpBox(fpSignInject(x, y, funct3, fpFmt), fpFmt))
+		case 0x05: // 00101 = FMIN, FMAX
+			if gt64(funct3, byteToU64(1)) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for FMIN/FMAX", funct3))
+			}
+			out, flags = fpMinMax(x, y, funct3, fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x08: // 01000 = FCVT.S.D, FCVT.D.S
+			// rs2 selects the source format, which must be the other format
+			if eq64(xor64(rs2, fpFmt), byteToU64(1)) == 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			x = fpUnbox(getFPRegister(parseRs1(instr)), rs2)
+			out, flags = fpConvert(x, getRoundingMode(funct3), rs2)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x14: // 10100 = FLE, FLT, FEQ
+			if gt64(funct3, byteToU64(2)) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for floating point comparison", funct3))
+			}
+			out, flags = fpCompare(x, y, funct3, fpFmt)
+			setRegister(rd, out)
+		case 0x18: // 11000 = FCVT.W, FCVT.WU, FCVT.L, FCVT.LU: rs2 selects the integer type
+			if gt64(rs2, byteToU64(3)) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			out, flags = fpToInt(x, getRoundingMode(funct3), rs2, fpFmt)
+			setRegister(rd, out)
+		case 0x1A: // 11010 = FCVT from W, WU, L, LU: rs2 selects the integer type
+			if gt64(rs2, byteToU64(3)) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			out, flags = fpFromInt(getRegister(parseRs1(instr)), getRoundingMode(funct3), rs2, fpFmt)
+			setFPRegister(rd, fpBox(out, fpFmt))
+		case 0x1C: // 11100 = FMV.X.W, FMV.X.D, FCLASS
+			if rs2 != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			switch funct3 {
+			case 0: // 000 = FMV.X.W, FMV.X.D: move the raw bits, single precision values are sign-extended
+				out = getFPRegister(parseRs1(instr))
+				if fpFmt == 0 {
+					out = mask32Signed64(out)
+				}
+				setRegister(rd, out)
+			case 1: // 001 = FCLASS
+				setRegister(rd, fpClass(x, fpFmt))
+			default:
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for FMV/FCLASS", funct3))
+			}
+		case 0x1E: // 11110 = FMV.W.X, FMV.D.X
+			if or64(rs2, funct3) != 0 {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+			}
+			setFPRegister(rd, fpBox(getRegister(parseRs1(instr)), fpFmt))
+		default:
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for opcode 0x53", parseFunct7(instr)))
 		}
+		accrueFPFlags(flags)
+	}
+
+	//
+	// CSRs - only the user-level CSRs have a state, all others read as zero and ignore writes
+	//
+
+	readCSR := func(num U64) U64 {
+		switch num {
+		case 0x001: // fflags
+			return and64(getFCSR(), byteToU64(0x1f))
+		case 0x002: // frm
+			return and64(shr64(byteToU64(5), getFCSR()), byteToU64(7))
+		case 0x003: // fcsr
+			return and64(getFCSR(), byteToU64(0xff))
+		case 0xC00, 0xC02: // cycle, instret
+			// every step executes one instruction, which takes one cycle.
+			// The counters do not include the current instruction, the step counter does.
+			return sub64(getStep(), byteToU64(1))
+		case 0xC01: // time: the virtual clock, the timer ticks every nanosecond
+			return getMonotonicTime()
+		case 0xF14: // mhartid: always hart 0, threads are interleaved on a single hart
+			return byteToU64(0)
+		default:
+			return byteToU64(0)
+		}
+	}
+
+	writeCSR := func(num U64, v U64) {
+		// CSRs with the top 2 bits set are read-only
+		if eq64(shr64(byteToU64(10), num), byteToU64(3)) != 0 {
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: cannot write read-only CSR %d", num))
+		}
+		switch num {
+		case 0x001: // fflags
+			setFCSR(or64(and64(getFCSR(), byteToU64(0xe0)), and64(v, byteToU64(0x1f))))
+		case 0x002: // frm
+			setFCSR(or64(and64(getFCSR(), byteToU64(0x1f)), shl64(byteToU64(5), and64(v, byteToU64(7)))))
+		case 0x003: // fcsr
+			setFCSR(and64(v, byteToU64(0xff)))
+		}
+	}
+
+	//
+	// Instruction fetch
+	//
+
+	// the length of the current instruction: 2 bytes if compressed, 4 bytes otherwise
+	instrLen := byteToU64(4)
+
+	// fetchInstr loads the instruction at the given PC, and expands it if it is a compressed instruction.
+	fetchInstr := func(pc U64) (instr U64) {
+		if and64(pc, byteToU64(1)) != 0 { // quick PC alignment check
+			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 2 bytes", pc))
+		}
+		checkMemAccess(pc, byteToU64(2), riscv.ProtExec)
+		instrPC = &pc
+		trackMemAccess(and64(pc, not64(byteToU64(31))), 0) // an aligned halfword never crosses a leaf
+		var lower [2]byte
+		s.Memory.GetUnaligned(pc, lower[:])
+		instr = U64(binary.LittleEndian.Uint16(lower[:]))
+		// the lowest 2 bits are 11 for all but compressed instructions
+		if eq64(and64(instr, byteToU64(3)), byteToU64(3)) == 0 {
+			instrLen = byteToU64(2)
+			expanded := expandCompressed(instr)
+			if iszero64(expanded) {
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved compressed instruction encoding", instr))
+			}
+			traceMemAccess(pc, instrLen, riscv.ProtExec)
+			return expanded
+		}
+		instrLen = byteToU64(4)
+		upperAddr := add64(pc, byteToU64(2))
+		checkMemAccess(upperAddr, byteToU64(2), riscv.ProtExec)
+		if and64(upperAddr, byteToU64(31)) == 0 { // the upper half of the instruction is in the next leaf
+			trackMemAccess(upperAddr, 1)
+			memProofOffset = 1
+		}
+		traceMemAccess(pc, instrLen, riscv.ProtExec)
+		var v [4]byte
+		s.Memory.GetUnaligned(pc, v[:])
+		return U64(binary.LittleEndian.Uint32(v[:]))
 	}
 
 	//
@@ -573,8 +1528,42 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 	}
 	setStep(add64(getStep(), byteToU64(1)))
 
+	// a thread that waits on a futex does not run until it is woken up, this step only checks the futex
+	if futexAddr := getFutexAddr(); futexAddr != 0 {
+		if loadMem(futexAddr, byteToU64(4), false, 0, 0xff) != getFutexVal() {
+			wakeFutex(byteToU64(0), byteToU64(0))
+		} else if gt64(getStep(), getFutexTimeoutStep()) != 0 {
+			// the steps of the wait advanced the clock by up to FutexTimeoutSteps, like nanosleep the clock
+			// jumps ahead by the rest of the timeout, that the thread still points to with A3
+			sec, nsec := loadTimespec(getRegister(byteToU64(13)), 1)
+			timeout := add64(mul64(sec, riscv.NanosPerSecond), nsec)
+			setClockOffset(add64(getClockOffset(), sub64(timeout, futexWaitSteps(sec, nsec))))
+			wakeFutex(u64Mask(), byteToU64(0x6e)) // ETIMEDOUT
+		} else {
+			preemptThread()
+			return nil
+		}
+		if inst.syscallTracer != nil {
+			inst.syscallTracer(resumedSyscallTrace(s))
+		}
+		return nil
+	}
+
+	// if there are other threads, the running thread is preempted once it used up its time slice,
+	// this step then only switches threads
+	if !threadStackEmpty(false) || !threadStackEmpty(true) {
+		if lt64(getStepsSinceContextSwitch(), riscv.SchedQuantum) == 0 {
+			preemptThread()
+			return nil
+		}
+		setStepsSinceContextSwitch(add64(getStepsSinceContextSwitch(), byteToU64(1)))
+	}
+
 	pc := getPC()
-	instr := loadMem(pc, byteToU64(4), false, 0, 0xff) // raw instruction
+	instr := fetchInstr(pc) // raw instruction, expanded if compressed
+	if inst.callStacks != nil {
+		inst.callStacks.instructions++
+	}
 
 	// these fields are ignored if not applicable to the instruction type / opcode
 	opcode := parseOpcode(instr)
@@ -583,6 +1572,9 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 	rs1 := parseRs1(instr) // source register 1 index
 	rs2 := parseRs2(instr) // source register 2 index
 	funct7 := parseFunct7(instr)
+	if inst.stats != nil {
+		inst.stats.instruction(opcode, funct3, funct7, instrLen == 2)
+	}
 
 	switch opcode {
 	case 0x03: // 000_0011: memory loading
@@ -600,7 +1592,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		memIndex := add64(rs1Value, signExtend64(imm, byteToU64(11)))
 		rdValue := loadMem(memIndex, size, signed, 1, 2)
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x23: // 010_0011: memory storing
 		// SB, SH, SW, SD
 		imm := parseImmTypeS(instr)
@@ -609,7 +1601,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		rs1Value := getRegister(rs1)
 		memIndex := add64(rs1Value, signExtend64(imm, byteToU64(11)))
 		storeMem(memIndex, size, value, 1, 2, true, true)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x63: // 110_0011: branching
 		rs1Value := getRegister(rs1)
 		rs2Value := getRegister(rs2)
@@ -630,7 +1622,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		}
 		switch branchHit {
 		case 0:
-			pc = add64(pc, byteToU64(4))
+			pc = add64(pc, instrLen)
 		default:
 			imm := parseImmTypeB(instr)
 			// imm is a signed offset, in multiples of 2 bytes.
@@ -638,9 +1630,9 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			pc = add64(pc, imm)
 		}
 
-		// The PC must be aligned to 4 bytes.
-		if pc&3 != 0 {
-			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 4 bytes", pc))
+		// The PC must be aligned to 2 bytes, since compressed instructions are supported.
+		if pc&1 != 0 {
+			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 2 bytes", pc))
 		}
 
 		// not like the other opcodes: nothing to write to rd register, and PC has already changed
@@ -652,8 +1644,34 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		switch funct3 {
 		case 0: // 000 = ADDI
 			rdValue = add64(rs1Value, imm)
-		case 1: // 001 = SLLI
-			rdValue = shl64(and64(imm, byteToU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
+		case 1: // 001 = SLLI and Zbb/Zbs ops
+			switch shr64(byteToU64(6), imm) { // in rv64i the top 6 bits select the shift type
+			case 0x00: // 000000 = SLLI
+				rdValue = shl64(and64(imm, byteToU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
+			case 0x0A: // 001010 = BSETI
+				rdValue = or64(rs1Value, bit64(imm))
+			case 0x12: // 010010 = BCLRI
+				rdValue = and64(rs1Value, not64(bit64(imm)))
+			case 0x1A: // 011010 = BINVI
+				rdValue = xor64(rs1Value, bit64(imm))
+			case 0x18: // 011000 = Zbb unary ops, selected by the lower 6 bits
+				switch and64(imm, byteToU64(0x3F)) {
+				case 0: // 000000 = CLZ
+					rdValue = clz64(rs1Value)
+				case 1: // 000001 = CTZ
+					rdValue = ctz64(rs1Value)
+				case 2: // 000010 = CPOP
+					rdValue = cpop64(rs1Value)
+				case 4: // 000100 = SEXT.B
+					rdValue = signExtend64(and64(rs1Value, byteToU64(0xFF)), byteToU64(7))
+				case 5: // 000101 = SEXT.H
+					rdValue = signExtend64(and64(rs1Value, shortToU64(0xFFFF)), byteToU64(15))
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x13", imm))
+				}
+			default:
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x13", imm))
+			}
 		case 2: // 010 = SLTI
 			rdValue = slt64(rs1Value, imm)
 		case 3: // 011 = SLTIU
@@ -666,6 +1684,20 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 				rdValue = shr64(and64(imm, byteToU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
 			case 0x10: // 010000 = SRAI
 				rdValue = sar64(and64(imm, byteToU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
+			case 0x12: // 010010 = BEXTI
+				rdValue = and64(shr64(and64(imm, byteToU64(0x3F)), rs1Value), byteToU64(1))
+			case 0x18: // 011000 = RORI
+				rdValue = ror64(rs1Value, imm)
+			case 0x0A: // 001010 = ORC.B
+				if and64(imm, byteToU64(0x3F)) != 0x07 {
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x13", imm))
+				}
+				rdValue = orcb64(rs1Value)
+			case 0x1A: // 011010 = REV8
+				if and64(imm, byteToU64(0x3F)) != 0x38 {
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x13", imm))
+				}
+				rdValue = rev864(rs1Value)
 			default:
 				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x13", imm))
 			}
@@ -677,7 +1709,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x13", funct3))
 		}
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x1B: // 001_1011: immediate arithmetic and logic signed 32 bit
 		rs1Value := getRegister(rs1)
 		imm := parseImmTypeI(instr)
@@ -685,14 +1717,32 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 		switch funct3 {
 		case 0: // 000 = ADDIW
 			rdValue = mask32Signed64(add64(rs1Value, imm))
-		case 1: // 001 = SLLIW
-			// SLLIW where imm[5] != 0 is reserved
-			if and64(imm, byteToU64(0x20)) != 0 {
-				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+		case 1: // 001 = SLLIW and Zba/Zbb ops
+			switch shr64(byteToU64(6), imm) { // top 6 bits select the operation
+			case 0x00: // 000000 = SLLIW
+				// SLLIW where imm[5] != 0 is reserved
+				if and64(imm, byteToU64(0x20)) != 0 {
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
+				}
+				rdValue = mask32Signed64(shl64(and64(imm, byteToU64(0x1F)), rs1Value))
+			case 0x02: // 000010 = SLLI.UW
+				rdValue = shl64(and64(imm, byteToU64(0x3F)), and64(rs1Value, u32Mask()))
+			case 0x18: // 011000 = Zbb unary ops on 32 bits, selected by the lower 6 bits
+				switch and64(imm, byteToU64(0x3F)) {
+				case 0: // 000000 = CLZW
+					rdValue = clz32(rs1Value)
+				case 1: // 000001 = CTZW
+					rdValue = ctz32(rs1Value)
+				case 2: // 000010 = CPOPW
+					rdValue = cpop64(and64(rs1Value, u32Mask()))
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x1B", imm))
+				}
+			default:
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x1B", imm))
 			}
-			rdValue = mask32Signed64(shl64(and64(imm, byteToU64(0x1F)), rs1Value))
 		case 5: // 101 = SR~
-			// SRLIW and SRAIW where imm[5] != 0 is reserved
+			// SRLIW, SRAIW and RORIW where imm[5] != 0 is reserved
 			if and64(imm, byteToU64(0x20)) != 0 {
 				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction %d: reserved instruction encoding", instr))
 			}
@@ -702,6 +1752,8 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 				rdValue = signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), byteToU64(31))
 			case 0x20: // 0100000 = SRAIW
 				rdValue = signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), sub64(byteToU64(31), shamt))
+			case 0x30: // 0110000 = RORIW
+				rdValue = ror32(rs1Value, shamt)
 			default:
 				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid imm value %d for opcode 0x1B", imm))
 			}
@@ -709,7 +1761,7 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x1B", funct3))
 		}
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x33: // 011_0011: register arithmetic and logic
 		rs1Value := getRegister(rs1)
 		rs2Value := getRegister(rs2)
@@ -767,33 +1819,107 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 				default:
 					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
 				}
-			case 1: // 001 = SLL
-				rdValue = shl64(and64(rs2Value, byteToU64(0x3F)), rs1Value) // only the low 6 bits are consider in RV6VI
-			case 2: // 010 = SLT
-				rdValue = slt64(rs1Value, rs2Value)
+			case 1: // 001 = SLL and Zbb/Zbs ops
+				switch funct7 {
+				case 0x00: // 0000000 = SLL
+					rdValue = shl64(and64(rs2Value, byteToU64(0x3F)), rs1Value) // only the low 6 bits are consider in RV6VI
+				case 0x14: // 0010100 = BSET
+					rdValue = or64(rs1Value, bit64(rs2Value))
+				case 0x24: // 0100100 = BCLR
+					rdValue = and64(rs1Value, not64(bit64(rs2Value)))
+				case 0x34: // 0110100 = BINV
+					rdValue = xor64(rs1Value, bit64(rs2Value))
+				case 0x30: // 0110000 = ROL
+					rdValue = rol64(rs1Value, rs2Value)
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 2: // 010 = SLT and SH1ADD
+				switch funct7 {
+				case 0x00: // 0000000 = SLT
+					rdValue = slt64(rs1Value, rs2Value)
+				case 0x10: // 0010000 = SH1ADD
+					rdValue = add64(shl64(byteToU64(1), rs1Value), rs2Value)
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
 			case 3: // 011 = SLTU
-				rdValue = lt64(rs1Value, rs2Value)
-			case 4: // 100 = XOR
-				rdValue = xor64(rs1Value, rs2Value)
-			case 5: // 101 = SR~
+				switch funct7 {
+				case 0x00: // 0000000 = SLTU
+					rdValue = lt64(rs1Value, rs2Value)
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 4: // 100 = XOR, and Zba/Zbb ops
+				switch funct7 {
+				case 0x00: // 0000000 = XOR
+					rdValue = xor64(rs1Value, rs2Value)
+				case 0x20: // 0100000 = XNOR
+					rdValue = not64(xor64(rs1Value, rs2Value))
+				case 0x10: // 0010000 = SH2ADD
+					rdValue = add64(shl64(byteToU64(2), rs1Value), rs2Value)
+				case 0x05: // 0000101 = MIN
+					rdValue = rs1Value
+					if slt64(rs2Value, rs1Value) != 0 {
+						rdValue = rs2Value
+					}
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 5: // 101 = SR~, and Zbb/Zbs ops
 				switch funct7 {
 				case 0x00: // 0000000 = SRL
 					rdValue = shr64(and64(rs2Value, byteToU64(0x3F)), rs1Value) // logical: fill with zeroes
 				case 0x20: // 0100000 = SRA
 					rdValue = sar64(and64(rs2Value, byteToU64(0x3F)), rs1Value) // arithmetic: sign bit is extended
+				case 0x24: // 0100100 = BEXT
+					rdValue = and64(shr64(and64(rs2Value, byteToU64(0x3F)), rs1Value), byteToU64(1))
+				case 0x30: // 0110000 = ROR
+					rdValue = ror64(rs1Value, rs2Value)
+				case 0x05: // 0000101 = MINU
+					rdValue = rs1Value
+					if lt64(rs2Value, rs1Value) != 0 {
+						rdValue = rs2Value
+					}
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 6: // 110 = OR, and Zba/Zbb ops
+				switch funct7 {
+				case 0x00: // 0000000 = OR
+					rdValue = or64(rs1Value, rs2Value)
+				case 0x20: // 0100000 = ORN
+					rdValue = or64(rs1Value, not64(rs2Value))
+				case 0x10: // 0010000 = SH3ADD
+					rdValue = add64(shl64(byteToU64(3), rs1Value), rs2Value)
+				case 0x05: // 0000101 = MAX
+					rdValue = rs1Value
+					if sgt64(rs2Value, rs1Value) != 0 {
+						rdValue = rs2Value
+					}
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 7: // 111 = AND, and Zbb ops
+				switch funct7 {
+				case 0x00: // 0000000 = AND
+					rdValue = and64(rs1Value, rs2Value)
+				case 0x20: // 0100000 = ANDN
+					rdValue = and64(rs1Value, not64(rs2Value))
+				case 0x05: // 0000101 = MAXU
+					rdValue = rs1Value
+					if gt64(rs2Value, rs1Value) != 0 {
+						rdValue = rs2Value
+					}
 				default:
 					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
 				}
-			case 6: // 110 = OR
-				rdValue = or64(rs1Value, rs2Value)
-			case 7: // 111 = AND
-				rdValue = and64(rs1Value, rs2Value)
 			default:
-				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x3B", funct3))
+				revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x33", funct3))
 			}
 		}
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x3B: // 011_1011: register arithmetic and logic in 32 bits
 		rs1Value := getRegister(rs1)
 		rs2Value := and64(getRegister(rs2), u32Mask())
@@ -836,24 +1962,61 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			}
 		default:
 			switch funct3 {
-			case 0: // 000 = ADDW/SUBW
+			case 0: // 000 = ADDW/SUBW/ADD.UW
 				switch funct7 {
 				case 0x00: // 0000000 = ADDW
 					rdValue = mask32Signed64(add64(and64(rs1Value, u32Mask()), and64(rs2Value, u32Mask())))
 				case 0x20: // 0100000 = SUBW
 					rdValue = mask32Signed64(sub64(and64(rs1Value, u32Mask()), and64(rs2Value, u32Mask())))
+				case 0x04: // 0000100 = ADD.UW
+					rdValue = add64(and64(rs1Value, u32Mask()), getRegister(rs2)) // rs2 is used in full, not truncated
 				default:
 					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
 				}
-			case 1: // 001 = SLLW
-				rdValue = mask32Signed64(shl64(and64(rs2Value, byteToU64(0x1F)), rs1Value))
-			case 5: // 101 = SR~
+			case 1: // 001 = SLLW/ROLW
+				switch funct7 {
+				case 0x00: // 0000000 = SLLW
+					rdValue = mask32Signed64(shl64(and64(rs2Value, byteToU64(0x1F)), rs1Value))
+				case 0x30: // 0110000 = ROLW
+					rdValue = rol32(rs1Value, rs2Value)
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 2: // 010 = SH1ADD.UW
+				switch funct7 {
+				case 0x10: // 0010000 = SH1ADD.UW
+					rdValue = add64(shl64(byteToU64(1), and64(rs1Value, u32Mask())), getRegister(rs2))
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 4: // 100 = SH2ADD.UW/ZEXT.H
+				switch funct7 {
+				case 0x10: // 0010000 = SH2ADD.UW
+					rdValue = add64(shl64(byteToU64(2), and64(rs1Value, u32Mask())), getRegister(rs2))
+				case 0x04: // 0000100 = ZEXT.H, only with rs2 = 0
+					if rs2 != 0 {
+						revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid rs2 value %d for ZEXT.H", rs2))
+					}
+					rdValue = and64(rs1Value, shortToU64(0xFFFF))
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 5: // 101 = SR~/RORW
 				shamt := and64(rs2Value, byteToU64(0x1F))
 				switch funct7 {
 				case 0x00: // 0000000 = SRLW
 					rdValue = signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), byteToU64(31))
 				case 0x20: // 0100000 = SRAW
 					rdValue = signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), sub64(byteToU64(31), shamt))
+				case 0x30: // 0110000 = RORW
+					rdValue = ror32(rs1Value, shamt)
+				default:
+					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
+				}
+			case 6: // 110 = SH3ADD.UW
+				switch funct7 {
+				case 0x10: // 0010000 = SH3ADD.UW
+					rdValue = add64(shl64(byteToU64(3), and64(rs1Value, u32Mask())), getRegister(rs2))
 				default:
 					revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct7 value %d for funct3 %d", funct7, funct3))
 				}
@@ -862,51 +2025,100 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			}
 		}
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x37: // 011_0111: LUI = Load upper immediate
 		imm := parseImmTypeU(instr)
 		rdValue := shl64(byteToU64(12), imm)
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x17: // 001_0111: AUIPC = Add upper immediate to PC
 		imm := parseImmTypeU(instr)
 		rdValue := add64(pc, signExtend64(shl64(byteToU64(12), imm), byteToU64(31)))
 		setRegister(rd, rdValue)
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x6F: // 110_1111: JAL = Jump and link
 		imm := parseImmTypeJ(instr)
-		rdValue := add64(pc, byteToU64(4))
+		rdValue := add64(pc, instrLen)
 		setRegister(rd, rdValue)
 
 		newPC := add64(pc, signExtend64(shl64(byteToU64(1), imm), byteToU64(20)))
-		if newPC&3 != 0 { // quick target alignment check
-			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 4 bytes", newPC))
+		if newPC&1 != 0 { // quick target alignment check
+			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 2 bytes", newPC))
 		}
 		setPC(newPC) // signed offset in multiples of 2 bytes (last bit is there, but ignored)
+		if inst.callStacks != nil {
+			inst.callStacks.jump(s.ThreadID, rd, 0, newPC, rdValue)
+		}
 	case 0x67: // 110_0111: JALR = Jump and link register
 		rs1Value := getRegister(rs1)
 		imm := parseImmTypeI(instr)
-		rdValue := add64(pc, byteToU64(4))
+		rdValue := add64(pc, instrLen)
 		setRegister(rd, rdValue)
 
+		// the least significant bit is set to 0, which keeps the target aligned to 2 bytes
 		newPC := and64(add64(rs1Value, signExtend64(imm, byteToU64(11))), xor64(u64Mask(), byteToU64(1)))
-		if newPC&3 != 0 { // quick addr alignment check
-			revertWithCode(riscv.ErrNotAlignedAddr, fmt.Errorf("pc %d not aligned with 4 bytes", newPC))
+		setPC(newPC)
+		if inst.callStacks != nil {
+			inst.callStacks.jump(s.ThreadID, rd, rs1, newPC, rdValue)
 		}
-		setPC(newPC) // least significant bit is set to 0
 	case 0x73: // 111_0011: environment things
 		switch funct3 {
 		case 0: // 000 = ECALL/EBREAK
 			switch shr64(byteToU64(20), instr) { // I-type, top 12 bits
 			case 0: // imm12 = 000000000000 ECALL
-				sysCall()
-				setPC(add64(pc, byteToU64(4)))
+				// the PC is updated first: the syscall may switch to another thread, or clone this one
+				setPC(add64(pc, instrLen))
+				if inst.syscallTracer != nil {
+					syscallTrace = startSyscallTrace(s, pc)
+				}
+				if inst.stats != nil {
+					inst.stats.syscall(getRegister(17))
+				}
+				if inst.syscallHandler == nil {
+					sysCall()
+				} else {
+					inst.syscallHandler.HandleSyscall(&SyscallEnv{
+						state:          s,
+						getRegister:    getRegister,
+						setRegister:    setRegister,
+						loadMem:        loadMem,
+						storeMem:       storeMem,
+						trackMemAccess: trackMemAccess,
+						defaultSyscall: sysCall,
+					})
+				}
+				if syscallTrace != nil {
+					finishSyscallTrace(s, syscallTrace)
+					inst.syscallTracer(syscallTrace)
+					syscallTrace = nil
+				}
 			default: // imm12 = 000000000001 EBREAK
-				setPC(add64(pc, byteToU64(4))) // ignore breakpoint
+				setPC(add64(pc, instrLen)) // ignore breakpoint
+			}
+		case 4: // 100 = reserved
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x73", funct3))
+		default: // CSRRW, CSRRS, CSRRC and their immediate variants
+			num := shr64(byteToU64(20), instr) // I-type, top 12 bits
+			// funct3 bit 2 selects the immediate variant: the rs1 field is a 5 bit unsigned immediate
+			v := rs1
+			if and64(funct3, byteToU64(4)) == 0 {
+				v = getRegister(rs1)
+			}
+			old := readCSR(num)
+			switch and64(funct3, byteToU64(3)) {
+			case 1: // 01 = CSRRW: always writes
+				writeCSR(num, v)
+			case 2: // 10 = CSRRS: sets the bits of v, does not write if rs1 is x0 or the immediate is 0
+				if rs1 != 0 {
+					writeCSR(num, or64(old, v))
+				}
+			default: // 11 = CSRRC: clears the bits of v, does not write if rs1 is x0 or the immediate is 0
+				if rs1 != 0 {
+					writeCSR(num, and64(old, not64(v)))
+				}
 			}
-		default: // CSR instructions
-			setRegister(rd, 0) // ignore CSR instructions
-			setPC(add64(pc, byteToU64(4)))
+			setRegister(rd, old)
+			setPC(add64(pc, instrLen))
 		}
 	case 0x2F: // 010_1111: RV32A and RV32A atomic operations extension
 		// acquire and release bits:
@@ -985,20 +2197,46 @@ func (inst *InstrumentedState) riscvStep() (outErr error) {
 			storeMem(addr, size, v, 1, 3, false, true) // after overwriting 1, proof 2 is no longer valid
 			setRegister(rd, rdValue)
 		}
-		setPC(add64(pc, byteToU64(4)))
+		setPC(add64(pc, instrLen))
 	case 0x0F: // 000_1111: fence
 		// Used to impose additional ordering constraints; flushing the mem operation pipeline.
 		// This VM doesn't have a pipeline, nor additional harts, so this is a no-op.
 		// FENCE / FENCE.TSO / FENCE.I all no-op: there's nothing to synchronize.
-		setPC(add64(pc, byteToU64(4)))
-	case 0x07: // FLW/FLD: floating point load word/double
-		setPC(add64(pc, byteToU64(4))) // no-op this.
-	case 0x27: // FSW/FSD: floating point store word/double
-		setPC(add64(pc, byteToU64(4))) // no-op this.
-	case 0x53: // FADD etc. no-op is enough to pass Go runtime check
-		setPC(add64(pc, byteToU64(4))) // no-op this.
+		setPC(add64(pc, instrLen))
+	case 0x07: // 000_0111: floating point memory loading
+		// FLW, FLD
+		imm := parseImmTypeI(instr)
+		rs1Value := getRegister(rs1)
+		memIndex := add64(rs1Value, signExtend64(imm, byteToU64(11)))
+		switch funct3 {
+		case 2: // 010 = FLW
+			setFPRegister(rd, fpBox(loadMem(memIndex, byteToU64(4), false, 1, 2), byteToU64(0)))
+		case 3: // 011 = FLD
+			setFPRegister(rd, loadMem(memIndex, byteToU64(8), false, 1, 2))
+		default:
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x07", funct3))
+		}
+		setPC(add64(pc, instrLen))
+	case 0x27: // 010_0111: floating point memory storing
+		// FSW, FSD
+		if eq64(shr64(byteToU64(1), funct3), byteToU64(1)) == 0 { // 010 = FSW, 011 = FSD
+			revertWithCode(riscv.ErrIllegalInstruction, fmt.Errorf("illegal instruction: invalid funct3 value %d for opcode 0x27", funct3))
+		}
+		imm := parseImmTypeS(instr)
+		size := shl64(funct3, byteToU64(1))
+		value := getFPRegister(rs2)
+		rs1Value := getRegister(rs1)
+		memIndex := add64(rs1Value, signExtend64(imm, byteToU64(11)))
+		storeMem(memIndex, size, value, 1, 2, true, true)
+		setPC(add64(pc, instrLen))
+	case 0x43, 0x47, 0x4B, 0x4F: // 100_0011, 100_0111, 100_1011, 100_1111: FMADD, FMSUB, FNMSUB, FNMADD
+		execFloatMulAdd(instr)
+		setPC(add64(pc, instrLen))
+	case 0x53: // 101_0011: floating point arithmetic
+		execFloatOp(instr)
+		setPC(add64(pc, instrLen))
 	default:
-		revertWithCode(riscv.ErrUnknownOpCode, fmt.Errorf("unknown instruction opcode: %d", opcode))
+		revertWithCode(riscv.ErrUnknownOpCode, fmt.Errorf("unknown instruction opcode: 0x%02x", opcode))
 	}
 	return nil
 }
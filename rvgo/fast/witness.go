@@ -18,6 +18,16 @@ type StepWitness struct {
 
 	MemProof []byte
 
+	// ThreadProof is the witness of the thread that this step switches to, followed by the root of
+	// the thread stack below it. It is only set when the step pops a suspended thread.
+	ThreadProof []byte
+
+	// FreeRangeProof is the witness of the free range that this step pops from the free range stack, followed by
+	// the root of the free range stack below it, and the same for a second free range that the step pops after it.
+	// It is only set when the step pops a free range.
+	// A step pops at most one thread or two free ranges, never both.
+	FreeRangeProof []byte
+
 	PreimageKey    [32]byte // zeroed when no pre-image is accessed
 	PreimageValue  []byte   // including the 8-byte length prefix
 	PreimageOffset uint64
@@ -28,13 +38,22 @@ func (wit *StepWitness) EncodeStepInput(localContext LocalContext) ([]byte, erro
 	if err != nil {
 		return nil, err
 	}
-	input, err := abi.Pack("step", wit.State, wit.MemProof, localContext)
+	input, err := abi.Pack("step", wit.State, wit.ProofData(), localContext)
 	if err != nil {
 		return nil, err
 	}
 	return input, nil
 }
 
+// ProofData returns the proof input of the step: the memory proofs, followed by the thread proof or the free range
+// proof if any.
+func (wit *StepWitness) ProofData() []byte {
+	out := make([]byte, 0, len(wit.MemProof)+len(wit.ThreadProof)+len(wit.FreeRangeProof))
+	out = append(out, wit.MemProof...)
+	out = append(out, wit.ThreadProof...)
+	return append(out, wit.FreeRangeProof...)
+}
+
 func (wit *StepWitness) HasPreimage() bool {
 	return wit.PreimageKey != ([32]byte{})
 }
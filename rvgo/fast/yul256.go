@@ -17,7 +17,6 @@ func beWordAsB32(v U256) [32]byte {
 	return v.Bytes32()
 }
 
-// nolint:unused
 func add(x, y U256) (out U256) {
 	out.Add(&x, &y)
 	return
@@ -33,7 +32,6 @@ func mul(x, y U256) (out U256) {
 	return
 }
 
-// nolint:unused
 func div(x, y U256) (out U256) {
 	out.Div(&x, &y)
 	return
@@ -45,7 +43,6 @@ func sdiv(x, y U256) (out U256) { // note: signed overflow semantics are the sam
 	return
 }
 
-// nolint:unused
 func mod(x, y U256) (out U256) {
 	out.Mod(&x, &y)
 	return
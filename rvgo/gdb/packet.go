@@ -0,0 +1,98 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// interruptByte is sent by the client, outside of a packet, to stop a running program
+const interruptByte = 0x03
+
+// event is what the client sent: a packet, an interrupt request, or a packet with a bad checksum
+type event struct {
+	packet    string
+	interrupt bool
+	badPacket bool
+	err       error
+}
+
+// readEvent reads the next event from the client. Acknowledgments of our packets are skipped.
+func readEvent(r *bufio.Reader) event {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return event{err: err}
+		}
+		switch b {
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return event{err: err}
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				return event{err: err}
+			}
+			expected, err := strconv.ParseUint(string(sum[:]), 16, 8)
+			if err != nil || uint8(expected) != checksum(data) {
+				return event{badPacket: true}
+			}
+			return event{packet: unescape(data)}
+		case interruptByte:
+			return event{interrupt: true}
+		default: // '+' and '-' acknowledgments, and noise between packets
+		}
+	}
+}
+
+func checksum(data string) (sum uint8) {
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// escape escapes the characters that cannot appear in packet data, as '}' followed by the character xor 0x20
+func escape(data string) string {
+	if !strings.ContainsAny(data, "#$}*") {
+		return data
+	}
+	var out strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '#', '$', '}', '*':
+			out.WriteByte('}')
+			out.WriteByte(c ^ 0x20)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var out strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out.WriteByte(data[i] ^ 0x20)
+		} else {
+			out.WriteByte(data[i])
+		}
+	}
+	return out.String()
+}
+
+// writePacket writes the data as a packet
+func writePacket(w io.Writer, data string) error {
+	data = escape(data)
+	_, err := fmt.Fprintf(w, "$%s#%02x", data, checksum(data))
+	return err
+}
@@ -0,0 +1,507 @@
+package gdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// maxPacketSize is the largest packet that the client may send, reported in qSupported
+const maxPacketSize = 0x4000
+
+// interruptCheckSteps is the number of steps between checks for an interrupt request while the program runs
+const interruptCheckSteps = 1024
+
+// The signals in stop replies
+const (
+	sigInt  = 0x02
+	sigIll  = 0x04
+	sigTrap = 0x05
+)
+
+// watchpoint is a data breakpoint, of kind '2' (write), '3' (read) or '4' (access)
+type watchpoint struct {
+	kind byte
+	addr uint64
+	size uint64
+}
+
+// action is what to do after replying to a packet
+type action uint8
+
+const (
+	actionNone action = iota
+	actionStep
+	actionContinue
+	actionDetach
+	actionKill
+)
+
+// Server serves the GDB remote serial protocol for a program that runs in the fast VM.
+//
+// The program runs in all-stop mode: the threads of the VM are the threads of GDB (with ID + 1, as GDB does not use
+// thread ID 0), and a single-step runs one step of the VM, which may switch threads instead of running an instruction.
+// Breakpoints are kept by the server, memory is not patched with EBREAK instructions, so the state stays provable.
+type Server struct {
+	state *fast.VMState
+	inst  *fast.InstrumentedState
+
+	breakpoints map[uint64]struct{}
+	watchpoints map[watchpoint]struct{}
+	// the watchpoint that was triggered during the last step, if any
+	hit *watchpoint
+
+	// the GDB thread ID selected for register access, or 0 for the running thread
+	regThread uint64
+	noAck     bool
+	// the error that the VM failed with: it cannot step any further
+	err error
+}
+
+// NewServer creates a server for the program in the state. The server sets the memory tracer of inst.
+func NewServer(state *fast.VMState, inst *fast.InstrumentedState) *Server {
+	s := &Server{
+		state:       state,
+		inst:        inst,
+		breakpoints: make(map[uint64]struct{}),
+		watchpoints: make(map[watchpoint]struct{}),
+	}
+	inst.SetMemoryTracer(s.traceMemAccess)
+	return s
+}
+
+// Err returns the error that the VM failed with, if any
+func (s *Server) Err() error {
+	return s.err
+}
+
+// ErrDisconnected is returned by Serve when the client closed the connection without detaching or killing the program
+var ErrDisconnected = errors.New("debugger disconnected without detaching")
+
+// Serve runs a debugging session with the client on conn, until the client detaches or kills the program.
+// It fails with ErrDisconnected if the connection is closed before. The caller closes conn.
+func (s *Server) Serve(ctx context.Context, conn io.ReadWriter) error {
+	events := make(chan event)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			ev := readEvent(r)
+			select {
+			case events <- ev:
+			case <-done:
+				return
+			}
+			if ev.err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var ev event
+		select {
+		case ev = <-events:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		switch {
+		case ev.err != nil:
+			if errors.Is(ev.err, io.EOF) {
+				return ErrDisconnected
+			}
+			return ev.err
+		case ev.badPacket:
+			if !s.noAck {
+				if _, err := io.WriteString(conn, "-"); err != nil {
+					return err
+				}
+			}
+			continue
+		case ev.interrupt: // the program is stopped already
+			continue
+		}
+		if !s.noAck {
+			if _, err := io.WriteString(conn, "+"); err != nil {
+				return err
+			}
+		}
+
+		reply, act := s.handle(ev.packet)
+		if act == actionStep || act == actionContinue {
+			var err error
+			if reply, err = s.resume(ctx, events, act == actionStep); err != nil {
+				return err
+			}
+			if s.err != nil { // tell the user why the program stopped, before it is reported as killed
+				msg := fmt.Sprintf("asterisc: %v\n", s.err)
+				if err := writePacket(conn, "O"+hex.EncodeToString([]byte(msg))); err != nil {
+					return err
+				}
+			}
+		}
+		if act == actionKill { // the client expects no reply
+			return nil
+		}
+		if err := writePacket(conn, reply); err != nil {
+			return err
+		}
+		if act == actionDetach {
+			return nil
+		}
+	}
+}
+
+// handle replies to a packet. Resuming the program is left to the caller.
+func (s *Server) handle(packet string) (string, action) {
+	if packet == "" {
+		return "", actionNone
+	}
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return s.stopReply(sigTrap), actionNone
+	case 'q':
+		return s.query(args), actionNone
+	case 'Q':
+		if args == "StartNoAckMode" {
+			s.noAck = true
+			return "OK", actionNone
+		}
+		return "", actionNone
+	case 'H':
+		if len(args) < 1 {
+			return "E01", actionNone
+		}
+		tid, ok := parseThreadID(args[1:])
+		if !ok {
+			return "E01", actionNone
+		}
+		if args[0] == 'g' {
+			if _, ok := s.threadRegisters(tid); !ok {
+				return "E01", actionNone
+			}
+			s.regThread = tid
+		}
+		return "OK", actionNone
+	case 'T':
+		tid, ok := parseThreadID(args)
+		if !ok {
+			return "E01", actionNone
+		}
+		if _, ok := s.threadRegisters(tid); !ok {
+			return "E01", actionNone
+		}
+		return "OK", actionNone
+	case 'g':
+		regs, _ := s.threadRegisters(s.regThread)
+		var out strings.Builder
+		for _, n := range gRegisters {
+			v, _ := regs.get(n)
+			out.WriteString(hex.EncodeToString(v))
+		}
+		return out.String(), actionNone
+	case 'G':
+		regs, _ := s.threadRegisters(s.regThread)
+		data, err := hex.DecodeString(args)
+		if err != nil {
+			return "E01", actionNone
+		}
+		for _, n := range gRegisters {
+			v, _ := regs.get(n)
+			if len(data) < len(v) {
+				return "E01", actionNone
+			}
+			regs.set(n, data[:len(v)])
+			data = data[len(v):]
+		}
+		return "OK", actionNone
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 64)
+		if err != nil {
+			return "E01", actionNone
+		}
+		regs, _ := s.threadRegisters(s.regThread)
+		v, ok := regs.get(n)
+		if !ok {
+			return "E01", actionNone
+		}
+		return hex.EncodeToString(v), actionNone
+	case 'P':
+		num, val, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(num, 16, 64)
+		if err != nil {
+			return "E01", actionNone
+		}
+		v, err := hex.DecodeString(val)
+		if err != nil {
+			return "E01", actionNone
+		}
+		regs, _ := s.threadRegisters(s.regThread)
+		if !regs.set(n, v) {
+			return "E01", actionNone
+		}
+		return "OK", actionNone
+	case 'm':
+		addr, size, ok := parseRange(args)
+		if !ok || size > maxPacketSize/2 {
+			return "E01", actionNone
+		}
+		return hex.EncodeToString(s.readMemory(addr, size)), actionNone
+	case 'M':
+		rng, val, _ := strings.Cut(args, ":")
+		addr, size, ok := parseRange(rng)
+		data, err := hex.DecodeString(val)
+		if !ok || err != nil || uint64(len(data)) != size {
+			return "E01", actionNone
+		}
+		s.writeMemory(addr, data)
+		return "OK", actionNone
+	case 's', 'c':
+		if args != "" { // resume at the given address
+			addr, err := strconv.ParseUint(args, 16, 64)
+			if err != nil {
+				return "E01", actionNone
+			}
+			s.state.PC = addr
+		}
+		if packet[0] == 's' {
+			return "", actionStep
+		}
+		return "", actionContinue
+	case 'Z', 'z':
+		return s.setBreakpoint(packet[0] == 'Z', args), actionNone
+	case 'k':
+		return "", actionKill
+	case 'D':
+		return "OK", actionDetach
+	case 'v':
+		if args == "Kill" || strings.HasPrefix(args, "Kill;") {
+			return "OK", actionDetach
+		}
+		return "", actionNone // including vCont?, so the client uses the s and c packets
+	default:
+		return "", actionNone
+	}
+}
+
+func (s *Server) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+;swbreak+", maxPacketSize)
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return fmt.Sprintf("QC%x", s.state.ThreadID+1)
+	case args == "fThreadInfo":
+		var ids []string
+		for _, tid := range s.threadIDs() {
+			ids = append(ids, strconv.FormatUint(tid, 16))
+		}
+		return "m" + strings.Join(ids, ",")
+	case args == "sThreadInfo":
+		return "l"
+	case args == "Symbol::":
+		return "OK"
+	case strings.HasPrefix(args, "Xfer:features:read:target.xml:"):
+		offset, size, ok := parseRange(strings.TrimPrefix(args, "Xfer:features:read:target.xml:"))
+		if !ok {
+			return "E01"
+		}
+		if offset >= uint64(len(targetXML)) {
+			return "l"
+		}
+		if end := offset + size; end < uint64(len(targetXML)) {
+			return "m" + targetXML[offset:end]
+		}
+		return "l" + targetXML[offset:]
+	default:
+		return ""
+	}
+}
+
+// setBreakpoint inserts or removes a breakpoint or a watchpoint, args is "type,addr,kind"
+func (s *Server) setBreakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return "E01"
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil {
+		return "E01"
+	}
+	kind, err := strconv.ParseUint(parts[2], 16, 64)
+	if err != nil {
+		return "E01"
+	}
+	switch parts[0] {
+	case "0", "1": // software and hardware breakpoints are the same
+		if insert {
+			s.breakpoints[addr] = struct{}{}
+		} else {
+			delete(s.breakpoints, addr)
+		}
+	case "2", "3", "4": // the kind of a watchpoint is its size
+		w := watchpoint{kind: parts[0][0], addr: addr, size: kind}
+		if insert {
+			s.watchpoints[w] = struct{}{}
+		} else {
+			delete(s.watchpoints, w)
+		}
+	default:
+		return ""
+	}
+	return "OK"
+}
+
+// resume runs a single step, or continues until a breakpoint, a watchpoint, the end of the program,
+// or an interrupt by the client. It returns the stop reply.
+func (s *Server) resume(ctx context.Context, events <-chan event, single bool) (string, error) {
+	s.regThread = 0
+	for i := uint64(1); ; i++ {
+		if s.err != nil {
+			return fmt.Sprintf("X%02x", sigIll), nil
+		}
+		if s.state.Exited {
+			return fmt.Sprintf("W%02x", s.state.ExitCode), nil
+		}
+		s.hit = nil
+		if _, err := s.inst.Step(false); err != nil {
+			s.err = err
+			continue
+		}
+		if s.state.Exited {
+			continue
+		}
+		if s.hit != nil {
+			kind := map[byte]string{'2': "watch", '3': "rwatch", '4': "awatch"}[s.hit.kind]
+			return fmt.Sprintf("T%02x%s:%x;thread:%x;", sigTrap, kind, s.hit.addr, s.state.ThreadID+1), nil
+		}
+		if single {
+			return s.stopReply(sigTrap), nil
+		}
+		// a thread that waits on a futex is at its ECALL, it did not reach the breakpoint
+		if _, ok := s.breakpoints[s.state.PC]; ok && s.state.FutexAddr == 0 {
+			return fmt.Sprintf("T%02xswbreak:;thread:%x;", sigTrap, s.state.ThreadID+1), nil
+		}
+		if i%interruptCheckSteps == 0 {
+			select {
+			case ev := <-events:
+				if ev.err != nil {
+					return "", ev.err
+				}
+				if ev.interrupt {
+					return s.stopReply(sigInt), nil
+				}
+				// any other packet is dropped: the client waits for the stop reply
+			case <-ctx.Done():
+				return "", ctx.Err()
+			default:
+			}
+		}
+	}
+}
+
+func (s *Server) stopReply(signal uint8) string {
+	if s.err != nil {
+		return fmt.Sprintf("X%02x", sigIll)
+	}
+	if s.state.Exited {
+		return fmt.Sprintf("W%02x", s.state.ExitCode)
+	}
+	return fmt.Sprintf("T%02xthread:%x;", signal, s.state.ThreadID+1)
+}
+
+// traceMemAccess is the memory tracer of the VM, it records the first watchpoint that a step triggers
+func (s *Server) traceMemAccess(addr uint64, size uint64, access uint8) {
+	if s.hit != nil || len(s.watchpoints) == 0 {
+		return
+	}
+	for w := range s.watchpoints {
+		matches := (w.kind == '2' && access == riscv.ProtWrite) ||
+			(w.kind == '3' && access == riscv.ProtRead) ||
+			(w.kind == '4' && access != riscv.ProtExec)
+		// the ranges overlap, without overflow at the top of the address space
+		overlaps := addr-w.addr < w.size || w.addr-addr < size
+		if matches && overlaps {
+			s.hit = &w
+			return
+		}
+	}
+}
+
+// threadIDs lists the GDB thread IDs, the running thread first
+func (s *Server) threadIDs() []uint64 {
+	ids := []uint64{s.state.ThreadID + 1}
+	for _, t := range s.state.LeftThreads {
+		ids = append(ids, t.ThreadID+1)
+	}
+	for _, t := range s.state.RightThreads {
+		ids = append(ids, t.ThreadID+1)
+	}
+	return ids
+}
+
+// threadRegisters returns the registers of the thread with the GDB thread ID, 0 is the running thread
+func (s *Server) threadRegisters(tid uint64) (registers, bool) {
+	if tid == 0 || tid == s.state.ThreadID+1 {
+		return registers{pc: &s.state.PC, x: &s.state.Registers, f: &s.state.FPRegisters, fcsr: &s.state.FCSR}, true
+	}
+	for _, stack := range [][]fast.ThreadState{s.state.LeftThreads, s.state.RightThreads} {
+		for i := range stack {
+			if t := &stack[i]; t.ThreadID+1 == tid {
+				return registers{pc: &t.PC, x: &t.Registers, f: &t.FPRegisters, fcsr: &t.FCSR}, true
+			}
+		}
+	}
+	return registers{}, false
+}
+
+func (s *Server) readMemory(addr uint64, size uint64) []byte {
+	out := make([]byte, size)
+	for i := uint64(0); i < size; i += 32 {
+		s.state.Memory.GetUnaligned(addr+i, out[i:min(i+32, size)])
+	}
+	return out
+}
+
+func (s *Server) writeMemory(addr uint64, data []byte) {
+	for i := 0; i < len(data); i += 32 {
+		s.state.Memory.SetUnaligned(addr+uint64(i), data[i:min(i+32, len(data))])
+	}
+}
+
+// parseThreadID parses a thread ID of the H and T packets: -1 (all threads) and 0 (any thread) are 0
+func parseThreadID(s string) (uint64, bool) {
+	if s == "-1" {
+		return 0, true
+	}
+	tid, err := strconv.ParseUint(s, 16, 64)
+	return tid, err == nil
+}
+
+// parseRange parses "addr,length" in hex
+func parseRange(s string) (uint64, uint64, bool) {
+	a, l, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, false
+	}
+	addr, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err := strconv.ParseUint(l, 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return addr, size, true
+}
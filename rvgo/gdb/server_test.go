@@ -0,0 +1,157 @@
+package gdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// client is the GDB side of a session
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(packet string) {
+	require.NoError(c.t, writePacket(c.conn, packet))
+}
+
+func (c *client) receive() string {
+	ev := readEvent(c.r)
+	require.NoError(c.t, ev.err)
+	require.False(c.t, ev.badPacket)
+	return ev.packet
+}
+
+func (c *client) request(packet string) string {
+	c.send(packet)
+	return c.receive()
+}
+
+// kill ends the session, the server only acknowledges the packet
+func (c *client) kill() {
+	c.send("k")
+	ack, err := c.r.ReadByte()
+	require.NoError(c.t, err)
+	require.Equal(c.t, byte('+'), ack)
+}
+
+func startSession(t *testing.T, state *fast.VMState) *client {
+	server := NewServer(state, fast.NewInstrumentedState(state, nil, nil, nil))
+	serverConn, clientConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(context.Background(), serverConn)
+		_ = serverConn.Close()
+	}()
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+		require.NoError(t, <-done)
+	})
+	return &client{t: t, conn: clientConn, r: bufio.NewReader(clientConn)}
+}
+
+func programState(insns ...uint32) *fast.VMState {
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), MemoryRegions: fast.UnprotectedRegions()}
+	for i, insn := range insns {
+		state.Memory.SetUnaligned(0x1000+uint64(i)*4, binary.LittleEndian.AppendUint32(nil, insn))
+	}
+	return state
+}
+
+func TestServer(t *testing.T) {
+	state := programState(
+		0x00108093, // addi x1, x1, 1
+		0x00113023, // sd x1, 0(x2)
+		0xff9ff06f, // j -8
+	)
+	state.Registers[2] = 0x2000
+	c := startSession(t, state)
+
+	require.Contains(t, c.request("qSupported:multiprocess+;swbreak+"), "qXfer:features:read+")
+	require.Equal(t, "OK", c.request("QStartNoAckMode"))
+	require.Equal(t, "T05thread:1;", c.request("?"))
+	require.Equal(t, "m1", c.request("qfThreadInfo"))
+
+	xml := c.request("qXfer:features:read:target.xml:0,10000")
+	require.True(t, strings.HasPrefix(xml, "l<?xml"))
+	require.Contains(t, xml, `<reg name="fcsr" bitsize="32" type="int" regnum="68"/>`)
+
+	// registers
+	require.Equal(t, "T05thread:1;", c.request("s"))
+	require.Equal(t, "0410000000000000", c.request("p20"))
+	require.Equal(t, "0100000000000000", c.request("p1"))
+	regs := c.request("g")
+	require.Len(t, regs, (33+32)*16+8)
+	require.Equal(t, "0100000000000000", regs[16:32])
+	require.Equal(t, "OK", c.request("P3=efbeadde00000000"))
+	require.Equal(t, uint64(0xdeadbeef), state.Registers[3])
+	require.Equal(t, "OK", c.request("P0=efbeadde00000000"))
+	require.Equal(t, uint64(0), state.Registers[0])
+
+	// watchpoint
+	require.Equal(t, "OK", c.request("Z2,2000,8"))
+	require.Equal(t, "T05watch:2000;thread:1;", c.request("c"))
+	require.Equal(t, uint64(0x1008), state.PC)
+	require.Equal(t, "0100000000000000", c.request("m2000,8"))
+	require.Equal(t, "OK", c.request("z2,2000,8"))
+
+	// breakpoint
+	require.Equal(t, "OK", c.request("Z0,1004,4"))
+	require.Equal(t, "T05swbreak:;thread:1;", c.request("c"))
+	require.Equal(t, uint64(0x1004), state.PC)
+	require.Equal(t, uint64(2), state.Registers[1])
+	require.Equal(t, "OK", c.request("z0,1004,4"))
+
+	// memory
+	require.Equal(t, "OK", c.request("M3ffe,4:01020304"))
+	require.Equal(t, "0001020304", c.request("m3ffd,5"))
+
+	// interrupt
+	c.send("c")
+	_, err := c.conn.Write([]byte{interruptByte})
+	require.NoError(t, err)
+	require.Equal(t, "T02thread:1;", c.receive())
+
+	require.Equal(t, "OK", c.request("D"))
+}
+
+func TestServerExit(t *testing.T) {
+	state := programState(0x00000073) // ecall
+	state.Registers[17] = riscv.SysExitGroup
+	state.Registers[10] = 3
+	c := startSession(t, state)
+	require.Equal(t, "W03", c.request("c"))
+	require.Equal(t, "W03", c.request("?"))
+	c.kill()
+}
+
+func TestServerDisconnect(t *testing.T) {
+	state := programState(0x00108093) // addi x1, x1, 1
+	server := NewServer(state, fast.NewInstrumentedState(state, nil, nil, nil))
+	serverConn, clientConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(context.Background(), serverConn) }()
+	c := &client{t: t, conn: clientConn, r: bufio.NewReader(clientConn)}
+	require.Equal(t, "OK", c.request("QStartNoAckMode"))
+	require.NoError(t, clientConn.Close())
+	require.ErrorIs(t, <-done, ErrDisconnected)
+}
+
+func TestServerError(t *testing.T) {
+	state := programState(0xffffffff) // illegal instruction
+	c := startSession(t, state)
+	out := c.request("s")
+	require.True(t, strings.HasPrefix(out, "O"))
+	require.Equal(t, "X04", c.receive())
+	c.kill()
+}
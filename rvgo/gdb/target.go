@@ -0,0 +1,87 @@
+package gdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// The register numbers of GDB for RISC-V: the integer registers, the PC, the floating point registers,
+// and then the CSRs, numbered from regCSRBase
+const (
+	regPC      = 32
+	regF0      = 33
+	regCSRBase = 65
+	regFCSR    = regCSRBase + 3
+)
+
+// targetXML describes the registers to GDB, in the order of the 'g' packet
+var targetXML = func() string {
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd"><target version="1.0">`)
+	out.WriteString(`<architecture>riscv:rv64</architecture><feature name="org.gnu.gdb.riscv.cpu">`)
+	for i, name := range riscv.IntRegisterNames {
+		fmt.Fprintf(&out, `<reg name="%s" bitsize="64" type="int" regnum="%d"/>`, name, i)
+	}
+	fmt.Fprintf(&out, `<reg name="pc" bitsize="64" type="code_ptr" regnum="%d"/>`, regPC)
+	out.WriteString(`</feature><feature name="org.gnu.gdb.riscv.fpu">`)
+	for i, name := range riscv.FloatRegisterNames {
+		fmt.Fprintf(&out, `<reg name="%s" bitsize="64" type="ieee_double" regnum="%d"/>`, name, regF0+i)
+	}
+	fmt.Fprintf(&out, `<reg name="fcsr" bitsize="32" type="int" regnum="%d"/>`, regFCSR)
+	out.WriteString(`</feature></target>`)
+	return out.String()
+}()
+
+// registers of a thread, the running thread or a suspended thread
+type registers struct {
+	pc   *uint64
+	x    *[32]uint64
+	f    *[32]uint64
+	fcsr *uint64
+}
+
+// get returns the little-endian encoding of register n, or false if there is no such register
+func (r registers) get(n uint64) ([]byte, bool) {
+	switch {
+	case n < regPC:
+		return binary.LittleEndian.AppendUint64(nil, r.x[n]), true
+	case n == regPC:
+		return binary.LittleEndian.AppendUint64(nil, *r.pc), true
+	case n >= regF0 && n < regF0+32:
+		return binary.LittleEndian.AppendUint64(nil, r.f[n-regF0]), true
+	case n == regFCSR:
+		return binary.LittleEndian.AppendUint32(nil, uint32(*r.fcsr)), true
+	default:
+		return nil, false
+	}
+}
+
+// set sets register n from its little-endian encoding. Writes to register zero are ignored.
+func (r registers) set(n uint64, v []byte) bool {
+	switch {
+	case n < regPC && len(v) == 8:
+		if n != 0 {
+			r.x[n] = binary.LittleEndian.Uint64(v)
+		}
+	case n == regPC && len(v) == 8:
+		*r.pc = binary.LittleEndian.Uint64(v)
+	case n >= regF0 && n < regF0+32 && len(v) == 8:
+		r.f[n-regF0] = binary.LittleEndian.Uint64(v)
+	case n == regFCSR && len(v) == 4:
+		*r.fcsr = uint64(binary.LittleEndian.Uint32(v)) & 0xff // frm and fflags
+	default:
+		return false
+	}
+	return true
+}
+
+// gRegisters are the registers of the 'g' packet, in order
+var gRegisters = func() (out []uint64) {
+	for n := uint64(0); n < regF0+32; n++ {
+		out = append(out, n)
+	}
+	return append(out, regFCSR)
+}()
@@ -21,6 +21,10 @@ func main() {
 		cmd.LoadELFCommand,
 		cmd.WitnessCommand,
 		cmd.RunCommand,
+		cmd.DebugCommand,
+		cmd.ReplCommand,
+		cmd.TraceDiffCommand,
+		cmd.ConvertCommand,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -0,0 +1,390 @@
+package riscv
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Reg is an integer register, x0 to x31
+type Reg uint32
+
+// The integer registers, by ABI name
+const (
+	RegZero Reg = iota
+	RegRA
+	RegSP
+	RegGP
+	RegTP
+	RegT0
+	RegT1
+	RegT2
+	RegS0
+	RegS1
+	RegA0
+	RegA1
+	RegA2
+	RegA3
+	RegA4
+	RegA5
+	RegA6
+	RegA7
+	RegS2
+	RegS3
+	RegS4
+	RegS5
+	RegS6
+	RegS7
+	RegS8
+	RegS9
+	RegS10
+	RegS11
+	RegT3
+	RegT4
+	RegT5
+	RegT6
+)
+
+func (r Reg) String() string {
+	return IntRegisterNames[r&31]
+}
+
+// AmoOp is the funct5 of an atomic memory operation
+type AmoOp uint32
+
+const (
+	AmoAdd  AmoOp = 0x00
+	AmoSwap AmoOp = 0x01
+	AmoLr   AmoOp = 0x02
+	AmoSc   AmoOp = 0x03
+	AmoXor  AmoOp = 0x04
+	AmoOr   AmoOp = 0x08
+	AmoAnd  AmoOp = 0x0C
+	AmoMin  AmoOp = 0x10
+	AmoMax  AmoOp = 0x14
+	AmoMinu AmoOp = 0x18
+	AmoMaxu AmoOp = 0x1C
+)
+
+// EncodeR encodes an R-type instruction
+func EncodeR(opcode uint32, rd Reg, funct3 uint32, rs1 Reg, rs2 Reg, funct7 uint32) uint32 {
+	return (funct7&0x7F)<<25 | uint32(rs2&31)<<20 | uint32(rs1&31)<<15 | (funct3&7)<<12 | uint32(rd&31)<<7 | opcode&0x7F
+}
+
+// EncodeI encodes an I-type instruction, with the lower 12 bits of imm
+func EncodeI(opcode uint32, rd Reg, funct3 uint32, rs1 Reg, imm int64) uint32 {
+	return (uint32(imm)&0xFFF)<<20 | uint32(rs1&31)<<15 | (funct3&7)<<12 | uint32(rd&31)<<7 | opcode&0x7F
+}
+
+// EncodeS encodes an S-type instruction, with the lower 12 bits of imm
+func EncodeS(opcode uint32, funct3 uint32, rs1 Reg, rs2 Reg, imm int64) uint32 {
+	v := uint32(imm)
+	return bits(v, 5, 7)<<25 | uint32(rs2&31)<<20 | uint32(rs1&31)<<15 | (funct3&7)<<12 | bits(v, 0, 5)<<7 | opcode&0x7F
+}
+
+// EncodeB encodes a B-type instruction, with the offset imm in multiples of 2 bytes, of up to 13 bits
+func EncodeB(opcode uint32, funct3 uint32, rs1 Reg, rs2 Reg, imm int64) uint32 {
+	v := uint32(imm)
+	return bits(v, 12, 1)<<31 | bits(v, 5, 6)<<25 | uint32(rs2&31)<<20 | uint32(rs1&31)<<15 | (funct3&7)<<12 |
+		bits(v, 1, 4)<<8 | bits(v, 11, 1)<<7 | opcode&0x7F
+}
+
+// EncodeU encodes a U-type instruction, with the lower 20 bits of imm as the upper 20 bits of the value
+func EncodeU(opcode uint32, rd Reg, imm int64) uint32 {
+	return (uint32(imm)&0xFFFFF)<<12 | uint32(rd&31)<<7 | opcode&0x7F
+}
+
+// EncodeJ encodes a J-type instruction, with the offset imm in multiples of 2 bytes, of up to 21 bits
+func EncodeJ(opcode uint32, rd Reg, imm int64) uint32 {
+	v := uint32(imm)
+	return bits(v, 20, 1)<<31 | bits(v, 1, 10)<<21 | bits(v, 11, 1)<<20 | bits(v, 12, 8)<<12 | uint32(rd&31)<<7 | opcode&0x7F
+}
+
+// Memory is where an assembled program is written to, e.g. a fast.Memory.
+// The program is written in chunks of at most 32 bytes.
+type Memory interface {
+	SetUnaligned(addr uint64, dat []byte)
+}
+
+// fixup is an instruction that refers to a label, encoded once all labels are known
+type fixup struct {
+	offset int // offset of the instruction in the program
+	label  string
+	encode func(imm int64) (uint32, error)
+}
+
+// Assembler builds a program of RISC-V instructions, starting at a base address.
+// Branches and jumps refer to labels, which may be defined before or after them.
+// The first error of a builder, e.g. an immediate out of range, is returned by Program and WriteMemory.
+type Assembler struct {
+	base   uint64
+	code   []byte
+	labels map[string]uint64
+	fixups []fixup
+	err    error
+}
+
+func NewAssembler(base uint64) *Assembler {
+	return &Assembler{base: base, labels: make(map[string]uint64)}
+}
+
+// PC returns the address of the next instruction
+func (a *Assembler) PC() uint64 {
+	return a.base + uint64(len(a.code))
+}
+
+// Label defines the label at the address of the next instruction
+func (a *Assembler) Label(name string) {
+	if _, ok := a.labels[name]; ok {
+		a.fail(fmt.Errorf("label %q is already defined", name))
+		return
+	}
+	a.labels[name] = a.PC()
+}
+
+// Addr returns the address of a label
+func (a *Assembler) Addr(name string) (uint64, bool) {
+	addr, ok := a.labels[name]
+	return addr, ok
+}
+
+func (a *Assembler) fail(err error) {
+	if a.err == nil {
+		a.err = fmt.Errorf("at %#x: %w", a.PC(), err)
+	}
+}
+
+// Emit appends a raw 32 bit instruction
+func (a *Assembler) Emit(instr uint32) {
+	a.code = binary.LittleEndian.AppendUint32(a.code, instr)
+}
+
+// EmitCompressed appends a raw 16 bit compressed instruction
+func (a *Assembler) EmitCompressed(instr uint16) {
+	a.code = binary.LittleEndian.AppendUint16(a.code, instr)
+}
+
+// Program resolves the labels, and returns the encoded program
+func (a *Assembler) Program() ([]byte, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	out := make([]byte, len(a.code))
+	copy(out, a.code)
+	for _, f := range a.fixups {
+		pc := a.base + uint64(f.offset)
+		addr, ok := a.labels[f.label]
+		if !ok {
+			return nil, fmt.Errorf("at %#x: undefined label %q", pc, f.label)
+		}
+		instr, err := f.encode(int64(addr - pc))
+		if err != nil {
+			return nil, fmt.Errorf("at %#x: %w", pc, err)
+		}
+		binary.LittleEndian.PutUint32(out[f.offset:], instr)
+	}
+	return out, nil
+}
+
+// WriteMemory writes the program to memory, at the base address
+func (a *Assembler) WriteMemory(mem Memory) error {
+	program, err := a.Program()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(program); i += 32 {
+		mem.SetUnaligned(a.base+uint64(i), program[i:min(i+32, len(program))])
+	}
+	return nil
+}
+
+// checkImm checks that imm is a signed value of the given bit width, and a multiple of align
+func checkImm(imm int64, width uint, align int64) error {
+	if imm < -(1<<(width-1)) || imm >= 1<<(width-1) {
+		return fmt.Errorf("immediate %d does not fit in %d bits", imm, width)
+	}
+	if imm%align != 0 {
+		return fmt.Errorf("immediate %d is not a multiple of %d", imm, align)
+	}
+	return nil
+}
+
+// R appends an R-type instruction
+func (a *Assembler) R(opcode uint32, rd Reg, funct3 uint32, rs1 Reg, rs2 Reg, funct7 uint32) {
+	a.Emit(EncodeR(opcode, rd, funct3, rs1, rs2, funct7))
+}
+
+// I appends an I-type instruction, with a 12 bit signed immediate
+func (a *Assembler) I(opcode uint32, rd Reg, funct3 uint32, rs1 Reg, imm int64) {
+	if err := checkImm(imm, 12, 1); err != nil {
+		a.fail(err)
+	}
+	a.Emit(EncodeI(opcode, rd, funct3, rs1, imm))
+}
+
+// S appends an S-type instruction, with a 12 bit signed immediate
+func (a *Assembler) S(opcode uint32, funct3 uint32, rs1 Reg, rs2 Reg, imm int64) {
+	if err := checkImm(imm, 12, 1); err != nil {
+		a.fail(err)
+	}
+	a.Emit(EncodeS(opcode, funct3, rs1, rs2, imm))
+}
+
+// B appends a B-type instruction, that branches to the label
+func (a *Assembler) B(opcode uint32, funct3 uint32, rs1 Reg, rs2 Reg, label string) {
+	a.fixups = append(a.fixups, fixup{offset: len(a.code), label: label, encode: func(imm int64) (uint32, error) {
+		return EncodeB(opcode, funct3, rs1, rs2, imm), checkImm(imm, 13, 2)
+	}})
+	a.Emit(0)
+}
+
+// U appends a U-type instruction, with the 20 bit upper immediate
+func (a *Assembler) U(opcode uint32, rd Reg, imm int64) {
+	if imm < 0 || imm >= 1<<20 {
+		a.fail(fmt.Errorf("upper immediate %#x does not fit in 20 bits", imm))
+	}
+	a.Emit(EncodeU(opcode, rd, imm))
+}
+
+// J appends a J-type instruction, that jumps to the label
+func (a *Assembler) J(opcode uint32, rd Reg, label string) {
+	a.fixups = append(a.fixups, fixup{offset: len(a.code), label: label, encode: func(imm int64) (uint32, error) {
+		return EncodeJ(opcode, rd, imm), checkImm(imm, 21, 2)
+	}})
+	a.Emit(0)
+}
+
+// The builders below append a single instruction, with the operands in assembly order:
+// a memory operand offset(base) is given as base, offset.
+
+func (a *Assembler) Lui(rd Reg, imm int64)   { a.U(0x37, rd, imm) }
+func (a *Assembler) Auipc(rd Reg, imm int64) { a.U(0x17, rd, imm) }
+
+func (a *Assembler) Jal(rd Reg, label string)           { a.J(0x6F, rd, label) }
+func (a *Assembler) Jalr(rd Reg, rs1 Reg, offset int64) { a.I(0x67, rd, 0, rs1, offset) }
+
+func (a *Assembler) Beq(rs1, rs2 Reg, label string)  { a.B(0x63, 0, rs1, rs2, label) }
+func (a *Assembler) Bne(rs1, rs2 Reg, label string)  { a.B(0x63, 1, rs1, rs2, label) }
+func (a *Assembler) Blt(rs1, rs2 Reg, label string)  { a.B(0x63, 4, rs1, rs2, label) }
+func (a *Assembler) Bge(rs1, rs2 Reg, label string)  { a.B(0x63, 5, rs1, rs2, label) }
+func (a *Assembler) Bltu(rs1, rs2 Reg, label string) { a.B(0x63, 6, rs1, rs2, label) }
+func (a *Assembler) Bgeu(rs1, rs2 Reg, label string) { a.B(0x63, 7, rs1, rs2, label) }
+
+func (a *Assembler) Lb(rd, base Reg, offset int64)  { a.I(0x03, rd, 0, base, offset) }
+func (a *Assembler) Lh(rd, base Reg, offset int64)  { a.I(0x03, rd, 1, base, offset) }
+func (a *Assembler) Lw(rd, base Reg, offset int64)  { a.I(0x03, rd, 2, base, offset) }
+func (a *Assembler) Ld(rd, base Reg, offset int64)  { a.I(0x03, rd, 3, base, offset) }
+func (a *Assembler) Lbu(rd, base Reg, offset int64) { a.I(0x03, rd, 4, base, offset) }
+func (a *Assembler) Lhu(rd, base Reg, offset int64) { a.I(0x03, rd, 5, base, offset) }
+func (a *Assembler) Lwu(rd, base Reg, offset int64) { a.I(0x03, rd, 6, base, offset) }
+
+func (a *Assembler) Sb(rs2, base Reg, offset int64) { a.S(0x23, 0, base, rs2, offset) }
+func (a *Assembler) Sh(rs2, base Reg, offset int64) { a.S(0x23, 1, base, rs2, offset) }
+func (a *Assembler) Sw(rs2, base Reg, offset int64) { a.S(0x23, 2, base, rs2, offset) }
+func (a *Assembler) Sd(rs2, base Reg, offset int64) { a.S(0x23, 3, base, rs2, offset) }
+
+func (a *Assembler) Addi(rd, rs1 Reg, imm int64)  { a.I(0x13, rd, 0, rs1, imm) }
+func (a *Assembler) Slti(rd, rs1 Reg, imm int64)  { a.I(0x13, rd, 2, rs1, imm) }
+func (a *Assembler) Sltiu(rd, rs1 Reg, imm int64) { a.I(0x13, rd, 3, rs1, imm) }
+func (a *Assembler) Xori(rd, rs1 Reg, imm int64)  { a.I(0x13, rd, 4, rs1, imm) }
+func (a *Assembler) Ori(rd, rs1 Reg, imm int64)   { a.I(0x13, rd, 6, rs1, imm) }
+func (a *Assembler) Andi(rd, rs1 Reg, imm int64)  { a.I(0x13, rd, 7, rs1, imm) }
+func (a *Assembler) Addiw(rd, rs1 Reg, imm int64) { a.I(0x1B, rd, 0, rs1, imm) }
+
+func (a *Assembler) Slli(rd, rs1 Reg, shamt uint32) { a.shift(0x13, rd, 1, rs1, shamt, 0x00, 64) }
+func (a *Assembler) Srli(rd, rs1 Reg, shamt uint32) { a.shift(0x13, rd, 5, rs1, shamt, 0x00, 64) }
+func (a *Assembler) Srai(rd, rs1 Reg, shamt uint32) { a.shift(0x13, rd, 5, rs1, shamt, 0x10, 64) }
+
+// shift appends a shift by an immediate; funct6 is the top 6 bits of the immediate
+func (a *Assembler) shift(opcode uint32, rd Reg, funct3 uint32, rs1 Reg, shamt uint32, funct6 uint32, width uint32) {
+	if shamt >= width {
+		a.fail(fmt.Errorf("shift amount %d is out of range", shamt))
+	}
+	a.Emit(EncodeI(opcode, rd, funct3, rs1, int64(funct6<<6|shamt&63)))
+}
+
+func (a *Assembler) Add(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 0, rs1, rs2, 0x00) }
+func (a *Assembler) Sub(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 0, rs1, rs2, 0x20) }
+func (a *Assembler) Sll(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 1, rs1, rs2, 0x00) }
+func (a *Assembler) Slt(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 2, rs1, rs2, 0x00) }
+func (a *Assembler) Sltu(rd, rs1, rs2 Reg) { a.R(0x33, rd, 3, rs1, rs2, 0x00) }
+func (a *Assembler) Xor(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 4, rs1, rs2, 0x00) }
+func (a *Assembler) Srl(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 5, rs1, rs2, 0x00) }
+func (a *Assembler) Sra(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 5, rs1, rs2, 0x20) }
+func (a *Assembler) Or(rd, rs1, rs2 Reg)   { a.R(0x33, rd, 6, rs1, rs2, 0x00) }
+func (a *Assembler) And(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 7, rs1, rs2, 0x00) }
+func (a *Assembler) Addw(rd, rs1, rs2 Reg) { a.R(0x3B, rd, 0, rs1, rs2, 0x00) }
+func (a *Assembler) Subw(rd, rs1, rs2 Reg) { a.R(0x3B, rd, 0, rs1, rs2, 0x20) }
+
+func (a *Assembler) Mul(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 0, rs1, rs2, 0x01) }
+func (a *Assembler) Div(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 4, rs1, rs2, 0x01) }
+func (a *Assembler) Divu(rd, rs1, rs2 Reg) { a.R(0x33, rd, 5, rs1, rs2, 0x01) }
+func (a *Assembler) Rem(rd, rs1, rs2 Reg)  { a.R(0x33, rd, 6, rs1, rs2, 0x01) }
+func (a *Assembler) Remu(rd, rs1, rs2 Reg) { a.R(0x33, rd, 7, rs1, rs2, 0x01) }
+
+// AmoW appends a 32 bit atomic memory operation: amo<op>.w rd, rs2, (addr)
+func (a *Assembler) AmoW(op AmoOp, rd, rs2, addr Reg) { a.R(0x2F, rd, 2, addr, rs2, uint32(op)<<2) }
+
+// AmoD appends a 64 bit atomic memory operation: amo<op>.d rd, rs2, (addr)
+func (a *Assembler) AmoD(op AmoOp, rd, rs2, addr Reg) { a.R(0x2F, rd, 3, addr, rs2, uint32(op)<<2) }
+
+func (a *Assembler) LrW(rd, addr Reg)      { a.AmoW(AmoLr, rd, RegZero, addr) }
+func (a *Assembler) LrD(rd, addr Reg)      { a.AmoD(AmoLr, rd, RegZero, addr) }
+func (a *Assembler) ScW(rd, rs2, addr Reg) { a.AmoW(AmoSc, rd, rs2, addr) }
+func (a *Assembler) ScD(rd, rs2, addr Reg) { a.AmoD(AmoSc, rd, rs2, addr) }
+
+func (a *Assembler) Fence()  { a.Emit(0x0330000F) } // fence rw, rw
+func (a *Assembler) Ecall()  { a.Emit(0x00000073) }
+func (a *Assembler) Ebreak() { a.Emit(0x00100073) }
+
+// Pseudo-instructions
+
+func (a *Assembler) Nop()                       { a.Addi(RegZero, RegZero, 0) }
+func (a *Assembler) Mv(rd, rs1 Reg)             { a.Addi(rd, rs1, 0) }
+func (a *Assembler) Jump(label string)          { a.Jal(RegZero, label) }
+func (a *Assembler) Call(label string)          { a.Jal(RegRA, label) }
+func (a *Assembler) Ret()                       { a.Jalr(RegZero, RegRA, 0) }
+func (a *Assembler) Beqz(rs1 Reg, label string) { a.Beq(rs1, RegZero, label) }
+func (a *Assembler) Bnez(rs1 Reg, label string) { a.Bne(rs1, RegZero, label) }
+
+// Li loads a 64 bit constant into rd, with lui, addi, addiw and slli
+func (a *Assembler) Li(rd Reg, v int64) {
+	lo := int64(int32(uint32(v)<<20) >> 20) // sign-extended lower 12 bits
+	if v == int64(int32(v)) {
+		hi := (v - lo) >> 12 & 0xFFFFF
+		switch {
+		case hi == 0:
+			a.Addi(rd, RegZero, lo)
+		case lo == 0:
+			a.Lui(rd, hi)
+		default:
+			a.Lui(rd, hi)
+			a.Addiw(rd, rd, lo)
+		}
+		return
+	}
+	// load the upper bits, without trailing zeroes, then shift them into place and add the lower 12 bits
+	hi := (v - lo) >> 12
+	shift := uint32(12)
+	for hi&1 == 0 {
+		hi >>= 1
+		shift++
+	}
+	a.Li(rd, hi)
+	a.Slli(rd, rd, shift)
+	if lo != 0 {
+		a.Addi(rd, rd, lo)
+	}
+}
+
+// Syscall loads the syscall number and arguments into a7 and a0 to a5, and appends an ecall
+func (a *Assembler) Syscall(num uint64, args ...int64) {
+	if len(args) > 6 {
+		a.fail(fmt.Errorf("syscall %d has %d arguments, at most 6 are passed in registers", num, len(args)))
+		return
+	}
+	a.Li(RegA7, int64(num))
+	for i, arg := range args {
+		a.Li(RegA0+Reg(i), arg)
+	}
+	a.Ecall()
+}
@@ -0,0 +1,118 @@
+package riscv
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testMemory is a sparse memory, by byte address
+type testMemory map[uint64]byte
+
+func (m testMemory) SetUnaligned(addr uint64, dat []byte) {
+	for i, b := range dat {
+		m[addr+uint64(i)] = b
+	}
+}
+
+// disassembleProgram disassembles a program of 32 bit instructions, one per line
+func disassembleProgram(t *testing.T, a *Assembler) []string {
+	program, err := a.Program()
+	require.NoError(t, err)
+	var out []string
+	for i := 0; i < len(program); i += 4 {
+		out = append(out, Disassemble(binary.LittleEndian.Uint32(program[i:]), a.base+uint64(i)))
+	}
+	return out
+}
+
+func TestAssembler(t *testing.T) {
+	a := NewAssembler(0x1000)
+	a.Li(RegA0, 3)
+	a.Label("loop")
+	a.Addi(RegA0, RegA0, -1)
+	a.Sd(RegA0, RegSP, -8)
+	a.AmoD(AmoAdd, RegA1, RegA0, RegA2)
+	a.LrW(RegT0, RegA2)
+	a.ScW(RegT1, RegT0, RegA2)
+	a.Bnez(RegA0, "loop")
+	a.Jump("end")
+	a.Slli(RegA0, RegA0, 63)
+	a.Label("end")
+	a.Syscall(SysExitGroup, 0)
+
+	end, ok := a.Addr("end")
+	require.True(t, ok)
+	require.Equal(t, uint64(0x1024), end)
+	require.Equal(t, []string{
+		"addi a0, zero, 3",
+		"addi a0, a0, -1",
+		"sd a0, -8(sp)",
+		"amoadd.d a1, a0, (a2)",
+		"lr.w t0, (a2)",
+		"sc.w t1, t0, (a2)",
+		"bne a0, zero, 0x1004",
+		"jal zero, 0x1024",
+		"slli a0, a0, 63",
+		"addi a7, zero, 94",
+		"addi a0, zero, 0",
+		"ecall",
+	}, disassembleProgram(t, a))
+
+	mem := make(testMemory)
+	require.NoError(t, a.WriteMemory(mem))
+	require.Len(t, mem, 12*4)
+	require.Equal(t, byte(0x73), mem[0x102c]) // ecall
+}
+
+func TestAssemblerLi(t *testing.T) {
+	cases := []struct {
+		v    int64
+		want []string
+	}{
+		{0, []string{"addi a0, zero, 0"}},
+		{-2048, []string{"addi a0, zero, -2048"}},
+		{0x1000, []string{"lui a0, 0x1"}},
+		{0x12345678, []string{"lui a0, 0x12345", "addiw a0, a0, 1656"}},
+		{0x7fff_ffff, []string{"lui a0, 0x80000", "addiw a0, a0, -1"}},
+		{-0x8000_0000, []string{"lui a0, 0x80000"}},
+		{0x1_0000_0000, []string{"addi a0, zero, 1", "slli a0, a0, 32"}},
+		{0x1234_5678_9abc_def0, []string{
+			"lui a0, 0x247", "addiw a0, a0, -1875", "slli a0, a0, 14", "addi a0, a0, -947", "slli a0, a0, 12",
+			"addi a0, a0, 1511", "slli a0, a0, 13", "addi a0, a0, -272",
+		}},
+	}
+	for _, tc := range cases {
+		a := NewAssembler(0)
+		a.Li(RegA0, tc.v)
+		require.Equal(t, tc.want, disassembleProgram(t, a), "li a0, %#x", tc.v)
+	}
+}
+
+func TestAssemblerErrors(t *testing.T) {
+	a := NewAssembler(0x1000)
+	a.Beqz(RegA0, "missing")
+	_, err := a.Program()
+	require.EqualError(t, err, `at 0x1000: undefined label "missing"`)
+
+	a = NewAssembler(0x1000)
+	a.Nop()
+	a.Addi(RegA0, RegA0, 2048)
+	_, err = a.Program()
+	require.EqualError(t, err, "at 0x1004: immediate 2048 does not fit in 12 bits")
+
+	a = NewAssembler(0x1000)
+	a.Beqz(RegA0, "far")
+	for i := 0; i < 1024; i++ {
+		a.Nop()
+	}
+	a.Label("far")
+	_, err = a.Program()
+	require.EqualError(t, err, "at 0x1000: immediate 4100 does not fit in 13 bits")
+
+	a = NewAssembler(0x1000)
+	a.Label("twice")
+	a.Label("twice")
+	require.EqualError(t, a.WriteMemory(make(testMemory)), `at 0x1000: label "twice" is already defined`)
+}
@@ -28,8 +28,61 @@ const (
 	SysMunmap           = 215
 	SysGetRandom        = 278
 	SysPrlimit64        = 261
-	SysFutex            = 422
+	SysFutex            = 98
 	SysNanosleep        = 101
+	SysMprotect         = 226
+	SysGetcwd           = 17
+	SysIoctl            = 29
+	SysGetuid           = 174
+	SysGetgid           = 176
+
+	MapFixed     = 0x10
+	MapAnonymous = 0x20
+
+	// FreeRangeMapped marks a mapped range on the free range stack, in the low bit of its page-aligned address
+	FreeRangeMapped = 0x1
+
+	// ProtRead, ProtWrite and ProtExec are the memory permissions, as in the prot argument of mmap.
+	// ProtDefault are the permissions of data: of memory outside the memory regions of the state,
+	// and of memory that mmap reserves with PROT_NONE.
+	ProtRead    = 0x1
+	ProtWrite   = 0x2
+	ProtExec    = 0x4
+	ProtAll     = ProtRead | ProtWrite | ProtExec
+	ProtDefault = ProtRead | ProtWrite
+	// MemoryRegionCount is the number of memory regions in the state
+	MemoryRegionCount = 8
+	// ExitCodeFault is the exit code of a program that accessed memory without the required permission,
+	// as of a process killed by SIGSEGV (128 + 11)
+	ExitCodeFault = 139
+
+	FutexWait    = 0
+	FutexWake    = 1
+	FutexCmdMask = 0x7f // ignore FUTEX_PRIVATE_FLAG and FUTEX_CLOCK_REALTIME
+	// FutexTimeoutSteps is the most steps a FUTEX_WAIT with a timeout waits before it times out,
+	// a full time slice, so that the other threads get to run and wake the waiting thread first.
+	FutexTimeoutSteps = SchedQuantum
+
+	// ClockRealtime and ClockRealtimeCoarse read the virtual clock offset by the epoch,
+	// all other clocks, such as CLOCK_MONOTONIC, read the virtual clock as-is.
+	ClockRealtime       = 0
+	ClockRealtimeCoarse = 5
+	NanosPerSecond      = 1_000_000_000
+
+	// RandomGamma is the increment of the SplitMix64 PRNG state,
+	// RandomMix1 and RandomMix2 are the multipliers that mix the state into a pseudo-random value.
+	RandomGamma = 0x9e3779b97f4a7c15
+	RandomMix1  = 0xbf58476d1ce4e5b9
+	RandomMix2  = 0x94d049bb133111eb
+	// RandomMaxBytes is the maximum number of bytes that a getrandom call fills: one value of the PRNG.
+	RandomMaxBytes = 8
+
+	// CloneThreadFlags are the clone flags used by the Go runtime to create a thread:
+	// CLONE_VM | CLONE_FS | CLONE_FILES | CLONE_SIGHAND | CLONE_SYSVSEM | CLONE_THREAD
+	CloneThreadFlags = 0x50f00
+
+	// SchedQuantum is the number of steps a thread runs before it is preempted
+	SchedQuantum = 100_000
 
 	FdStdin         = 0
 	FdStdout        = 1
@@ -55,4 +108,6 @@ const (
 	ErrBadAMOSize                     = uint64(0xbada70)
 	ErrFailToReadPreimage             = uint64(0xbadf00d0)
 	ErrBadMemoryProof                 = uint64(0xbadf00d1)
+	ErrBadThreadProof                 = uint64(0xbadf00d2)
+	ErrBadFreeRangeProof              = uint64(0xbadf00d3)
 )
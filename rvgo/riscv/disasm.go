@@ -0,0 +1,538 @@
+package riscv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble returns the assembly of the instruction at the given PC, with ABI register names,
+// e.g. "amoadd.d a0, a1, (a2)". The targets of branches and jumps are absolute addresses.
+// Compressed instructions are in the lower 16 bits of instr, and keep their "c." mnemonic.
+// Encodings that are reserved or unknown are returned as a .4byte or .2byte directive.
+func Disassemble(instr uint32, pc uint64) string {
+	if instr&3 != 3 {
+		if out := disassembleCompressed(instr&0xFFFF, pc); out != "" {
+			return out
+		}
+		return fmt.Sprintf(".2byte 0x%04x", instr&0xFFFF)
+	}
+	if out := disassemble(instr, pc); out != "" {
+		return out
+	}
+	return fmt.Sprintf(".4byte 0x%08x", instr)
+}
+
+// bits returns width bits of instr, starting at bit index lo
+func bits(instr uint32, lo uint32, width uint32) uint32 {
+	return (instr >> lo) & (1<<width - 1)
+}
+
+// signExtend sign-extends the lower width bits of v
+func signExtend(v uint32, width uint32) int64 {
+	return int64(int32(v<<(32-width)) >> (32 - width))
+}
+
+func xreg(reg uint32) string { return IntRegisterNames[reg] }
+
+func freg(reg uint32) string { return FloatRegisterNames[reg] }
+
+// asm formats an instruction with its operands
+func asm(mnemonic string, operands ...any) string {
+	var out strings.Builder
+	out.WriteString(mnemonic)
+	for i, op := range operands {
+		if i == 0 {
+			out.WriteString(" ")
+		} else {
+			out.WriteString(", ")
+		}
+		fmt.Fprint(&out, op)
+	}
+	return out.String()
+}
+
+// mem formats a memory operand: offset(base)
+func mem(offset int64, base uint32) string {
+	return fmt.Sprintf("%d(%s)", offset, xreg(base))
+}
+
+func target(pc uint64, offset int64) string {
+	return fmt.Sprintf("%#x", pc+uint64(offset))
+}
+
+var (
+	loadNames   = [8]string{"lb", "lh", "lw", "ld", "lbu", "lhu", "lwu", ""}
+	storeNames  = [8]string{"sb", "sh", "sw", "sd", "", "", "", ""}
+	branchNames = [8]string{"beq", "bne", "", "", "blt", "bge", "bltu", "bgeu"}
+	csrOpNames  = [4]string{"", "csrrw", "csrrs", "csrrc"}
+)
+
+// opNames are the register-register operations of opcode 0x33, by funct7<<3 | funct3
+var opNames = map[uint32]string{
+	0x00<<3 | 0: "add", 0x00<<3 | 1: "sll", 0x00<<3 | 2: "slt", 0x00<<3 | 3: "sltu",
+	0x00<<3 | 4: "xor", 0x00<<3 | 5: "srl", 0x00<<3 | 6: "or", 0x00<<3 | 7: "and",
+	0x20<<3 | 0: "sub", 0x20<<3 | 5: "sra",
+	// M extension
+	0x01<<3 | 0: "mul", 0x01<<3 | 1: "mulh", 0x01<<3 | 2: "mulhsu", 0x01<<3 | 3: "mulhu",
+	0x01<<3 | 4: "div", 0x01<<3 | 5: "divu", 0x01<<3 | 6: "rem", 0x01<<3 | 7: "remu",
+	// Zba, Zbb, Zbc, Zbs and Zicond extensions
+	0x10<<3 | 2: "sh1add", 0x10<<3 | 4: "sh2add", 0x10<<3 | 6: "sh3add",
+	0x20<<3 | 4: "xnor", 0x20<<3 | 6: "orn", 0x20<<3 | 7: "andn",
+	0x05<<3 | 1: "clmul", 0x05<<3 | 2: "clmulr", 0x05<<3 | 3: "clmulh",
+	0x05<<3 | 4: "min", 0x05<<3 | 5: "minu", 0x05<<3 | 6: "max", 0x05<<3 | 7: "maxu",
+	0x30<<3 | 1: "rol", 0x30<<3 | 5: "ror",
+	0x14<<3 | 1: "bset", 0x24<<3 | 1: "bclr", 0x34<<3 | 1: "binv", 0x24<<3 | 5: "bext",
+	0x07<<3 | 5: "czero.eqz", 0x07<<3 | 7: "czero.nez",
+}
+
+// op32Names are the 32 bit register-register operations of opcode 0x3B, by funct7<<3 | funct3
+var op32Names = map[uint32]string{
+	0x00<<3 | 0: "addw", 0x20<<3 | 0: "subw", 0x00<<3 | 1: "sllw", 0x00<<3 | 5: "srlw", 0x20<<3 | 5: "sraw",
+	// M extension
+	0x01<<3 | 0: "mulw", 0x01<<3 | 4: "divw", 0x01<<3 | 5: "divuw", 0x01<<3 | 6: "remw", 0x01<<3 | 7: "remuw",
+	// Zba and Zbb extensions
+	0x04<<3 | 0: "add.uw", 0x10<<3 | 2: "sh1add.uw", 0x10<<3 | 4: "sh2add.uw", 0x10<<3 | 6: "sh3add.uw",
+	0x30<<3 | 1: "rolw", 0x30<<3 | 5: "rorw",
+}
+
+// unaryNames are the Zbb unary operations, by the lower 6 bits of the immediate; the first 3 have a 32 bit variant
+var unaryNames = map[uint32]string{0: "clz", 1: "ctz", 2: "cpop", 4: "sext.b", 5: "sext.h"}
+
+// amoNames are the atomic memory operations, by funct5
+var amoNames = map[uint32]string{
+	0x00: "amoadd", 0x01: "amoswap", 0x02: "lr", 0x03: "sc", 0x04: "amoxor", 0x08: "amoor", 0x0C: "amoand",
+	0x10: "amomin", 0x14: "amomax", 0x18: "amominu", 0x1C: "amomaxu",
+}
+
+var csrNames = map[uint32]string{
+	0x001: "fflags", 0x002: "frm", 0x003: "fcsr",
+	0xC00: "cycle", 0xC01: "time", 0xC02: "instret",
+}
+
+// floatFmtNames are the suffixes of the floating point formats, and the integer move suffixes of the same width
+var (
+	floatFmtNames = [4]string{"s", "d", "h", "q"}
+	floatMvNames  = [4]string{"w", "d", "h", ""}
+	intCvtNames   = [4]string{"w", "wu", "l", "lu"}
+)
+
+// roundingModeNames are the static rounding modes; the dynamic rounding mode 7 is the default and not printed
+var roundingModeNames = [8]string{"rne", "rtz", "rdn", "rup", "rmm", "", "", ""}
+
+// withRoundingMode appends the rounding mode operand, or returns "" if the rounding mode is invalid
+func withRoundingMode(out string, rm uint32) string {
+	if rm == 7 {
+		return out
+	}
+	if roundingModeNames[rm] == "" {
+		return ""
+	}
+	return out + ", " + roundingModeNames[rm]
+}
+
+// fenceSet formats the predecessor or successor set of a fence: i, o, r and w
+func fenceSet(v uint32) string {
+	var out strings.Builder
+	for i, c := range "iorw" {
+		if v&(8>>i) != 0 {
+			out.WriteRune(c)
+		}
+	}
+	if out.Len() == 0 {
+		return "0"
+	}
+	return out.String()
+}
+
+// disassemble returns the assembly of a 32 bit instruction, or "" if it is unknown
+func disassemble(instr uint32, pc uint64) string {
+	opcode := bits(instr, 0, 7)
+	rd := bits(instr, 7, 5)
+	funct3 := bits(instr, 12, 3)
+	rs1 := bits(instr, 15, 5)
+	rs2 := bits(instr, 20, 5)
+	funct7 := bits(instr, 25, 7)
+	immI := signExtend(bits(instr, 20, 12), 12)
+	shamt := bits(instr, 20, 6)
+
+	switch opcode {
+	case 0x03: // 000_0011: memory loading
+		if name := loadNames[funct3]; name != "" {
+			return asm(name, xreg(rd), mem(immI, rs1))
+		}
+	case 0x07: // 000_0111: floating point loading
+		switch funct3 {
+		case 1:
+			return asm("flh", freg(rd), mem(immI, rs1))
+		case 2:
+			return asm("flw", freg(rd), mem(immI, rs1))
+		case 3:
+			return asm("fld", freg(rd), mem(immI, rs1))
+		}
+	case 0x0F: // 000_1111: fence
+		switch funct3 {
+		case 0:
+			fm, pred, succ := bits(instr, 28, 4), bits(instr, 24, 4), bits(instr, 20, 4)
+			switch {
+			case fm == 8 && pred == 3 && succ == 3:
+				return "fence.tso"
+			case instr == 0x0100000F:
+				return "pause"
+			case fm == 0:
+				return asm("fence", fenceSet(pred), fenceSet(succ))
+			}
+		case 1:
+			return "fence.i"
+		}
+	case 0x13: // 001_0011: immediate arithmetic and logic
+		switch funct3 {
+		case 0:
+			return asm("addi", xreg(rd), xreg(rs1), immI)
+		case 1:
+			switch bits(instr, 26, 6) {
+			case 0x00:
+				return asm("slli", xreg(rd), xreg(rs1), shamt)
+			case 0x0A:
+				return asm("bseti", xreg(rd), xreg(rs1), shamt)
+			case 0x12:
+				return asm("bclri", xreg(rd), xreg(rs1), shamt)
+			case 0x1A:
+				return asm("binvi", xreg(rd), xreg(rs1), shamt)
+			case 0x18:
+				if name, ok := unaryNames[shamt]; ok {
+					return asm(name, xreg(rd), xreg(rs1))
+				}
+			}
+		case 2:
+			return asm("slti", xreg(rd), xreg(rs1), immI)
+		case 3:
+			return asm("sltiu", xreg(rd), xreg(rs1), immI)
+		case 4:
+			return asm("xori", xreg(rd), xreg(rs1), immI)
+		case 5:
+			switch bits(instr, 26, 6) {
+			case 0x00:
+				return asm("srli", xreg(rd), xreg(rs1), shamt)
+			case 0x10:
+				return asm("srai", xreg(rd), xreg(rs1), shamt)
+			case 0x12:
+				return asm("bexti", xreg(rd), xreg(rs1), shamt)
+			case 0x18:
+				return asm("rori", xreg(rd), xreg(rs1), shamt)
+			case 0x0A:
+				if shamt == 0x07 {
+					return asm("orc.b", xreg(rd), xreg(rs1))
+				}
+			case 0x1A:
+				if shamt == 0x38 {
+					return asm("rev8", xreg(rd), xreg(rs1))
+				}
+			}
+		case 6:
+			return asm("ori", xreg(rd), xreg(rs1), immI)
+		case 7:
+			return asm("andi", xreg(rd), xreg(rs1), immI)
+		}
+	case 0x17: // 001_0111: AUIPC
+		return asm("auipc", xreg(rd), fmt.Sprintf("%#x", bits(instr, 12, 20)))
+	case 0x1B: // 001_1011: immediate arithmetic and logic signed 32 bit
+		switch funct3 {
+		case 0:
+			return asm("addiw", xreg(rd), xreg(rs1), immI)
+		case 1:
+			switch bits(instr, 26, 6) {
+			case 0x00:
+				if shamt < 32 {
+					return asm("slliw", xreg(rd), xreg(rs1), shamt)
+				}
+			case 0x02:
+				return asm("slli.uw", xreg(rd), xreg(rs1), shamt)
+			case 0x18:
+				if name, ok := unaryNames[shamt]; ok && shamt < 3 {
+					return asm(name+"w", xreg(rd), xreg(rs1))
+				}
+			}
+		case 5:
+			switch funct7 {
+			case 0x00:
+				return asm("srliw", xreg(rd), xreg(rs1), rs2)
+			case 0x20:
+				return asm("sraiw", xreg(rd), xreg(rs1), rs2)
+			case 0x30:
+				return asm("roriw", xreg(rd), xreg(rs1), rs2)
+			}
+		}
+	case 0x23: // 010_0011: memory storing
+		immS := signExtend(funct7<<5|rd, 12)
+		if name := storeNames[funct3]; name != "" {
+			return asm(name, xreg(rs2), mem(immS, rs1))
+		}
+	case 0x27: // 010_0111: floating point storing
+		immS := signExtend(funct7<<5|rd, 12)
+		switch funct3 {
+		case 1:
+			return asm("fsh", freg(rs2), mem(immS, rs1))
+		case 2:
+			return asm("fsw", freg(rs2), mem(immS, rs1))
+		case 3:
+			return asm("fsd", freg(rs2), mem(immS, rs1))
+		}
+	case 0x2F: // 010_1111: atomic memory operations
+		if funct3 != 2 && funct3 != 3 {
+			return ""
+		}
+		name, ok := amoNames[bits(instr, 27, 5)]
+		if !ok {
+			return ""
+		}
+		name += [4]string{"", "", ".w", ".d"}[funct3] + [4]string{"", ".rl", ".aq", ".aqrl"}[bits(instr, 25, 2)]
+		if name[:2] == "lr" {
+			if rs2 != 0 {
+				return ""
+			}
+			return asm(name, xreg(rd), "("+xreg(rs1)+")")
+		}
+		return asm(name, xreg(rd), xreg(rs2), "("+xreg(rs1)+")")
+	case 0x33: // 011_0011: register arithmetic and logic
+		if name, ok := opNames[funct7<<3|funct3]; ok {
+			return asm(name, xreg(rd), xreg(rs1), xreg(rs2))
+		}
+	case 0x37: // 011_0111: LUI
+		return asm("lui", xreg(rd), fmt.Sprintf("%#x", bits(instr, 12, 20)))
+	case 0x3B: // 011_1011: register arithmetic and logic in 32 bits
+		if funct7 == 0x04 && funct3 == 4 && rs2 == 0 {
+			return asm("zext.h", xreg(rd), xreg(rs1))
+		}
+		if name, ok := op32Names[funct7<<3|funct3]; ok {
+			return asm(name, xreg(rd), xreg(rs1), xreg(rs2))
+		}
+	case 0x43, 0x47, 0x4B, 0x4F: // 100_0011, 100_0111, 100_1011, 100_1111: FMADD, FMSUB, FNMSUB, FNMADD
+		name := [4]string{"fmadd", "fmsub", "fnmsub", "fnmadd"}[bits(instr, 2, 2)] + "." + floatFmtNames[bits(instr, 25, 2)]
+		return withRoundingMode(asm(name, freg(rd), freg(rs1), freg(rs2), freg(bits(instr, 27, 5))), funct3)
+	case 0x53: // 101_0011: floating point arithmetic
+		return disassembleFloat(instr)
+	case 0x63: // 110_0011: branching
+		immB := signExtend(bits(instr, 31, 1)<<12|bits(instr, 7, 1)<<11|bits(instr, 25, 6)<<5|bits(instr, 8, 4)<<1, 13)
+		if name := branchNames[funct3]; name != "" {
+			return asm(name, xreg(rs1), xreg(rs2), target(pc, immB))
+		}
+	case 0x67: // 110_0111: JALR
+		if funct3 == 0 {
+			return asm("jalr", xreg(rd), mem(immI, rs1))
+		}
+	case 0x6F: // 110_1111: JAL
+		immJ := signExtend(bits(instr, 31, 1)<<20|bits(instr, 12, 8)<<12|bits(instr, 20, 1)<<11|bits(instr, 21, 10)<<1, 21)
+		return asm("jal", xreg(rd), target(pc, immJ))
+	case 0x73: // 111_0011: environment things
+		switch funct3 {
+		case 0:
+			switch bits(instr, 20, 12) {
+			case 0x000:
+				return "ecall"
+			case 0x001:
+				return "ebreak"
+			case 0x102:
+				return "sret"
+			case 0x302:
+				return "mret"
+			case 0x105:
+				return "wfi"
+			}
+		case 4:
+			return ""
+		default:
+			num := bits(instr, 20, 12)
+			csr, ok := csrNames[num]
+			if !ok {
+				csr = fmt.Sprintf("%#x", num)
+			}
+			if funct3&4 != 0 {
+				return asm(csrOpNames[funct3&3]+"i", xreg(rd), csr, rs1)
+			}
+			return asm(csrOpNames[funct3&3], xreg(rd), csr, xreg(rs1))
+		}
+	}
+	return ""
+}
+
+// disassembleFloat returns the assembly of a floating point arithmetic instruction, or "" if it is unknown
+func disassembleFloat(instr uint32) string {
+	rd := bits(instr, 7, 5)
+	rm := bits(instr, 12, 3)
+	rs1 := bits(instr, 15, 5)
+	rs2 := bits(instr, 20, 5)
+	fpFmt := bits(instr, 25, 2)
+	suffix := "." + floatFmtNames[fpFmt]
+	switch bits(instr, 27, 5) {
+	case 0x00, 0x01, 0x02, 0x03: // FADD, FSUB, FMUL, FDIV
+		name := [4]string{"fadd", "fsub", "fmul", "fdiv"}[bits(instr, 27, 2)]
+		return withRoundingMode(asm(name+suffix, freg(rd), freg(rs1), freg(rs2)), rm)
+	case 0x0B: // FSQRT
+		if rs2 == 0 {
+			return withRoundingMode(asm("fsqrt"+suffix, freg(rd), freg(rs1)), rm)
+		}
+	case 0x04: // FSGNJ, FSGNJN, FSGNJX
+		if rm < 3 {
+			return asm([3]string{"fsgnj", "fsgnjn", "fsgnjx"}[rm]+suffix, freg(rd), freg(rs1), freg(rs2))
+		}
+	case 0x05: // FMIN, FMAX
+		if rm < 2 {
+			return asm([2]string{"fmin", "fmax"}[rm]+suffix, freg(rd), freg(rs1), freg(rs2))
+		}
+	case 0x08: // FCVT between floating point formats
+		if rs2 < 4 && rs2 != fpFmt {
+			if fpFmt == 1 && rs2 == 0 { // widening from single precision is exact, without rounding
+				return asm("fcvt.d.s", freg(rd), freg(rs1))
+			}
+			return withRoundingMode(asm("fcvt"+suffix+"."+floatFmtNames[rs2], freg(rd), freg(rs1)), rm)
+		}
+	case 0x14: // FLE, FLT, FEQ
+		if rm < 3 {
+			return asm([3]string{"fle", "flt", "feq"}[rm]+suffix, xreg(rd), freg(rs1), freg(rs2))
+		}
+	case 0x18: // FCVT to an integer
+		if rs2 < 4 {
+			return withRoundingMode(asm("fcvt."+intCvtNames[rs2]+suffix, xreg(rd), freg(rs1)), rm)
+		}
+	case 0x1A: // FCVT from an integer
+		if fpFmt == 1 && rs2 < 2 { // a 32 bit integer fits in double precision, without rounding
+			return asm("fcvt.d."+intCvtNames[rs2], freg(rd), xreg(rs1))
+		}
+		if rs2 < 4 {
+			return withRoundingMode(asm("fcvt"+suffix+"."+intCvtNames[rs2], freg(rd), xreg(rs1)), rm)
+		}
+	case 0x1C: // FMV to an integer register, FCLASS
+		switch {
+		case rs2 == 0 && rm == 0 && floatMvNames[fpFmt] != "":
+			return asm("fmv.x."+floatMvNames[fpFmt], xreg(rd), freg(rs1))
+		case rs2 == 0 && rm == 1:
+			return asm("fclass"+suffix, xreg(rd), freg(rs1))
+		}
+	case 0x1E: // FMV from an integer register
+		if rs2 == 0 && rm == 0 && floatMvNames[fpFmt] != "" {
+			return asm("fmv."+floatMvNames[fpFmt]+".x", freg(rd), xreg(rs1))
+		}
+	}
+	return ""
+}
+
+// disassembleCompressed returns the assembly of a 16 bit compressed instruction, or "" if it is reserved or unknown
+func disassembleCompressed(instr uint32, pc uint64) string {
+	funct3 := bits(instr, 13, 3)
+	rd := bits(instr, 7, 5)           // rd/rs1
+	rs2 := bits(instr, 2, 5)          // rs2
+	rs1Prime := 8 + bits(instr, 7, 3) // rs1' and rd' of the arithmetic instructions
+	rdPrime := 8 + bits(instr, 2, 3)  // rd' of loads, rs2' of stores and of the arithmetic instructions
+	imm := signExtend(bits(instr, 12, 1)<<5|rs2, 6)
+	shamt := bits(instr, 12, 1)<<5 | rs2
+
+	switch instr & 3 {
+	case 0: // quadrant 0: stack-pointer based addition, and loads and stores
+		immW := int64(bits(instr, 10, 3)<<3 | bits(instr, 6, 1)<<2 | bits(instr, 5, 1)<<6)
+		immD := int64(bits(instr, 10, 3)<<3 | bits(instr, 5, 2)<<6)
+		switch funct3 {
+		case 0:
+			nzuimm := bits(instr, 11, 2)<<4 | bits(instr, 7, 4)<<6 | bits(instr, 6, 1)<<2 | bits(instr, 5, 1)<<3
+			if nzuimm != 0 {
+				return asm("c.addi4spn", xreg(rdPrime), "sp", nzuimm)
+			}
+		case 1:
+			return asm("c.fld", freg(rdPrime), mem(immD, rs1Prime))
+		case 2:
+			return asm("c.lw", xreg(rdPrime), mem(immW, rs1Prime))
+		case 3:
+			return asm("c.ld", xreg(rdPrime), mem(immD, rs1Prime))
+		case 5:
+			return asm("c.fsd", freg(rdPrime), mem(immD, rs1Prime))
+		case 6:
+			return asm("c.sw", xreg(rdPrime), mem(immW, rs1Prime))
+		case 7:
+			return asm("c.sd", xreg(rdPrime), mem(immD, rs1Prime))
+		}
+	case 1: // quadrant 1: arithmetic with immediates and registers, jumps and branches
+		switch funct3 {
+		case 0:
+			if rd == 0 {
+				if imm != 0 {
+					return asm("c.nop", imm)
+				}
+				return "c.nop"
+			}
+			return asm("c.addi", xreg(rd), imm)
+		case 1:
+			if rd != 0 {
+				return asm("c.addiw", xreg(rd), imm)
+			}
+		case 2:
+			return asm("c.li", xreg(rd), imm)
+		case 3:
+			if rd == 2 {
+				imm16 := signExtend(bits(instr, 12, 1)<<9|bits(instr, 6, 1)<<4|bits(instr, 5, 1)<<6|bits(instr, 3, 2)<<7|bits(instr, 2, 1)<<5, 10)
+				if imm16 != 0 {
+					return asm("c.addi16sp", "sp", imm16)
+				}
+			} else if imm != 0 {
+				return asm("c.lui", xreg(rd), fmt.Sprintf("%#x", uint32(imm)&0xFFFFF))
+			}
+		case 4:
+			switch bits(instr, 10, 2) {
+			case 0:
+				return asm("c.srli", xreg(rs1Prime), shamt)
+			case 1:
+				return asm("c.srai", xreg(rs1Prime), shamt)
+			case 2:
+				return asm("c.andi", xreg(rs1Prime), imm)
+			case 3:
+				if name := [8]string{"c.sub", "c.xor", "c.or", "c.and", "c.subw", "c.addw", "", ""}[bits(instr, 12, 1)<<2|bits(instr, 5, 2)]; name != "" {
+					return asm(name, xreg(rs1Prime), xreg(rdPrime))
+				}
+			}
+		case 5:
+			offset := signExtend(bits(instr, 12, 1)<<11|bits(instr, 11, 1)<<4|bits(instr, 9, 2)<<8|bits(instr, 8, 1)<<10|
+				bits(instr, 7, 1)<<6|bits(instr, 6, 1)<<7|bits(instr, 3, 3)<<1|bits(instr, 2, 1)<<5, 12)
+			return asm("c.j", target(pc, offset))
+		case 6, 7:
+			offset := signExtend(bits(instr, 12, 1)<<8|bits(instr, 10, 2)<<3|bits(instr, 5, 2)<<6|bits(instr, 3, 2)<<1|bits(instr, 2, 1)<<5, 9)
+			return asm([2]string{"c.beqz", "c.bnez"}[funct3-6], xreg(rs1Prime), target(pc, offset))
+		}
+	case 2: // quadrant 2: shifts, stack-pointer based loads and stores, moves and jumps
+		immLoadD := int64(bits(instr, 12, 1)<<5 | bits(instr, 5, 2)<<3 | bits(instr, 2, 3)<<6)
+		immStoreD := int64(bits(instr, 10, 3)<<3 | bits(instr, 7, 3)<<6)
+		switch funct3 {
+		case 0:
+			return asm("c.slli", xreg(rd), shamt)
+		case 1:
+			return asm("c.fldsp", freg(rd), mem(immLoadD, 2))
+		case 2:
+			if rd != 0 {
+				return asm("c.lwsp", xreg(rd), mem(int64(bits(instr, 12, 1)<<5|bits(instr, 4, 3)<<2|bits(instr, 2, 2)<<6), 2))
+			}
+		case 3:
+			if rd != 0 {
+				return asm("c.ldsp", xreg(rd), mem(immLoadD, 2))
+			}
+		case 4:
+			switch {
+			case bits(instr, 12, 1) == 0 && rs2 == 0:
+				if rd != 0 {
+					return asm("c.jr", xreg(rd))
+				}
+			case bits(instr, 12, 1) == 0:
+				return asm("c.mv", xreg(rd), xreg(rs2))
+			case rs2 == 0 && rd == 0:
+				return "c.ebreak"
+			case rs2 == 0:
+				return asm("c.jalr", xreg(rd))
+			default:
+				return asm("c.add", xreg(rd), xreg(rs2))
+			}
+		case 5:
+			return asm("c.fsdsp", freg(rs2), mem(immStoreD, 2))
+		case 6:
+			return asm("c.swsp", xreg(rs2), mem(int64(bits(instr, 9, 4)<<2|bits(instr, 7, 2)<<6), 2))
+		case 7:
+			return asm("c.sdsp", xreg(rs2), mem(immStoreD, 2))
+		}
+	}
+	return ""
+}
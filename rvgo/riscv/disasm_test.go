@@ -0,0 +1,98 @@
+package riscv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisassemble(t *testing.T) {
+	const pc = 0x1000
+	cases := []struct {
+		instr uint32
+		want  string
+	}{
+		// RV64I
+		{0x00113823, "sd ra, 16(sp)"},
+		{0xfe113823, "sd ra, -16(sp)"},
+		{0x12345537, "lui a0, 0x12345"},
+		{0x00002197, "auipc gp, 0x2"},
+		{0xfff00513, "addi a0, zero, -1"},
+		{0x03f31293, "slli t0, t1, 63"},
+		{0x41f5d51b, "sraiw a0, a1, 31"},
+		{0x40c58533, "sub a0, a1, a2"},
+		{0xfeb50ce3, "beq a0, a1, 0xff8"},
+		{0x001000ef, "jal ra, 0x1800"},
+		{0x00008067, "jalr zero, 0(ra)"},
+		{0x00000073, "ecall"},
+		{0x00100073, "ebreak"},
+		{0x0330000f, "fence rw, rw"},
+		{0x0000100f, "fence.i"},
+		{0x00302573, "csrrs a0, fcsr, zero"},
+		{0x0020d073, "csrrwi zero, frm, 1"},
+		// M and A
+		{0x02c5b533, "mulhu a0, a1, a2"},
+		{0x02c5f53b, "remuw a0, a1, a2"},
+		{0x00b6352f, "amoadd.d a0, a1, (a2)"},
+		{0x140522af, "lr.w.aq t0, (a0)"},
+		{0x1ac5332f, "sc.d.rl t1, a2, (a0)"},
+		// bit manipulation
+		{0x20c5c533, "sh2add a0, a1, a2"},
+		{0x0805853b, "add.uw a0, a1, zero"},
+		{0x40c5f533, "andn a0, a1, a2"},
+		{0x6075d513, "rori a0, a1, 7"},
+		{0x6b85d513, "rev8 a0, a1"},
+		{0x2875d513, "orc.b a0, a1"},
+		{0x6005951b, "clzw a0, a1"},
+		{0x60559513, "sext.h a0, a1"},
+		{0x0805c53b, "zext.h a0, a1"},
+		{0x4855d513, "bexti a0, a1, 5"},
+		// F and D
+		{0x00b12227, "fsw fa1, 4(sp)"},
+		{0x6ac5f543, "fmadd.d fa0, fa1, fa2, fa3"},
+		{0x00209053, "fadd.s ft0, ft1, ft2, rtz"},
+		{0x5a057553, "fsqrt.d fa0, fa0"},
+		{0x22b59553, "fsgnjn.d fa0, fa1, fa1"},
+		{0xc2251553, "fcvt.l.d a0, fa0, rtz"},
+		{0xd2150553, "fcvt.d.wu fa0, a0"},
+		{0x4015f553, "fcvt.s.d fa0, fa1"},
+		{0xa2b51553, "flt.d a0, fa0, fa1"},
+		{0xe2050553, "fmv.x.d a0, fa0"},
+		{0xf0050553, "fmv.w.x fa0, a0"},
+		{0xe0051553, "fclass.s a0, fa0"},
+		// compressed
+		{0x0804, "c.addi4spn s1, sp, 16"},
+		{0x6588, "c.ld a0, 8(a1)"},
+		{0x2508, "c.fld fa0, 8(a0)"},
+		{0x0001, "c.nop"},
+		{0x1141, "c.addi sp, -16"},
+		{0x557d, "c.li a0, -1"},
+		{0x2505, "c.addiw a0, 1"},
+		{0x7139, "c.addi16sp sp, -64"},
+		{0x77fd, "c.lui a5, 0xfffff"},
+		{0x8105, "c.srli a0, 1"},
+		{0x850d, "c.srai a0, 3"},
+		{0x8d0d, "c.sub a0, a1"},
+		{0x9d2d, "c.addw a0, a1"},
+		{0xbffd, "c.j 0xffe"},
+		{0xe119, "c.bnez a0, 0x1006"},
+		{0x050e, "c.slli a0, 3"},
+		{0x60e2, "c.ldsp ra, 24(sp)"},
+		{0x8082, "c.jr ra"},
+		{0x852e, "c.mv a0, a1"},
+		{0x9002, "c.ebreak"},
+		{0x9502, "c.jalr a0"},
+		{0x952e, "c.add a0, a1"},
+		{0xec06, "c.sdsp ra, 24(sp)"},
+		{0xa42a, "c.fsdsp fa0, 8(sp)"},
+		// reserved and unknown encodings
+		{0xffffffff, ".4byte 0xffffffff"},
+		{0x0000707f, ".4byte 0x0000707f"},
+		{0x0000, ".2byte 0x0000"},
+		{0x6e81, ".2byte 0x6e81"},
+		{0x4002, ".2byte 0x4002"},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.want, Disassemble(tc.instr, pc), "instruction %08x", tc.instr)
+	}
+}
@@ -0,0 +1,59 @@
+package riscv
+
+import "fmt"
+
+var syscallNames = map[uint64]string{
+	SysExit:             "exit",
+	SysExitGroup:        "exit_group",
+	SysBrk:              "brk",
+	SysMmap:             "mmap",
+	SysRead:             "read",
+	SysWrite:            "write",
+	SysFcntl:            "fcntl",
+	SysOpenat:           "openat",
+	SysSchedGetaffinity: "sched_getaffinity",
+	SysSchedYield:       "sched_yield",
+	SysClockGettime:     "clock_gettime",
+	SysRtSigprocmask:    "rt_sigprocmask",
+	SysSigaltstack:      "sigaltstack",
+	SysGettid:           "gettid",
+	SysRtSigaction:      "rt_sigaction",
+	SysClone:            "clone",
+	SysGetrlimit:        "getrlimit",
+	SysMadvise:          "madvise",
+	SysEpollCreate1:     "epoll_create1",
+	SysEpollCtl:         "epoll_ctl",
+	SysPipe2:            "pipe2",
+	SysReadlinnkat:      "readlinkat",
+	SysNewfstatat:       "newfstatat",
+	SysNewuname:         "newuname",
+	SysMunmap:           "munmap",
+	SysGetRandom:        "getrandom",
+	SysPrlimit64:        "prlimit64",
+	SysFutex:            "futex",
+	SysNanosleep:        "nanosleep",
+	SysMprotect:         "mprotect",
+	SysGetcwd:           "getcwd",
+	SysIoctl:            "ioctl",
+	SysGetuid:           "getuid",
+	SysGetgid:           "getgid",
+}
+
+// SyscallName returns the Linux name of the syscall with the given number,
+// or syscall_<num> for a syscall without a constant in this package.
+func SyscallName(num uint64) string {
+	if name, ok := syscallNames[num]; ok {
+		return name
+	}
+	return fmt.Sprintf("syscall_%d", num)
+}
+
+// SyscallNum returns the number of the syscall with the given Linux name
+func SyscallNum(name string) (uint64, bool) {
+	for num, n := range syscallNames {
+		if n == name {
+			return num, true
+		}
+	}
+	return 0, false
+}
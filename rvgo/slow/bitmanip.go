@@ -0,0 +1,88 @@
+package slow
+
+// Functions to emulate the Zbb and Zbs bit-manipulation extensions.
+// Zba (address generation) is a plain shift and add, and does not need any helpers.
+// These should 1:1 match with the same definitions in the fast package.
+
+// clz64 returns the number of leading zero bits, 64 if x is zero
+func clz64(x U64) U64 {
+	if x == (U64{}) {
+		return byteToU64(64)
+	}
+	return sub64(byteToU64(63), msb64(x))
+}
+
+// ctz64 returns the number of trailing zero bits, 64 if x is zero
+func ctz64(x U64) U64 {
+	if x == (U64{}) {
+		return byteToU64(64)
+	}
+	return msb64(and64(x, sub64(byteToU64(0), x))) // x & -x isolates the lowest set bit
+}
+
+// clz32 returns the number of leading zero bits of the lower 32 bits, 32 if those are zero
+func clz32(x U64) U64 {
+	return sub64(clz64(and64(x, u32Mask())), byteToU64(32))
+}
+
+// ctz32 returns the number of trailing zero bits of the lower 32 bits, 32 if those are zero
+func ctz32(x U64) U64 {
+	return ctz64(or64(x, shl64(byteToU64(32), byteToU64(1))))
+}
+
+// cpop64 returns the number of set bits
+func cpop64(x U64) (n U64) {
+	for i := uint8(0); i < 64; i++ {
+		n = add64(n, and64(shr64(byteToU64(i), x), byteToU64(1)))
+	}
+	return
+}
+
+// orcb64 sets each byte to all ones if any of its bits are set, and to zero otherwise
+func orcb64(x U64) (out U64) {
+	for i := uint8(0); i < 64; i += 8 {
+		if and64(shr64(byteToU64(i), x), byteToU64(0xff)) != (U64{}) {
+			out = or64(out, shl64(byteToU64(i), byteToU64(0xff)))
+		}
+	}
+	return
+}
+
+// rev864 reverses the order of the bytes
+func rev864(x U64) (out U64) {
+	for i := uint8(0); i < 64; i += 8 {
+		out = or64(out, shl64(byteToU64(56-i), and64(shr64(byteToU64(i), x), byteToU64(0xff))))
+	}
+	return
+}
+
+// rol64 rotates x left by the lower 6 bits of n
+func rol64(x U64, n U64) U64 {
+	n = and64(n, byteToU64(0x3F))
+	return or64(shl64(n, x), shr64(sub64(byteToU64(64), n), x))
+}
+
+// ror64 rotates x right by the lower 6 bits of n
+func ror64(x U64, n U64) U64 {
+	n = and64(n, byteToU64(0x3F))
+	return or64(shr64(n, x), shl64(sub64(byteToU64(64), n), x))
+}
+
+// rol32 rotates the lower 32 bits of x left by the lower 5 bits of n, and sign-extends the result
+func rol32(x U64, n U64) U64 {
+	x = and64(x, u32Mask())
+	n = and64(n, byteToU64(0x1F))
+	return mask32Signed64(or64(shl64(n, x), shr64(sub64(byteToU64(32), n), x)))
+}
+
+// ror32 rotates the lower 32 bits of x right by the lower 5 bits of n, and sign-extends the result
+func ror32(x U64, n U64) U64 {
+	x = and64(x, u32Mask())
+	n = and64(n, byteToU64(0x1F))
+	return mask32Signed64(or64(shr64(n, x), shl64(sub64(byteToU64(32), n), x)))
+}
+
+// bit64 returns a mask with only the bit at the lower 6 bits of n set
+func bit64(n U64) U64 {
+	return shl64(and64(n, byteToU64(0x3F)), byteToU64(1))
+}
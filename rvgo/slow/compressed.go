@@ -0,0 +1,287 @@
+package slow
+
+// Functions to expand 16-bit compressed (RVC) instructions into their 32-bit equivalents.
+// Every compressed instruction is an alias of a regular instruction,
+// so the VM expands it before decoding, and then executes the regular instruction.
+// These should 1:1 match with the same definitions in the fast package.
+
+// moveBits takes width bits of v, starting at bit index from, and places them at bit index to.
+func moveBits(v U64, from U64, width U64, to U64) U64 {
+	return shl64(to, and64(shr64(from, v), sub64(shl64(width, byteToU64(1)), byteToU64(1))))
+}
+
+// parseCRegPrime parses a 3-bit compressed register field at the given bit index; it addresses x8 to x15.
+func parseCRegPrime(instr U64, from U64) U64 {
+	return add64(byteToU64(8), moveBits(instr, from, byteToU64(3), byteToU64(0)))
+}
+
+func encodeTypeR(opcode U64, rd U64, funct3 U64, rs1 U64, rs2 U64, funct7 U64) U64 {
+	return or64(
+		or64(
+			or64(shl64(byteToU64(25), funct7), shl64(byteToU64(20), rs2)),
+			or64(shl64(byteToU64(15), rs1), shl64(byteToU64(12), funct3)),
+		),
+		or64(shl64(byteToU64(7), rd), opcode),
+	)
+}
+
+func encodeTypeI(opcode U64, rd U64, funct3 U64, rs1 U64, imm U64) U64 {
+	return or64(
+		or64(
+			moveBits(imm, byteToU64(0), byteToU64(12), byteToU64(20)),
+			or64(shl64(byteToU64(15), rs1), shl64(byteToU64(12), funct3)),
+		),
+		or64(shl64(byteToU64(7), rd), opcode),
+	)
+}
+
+func encodeTypeS(opcode U64, funct3 U64, rs1 U64, rs2 U64, imm U64) U64 {
+	return or64(
+		or64(
+			or64(moveBits(imm, byteToU64(5), byteToU64(7), byteToU64(25)), shl64(byteToU64(20), rs2)),
+			or64(shl64(byteToU64(15), rs1), shl64(byteToU64(12), funct3)),
+		),
+		or64(moveBits(imm, byteToU64(0), byteToU64(5), byteToU64(7)), opcode),
+	)
+}
+
+func encodeTypeB(opcode U64, funct3 U64, rs1 U64, rs2 U64, imm U64) U64 {
+	return or64(
+		or64(
+			or64(moveBits(imm, byteToU64(12), byteToU64(1), byteToU64(31)), moveBits(imm, byteToU64(5), byteToU64(6), byteToU64(25))),
+			or64(shl64(byteToU64(20), rs2), shl64(byteToU64(15), rs1)),
+		),
+		or64(
+			or64(shl64(byteToU64(12), funct3), moveBits(imm, byteToU64(1), byteToU64(4), byteToU64(8))),
+			or64(moveBits(imm, byteToU64(11), byteToU64(1), byteToU64(7)), opcode),
+		),
+	)
+}
+
+func encodeTypeU(opcode U64, rd U64, imm U64) U64 {
+	return or64(moveBits(imm, byteToU64(0), byteToU64(20), byteToU64(12)), or64(shl64(byteToU64(7), rd), opcode))
+}
+
+func encodeTypeJ(opcode U64, rd U64, imm U64) U64 {
+	return or64(
+		or64(
+			or64(moveBits(imm, byteToU64(20), byteToU64(1), byteToU64(31)), moveBits(imm, byteToU64(1), byteToU64(10), byteToU64(21))),
+			or64(moveBits(imm, byteToU64(11), byteToU64(1), byteToU64(20)), moveBits(imm, byteToU64(12), byteToU64(8), byteToU64(12))),
+		),
+		or64(shl64(byteToU64(7), rd), opcode),
+	)
+}
+
+// expandCompressed expands a 16-bit compressed instruction into the equivalent 32-bit instruction.
+// Reserved encodings expand to 0, which is not a valid instruction.
+func expandCompressed(instr U64) (out U64) {
+	switch and64(instr, byteToU64(3)).val() {
+	case 0:
+		out = expandCompressedQ0(instr)
+	case 1:
+		out = expandCompressedQ1(instr)
+	case 2:
+		out = expandCompressedQ2(instr)
+	}
+	return
+}
+
+// expandCompressedQ0 expands the quadrant 0 instructions: stack-pointer based addition, and loads and stores.
+func expandCompressedQ0(instr U64) (out U64) {
+	rs1 := parseCRegPrime(instr, byteToU64(7))
+	rd := parseCRegPrime(instr, byteToU64(2)) // rd' for loads, rs2' for stores
+	// unsigned offset for word loads and stores: uimm[5:3|2|6]
+	immW := or64(
+		moveBits(instr, byteToU64(10), byteToU64(3), byteToU64(3)),
+		or64(moveBits(instr, byteToU64(6), byteToU64(1), byteToU64(2)), moveBits(instr, byteToU64(5), byteToU64(1), byteToU64(6))),
+	)
+	// unsigned offset for double-word loads and stores: uimm[5:3|7:6]
+	immD := or64(moveBits(instr, byteToU64(10), byteToU64(3), byteToU64(3)), moveBits(instr, byteToU64(5), byteToU64(2), byteToU64(6)))
+	switch moveBits(instr, byteToU64(13), byteToU64(3), byteToU64(0)).val() {
+	case 0: // C.ADDI4SPN = addi rd', x2, nzuimm[5:4|9:6|2|3]
+		imm := or64(
+			or64(moveBits(instr, byteToU64(11), byteToU64(2), byteToU64(4)), moveBits(instr, byteToU64(7), byteToU64(4), byteToU64(6))),
+			or64(moveBits(instr, byteToU64(6), byteToU64(1), byteToU64(2)), moveBits(instr, byteToU64(5), byteToU64(1), byteToU64(3))),
+		)
+		if !iszero64(imm) { // nzuimm=0 is reserved
+			out = encodeTypeI(byteToU64(0x13), rd, byteToU64(0), byteToU64(2), imm)
+		}
+	case 1: // C.FLD = fld rd', uimm(rs1')
+		out = encodeTypeI(byteToU64(0x07), rd, byteToU64(3), rs1, immD)
+	case 2: // C.LW = lw rd', uimm(rs1')
+		out = encodeTypeI(byteToU64(0x03), rd, byteToU64(2), rs1, immW)
+	case 3: // C.LD = ld rd', uimm(rs1')
+		out = encodeTypeI(byteToU64(0x03), rd, byteToU64(3), rs1, immD)
+	case 5: // C.FSD = fsd rs2', uimm(rs1')
+		out = encodeTypeS(byteToU64(0x27), byteToU64(3), rs1, rd, immD)
+	case 6: // C.SW = sw rs2', uimm(rs1')
+		out = encodeTypeS(byteToU64(0x23), byteToU64(2), rs1, rd, immW)
+	case 7: // C.SD = sd rs2', uimm(rs1')
+		out = encodeTypeS(byteToU64(0x23), byteToU64(3), rs1, rd, immD)
+	}
+	return
+}
+
+// expandCompressedQ1 expands the quadrant 1 instructions: arithmetic with immediates and registers, jumps and branches.
+func expandCompressedQ1(instr U64) (out U64) {
+	rd := moveBits(instr, byteToU64(7), byteToU64(5), byteToU64(0))
+	rdPrime := parseCRegPrime(instr, byteToU64(7))
+	rs2Prime := parseCRegPrime(instr, byteToU64(2))
+	// signed immediate: imm[5|4:0]
+	imm := signExtend64(or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(5)), moveBits(instr, byteToU64(2), byteToU64(5), byteToU64(0))), byteToU64(5))
+	switch moveBits(instr, byteToU64(13), byteToU64(3), byteToU64(0)).val() {
+	case 0: // C.ADDI = addi rd, rd, imm (C.NOP if rd is x0)
+		out = encodeTypeI(byteToU64(0x13), rd, byteToU64(0), rd, imm)
+	case 1: // C.ADDIW = addiw rd, rd, imm
+		if !iszero64(rd) { // rd=x0 is reserved
+			out = encodeTypeI(byteToU64(0x1B), rd, byteToU64(0), rd, imm)
+		}
+	case 2: // C.LI = addi rd, x0, imm
+		out = encodeTypeI(byteToU64(0x13), rd, byteToU64(0), byteToU64(0), imm)
+	case 3:
+		switch rd.val() {
+		case 2: // C.ADDI16SP = addi x2, x2, nzimm[9|4|6|8:7|5]
+			imm16 := signExtend64(
+				or64(
+					or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(9)), moveBits(instr, byteToU64(6), byteToU64(1), byteToU64(4))),
+					or64(
+						or64(moveBits(instr, byteToU64(5), byteToU64(1), byteToU64(6)), moveBits(instr, byteToU64(3), byteToU64(2), byteToU64(7))),
+						moveBits(instr, byteToU64(2), byteToU64(1), byteToU64(5)),
+					),
+				),
+				byteToU64(9),
+			)
+			if !iszero64(imm16) { // nzimm=0 is reserved
+				out = encodeTypeI(byteToU64(0x13), byteToU64(2), byteToU64(0), byteToU64(2), imm16)
+			}
+		default: // C.LUI = lui rd, nzimm[17|16:12]
+			if !iszero64(imm) { // nzimm=0 is reserved
+				out = encodeTypeU(byteToU64(0x37), rd, imm)
+			}
+		}
+	case 4:
+		// shift amount: shamt[5|4:0]
+		shamt := and64(imm, byteToU64(0x3F))
+		switch moveBits(instr, byteToU64(10), byteToU64(2), byteToU64(0)).val() {
+		case 0: // C.SRLI = srli rd', rd', shamt
+			out = encodeTypeI(byteToU64(0x13), rdPrime, byteToU64(5), rdPrime, shamt)
+		case 1: // C.SRAI = srai rd', rd', shamt
+			out = encodeTypeI(byteToU64(0x13), rdPrime, byteToU64(5), rdPrime, or64(shamt, shortToU64(0x400)))
+		case 2: // C.ANDI = andi rd', rd', imm
+			out = encodeTypeI(byteToU64(0x13), rdPrime, byteToU64(7), rdPrime, imm)
+		case 3:
+			// bit 12 selects the word variants, bits[6:5] the operation
+			switch or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(2)), moveBits(instr, byteToU64(5), byteToU64(2), byteToU64(0))).val() {
+			case 0: // C.SUB = sub rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x33), rdPrime, byteToU64(0), rdPrime, rs2Prime, byteToU64(0x20))
+			case 1: // C.XOR = xor rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x33), rdPrime, byteToU64(4), rdPrime, rs2Prime, byteToU64(0))
+			case 2: // C.OR = or rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x33), rdPrime, byteToU64(6), rdPrime, rs2Prime, byteToU64(0))
+			case 3: // C.AND = and rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x33), rdPrime, byteToU64(7), rdPrime, rs2Prime, byteToU64(0))
+			case 4: // C.SUBW = subw rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x3B), rdPrime, byteToU64(0), rdPrime, rs2Prime, byteToU64(0x20))
+			case 5: // C.ADDW = addw rd', rd', rs2'
+				out = encodeTypeR(byteToU64(0x3B), rdPrime, byteToU64(0), rdPrime, rs2Prime, byteToU64(0))
+			}
+		}
+	case 5: // C.J = jal x0, offset[11|4|9:8|10|6|7|3:1|5]
+		offset := signExtend64(
+			or64(
+				or64(
+					or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(11)), moveBits(instr, byteToU64(11), byteToU64(1), byteToU64(4))),
+					or64(moveBits(instr, byteToU64(9), byteToU64(2), byteToU64(8)), moveBits(instr, byteToU64(8), byteToU64(1), byteToU64(10))),
+				),
+				or64(
+					or64(moveBits(instr, byteToU64(7), byteToU64(1), byteToU64(6)), moveBits(instr, byteToU64(6), byteToU64(1), byteToU64(7))),
+					or64(moveBits(instr, byteToU64(3), byteToU64(3), byteToU64(1)), moveBits(instr, byteToU64(2), byteToU64(1), byteToU64(5))),
+				),
+			),
+			byteToU64(11),
+		)
+		out = encodeTypeJ(byteToU64(0x6F), byteToU64(0), offset)
+	case 6: // C.BEQZ = beq rs1', x0, offset
+		out = encodeTypeB(byteToU64(0x63), byteToU64(0), rdPrime, byteToU64(0), parseCImmTypeB(instr))
+	case 7: // C.BNEZ = bne rs1', x0, offset
+		out = encodeTypeB(byteToU64(0x63), byteToU64(1), rdPrime, byteToU64(0), parseCImmTypeB(instr))
+	}
+	return
+}
+
+// parseCImmTypeB parses the signed branch offset of C.BEQZ and C.BNEZ: offset[8|4:3|7:6|2:1|5]
+func parseCImmTypeB(instr U64) U64 {
+	return signExtend64(
+		or64(
+			or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(8)), moveBits(instr, byteToU64(10), byteToU64(2), byteToU64(3))),
+			or64(
+				or64(moveBits(instr, byteToU64(5), byteToU64(2), byteToU64(6)), moveBits(instr, byteToU64(3), byteToU64(2), byteToU64(1))),
+				moveBits(instr, byteToU64(2), byteToU64(1), byteToU64(5)),
+			),
+		),
+		byteToU64(8),
+	)
+}
+
+// expandCompressedQ2 expands the quadrant 2 instructions: shifts, stack-pointer based loads and stores, moves and jumps.
+func expandCompressedQ2(instr U64) (out U64) {
+	rd := moveBits(instr, byteToU64(7), byteToU64(5), byteToU64(0)) // rd/rs1
+	rs2 := moveBits(instr, byteToU64(2), byteToU64(5), byteToU64(0))
+	// unsigned offset for double-word stack loads: uimm[5|4:3|8:6]
+	immLoadD := or64(
+		moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(5)),
+		or64(moveBits(instr, byteToU64(5), byteToU64(2), byteToU64(3)), moveBits(instr, byteToU64(2), byteToU64(3), byteToU64(6))),
+	)
+	// unsigned offset for double-word stack stores: uimm[5:3|8:6]
+	immStoreD := or64(moveBits(instr, byteToU64(10), byteToU64(3), byteToU64(3)), moveBits(instr, byteToU64(7), byteToU64(3), byteToU64(6)))
+	switch moveBits(instr, byteToU64(13), byteToU64(3), byteToU64(0)).val() {
+	case 0: // C.SLLI = slli rd, rd, shamt[5|4:0]
+		out = encodeTypeI(byteToU64(0x13), rd, byteToU64(1), rd, or64(moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(5)), rs2))
+	case 1: // C.FLDSP = fld rd, uimm(x2)
+		out = encodeTypeI(byteToU64(0x07), rd, byteToU64(3), byteToU64(2), immLoadD)
+	case 2: // C.LWSP = lw rd, uimm[5|4:2|7:6](x2)
+		if !iszero64(rd) { // rd=x0 is reserved
+			imm := or64(
+				moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(5)),
+				or64(moveBits(instr, byteToU64(4), byteToU64(3), byteToU64(2)), moveBits(instr, byteToU64(2), byteToU64(2), byteToU64(6))),
+			)
+			out = encodeTypeI(byteToU64(0x03), rd, byteToU64(2), byteToU64(2), imm)
+		}
+	case 3: // C.LDSP = ld rd, uimm(x2)
+		if !iszero64(rd) { // rd=x0 is reserved
+			out = encodeTypeI(byteToU64(0x03), rd, byteToU64(3), byteToU64(2), immLoadD)
+		}
+	case 4:
+		switch moveBits(instr, byteToU64(12), byteToU64(1), byteToU64(0)).val() {
+		case 0:
+			switch rs2.val() {
+			case 0: // C.JR = jalr x0, 0(rs1)
+				if !iszero64(rd) { // rs1=x0 is reserved
+					out = encodeTypeI(byteToU64(0x67), byteToU64(0), byteToU64(0), rd, byteToU64(0))
+				}
+			default: // C.MV = add rd, x0, rs2
+				out = encodeTypeR(byteToU64(0x33), rd, byteToU64(0), byteToU64(0), rs2, byteToU64(0))
+			}
+		case 1:
+			switch rs2.val() {
+			case 0:
+				switch rd.val() {
+				case 0: // C.EBREAK = ebreak
+					out = encodeTypeI(byteToU64(0x73), byteToU64(0), byteToU64(0), byteToU64(0), byteToU64(1))
+				default: // C.JALR = jalr x1, 0(rs1)
+					out = encodeTypeI(byteToU64(0x67), byteToU64(1), byteToU64(0), rd, byteToU64(0))
+				}
+			default: // C.ADD = add rd, rd, rs2
+				out = encodeTypeR(byteToU64(0x33), rd, byteToU64(0), rd, rs2, byteToU64(0))
+			}
+		}
+	case 5: // C.FSDSP = fsd rs2, uimm(x2)
+		out = encodeTypeS(byteToU64(0x27), byteToU64(3), byteToU64(2), rs2, immStoreD)
+	case 6: // C.SWSP = sw rs2, uimm[5:2|7:6](x2)
+		imm := or64(moveBits(instr, byteToU64(9), byteToU64(4), byteToU64(2)), moveBits(instr, byteToU64(7), byteToU64(2), byteToU64(6)))
+		out = encodeTypeS(byteToU64(0x23), byteToU64(2), byteToU64(2), rs2, imm)
+	case 7: // C.SDSP = sd rs2, uimm(x2)
+		out = encodeTypeS(byteToU64(0x23), byteToU64(3), byteToU64(2), rs2, immStoreD)
+	}
+	return
+}
@@ -75,3 +75,7 @@ func parseRs2(instr U64) U64 {
 func parseFunct7(instr U64) U64 {
 	return shr64(byteToU64(25), instr)
 }
+
+func parseRs3(instr U64) U64 {
+	return shr64(byteToU64(27), instr)
+}
@@ -27,7 +27,6 @@ func shortToU256(v uint16) U256 {
 	return *uint256.NewInt(uint64(v))
 }
 
-// nolint:unused
 func longToU256(v uint64) U256 {
 	return *uint256.NewInt(v)
 }
@@ -0,0 +1,429 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+// runAllocStep steps the given state, and checks that the fast, slow and EVM implementations agree on the post-state
+func runAllocStep(t *testing.T, state *fast.VMState) *fast.StepWitness {
+	fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+	stepWitness, err := fastState.Step(true)
+	require.NoError(t, err)
+
+	fastPost := state.EncodeWitness()
+	runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+	runSlow(t, stepWitness, fastPost, nil, nil)
+	return stepWitness
+}
+
+func TestStateSyscallMmap(t *testing.T) {
+	const anon = riscv.MapAnonymous
+	const fixed = riscv.MapFixed | riscv.MapAnonymous
+
+	cases := []struct {
+		name       string
+		addr       uint64
+		length     uint64
+		flags      uint64
+		freeRanges []fast.FreeRange
+		out        uint64
+		errCode    uint64
+		heap       uint64
+		postRanges []fast.FreeRange
+	}{
+		{name: "grow heap", length: 0x1800, flags: anon, out: 0x10_0000, heap: 0x10_2000},
+		{name: "zero length", length: 0, flags: anon, out: ^uint64(0), errCode: 0x16, heap: 0x10_0000},
+		{name: "not anonymous", length: 0x1000, flags: 0, out: ^uint64(0), errCode: 0x4d, heap: 0x10_0000},
+		{name: "hint above heap", addr: 0x20_0000, length: 0x1000, flags: anon, out: 0x20_0000, heap: 0x20_1000,
+			postRanges: []fast.FreeRange{{Addr: 0x10_0000, Size: 0x10_0000}}},
+		{name: "hint at heap", addr: 0x10_0000, length: 0x1000, flags: anon, out: 0x10_0000, heap: 0x10_1000},
+		{name: "hint below heap", addr: 0x8_0000, length: 0x1000, flags: anon, out: 0x10_0000, heap: 0x10_1000},
+		{name: "unaligned hint", addr: 0x20_0001, length: 0x1000, flags: anon, out: 0x10_0000, heap: 0x10_1000},
+		{name: "fixed below heap", addr: 0x8_0000, length: 0x1000, flags: fixed, out: 0x8_0000, heap: 0x10_0000},
+		{name: "fixed across heap", addr: 0xf_f000, length: 0x2000, flags: fixed, out: 0xf_f000, heap: 0x10_1000},
+		{name: "fixed unaligned", addr: 0x8_0001, length: 0x1000, flags: fixed, out: ^uint64(0), errCode: 0x16, heap: 0x10_0000},
+		{name: "fixed overflow", addr: 0xFFFF_FFFF_FFFF_F000, length: 0x2000, flags: fixed, out: ^uint64(0), errCode: 0x16, heap: 0x10_0000},
+		{name: "exact free range", length: 0x2000, flags: anon,
+			freeRanges: []fast.FreeRange{{Addr: 0x4_0000, Size: 0x2000}},
+			out:        0x4_0000, heap: 0x10_0000},
+		{name: "split free range", length: 0x1000, flags: anon,
+			freeRanges: []fast.FreeRange{{Addr: 0x3_0000, Size: 0x1000}, {Addr: 0x4_0000, Size: 0x3000}},
+			out:        0x4_0000, heap: 0x10_0000,
+			postRanges: []fast.FreeRange{{Addr: 0x3_0000, Size: 0x1000}, {Addr: 0x4_1000, Size: 0x2000}}},
+		{name: "free range too small", length: 0x3000, flags: anon,
+			freeRanges: []fast.FreeRange{{Addr: 0x4_0000, Size: 0x2000}},
+			out:        0x10_0000, heap: 0x10_3000,
+			postRanges: []fast.FreeRange{{Addr: 0x4_0000, Size: 0x2000}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:     0x100,
+				Heap:   0x10_0000,
+				Memory: fast.NewMemory(),
+				Registers: [32]uint64{
+					17: riscv.SysMmap,
+					10: c.addr,
+					11: c.length,
+					13: c.flags,
+					14: 0xFFFF_FFFF_FFFF_FFFF, // fd == -1
+				},
+				FreeRanges:    c.freeRanges,
+				MemoryRegions: fast.UnprotectedRegions(),
+			}
+			state.Memory.SetUnaligned(0x100, syscallInsn)
+
+			stepWitness := runAllocStep(t, state)
+			if c.freeRanges != nil {
+				require.Len(t, stepWitness.FreeRangeProof, fast.FREE_RANGE_PROOF_SIZE)
+			} else {
+				require.Nil(t, stepWitness.FreeRangeProof)
+			}
+
+			require.Equal(t, uint64(0x104), state.PC)
+			require.Equal(t, c.out, state.Registers[10])
+			require.Equal(t, c.errCode, state.Registers[11])
+			require.Equal(t, c.heap, state.Heap)
+			if c.postRanges != nil {
+				require.Equal(t, c.postRanges, state.FreeRanges)
+			} else {
+				require.Empty(t, state.FreeRanges)
+			}
+		})
+	}
+}
+
+func TestStateSyscallMunmap(t *testing.T) {
+	code := fast.MemoryRegion{Start: 0, End: 0x1000, Prot: riscv.ProtRead | riscv.ProtExec}
+	newState := func(addr, length uint64, freeRanges []fast.FreeRange) *fast.VMState {
+		state := &fast.VMState{
+			PC:     0x100,
+			Heap:   0x10_0000,
+			Memory: fast.NewMemory(),
+			Registers: [32]uint64{
+				17: riscv.SysMunmap,
+				10: addr,
+				11: length,
+			},
+			FreeRanges:    freeRanges,
+			MemoryRegions: [riscv.MemoryRegionCount]fast.MemoryRegion{code},
+		}
+		state.Memory.SetUnaligned(0x100, syscallInsn)
+		return state
+	}
+
+	t.Run("release pages", func(t *testing.T) {
+		state := newState(0x4_0000, 0x1800, nil)
+		emptyRoot := state.Memory.MerkleRoot()
+		state.Memory.SetUnaligned(0x4_0010, []byte{1, 2, 3})
+		state.Memory.SetUnaligned(0x4_1ff8, []byte{4, 5, 6})
+
+		// the first page is released, and the syscall restarts with the remaining range
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x100), state.PC)
+		require.Equal(t, uint64(0x4_1000), state.Registers[10])
+		require.Equal(t, uint64(0x800), state.Registers[11])
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}}, state.FreeRanges)
+
+		// the second page extends the free range at the top of the stack
+		stepWitness := runAllocStep(t, state)
+		require.Len(t, stepWitness.FreeRangeProof, fast.FREE_RANGE_PROOF_SIZE)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Equal(t, uint64(0), state.Registers[11])
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x2000}}, state.FreeRanges)
+		require.Equal(t, emptyRoot, state.Memory.MerkleRoot())
+		require.Equal(t, uint64(0x10_0000), state.Heap)
+	})
+
+	t.Run("release blocks", func(t *testing.T) {
+		state := newState(0x3_f000, 0x1_1800, nil)
+		emptyRoot := state.Memory.MerkleRoot()
+		state.Memory.SetUnaligned(0x3_f008, []byte{1})
+		state.Memory.SetUnaligned(0x4_8000, []byte{2})
+		state.Memory.SetUnaligned(0x5_0100, []byte{3})
+
+		// each step releases the largest aligned block at the address that fits in the remaining range
+		for _, block := range []struct{ addr, size uint64 }{{0x3_f000, 0x1000}, {0x4_0000, 0x1_0000}} {
+			runAllocStep(t, state)
+			require.Equal(t, uint64(0x100), state.PC)
+			require.Equal(t, block.addr+block.size, state.Registers[10])
+		}
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Equal(t, []fast.FreeRange{{Addr: 0x3_f000, Size: 0x1_2000}}, state.FreeRanges)
+		require.Equal(t, emptyRoot, state.Memory.MerkleRoot())
+	})
+
+	t.Run("block across heap", func(t *testing.T) {
+		state := newState(0, 0x20_0000, nil)
+		state.Memory.SetUnaligned(0x18_0000, []byte{1})
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		// the block is released in one step, and only the part below the heap becomes free
+		require.Equal(t, []fast.FreeRange{{Addr: 0, Size: 0x10_0000}}, state.FreeRanges)
+		require.False(t, state.Memory.HasPage(0x18_0000>>fast.PageAddrSize))
+	})
+
+	t.Run("separate range", func(t *testing.T) {
+		state := newState(0x8_0000, 0x1000, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}})
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}, {Addr: 0x8_0000, Size: 0x1000}}, state.FreeRanges)
+	})
+
+	t.Run("above heap", func(t *testing.T) {
+		state := newState(0x20_0000, 0x1000, nil)
+		state.Memory.SetUnaligned(0x20_0000, []byte{1})
+		stepWitness := runAllocStep(t, state)
+		require.Nil(t, stepWitness.FreeRangeProof)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Empty(t, state.FreeRanges)
+		require.Equal(t, 1, state.Memory.PageCount()) // only the page of the instruction remains
+	})
+
+	t.Run("clears permissions", func(t *testing.T) {
+		const protR = riscv.ProtRead
+		state := newState(0x4_f000, 0x1800, nil)
+		state.MemoryRegions[1] = fast.MemoryRegion{Start: 0x4_0000, End: 0x6_0000, Prot: protR}
+		// the released range, aligned up, gets the default permissions in the first step
+		postRegions := [riscv.MemoryRegionCount]fast.MemoryRegion{
+			code,
+			{Start: 0x4_0000, End: 0x4_f000, Prot: protR},
+			{Start: 0x5_1000, End: 0x6_0000, Prot: protR},
+		}
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x100), state.PC)
+		require.Equal(t, postRegions, state.MemoryRegions)
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Equal(t, postRegions, state.MemoryRegions)
+		require.Equal(t, uint8(riscv.ProtDefault), state.ProtAt(0x5_0000))
+	})
+
+	t.Run("no unused region to split", func(t *testing.T) {
+		state := newState(0x4_1000, 0x1000, nil)
+		for i := 1; i < riscv.MemoryRegionCount; i++ {
+			start := uint64(i) * 0x4_0000
+			state.MemoryRegions[i] = fast.MemoryRegion{Start: start, End: start + 0x4_0000, Prot: riscv.ProtRead}
+		}
+		regions := state.MemoryRegions
+		state.Memory.SetUnaligned(0x4_1000, []byte{1})
+		memRoot := state.Memory.MerkleRoot()
+
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, ^uint64(0), state.Registers[10])
+		require.Equal(t, uint64(0xc), state.Registers[11]) // ENOMEM
+		require.Equal(t, regions, state.MemoryRegions)
+		require.Equal(t, memRoot, state.Memory.MerkleRoot())
+		require.Empty(t, state.FreeRanges)
+	})
+
+	for _, c := range []struct {
+		name         string
+		addr, length uint64
+	}{
+		{name: "unaligned", addr: 0x4_0001, length: 0x1000},
+		{name: "zero length", addr: 0x4_0000, length: 0},
+		{name: "overflow", addr: 0xFFFF_FFFF_FFFF_F000, length: 0x2000},
+		{name: "overflow when aligned", addr: 0xFFFF_FFFF_FFFF_E000, length: 0x1001},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			state := newState(c.addr, c.length, nil)
+			runAllocStep(t, state)
+			require.Equal(t, uint64(0x104), state.PC)
+			require.Equal(t, ^uint64(0), state.Registers[10])
+			require.Equal(t, uint64(0x16), state.Registers[11]) // EINVAL
+		})
+	}
+}
+
+func TestStateSyscallMmapFixed(t *testing.T) {
+	const anon = riscv.MapAnonymous
+	const fixed = riscv.MapFixed | riscv.MapAnonymous
+
+	newState := func(freeRanges []fast.FreeRange) *fast.VMState {
+		state := &fast.VMState{
+			Heap:          0x10_0000,
+			Memory:        fast.NewMemory(),
+			FreeRanges:    freeRanges,
+			MemoryRegions: fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(0x100, syscallInsn)
+		return state
+	}
+	// syscall runs a step of the syscall at the syscall instruction
+	syscall := func(state *fast.VMState, num, addr, length, flags uint64) *fast.StepWitness {
+		state.PC = 0x100
+		state.Registers[17] = num
+		state.Registers[10] = addr
+		state.Registers[11] = length
+		state.Registers[13] = flags
+		state.Registers[14] = 0xFFFF_FFFF_FFFF_FFFF // fd == -1
+		return runAllocStep(t, state)
+	}
+
+	t.Run("remap unmapped range", func(t *testing.T) {
+		state := newState(nil)
+		syscall(state, riscv.SysMmap, 0, 0x1000, anon)
+		require.Equal(t, uint64(0x10_0000), state.Registers[10])
+		syscall(state, riscv.SysMunmap, 0x10_0000, 0x1000, 0)
+		require.Equal(t, []fast.FreeRange{{Addr: 0x10_0000, Size: 0x1000}}, state.FreeRanges)
+
+		syscall(state, riscv.SysMmap, 0x10_0000, 0x1000, fixed)
+		require.Equal(t, uint64(0x10_0000), state.Registers[10])
+		require.Empty(t, state.FreeRanges)
+
+		// the fixed range is not free anymore
+		syscall(state, riscv.SysMmap, 0, 0x1000, anon)
+		require.Equal(t, uint64(0x10_1000), state.Registers[10])
+	})
+
+	t.Run("carve mapped range", func(t *testing.T) {
+		state := newState([]fast.FreeRange{{Addr: 0x4_0000, Size: 0x4000}, {Addr: 0x8_0000, Size: 0x2000}})
+		stepWitness := syscall(state, riscv.SysMmap, 0x4_1000, 0x1000, fixed)
+		require.Len(t, stepWitness.FreeRangeProof, fast.FREE_RANGE_PROOF_SIZE)
+		require.Equal(t, uint64(0x4_1000), state.Registers[10])
+		require.Equal(t, []fast.FreeRange{
+			{Addr: 0x4_0000, Size: 0x4000},
+			{Addr: 0x4_1000 | riscv.FreeRangeMapped, Size: 0x1000},
+			{Addr: 0x8_0000, Size: 0x2000},
+		}, state.FreeRanges)
+
+		syscall(state, riscv.SysMmap, 0, 0x2000, anon)
+		require.Equal(t, uint64(0x8_0000), state.Registers[10])
+
+		// the mapped range is carved out of the range below it, and the syscall restarts
+		stepWitness = syscall(state, riscv.SysMmap, 0, 0x1000, anon)
+		require.Len(t, stepWitness.FreeRangeProof, 2*fast.FREE_RANGE_PROOF_SIZE)
+		require.Equal(t, uint64(0x100), state.PC)
+		require.Equal(t, uint64(0), state.Registers[10])
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}, {Addr: 0x4_2000, Size: 0x2000}}, state.FreeRanges)
+
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, uint64(0x4_2000), state.Registers[10])
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}, {Addr: 0x4_3000, Size: 0x1000}}, state.FreeRanges)
+	})
+
+	t.Run("merge mapped ranges", func(t *testing.T) {
+		state := newState([]fast.FreeRange{{Addr: 0x4_0000, Size: 0x8000}, {Addr: 0x4_1000 | riscv.FreeRangeMapped, Size: 0x1000}})
+		syscall(state, riscv.SysMmap, 0x4_3000, 0x1000, fixed)
+		require.Equal(t, []fast.FreeRange{
+			{Addr: 0x4_0000, Size: 0x8000},
+			{Addr: 0x4_1000 | riscv.FreeRangeMapped, Size: 0x3000},
+		}, state.FreeRanges)
+
+		state.FreeRanges = append(state.FreeRanges, fast.FreeRange{Addr: 0x4_6000 | riscv.FreeRangeMapped, Size: 0x1000})
+		stepWitness := syscall(state, riscv.SysMmap, 0, 0x1000, anon)
+		require.Len(t, stepWitness.FreeRangeProof, 2*fast.FREE_RANGE_PROOF_SIZE)
+		require.Equal(t, uint64(0x100), state.PC)
+		require.Equal(t, []fast.FreeRange{
+			{Addr: 0x4_0000, Size: 0x8000},
+			{Addr: 0x4_1000 | riscv.FreeRangeMapped, Size: 0x6000},
+		}, state.FreeRanges)
+	})
+
+	t.Run("drop mapped range", func(t *testing.T) {
+		state := newState([]fast.FreeRange{{Addr: 0x4_1000 | riscv.FreeRangeMapped, Size: 0x1000}})
+		stepWitness := syscall(state, riscv.SysMmap, 0, 0x1000, anon)
+		require.Len(t, stepWitness.FreeRangeProof, fast.FREE_RANGE_PROOF_SIZE)
+		require.Equal(t, uint64(0x100), state.PC)
+		require.Empty(t, state.FreeRanges)
+	})
+
+	t.Run("fixed above heap", func(t *testing.T) {
+		state := newState([]fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}})
+		stepWitness := syscall(state, riscv.SysMmap, 0x10_0000, 0x1000, fixed)
+		require.Nil(t, stepWitness.FreeRangeProof)
+		require.Equal(t, []fast.FreeRange{{Addr: 0x4_0000, Size: 0x1000}}, state.FreeRanges)
+	})
+}
+
+func TestStateSyscallMprotect(t *testing.T) {
+	for _, c := range []struct {
+		addr    uint64
+		out     uint64
+		errCode uint64
+	}{
+		{addr: 0x4_0000, out: 0, errCode: 0},
+		{addr: 0x4_0001, out: ^uint64(0), errCode: 0x16}, // EINVAL
+	} {
+		state := &fast.VMState{
+			PC:            0x100,
+			Memory:        fast.NewMemory(),
+			Registers:     [32]uint64{17: riscv.SysMprotect, 10: c.addr, 11: 0x1000, 12: 1},
+			MemoryRegions: fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(0x100, syscallInsn)
+
+		runAllocStep(t, state)
+		require.Equal(t, uint64(0x104), state.PC)
+		require.Equal(t, c.out, state.Registers[10])
+		require.Equal(t, c.errCode, state.Registers[11])
+	}
+}
+
+func TestStateBadFreeRangeProof(t *testing.T) {
+	contracts := testContracts(t)
+	addrs := testAddrs
+
+	cases := []struct {
+		name   string
+		modify func(freeRangeProof []byte) []byte
+	}{
+		{name: "missing", modify: func(freeRangeProof []byte) []byte { return nil }},
+		{name: "bad range", modify: func(freeRangeProof []byte) []byte {
+			freeRangeProof[fast.FREE_RANGE_WITNESS_SIZE-1] ^= 1
+			return freeRangeProof
+		}},
+		{name: "bad stack root", modify: func(freeRangeProof []byte) []byte {
+			freeRangeProof[fast.FREE_RANGE_PROOF_SIZE-1] ^= 1
+			return freeRangeProof
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:     0x100,
+				Heap:   0x10_0000,
+				Memory: fast.NewMemory(),
+				Registers: [32]uint64{
+					17: riscv.SysMmap,
+					11: 0x1000,
+					13: riscv.MapAnonymous,
+					14: 0xFFFF_FFFF_FFFF_FFFF,
+				},
+				FreeRanges:    []fast.FreeRange{{Addr: 0x3_0000, Size: 0x1000}, {Addr: 0x4_0000, Size: 0x2000}},
+				MemoryRegions: fast.UnprotectedRegions(),
+			}
+			state.Memory.SetUnaligned(0x100, syscallInsn)
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+			stepWitness.FreeRangeProof = c.modify(stepWitness.FreeRangeProof)
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, "revert badf00d3")
+
+			runEVM(t, contracts, addrs, stepWitness, nil, errCodeToByte32(riscv.ErrBadFreeRangeProof))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+// runProgram assembles the program at 0x1000 and runs it until it exits,
+// checking every step against the slow and EVM implementations.
+func runProgram(t *testing.T, build func(a *riscv.Assembler), registers [32]uint64) *fast.VMState {
+	a := riscv.NewAssembler(0x1000)
+	build(a)
+	state := &fast.VMState{PC: 0x1000, Memory: fast.NewMemory(), Registers: registers, MemoryRegions: fast.UnprotectedRegions()}
+	require.NoError(t, a.WriteMemory(state.Memory))
+
+	contracts := testContracts(t)
+	fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+	for i := 0; !state.Exited; i++ {
+		require.Less(t, i, 1000, "program does not exit")
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		fastPost := state.EncodeWitness()
+		runSlow(t, stepWitness, fastPost, nil, nil)
+		if contracts != nil {
+			runEVM(t, contracts, testAddrs, stepWitness, fastPost, nil)
+		}
+	}
+	return state
+}
+
+func TestStateProgramLi(t *testing.T) {
+	values := []int64{0, -1, 2047, -2048, 0x7fff_ffff, -0x8000_0000, 0x1_0000_0000, 0x1234_5678_9abc_def0, -0x0123_4567_89ab_cdef}
+	state := runProgram(t, func(a *riscv.Assembler) {
+		for i, v := range values {
+			a.Li(riscv.RegS2+riscv.Reg(i), v)
+		}
+		a.Li(riscv.RegA7, riscv.SysExitGroup)
+		a.Ecall()
+	}, [32]uint64{})
+	for i, v := range values {
+		require.Equal(t, uint64(v), state.Registers[18+i], "li %#x", v)
+	}
+}
+
+func TestStateProgramUnalignedCrossLeafStore(t *testing.T) {
+	// store a double word across the 32 byte leaf boundary at 0x2020, then load it back byte by byte
+	state := runProgram(t, func(a *riscv.Assembler) {
+		a.Li(riscv.RegA1, 0x0807_0605_0403_0201)
+		a.Sd(riscv.RegA1, riscv.RegA0, 0)
+		a.Li(riscv.RegA2, 0)
+		a.Li(riscv.RegT0, 8)
+		a.Label("loop")
+		a.Lbu(riscv.RegT1, riscv.RegA0, 0)
+		a.Slli(riscv.RegA2, riscv.RegA2, 8)
+		a.Or(riscv.RegA2, riscv.RegA2, riscv.RegT1)
+		a.Addi(riscv.RegA0, riscv.RegA0, 1)
+		a.Addi(riscv.RegT0, riscv.RegT0, -1)
+		a.Bnez(riscv.RegT0, "loop")
+		a.Syscall(riscv.SysExitGroup, 0)
+	}, [32]uint64{10: 0x201d})
+
+	var stored [8]byte
+	state.Memory.GetUnaligned(0x201d, stored[:])
+	require.Equal(t, uint64(0x0807_0605_0403_0201), binary.LittleEndian.Uint64(stored[:]))
+	require.Equal(t, uint64(0x0102_0304_0506_0708), state.Registers[12]) // the bytes in reverse order
+}
+
+func TestStateProgramAMOPageBoundary(t *testing.T) {
+	// atomic operations on the last word and double word of a page, and the first of the next page
+	state := runProgram(t, func(a *riscv.Assembler) {
+		a.Li(riscv.RegA0, 0x2ffc)
+		a.Li(riscv.RegA1, 0x2ff8)
+		a.Li(riscv.RegA2, 0x3000)
+		a.Li(riscv.RegT0, 5)
+		a.AmoW(riscv.AmoAdd, riscv.RegS1, riscv.RegT0, riscv.RegA0)
+		a.AmoW(riscv.AmoAdd, riscv.RegS1, riscv.RegT0, riscv.RegA0)
+		a.AmoD(riscv.AmoSwap, riscv.RegS2, riscv.RegT0, riscv.RegA1)
+		a.Label("retry")
+		a.LrD(riscv.RegT1, riscv.RegA2)
+		a.Addi(riscv.RegT1, riscv.RegT1, 7)
+		a.ScD(riscv.RegT2, riscv.RegT1, riscv.RegA2)
+		a.Bnez(riscv.RegT2, "retry")
+		a.Syscall(riscv.SysExitGroup, 0)
+	}, [32]uint64{})
+
+	require.Equal(t, uint64(5), state.Registers[9])       // s1: the value before the second add
+	require.Equal(t, uint64(10)<<32, state.Registers[18]) // s2: the double word before the swap, 10 in the upper word
+	require.Equal(t, uint64(0), state.Registers[7])       // t2: the store-conditional succeeded
+	var mem [16]byte
+	state.Memory.GetUnaligned(0x2ff8, mem[:])
+	require.Equal(t, uint64(5), binary.LittleEndian.Uint64(mem[:8]))
+	require.Equal(t, uint64(7), binary.LittleEndian.Uint64(mem[8:]))
+}
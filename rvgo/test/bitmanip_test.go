@@ -0,0 +1,192 @@
+package test
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+// encodeR encodes an R-type instruction
+func encodeR(opcode, rd, funct3, rs1, rs2, funct7 uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, funct7<<25|rs2<<20|rs1<<15|funct3<<12|rd<<7|opcode)
+}
+
+// encodeI encodes an I-type instruction, with the 12 bit immediate
+func encodeI(opcode, rd, funct3, rs1, imm uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, (imm&0xfff)<<20|rs1<<15|funct3<<12|rd<<7|opcode)
+}
+
+func sext32(v uint64) uint64 {
+	return uint64(int64(int32(uint32(v))))
+}
+
+// bitmanipOp is an instruction of the Zba, Zbb or Zbs extensions that writes a function of a0 and a1 to a2
+type bitmanipOp struct {
+	name string
+	insn []byte
+	ref  func(a, b uint64) uint64
+}
+
+const (
+	bmA0 = 10
+	bmA1 = 11
+	bmA2 = 12
+)
+
+var bitmanipOps = []bitmanipOp{
+	// Zba
+	{"add.uw", encodeR(0x3B, bmA2, 0, bmA0, bmA1, 0x04), func(a, b uint64) uint64 { return b + uint64(uint32(a)) }},
+	{"sh1add", encodeR(0x33, bmA2, 2, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + a<<1 }},
+	{"sh2add", encodeR(0x33, bmA2, 4, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + a<<2 }},
+	{"sh3add", encodeR(0x33, bmA2, 6, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + a<<3 }},
+	{"sh1add.uw", encodeR(0x3B, bmA2, 2, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + uint64(uint32(a))<<1 }},
+	{"sh2add.uw", encodeR(0x3B, bmA2, 4, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + uint64(uint32(a))<<2 }},
+	{"sh3add.uw", encodeR(0x3B, bmA2, 6, bmA0, bmA1, 0x10), func(a, b uint64) uint64 { return b + uint64(uint32(a))<<3 }},
+	{"slli.uw", encodeI(0x1B, bmA2, 1, bmA0, 0x02<<6|37), func(a, b uint64) uint64 { return uint64(uint32(a)) << 37 }},
+	// Zbb
+	{"andn", encodeR(0x33, bmA2, 7, bmA0, bmA1, 0x20), func(a, b uint64) uint64 { return a &^ b }},
+	{"orn", encodeR(0x33, bmA2, 6, bmA0, bmA1, 0x20), func(a, b uint64) uint64 { return a | ^b }},
+	{"xnor", encodeR(0x33, bmA2, 4, bmA0, bmA1, 0x20), func(a, b uint64) uint64 { return ^(a ^ b) }},
+	{"clz", encodeI(0x13, bmA2, 1, bmA0, 0x600), func(a, b uint64) uint64 { return uint64(bits.LeadingZeros64(a)) }},
+	{"clzw", encodeI(0x1B, bmA2, 1, bmA0, 0x600), func(a, b uint64) uint64 { return uint64(bits.LeadingZeros32(uint32(a))) }},
+	{"ctz", encodeI(0x13, bmA2, 1, bmA0, 0x601), func(a, b uint64) uint64 { return uint64(bits.TrailingZeros64(a)) }},
+	{"ctzw", encodeI(0x1B, bmA2, 1, bmA0, 0x601), func(a, b uint64) uint64 { return uint64(bits.TrailingZeros32(uint32(a))) }},
+	{"cpop", encodeI(0x13, bmA2, 1, bmA0, 0x602), func(a, b uint64) uint64 { return uint64(bits.OnesCount64(a)) }},
+	{"cpopw", encodeI(0x1B, bmA2, 1, bmA0, 0x602), func(a, b uint64) uint64 { return uint64(bits.OnesCount32(uint32(a))) }},
+	{"max", encodeR(0x33, bmA2, 6, bmA0, bmA1, 0x05), func(a, b uint64) uint64 { return uint64(max(int64(a), int64(b))) }},
+	{"maxu", encodeR(0x33, bmA2, 7, bmA0, bmA1, 0x05), func(a, b uint64) uint64 { return max(a, b) }},
+	{"min", encodeR(0x33, bmA2, 4, bmA0, bmA1, 0x05), func(a, b uint64) uint64 { return uint64(min(int64(a), int64(b))) }},
+	{"minu", encodeR(0x33, bmA2, 5, bmA0, bmA1, 0x05), func(a, b uint64) uint64 { return min(a, b) }},
+	{"sext.b", encodeI(0x13, bmA2, 1, bmA0, 0x604), func(a, b uint64) uint64 { return uint64(int64(int8(a))) }},
+	{"sext.h", encodeI(0x13, bmA2, 1, bmA0, 0x605), func(a, b uint64) uint64 { return uint64(int64(int16(a))) }},
+	{"zext.h", encodeR(0x3B, bmA2, 4, bmA0, 0, 0x04), func(a, b uint64) uint64 { return uint64(uint16(a)) }},
+	{"rol", encodeR(0x33, bmA2, 1, bmA0, bmA1, 0x30), func(a, b uint64) uint64 { return bits.RotateLeft64(a, int(b&63)) }},
+	{"rolw", encodeR(0x3B, bmA2, 1, bmA0, bmA1, 0x30), func(a, b uint64) uint64 {
+		return sext32(uint64(bits.RotateLeft32(uint32(a), int(b&31))))
+	}},
+	{"ror", encodeR(0x33, bmA2, 5, bmA0, bmA1, 0x30), func(a, b uint64) uint64 { return bits.RotateLeft64(a, -int(b&63)) }},
+	{"rori", encodeI(0x13, bmA2, 5, bmA0, 0x18<<6|45), func(a, b uint64) uint64 { return bits.RotateLeft64(a, -45) }},
+	{"roriw", encodeI(0x1B, bmA2, 5, bmA0, 0x30<<5|13), func(a, b uint64) uint64 {
+		return sext32(uint64(bits.RotateLeft32(uint32(a), -13)))
+	}},
+	{"rorw", encodeR(0x3B, bmA2, 5, bmA0, bmA1, 0x30), func(a, b uint64) uint64 {
+		return sext32(uint64(bits.RotateLeft32(uint32(a), -int(b&31))))
+	}},
+	{"orc.b", encodeI(0x13, bmA2, 5, bmA0, 0x287), func(a, b uint64) uint64 {
+		var out uint64
+		for i := 0; i < 64; i += 8 {
+			if (a>>i)&0xff != 0 {
+				out |= 0xff << i
+			}
+		}
+		return out
+	}},
+	{"rev8", encodeI(0x13, bmA2, 5, bmA0, 0x6b8), func(a, b uint64) uint64 { return bits.ReverseBytes64(a) }},
+	// Zbs
+	{"bclr", encodeR(0x33, bmA2, 1, bmA0, bmA1, 0x24), func(a, b uint64) uint64 { return a &^ (1 << (b & 63)) }},
+	{"bclri", encodeI(0x13, bmA2, 1, bmA0, 0x12<<6|63), func(a, b uint64) uint64 { return a &^ (1 << 63) }},
+	{"bext", encodeR(0x33, bmA2, 5, bmA0, bmA1, 0x24), func(a, b uint64) uint64 { return (a >> (b & 63)) & 1 }},
+	{"bexti", encodeI(0x13, bmA2, 5, bmA0, 0x12<<6|33), func(a, b uint64) uint64 { return (a >> 33) & 1 }},
+	{"binv", encodeR(0x33, bmA2, 1, bmA0, bmA1, 0x34), func(a, b uint64) uint64 { return a ^ (1 << (b & 63)) }},
+	{"binvi", encodeI(0x13, bmA2, 1, bmA0, 0x1a<<6|7), func(a, b uint64) uint64 { return a ^ (1 << 7) }},
+	{"bset", encodeR(0x33, bmA2, 1, bmA0, bmA1, 0x14), func(a, b uint64) uint64 { return a | (1 << (b & 63)) }},
+	{"bseti", encodeI(0x13, bmA2, 1, bmA0, 0x0a<<6|0), func(a, b uint64) uint64 { return a | 1 }},
+}
+
+// runBitmanipOp executes the instruction with the given operands,
+// and checks the result against the reference and the slow and EVM implementations.
+func runBitmanipOp(t *testing.T, op bitmanipOp, a, b uint64) {
+	pc := uint64(0x100)
+	state := &fast.VMState{
+		PC:            pc,
+		Memory:        fast.NewMemory(),
+		Registers:     [32]uint64{bmA0: a, bmA1: b},
+		MemoryRegions: fast.UnprotectedRegions(),
+	}
+	state.Memory.SetUnaligned(pc, op.insn)
+
+	fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+	stepWitness, err := fastState.Step(true)
+	require.NoError(t, err)
+
+	require.Equal(t, [32]uint64{bmA0: a, bmA1: b, bmA2: op.ref(a, b)}, state.Registers, "%s(%#x, %#x)", op.name, a, b)
+	require.Equal(t, pc+4, state.PC)
+
+	fastPost := state.EncodeWitness()
+	runSlow(t, stepWitness, fastPost, nil, nil)
+	runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+}
+
+func TestStateBitmanip(t *testing.T) {
+	operands := [][2]uint64{
+		{0, 0},
+		{1, 1},
+		{0xffff_ffff_ffff_ffff, 63},
+		{0x8000_0000_0000_0000, 0x40},
+		{0x0000_0001_8000_0000, 0xffff_ffff_ffff_ffff},
+		{0x0123_4567_89ab_cdef, 0xfedc_ba98_7654_3210},
+		{0x00ff_0000_1000_0080, 31},
+		{0xffff_ffff_7fff_fff0, 0x8000_0000_0000_0001},
+	}
+	for _, op := range bitmanipOps {
+		op := op
+		t.Run(op.name, func(t *testing.T) {
+			for _, v := range operands {
+				runBitmanipOp(t, op, v[0], v[1])
+				runBitmanipOp(t, op, v[1], v[0])
+			}
+		})
+	}
+}
+
+func FuzzStateBitmanip(f *testing.F) {
+	f.Fuzz(func(t *testing.T, opIndex uint8, a uint64, b uint64) {
+		op := bitmanipOps[int(opIndex)%len(bitmanipOps)]
+		runBitmanipOp(t, op, a, b)
+	})
+}
+
+func TestStateBitmanipFaults(t *testing.T) {
+	cases := []struct {
+		name string
+		insn []byte
+	}{
+		{name: "slli with reserved funct6", insn: encodeI(0x13, bmA2, 1, bmA0, 0x01<<6|3)},
+		{name: "reserved unary op", insn: encodeI(0x13, bmA2, 1, bmA0, 0x603)},
+		{name: "reserved unary op on 32 bits", insn: encodeI(0x1B, bmA2, 1, bmA0, 0x604)},
+		{name: "orc.b with bad shamt", insn: encodeI(0x13, bmA2, 5, bmA0, 0x286)},
+		{name: "rev8 with bad shamt", insn: encodeI(0x13, bmA2, 5, bmA0, 0x6bf)},
+		{name: "roriw with imm[5] set", insn: encodeI(0x1B, bmA2, 5, bmA0, 0x30<<5|0x20)},
+		{name: "zext.h with rs2", insn: encodeR(0x3B, bmA2, 4, bmA0, bmA1, 0x04)},
+		{name: "sh1add with bad funct7", insn: encodeR(0x33, bmA2, 2, bmA0, bmA1, 0x11)},
+		{name: "sll with bad funct7", insn: encodeR(0x33, bmA2, 1, bmA0, bmA1, 0x02)},
+		{name: "sltu with bad funct7", insn: encodeR(0x33, bmA2, 3, bmA0, bmA1, 0x10)},
+		{name: "sh1add.uw with bad funct7", insn: encodeR(0x3B, bmA2, 2, bmA0, bmA1, 0x00)},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pc := uint64(0x100)
+			state := &fast.VMState{PC: pc, Memory: fast.NewMemory(), MemoryRegions: fast.UnprotectedRegions()}
+			state.Memory.SetUnaligned(pc, tc.insn)
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			runEVM(t, testContracts(t), testAddrs, stepWitness, nil, errCodeToByte32(riscv.ErrIllegalInstruction))
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+const (
+	compressedTestPC   = uint64(0x100)
+	compressedTestData = uint64(0x1000)
+	compressedTestSP   = uint64(0x2000)
+)
+
+// compressedTestState creates a state with the instruction at the given PC,
+// and some distinguishable data at compressedTestData and around the stack pointer.
+func compressedTestState(pc uint64, insn []byte, registers [32]uint64) *fast.VMState {
+	state := &fast.VMState{
+		PC:              pc,
+		Heap:            0,
+		ExitCode:        0,
+		Exited:          false,
+		Memory:          fast.NewMemory(),
+		LoadReservation: 0,
+		Registers:       registers,
+		Step:            0,
+		MemoryRegions:   fast.UnprotectedRegions(),
+	}
+	state.Memory.SetUnaligned(pc, insn)
+	state.Memory.SetUnaligned(compressedTestData, binary.LittleEndian.AppendUint64(nil, 0x8877_6655_4433_2211))
+	state.Memory.SetUnaligned(compressedTestData+8, binary.LittleEndian.AppendUint64(nil, 0xffee_ddcc_bbaa_9988))
+	state.Memory.SetUnaligned(compressedTestSP+8, binary.LittleEndian.AppendUint64(nil, 0x0102_0304_0506_0708))
+	state.Memory.SetUnaligned(compressedTestSP+16, binary.LittleEndian.AppendUint64(nil, 0xa1a2_a3a4_a5a6_a7a8))
+	return state
+}
+
+func readU64(state *fast.VMState, addr uint64) uint64 {
+	var v [8]byte
+	state.Memory.GetUnaligned(addr, v[:])
+	return binary.LittleEndian.Uint64(v[:])
+}
+
+func TestStateCompressed(t *testing.T) {
+	const (
+		sp = 2
+		a0 = 10
+		a1 = 11
+		a2 = 12
+	)
+	cases := []struct {
+		name   string
+		insn   []byte
+		pre    [32]uint64 // registers before the instruction, besides the stack pointer
+		post   [32]uint64 // expected registers after the instruction, besides the stack pointer
+		postSP uint64     // expected stack pointer, if changed
+		nextPC uint64     // expected PC after the instruction
+		memory [2]uint64  // expected data at compressedTestSP+8 and compressedTestSP+16, if changed
+	}{
+		{name: "c.nop", insn: []byte{0x01, 0x00}, nextPC: compressedTestPC + 2},
+		{name: "c.addi", insn: []byte{0x15, 0x05}, pre: [32]uint64{a0: 7}, post: [32]uint64{a0: 12}, nextPC: compressedTestPC + 2},
+		{name: "c.addiw", insn: []byte{0x7d, 0x35}, pre: [32]uint64{a0: 0x1_0000_0000}, post: [32]uint64{a0: 0xffff_ffff_ffff_ffff}, nextPC: compressedTestPC + 2},
+		{name: "c.li", insn: []byte{0xf5, 0x55}, post: [32]uint64{a1: 0xffff_ffff_ffff_fffd}, nextPC: compressedTestPC + 2},
+		{name: "c.lui", insn: []byte{0x7d, 0x66}, post: [32]uint64{a2: 0x1f000}, nextPC: compressedTestPC + 2},
+		{name: "c.addi16sp", insn: []byte{0x39, 0x71}, postSP: compressedTestSP - 64, nextPC: compressedTestPC + 2},
+		{name: "c.addi4spn", insn: []byte{0x08, 0x08}, post: [32]uint64{a0: compressedTestSP + 16}, nextPC: compressedTestPC + 2},
+		{name: "c.slli", insn: []byte{0x0e, 0x05}, pre: [32]uint64{a0: 0x8000_0000_0000_0003}, post: [32]uint64{a0: 0x18}, nextPC: compressedTestPC + 2},
+		{name: "c.srli", insn: []byte{0x0d, 0x81}, pre: [32]uint64{a0: 0x8000_0000_0000_0018}, post: [32]uint64{a0: 0x1000_0000_0000_0003}, nextPC: compressedTestPC + 2},
+		{name: "c.srai", insn: []byte{0x05, 0x85}, pre: [32]uint64{a0: 0x8000_0000_0000_0018}, post: [32]uint64{a0: 0xc000_0000_0000_000c}, nextPC: compressedTestPC + 2},
+		{name: "c.andi", insn: []byte{0x79, 0x99}, pre: [32]uint64{a0: 0xff}, post: [32]uint64{a0: 0xfe}, nextPC: compressedTestPC + 2},
+		{name: "c.sub", insn: []byte{0x0d, 0x8d}, pre: [32]uint64{a0: 3, a1: 5}, post: [32]uint64{a0: 0xffff_ffff_ffff_fffe, a1: 5}, nextPC: compressedTestPC + 2},
+		{name: "c.xor", insn: []byte{0x2d, 0x8d}, pre: [32]uint64{a0: 0b1100, a1: 0b1010}, post: [32]uint64{a0: 0b0110, a1: 0b1010}, nextPC: compressedTestPC + 2},
+		{name: "c.or", insn: []byte{0x4d, 0x8d}, pre: [32]uint64{a0: 0b1100, a1: 0b1010}, post: [32]uint64{a0: 0b1110, a1: 0b1010}, nextPC: compressedTestPC + 2},
+		{name: "c.and", insn: []byte{0x6d, 0x8d}, pre: [32]uint64{a0: 0b1100, a1: 0b1010}, post: [32]uint64{a0: 0b1000, a1: 0b1010}, nextPC: compressedTestPC + 2},
+		{name: "c.subw", insn: []byte{0x0d, 0x9d}, pre: [32]uint64{a0: 0x1_0000_0000, a1: 1}, post: [32]uint64{a0: 0xffff_ffff_ffff_ffff, a1: 1}, nextPC: compressedTestPC + 2},
+		{name: "c.addw", insn: []byte{0x2d, 0x9d}, pre: [32]uint64{a0: 0x7fff_ffff, a1: 1}, post: [32]uint64{a0: 0xffff_ffff_8000_0000, a1: 1}, nextPC: compressedTestPC + 2},
+		{name: "c.mv", insn: []byte{0x2e, 0x85}, pre: [32]uint64{a0: 1, a1: 42}, post: [32]uint64{a0: 42, a1: 42}, nextPC: compressedTestPC + 2},
+		{name: "c.add", insn: []byte{0x2e, 0x95}, pre: [32]uint64{a0: 1, a1: 42}, post: [32]uint64{a0: 43, a1: 42}, nextPC: compressedTestPC + 2},
+		{name: "c.lw", insn: []byte{0xc8, 0x41}, pre: [32]uint64{a1: compressedTestData}, post: [32]uint64{a0: 0xffff_ffff_8877_6655, a1: compressedTestData}, nextPC: compressedTestPC + 2},
+		{name: "c.ld", insn: []byte{0x88, 0x65}, pre: [32]uint64{a1: compressedTestData}, post: [32]uint64{a0: 0xffee_ddcc_bbaa_9988, a1: compressedTestData}, nextPC: compressedTestPC + 2},
+		{name: "c.lwsp", insn: []byte{0x32, 0x45}, post: [32]uint64{a0: 0x0102_0304}, nextPC: compressedTestPC + 2},
+		{name: "c.ldsp", insn: []byte{0x42, 0x65}, post: [32]uint64{a0: 0xa1a2_a3a4_a5a6_a7a8}, nextPC: compressedTestPC + 2},
+		{name: "c.swsp", insn: []byte{0x2a, 0xc6}, pre: [32]uint64{a0: 0xdead_beef}, post: [32]uint64{a0: 0xdead_beef}, nextPC: compressedTestPC + 2,
+			memory: [2]uint64{0xdead_beef_0506_0708, 0xa1a2_a3a4_a5a6_a7a8}},
+		{name: "c.sdsp", insn: []byte{0x2a, 0xe8}, pre: [32]uint64{a0: 0xdead_beef}, post: [32]uint64{a0: 0xdead_beef}, nextPC: compressedTestPC + 2,
+			memory: [2]uint64{0x0102_0304_0506_0708, 0xdead_beef}},
+		{name: "c.j forward", insn: []byte{0x21, 0xa0}, nextPC: compressedTestPC + 8},
+		{name: "c.j backward", insn: []byte{0xe5, 0xbf}, nextPC: compressedTestPC - 8},
+		{name: "c.jr", insn: []byte{0x82, 0x85}, pre: [32]uint64{a1: 0x4002}, post: [32]uint64{a1: 0x4002}, nextPC: 0x4002},
+		{name: "c.jalr", insn: []byte{0x82, 0x95}, pre: [32]uint64{a1: 0x4002}, post: [32]uint64{1: compressedTestPC + 2, a1: 0x4002}, nextPC: 0x4002},
+		{name: "c.beqz taken", insn: []byte{0x01, 0xc5}, nextPC: compressedTestPC + 8},
+		{name: "c.beqz not taken", insn: []byte{0x01, 0xc5}, pre: [32]uint64{a0: 1}, post: [32]uint64{a0: 1}, nextPC: compressedTestPC + 2},
+		{name: "c.bnez taken", insn: []byte{0x75, 0xfd}, pre: [32]uint64{a0: 1}, post: [32]uint64{a0: 1}, nextPC: compressedTestPC - 4},
+		{name: "c.bnez not taken", insn: []byte{0x75, 0xfd}, nextPC: compressedTestPC + 2},
+		{name: "c.ebreak", insn: []byte{0x02, 0x90}, nextPC: compressedTestPC + 2},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pre := tc.pre
+			pre[sp] = compressedTestSP
+			state := compressedTestState(compressedTestPC, tc.insn, pre)
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+
+			expected := tc.post
+			expected[sp] = compressedTestSP
+			if tc.postSP != 0 {
+				expected[sp] = tc.postSP
+			}
+			require.Equal(t, expected, state.Registers)
+			require.Equal(t, tc.nextPC, state.PC)
+			require.Equal(t, uint64(1), state.Step)
+			expectedMemory := [2]uint64{0x0102_0304_0506_0708, 0xa1a2_a3a4_a5a6_a7a8}
+			if tc.memory != ([2]uint64{}) {
+				expectedMemory = tc.memory
+			}
+			require.Equal(t, expectedMemory, [2]uint64{readU64(state, compressedTestSP+8), readU64(state, compressedTestSP+16)})
+
+			fastPost := state.EncodeWitness()
+			runSlow(t, stepWitness, fastPost, nil, nil)
+			runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+		})
+	}
+}
+
+// TestStateInstructionStraddlesLeaf checks that a 4-byte instruction at a 2-byte aligned PC
+// can span two memory leaves, in which case the instruction is proven with 2 memory proofs,
+// and the proofs for the data memory access follow after.
+func TestStateInstructionStraddlesLeaf(t *testing.T) {
+	cases := []struct {
+		name     string
+		insn     []byte
+		pre      [32]uint64
+		post     [32]uint64
+		postData uint64
+	}{
+		{
+			name:     "ld a0, 0(a1)",
+			insn:     []byte{0x03, 0xb5, 0x05, 0x00},
+			pre:      [32]uint64{11: compressedTestData},
+			post:     [32]uint64{10: 0x8877_6655_4433_2211, 11: compressedTestData},
+			postData: 0x8877_6655_4433_2211,
+		},
+		{
+			name:     "sd a0, 0(a1)",
+			insn:     []byte{0x23, 0xb0, 0xa5, 0x00},
+			pre:      [32]uint64{10: 0xdead_beef, 11: compressedTestData},
+			post:     [32]uint64{10: 0xdead_beef, 11: compressedTestData},
+			postData: 0xdead_beef,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pc := uint64(0x11e)
+			state := compressedTestState(pc, tc.insn, tc.pre)
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+			require.Len(t, stepWitness.MemProof, 3*60*32, "2 proofs for the instruction, 1 for the data")
+
+			require.Equal(t, tc.post, state.Registers)
+			require.Equal(t, pc+4, state.PC)
+			require.Equal(t, tc.postData, readU64(state, compressedTestData))
+
+			fastPost := state.EncodeWitness()
+			runSlow(t, stepWitness, fastPost, nil, nil)
+			runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+		})
+	}
+}
+
+func TestStateCompressedFaults(t *testing.T) {
+	cases := []struct {
+		name    string
+		pc      uint64
+		insn    []byte
+		errCode uint64
+		errMsg  string
+	}{
+		{name: "all zeroes", pc: compressedTestPC, insn: []byte{0x00, 0x00}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "reserved quadrant 0 funct3", pc: compressedTestPC, insn: []byte{0x00, 0x80}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "c.addiw with rd=x0", pc: compressedTestPC, insn: []byte{0x05, 0x20}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "c.addi16sp with nzimm=0", pc: compressedTestPC, insn: []byte{0x01, 0x61}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "c.lui with nzimm=0", pc: compressedTestPC, insn: []byte{0x01, 0x65}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "reserved arithmetic", pc: compressedTestPC, insn: []byte{0x41, 0x9c}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "c.lwsp with rd=x0", pc: compressedTestPC, insn: []byte{0x02, 0x40}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "c.jr with rs1=x0", pc: compressedTestPC, insn: []byte{0x02, 0x80}, errCode: riscv.ErrIllegalInstruction, errMsg: "illegal instruction"},
+		{name: "odd PC", pc: compressedTestPC + 1, insn: []byte{0x01, 0x00}, errCode: riscv.ErrNotAlignedAddr, errMsg: "not aligned with 2 bytes"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			state := compressedTestState(tc.pc, tc.insn, [32]uint64{})
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.ErrorContains(t, err, tc.errMsg)
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, tc.errMsg)
+
+			runEVM(t, testContracts(t), testAddrs, stepWitness, nil, errCodeToByte32(tc.errCode))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+const (
+	csrFflags  = 0x001
+	csrFrm     = 0x002
+	csrFcsr    = 0x003
+	csrCycle   = 0xC00
+	csrTime    = 0xC01
+	csrInstret = 0xC02
+	csrMtvec   = 0x305
+	csrMhartid = 0xF14
+)
+
+// encodeCSR encodes a CSR instruction: funct3 1, 2, 3 = CSRRW, CSRRS, CSRRC, and 5, 6, 7 for the immediate variants
+func encodeCSR(rd, funct3, rs1, csr uint32) []byte {
+	return encodeI(0x73, rd, funct3, rs1, csr)
+}
+
+func TestStateCSR(t *testing.T) {
+	cases := []struct {
+		name       string
+		insn       []byte
+		a0         uint64
+		fcsr       uint64
+		expectedA1 uint64
+		expectedFC uint64
+	}{
+		{name: "rdcycle", insn: encodeCSR(11, 2, 0, csrCycle), expectedA1: 10},
+		{name: "rdtime", insn: encodeCSR(11, 2, 0, csrTime), expectedA1: 1010}, // includes the time slept
+		{name: "rdinstret", insn: encodeCSR(11, 2, 0, csrInstret), expectedA1: 10},
+		{name: "clear read-only without write", insn: encodeCSR(11, 7, 0, csrCycle), expectedA1: 10},
+		{name: "mhartid", insn: encodeCSR(11, 2, 0, csrMhartid), expectedA1: 0},
+		{name: "frflags", insn: encodeCSR(11, 2, 0, csrFflags), fcsr: 0xff, expectedA1: 0x1f, expectedFC: 0xff},
+		{name: "frrm", insn: encodeCSR(11, 2, 0, csrFrm), fcsr: 0xff, expectedA1: 0x7, expectedFC: 0xff},
+		{name: "frcsr", insn: encodeCSR(11, 2, 0, csrFcsr), fcsr: 0xff, expectedA1: 0xff, expectedFC: 0xff},
+		{name: "fsflags", insn: encodeCSR(11, 1, 10, csrFflags), a0: 0xffff_ff03, fcsr: 0xe4, expectedA1: 0x4, expectedFC: 0xe3},
+		{name: "fsrm", insn: encodeCSR(11, 1, 10, csrFrm), a0: 0x2, fcsr: 0xff, expectedA1: 0x7, expectedFC: 0x5f},
+		{name: "fscsr", insn: encodeCSR(11, 1, 10, csrFcsr), a0: 0x1_23, fcsr: 0x1, expectedA1: 0x1, expectedFC: 0x23},
+		{name: "fsrmi", insn: encodeCSR(11, 5, 1, csrFrm), fcsr: 0x1f, expectedA1: 0, expectedFC: 0x3f},
+		{name: "csrrs", insn: encodeCSR(11, 2, 10, csrFcsr), a0: 0x5, fcsr: 0x40, expectedA1: 0x40, expectedFC: 0x45},
+		{name: "csrrc", insn: encodeCSR(11, 3, 10, csrFcsr), a0: 0x41, fcsr: 0xc3, expectedA1: 0xc3, expectedFC: 0x82},
+		{name: "csrrsi", insn: encodeCSR(11, 6, 0x18, csrFflags), fcsr: 0x20, expectedA1: 0, expectedFC: 0x38},
+		{name: "csrrci", insn: encodeCSR(11, 7, 0x3, csrFflags), fcsr: 0x1f, expectedA1: 0x1f, expectedFC: 0x1c},
+		{name: "csrrc with x0", insn: encodeCSR(11, 3, 0, csrFcsr), a0: 0xff, fcsr: 0xc3, expectedA1: 0xc3, expectedFC: 0xc3},
+		{name: "csrrw with rd x0", insn: encodeCSR(0, 1, 10, csrFcsr), a0: 0x7, fcsr: 0xc3, expectedA1: 0xdead, expectedFC: 0x7},
+		{name: "unsupported CSR", insn: encodeCSR(11, 1, 10, csrMtvec), a0: 0x8000_0000, expectedA1: 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:            0x100,
+				Memory:        fast.NewMemory(),
+				Step:          10,
+				Registers:     [32]uint64{10: c.a0, 11: 0xdead},
+				FCSR:          c.fcsr,
+				ThreadID:      1,
+				NextThreadID:  2,
+				ClockOffset:   1000,
+				MemoryRegions: fast.UnprotectedRegions(),
+			}
+			state.Memory.SetUnaligned(0x100, c.insn)
+
+			runThreadStep(t, state)
+
+			require.Equal(t, uint64(0x104), state.PC)
+			require.Equal(t, uint64(11), state.Step)
+			require.Equal(t, c.a0, state.Registers[10])
+			require.Equal(t, c.expectedA1, state.Registers[11])
+			require.Equal(t, c.expectedFC, state.FCSR)
+		})
+	}
+}
+
+func TestStateCSRFaults(t *testing.T) {
+	cases := []struct {
+		name string
+		insn []byte
+	}{
+		{name: "write cycle", insn: encodeCSR(11, 1, 0, csrCycle)},
+		{name: "set bits of instret", insn: encodeCSR(11, 2, 10, csrInstret)},
+		{name: "clear bits of time", insn: encodeCSR(11, 7, 1, csrTime)},
+		{name: "write mhartid", insn: encodeCSR(0, 5, 0, csrMhartid)},
+		{name: "reserved funct3", insn: encodeCSR(11, 4, 0, csrFcsr)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &fast.VMState{PC: 0x100, Memory: fast.NewMemory(), Registers: [32]uint64{10: 1}, MemoryRegions: fast.UnprotectedRegions()}
+			state.Memory.SetUnaligned(0x100, tc.insn)
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			runEVM(t, testContracts(t), testAddrs, stepWitness, nil, errCodeToByte32(riscv.ErrIllegalInstruction))
+		})
+	}
+}
@@ -64,6 +64,15 @@ func loadRISCVContractCode(t require.TestingT) *Contract {
 	return &outDat
 }
 
+func loadRISCVFloatContractCode(t require.TestingT) *Contract {
+	dat, err := os.ReadFile("../../rvsol/out/RISCVFloat.sol/RISCVFloat.json")
+	require.NoError(t, err)
+	var outDat Contract
+	err = json.Unmarshal(dat, &outDat)
+	require.NoError(t, err)
+	return &outDat
+}
+
 func loadPreimageOracleContractCode(t require.TestingT) *Contract {
 	dat, err := os.ReadFile("../../rvsol/out/PreimageOracle.sol/PreimageOracle.json")
 	require.NoError(t, err)
@@ -82,11 +91,13 @@ type Contract struct {
 
 type Contracts struct {
 	RISCV  *Contract
+	Float  *Contract
 	Oracle *Contract
 }
 
 type Addresses struct {
 	RISCV        common.Address
+	Float        common.Address
 	Oracle       common.Address
 	Sender       common.Address
 	FeeRecipient common.Address
@@ -108,7 +119,9 @@ func newEVMEnv(t *testing.T, contracts *Contracts, addrs *Addresses) *vm.EVM {
 	env := vm.NewEVM(blockContext, vm.TxContext{}, statedb, chainCfg, vmCfg)
 	env.StateDB.SetCode(addrs.RISCV, contracts.RISCV.DeployedBytecode.Object)
 	env.StateDB.SetCode(addrs.Oracle, contracts.Oracle.DeployedBytecode.Object)
-	env.StateDB.SetState(addrs.RISCV, common.Hash{}, common.BytesToHash(addrs.Oracle.Bytes())) // set storage slot pointing to preimage oracle
+	env.StateDB.SetCode(addrs.Float, contracts.Float.DeployedBytecode.Object)
+	env.StateDB.SetState(addrs.RISCV, common.Hash{}, common.BytesToHash(addrs.Oracle.Bytes()))     // set storage slot pointing to preimage oracle
+	env.StateDB.SetState(addrs.RISCV, common.Hash{31: 1}, common.BytesToHash(addrs.Float.Bytes())) // set storage slot pointing to RISCVFloat
 
 	rules := env.ChainConfig().Rules(header.Number, true, header.Time)
 	env.StateDB.Prepare(rules, addrs.Sender, addrs.FeeRecipient, &addrs.RISCV, vm.ActivePrecompiles(rules), nil)
@@ -117,6 +130,7 @@ func newEVMEnv(t *testing.T, contracts *Contracts, addrs *Addresses) *vm.EVM {
 
 var testAddrs = &Addresses{
 	RISCV:        common.HexToAddress("0x1337"),
+	Float:        common.HexToAddress("0xf10a7"),
 	Oracle:       common.HexToAddress("0xf00d"),
 	Sender:       common.HexToAddress("0x7070"),
 	FeeRecipient: common.HexToAddress("0xbd69"),
@@ -125,6 +139,7 @@ var testAddrs = &Addresses{
 func testContracts(t require.TestingT) *Contracts {
 	return &Contracts{
 		RISCV:  loadRISCVContractCode(t),
+		Float:  loadRISCVFloatContractCode(t),
 		Oracle: loadPreimageOracleContractCode(t),
 	}
 }
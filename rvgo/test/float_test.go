@@ -0,0 +1,263 @@
+package test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+// encodeFloatR encodes an R-type instruction, as used by the OP-FP opcode 0x53
+func encodeFloatR(rd, funct3, rs1, rs2, funct7 uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, funct7<<25|rs2<<20|rs1<<15|funct3<<12|rd<<7|0x53)
+}
+
+// encodeFloatR4 encodes an R4-type instruction, as used by the fused multiply-add opcodes
+func encodeFloatR4(opcode, rd, rm, rs1, rs2, rs3, fmt uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, rs3<<27|fmt<<25|rs2<<20|rs1<<15|rm<<12|rd<<7|opcode)
+}
+
+func encodeFloatLoad(rd, funct3, rs1, imm uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, imm<<20|rs1<<15|funct3<<12|rd<<7|0x07)
+}
+
+func encodeFloatStore(funct3, rs1, rs2, imm uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, (imm>>5)<<25|rs2<<20|rs1<<15|funct3<<12|(imm&0x1f)<<7|0x27)
+}
+
+const (
+	fpRNE = 0
+	fpRTZ = 1
+	fpRUP = 3
+	fpDyn = 7
+
+	fpNV = 0x10
+	fpDZ = 0x08
+	fpOF = 0x04
+	fpNX = 0x01
+)
+
+func TestStateFloat(t *testing.T) {
+	const (
+		sp = 2
+		a0 = 10
+		a1 = 11
+		// single precision values are NaN-boxed in the 64 bit registers
+		boxed = uint64(0xffff_ffff_0000_0000)
+	)
+	cases := []struct {
+		name     string
+		insn     []byte
+		x        map[int]uint64 // integer registers before the instruction
+		f        map[int]uint64 // floating point registers before the instruction
+		fcsr     uint64
+		postX    map[int]uint64 // changed integer registers
+		postF    map[int]uint64 // changed floating point registers
+		postFCSR uint64
+		memory   [2]uint64 // expected data at compressedTestSP+8 and compressedTestSP+16, if changed
+	}{
+		{name: "fadd.s", insn: encodeFloatR(3, fpRNE, 1, 2, 0x00),
+			f:     map[int]uint64{1: boxed | 0x3fc0_0000, 2: boxed | 0x4010_0000},
+			postF: map[int]uint64{3: boxed | 0x4070_0000}},
+		{name: "fadd.s not NaN-boxed", insn: encodeFloatR(3, fpRNE, 1, 2, 0x00),
+			f:     map[int]uint64{1: 0x3fc0_0000, 2: boxed | 0x4010_0000},
+			postF: map[int]uint64{3: boxed | 0x7fc0_0000}},
+		{name: "fadd.d dynamic rounding", insn: encodeFloatR(3, fpDyn, 1, 2, 0x01),
+			f: map[int]uint64{1: 0x3ff0_0000_0000_0000, 2: 0x3fb9_9999_9999_999a}, fcsr: fpRUP << 5,
+			postF: map[int]uint64{3: 0x3ff1_9999_9999_999a}, postFCSR: fpRUP<<5 | fpNX},
+		{name: "fadd.d inf - inf", insn: encodeFloatR(3, fpRNE, 1, 2, 0x01),
+			f:     map[int]uint64{1: 0x7ff0_0000_0000_0000, 2: 0xfff0_0000_0000_0000},
+			postF: map[int]uint64{3: 0x7ff8_0000_0000_0000}, postFCSR: fpNV},
+		{name: "fsub.d exact zero", insn: encodeFloatR(3, fpRNE, 1, 1, 0x05),
+			f:     map[int]uint64{1: 0x3ff0_0000_0000_0000},
+			postF: map[int]uint64{3: 0}},
+		{name: "fmul.d overflow", insn: encodeFloatR(3, fpRNE, 1, 1, 0x09),
+			f:     map[int]uint64{1: 0x7fef_ffff_ffff_ffff},
+			postF: map[int]uint64{3: 0x7ff0_0000_0000_0000}, postFCSR: fpOF | fpNX},
+		{name: "fmul.d overflow rtz", insn: encodeFloatR(3, fpRTZ, 1, 1, 0x09),
+			f:     map[int]uint64{1: 0x7fef_ffff_ffff_ffff},
+			postF: map[int]uint64{3: 0x7fef_ffff_ffff_ffff}, postFCSR: fpOF | fpNX},
+		{name: "fdiv.d", insn: encodeFloatR(3, fpRNE, 1, 2, 0x0d),
+			f:     map[int]uint64{1: 0x3ff0_0000_0000_0000, 2: 0x4008_0000_0000_0000},
+			postF: map[int]uint64{3: 0x3fd5_5555_5555_5555}, postFCSR: fpNX},
+		{name: "fdiv.s by zero", insn: encodeFloatR(3, fpRNE, 1, 2, 0x0c),
+			f:     map[int]uint64{1: boxed | 0xbf80_0000, 2: boxed},
+			postF: map[int]uint64{3: boxed | 0xff80_0000}, postFCSR: fpDZ},
+		{name: "fsqrt.d", insn: encodeFloatR(3, fpRNE, 1, 0, 0x2d),
+			f:     map[int]uint64{1: 0x4000_0000_0000_0000},
+			postF: map[int]uint64{3: 0x3ff6_a09e_667f_3bcd}, postFCSR: fpNX},
+		{name: "fsqrt.s negative", insn: encodeFloatR(3, fpRNE, 1, 0, 0x2c),
+			f:     map[int]uint64{1: boxed | 0xbf80_0000},
+			postF: map[int]uint64{3: boxed | 0x7fc0_0000}, postFCSR: fpNV},
+		{name: "fmadd.d single rounding", insn: encodeFloatR4(0x43, 3, fpRNE, 1, 2, 4, 1),
+			f:     map[int]uint64{1: 0x3ff0_0000_0000_0001, 2: 0x3fef_ffff_ffff_ffff, 4: 0xbff0_0000_0000_0000},
+			postF: map[int]uint64{3: 0x3c9f_ffff_ffff_fffe}},
+		{name: "fnmsub.s", insn: encodeFloatR4(0x4b, 3, fpRNE, 1, 2, 4, 0),
+			f:     map[int]uint64{1: boxed | 0x4000_0000, 2: boxed | 0x4080_0000, 4: boxed | 0x3f80_0000},
+			postF: map[int]uint64{3: boxed | 0xc0e0_0000}},
+		{name: "fsgnjn.d", insn: encodeFloatR(3, 1, 1, 2, 0x11),
+			f:     map[int]uint64{1: 0x3ff0_0000_0000_0000, 2: 0x3ff0_0000_0000_0000},
+			postF: map[int]uint64{3: 0xbff0_0000_0000_0000}},
+		{name: "fmin.d zeroes", insn: encodeFloatR(3, 0, 1, 2, 0x15),
+			f:     map[int]uint64{1: 0, 2: 0x8000_0000_0000_0000},
+			postF: map[int]uint64{3: 0x8000_0000_0000_0000}},
+		{name: "fmax.s signaling NaN", insn: encodeFloatR(3, 1, 1, 2, 0x14),
+			f:     map[int]uint64{1: boxed | 0x7fa0_0000, 2: boxed | 0x3f80_0000},
+			postF: map[int]uint64{3: boxed | 0x3f80_0000}, postFCSR: fpNV},
+		{name: "feq.d quiet NaN", insn: encodeFloatR(a0, 2, 1, 2, 0x51),
+			f:     map[int]uint64{1: 0x7ff8_0000_0000_0000, 2: 0x7ff8_0000_0000_0000},
+			postX: map[int]uint64{a0: 0}},
+		{name: "flt.d quiet NaN", insn: encodeFloatR(a0, 1, 1, 2, 0x51),
+			x: map[int]uint64{a0: 1}, f: map[int]uint64{1: 0x7ff8_0000_0000_0000},
+			postX: map[int]uint64{a0: 0}, postFCSR: fpNV},
+		{name: "fle.s", insn: encodeFloatR(a0, 0, 1, 2, 0x50),
+			f:     map[int]uint64{1: boxed | 0xbf80_0000, 2: boxed | 0x3f80_0000},
+			postX: map[int]uint64{a0: 1}},
+		{name: "fclass.d -inf", insn: encodeFloatR(a0, 1, 1, 0, 0x71),
+			f:     map[int]uint64{1: 0xfff0_0000_0000_0000},
+			postX: map[int]uint64{a0: 1 << 0}},
+		{name: "fclass.s quiet NaN", insn: encodeFloatR(a0, 1, 1, 0, 0x70),
+			f:     map[int]uint64{1: boxed | 0x7fc0_0000},
+			postX: map[int]uint64{a0: 1 << 9}},
+		{name: "fcvt.l.d rtz", insn: encodeFloatR(a0, fpRTZ, 1, 2, 0x61),
+			f:     map[int]uint64{1: 0xc004_0000_0000_0000},
+			postX: map[int]uint64{a0: 0xffff_ffff_ffff_fffe}, postFCSR: fpNX},
+		{name: "fcvt.w.d saturates", insn: encodeFloatR(a0, fpRNE, 1, 0, 0x61),
+			f:     map[int]uint64{1: 0x41e6_5a0b_c000_0000},
+			postX: map[int]uint64{a0: 0x7fff_ffff}, postFCSR: fpNV},
+		{name: "fcvt.wu.s negative", insn: encodeFloatR(a0, fpRNE, 1, 1, 0x60),
+			x: map[int]uint64{a0: 1}, f: map[int]uint64{1: boxed | 0xbf80_0000},
+			postX: map[int]uint64{a0: 0}, postFCSR: fpNV},
+		{name: "fcvt.d.w", insn: encodeFloatR(3, fpRNE, a0, 0, 0x69),
+			x:     map[int]uint64{a0: 0xffff_ffff_ffff_fff9},
+			postF: map[int]uint64{3: 0xc01c_0000_0000_0000}},
+		{name: "fcvt.s.lu inexact", insn: encodeFloatR(3, fpRNE, a0, 3, 0x68),
+			x:     map[int]uint64{a0: 0xffff_ffff_ffff_ffff},
+			postF: map[int]uint64{3: boxed | 0x5f80_0000}, postFCSR: fpNX},
+		{name: "fcvt.s.d", insn: encodeFloatR(3, fpRNE, 1, 1, 0x20),
+			f:     map[int]uint64{1: 0x3fb9_9999_9999_999a},
+			postF: map[int]uint64{3: boxed | 0x3dcc_cccd}, postFCSR: fpNX},
+		{name: "fcvt.d.s", insn: encodeFloatR(3, fpRNE, 1, 0, 0x21),
+			f:     map[int]uint64{1: boxed | 0x3f00_0000},
+			postF: map[int]uint64{3: 0x3fe0_0000_0000_0000}},
+		{name: "fmv.x.w sign-extends", insn: encodeFloatR(a0, 0, 1, 0, 0x70),
+			f:     map[int]uint64{1: boxed | 0xbf80_0000},
+			postX: map[int]uint64{a0: 0xffff_ffff_bf80_0000}},
+		{name: "fmv.w.x boxes", insn: encodeFloatR(3, 0, a0, 0, 0x78),
+			x:     map[int]uint64{a0: 0x1234_5678_3f80_0000},
+			postF: map[int]uint64{3: boxed | 0x3f80_0000}},
+		{name: "fmv.d.x", insn: encodeFloatR(3, 0, a0, 0, 0x79),
+			x:     map[int]uint64{a0: 0x1234_5678_3f80_0000},
+			postF: map[int]uint64{3: 0x1234_5678_3f80_0000}},
+		{name: "flags accrue", insn: encodeFloatR(3, fpRNE, 1, 2, 0x0d),
+			f: map[int]uint64{1: 0x3ff0_0000_0000_0000, 2: 0x4008_0000_0000_0000}, fcsr: fpNV,
+			postF: map[int]uint64{3: 0x3fd5_5555_5555_5555}, postFCSR: fpNV | fpNX},
+		{name: "flw", insn: encodeFloatLoad(3, 2, a1, 4),
+			x:     map[int]uint64{a1: compressedTestData},
+			postF: map[int]uint64{3: boxed | 0x8877_6655}},
+		{name: "fld", insn: encodeFloatLoad(3, 3, a1, 8),
+			x:     map[int]uint64{a1: compressedTestData},
+			postF: map[int]uint64{3: 0xffee_ddcc_bbaa_9988}},
+		{name: "fsw", insn: encodeFloatStore(2, sp, 3, 12),
+			f:      map[int]uint64{3: boxed | 0xdead_beef},
+			memory: [2]uint64{0xdead_beef_0506_0708, 0xa1a2_a3a4_a5a6_a7a8}},
+		{name: "fsd", insn: encodeFloatStore(3, sp, 3, 16),
+			f:      map[int]uint64{3: 0x1122_3344_5566_7788},
+			memory: [2]uint64{0x0102_0304_0506_0708, 0x1122_3344_5566_7788}},
+		{name: "c.fld", insn: []byte{0x88, 0x25}, // c.fld f10, 8(a1)
+			x:     map[int]uint64{a1: compressedTestData},
+			postF: map[int]uint64{a0: 0xffee_ddcc_bbaa_9988}},
+		{name: "c.fldsp", insn: []byte{0x42, 0x25}, // c.fldsp f10, 16(sp)
+			postF: map[int]uint64{a0: 0xa1a2_a3a4_a5a6_a7a8}},
+		{name: "c.fsdsp", insn: []byte{0x2a, 0xa8}, // c.fsdsp f10, 16(sp)
+			f:      map[int]uint64{a0: 0x1122_3344_5566_7788},
+			memory: [2]uint64{0x0102_0304_0506_0708, 0x1122_3344_5566_7788}},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var pre [32]uint64
+			for i, v := range tc.x {
+				pre[i] = v
+			}
+			pre[sp] = compressedTestSP
+			state := compressedTestState(compressedTestPC, tc.insn, pre)
+			for i, v := range tc.f {
+				state.FPRegisters[i] = v
+			}
+			state.FCSR = tc.fcsr
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+
+			expectedX := pre
+			for i, v := range tc.postX {
+				expectedX[i] = v
+			}
+			var expectedF [32]uint64
+			for i, v := range tc.f {
+				expectedF[i] = v
+			}
+			for i, v := range tc.postF {
+				expectedF[i] = v
+			}
+			require.Equal(t, expectedX, state.Registers)
+			require.Equal(t, expectedF, state.FPRegisters)
+			require.Equal(t, tc.postFCSR|tc.fcsr, state.FCSR)
+			require.Equal(t, compressedTestPC+uint64(len(tc.insn)), state.PC)
+			expectedMemory := [2]uint64{0x0102_0304_0506_0708, 0xa1a2_a3a4_a5a6_a7a8}
+			if tc.memory != ([2]uint64{}) {
+				expectedMemory = tc.memory
+			}
+			require.Equal(t, expectedMemory, [2]uint64{readU64(state, compressedTestSP+8), readU64(state, compressedTestSP+16)})
+
+			fastPost := state.EncodeWitness()
+			runSlow(t, stepWitness, fastPost, nil, nil)
+			runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+		})
+	}
+}
+
+func TestStateFloatFaults(t *testing.T) {
+	cases := []struct {
+		name string
+		insn []byte
+		fcsr uint64
+	}{
+		{name: "reserved rounding mode", insn: encodeFloatR(3, 5, 1, 2, 0x01)},
+		{name: "reserved dynamic rounding mode", insn: encodeFloatR(3, fpDyn, 1, 2, 0x01), fcsr: 6 << 5},
+		{name: "half precision format", insn: encodeFloatR(3, fpRNE, 1, 2, 0x02)},
+		{name: "quad precision fma", insn: encodeFloatR4(0x43, 3, fpRNE, 1, 2, 4, 3)},
+		{name: "fsqrt with rs2", insn: encodeFloatR(3, fpRNE, 1, 1, 0x2d)},
+		{name: "fcvt.d.d", insn: encodeFloatR(3, fpRNE, 1, 1, 0x21)},
+		{name: "fsgnj funct3", insn: encodeFloatR(3, 3, 1, 2, 0x11)},
+		{name: "fclass funct3", insn: encodeFloatR(10, 2, 1, 0, 0x71)},
+		{name: "unknown funct5", insn: encodeFloatR(3, fpRNE, 1, 2, 0x7d)},
+		{name: "flh", insn: encodeFloatLoad(3, 1, 2, 0)},
+		{name: "fsq", insn: encodeFloatStore(4, 2, 3, 0)},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			state := compressedTestState(compressedTestPC, tc.insn, [32]uint64{})
+			state.FCSR = tc.fcsr
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, "illegal instruction")
+
+			runEVM(t, testContracts(t), testAddrs, stepWitness, nil, errCodeToByte32(riscv.ErrIllegalInstruction))
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+)
+
+const (
+	protR   = riscv.ProtRead
+	protRW  = riscv.ProtRead | riscv.ProtWrite
+	protRX  = riscv.ProtRead | riscv.ProtExec
+	protRWX = riscv.ProtAll
+)
+
+func encodeStore(funct3, rs1, rs2, imm uint32) []byte {
+	insn := (imm>>5)<<25 | rs2<<20 | rs1<<15 | funct3<<12 | (imm&0x1f)<<7 | 0x23
+	return binary.LittleEndian.AppendUint32(nil, insn)
+}
+
+func TestStateMemoryFault(t *testing.T) {
+	ld := encodeI(0x03, 1, 3, 2, 0)  // ld x1, 0(x2)
+	sd := encodeStore(3, 2, 3, 0)    // sd x3, 0(x2)
+	nop := encodeI(0x13, 0, 0, 0, 0) // addi x0, x0, 0
+	cnop := []byte{0x01, 0x00}       // c.nop
+	code := fast.MemoryRegion{Start: 0x1000, End: 0x2000, Prot: protRX}
+	unprotected := fast.UnprotectedRegions()
+
+	cases := []struct {
+		name    string
+		pc      uint64
+		insn    []byte
+		addr    uint64 // x2
+		regions []fast.MemoryRegion
+		fault   bool
+	}{
+		{name: "no regions", pc: 0x1000, insn: sd, addr: 0x1008, fault: true},
+		{name: "unprotected", pc: 0x1000, insn: sd, addr: 0x1008, regions: unprotected[:]},
+		{name: "execute last page", pc: 0xFFFF_FFFF_FFFF_F000, insn: nop, regions: unprotected[:], fault: true},
+		{name: "load from code", pc: 0x1000, insn: ld, addr: 0x1008, regions: []fast.MemoryRegion{code}},
+		{name: "store to code", pc: 0x1000, insn: sd, addr: 0x1008, regions: []fast.MemoryRegion{code}, fault: true},
+		{name: "store to data", pc: 0x1000, insn: sd, addr: 0x2000, regions: []fast.MemoryRegion{code}},
+		{name: "store to read-only data", pc: 0x1000, insn: sd, addr: 0x2000,
+			regions: []fast.MemoryRegion{code, {Start: 0x2000, End: 0x3000, Prot: protR}}, fault: true},
+		{name: "store across into read-only page", pc: 0x1000, insn: sd, addr: 0x2ffc,
+			regions: []fast.MemoryRegion{code, {Start: 0x3000, End: 0x4000, Prot: protR}}, fault: true},
+		{name: "load from execute-only page", pc: 0x1000, insn: ld, addr: 0x2000,
+			regions: []fast.MemoryRegion{code, {Start: 0x2000, End: 0x3000, Prot: riscv.ProtExec}}, fault: true},
+		{name: "execute data", pc: 0x2000, insn: nop, regions: []fast.MemoryRegion{code}, fault: true},
+		{name: "execute compressed data", pc: 0x2000, insn: cnop, regions: []fast.MemoryRegion{code}, fault: true},
+		{name: "execute across into data", pc: 0x1ffe, insn: nop, regions: []fast.MemoryRegion{code}, fault: true},
+		{name: "execute compressed at end of code", pc: 0x1ffe, insn: cnop, regions: []fast.MemoryRegion{code}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:        c.pc,
+				Memory:    fast.NewMemory(),
+				Registers: [32]uint64{2: c.addr, 3: 0x1122_3344_5566_7788},
+			}
+			copy(state.MemoryRegions[:], c.regions)
+			state.Memory.SetUnaligned(c.pc, c.insn)
+			memRoot := state.Memory.MerkleRoot()
+
+			runAllocStep(t, state)
+			if c.fault {
+				require.True(t, state.Exited)
+				require.Equal(t, uint8(riscv.ExitCodeFault), state.ExitCode)
+				require.Equal(t, c.pc, state.PC)
+				require.Equal(t, memRoot, state.Memory.MerkleRoot())
+			} else {
+				require.False(t, state.Exited)
+				require.Equal(t, c.pc+uint64(len(c.insn)), state.PC)
+			}
+		})
+	}
+}
+
+func TestStateSyscallMmapProt(t *testing.T) {
+	const anon = riscv.MapAnonymous
+	const fixed = riscv.MapFixed | riscv.MapAnonymous
+	code := fast.MemoryRegion{Start: 0, End: 0x1000, Prot: protRX}
+	heapRegion := fast.MemoryRegion{Start: 0x10_0000, End: 0x100_0000, Prot: protR}
+
+	cases := []struct {
+		name        string
+		addr        uint64
+		prot        uint64
+		flags       uint64
+		regions     []fast.MemoryRegion
+		out         uint64
+		errCode     uint64
+		postRegions []fast.MemoryRegion
+	}{
+		{name: "read-only", prot: protR, flags: anon, out: 0x10_0000,
+			postRegions: []fast.MemoryRegion{{Start: 0x10_0000, End: 0x10_2000, Prot: protR}}},
+		{name: "data", prot: protRW, flags: anon, out: 0x10_0000},
+		{name: "none", prot: 0, flags: anon, out: 0x10_0000},
+		{name: "in region with same permissions", prot: protR, flags: anon, regions: []fast.MemoryRegion{heapRegion},
+			out: 0x10_0000, postRegions: []fast.MemoryRegion{heapRegion}},
+		{name: "splits region", prot: protRX, flags: fixed, addr: 0x20_0000, regions: []fast.MemoryRegion{heapRegion},
+			out: 0x20_0000, postRegions: []fast.MemoryRegion{
+				{Start: 0x10_0000, End: 0x20_0000, Prot: protR},
+				{Start: 0x20_2000, End: 0x100_0000, Prot: protR},
+				{Start: 0x20_0000, End: 0x20_2000, Prot: protRX},
+			}},
+		{name: "data splits region", prot: protRW, flags: fixed, addr: 0x20_0000, regions: []fast.MemoryRegion{heapRegion},
+			out: 0x20_0000, postRegions: []fast.MemoryRegion{
+				{Start: 0x10_0000, End: 0x20_0000, Prot: protR},
+				{Start: 0x20_2000, End: 0x100_0000, Prot: protR},
+			}},
+		{name: "writable and executable", prot: protRWX, flags: anon, out: ^uint64(0), errCode: 0xd},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:     0x100,
+				Heap:   0x10_0000,
+				Memory: fast.NewMemory(),
+				Registers: [32]uint64{
+					17: riscv.SysMmap,
+					10: c.addr,
+					11: 0x2000,
+					12: c.prot,
+					13: c.flags,
+					14: 0xFFFF_FFFF_FFFF_FFFF, // fd == -1
+				},
+			}
+			state.MemoryRegions[0] = code
+			copy(state.MemoryRegions[1:], c.regions)
+			state.Memory.SetUnaligned(0x100, syscallInsn)
+
+			runAllocStep(t, state)
+			require.Equal(t, uint64(0x104), state.PC)
+			require.Equal(t, c.out, state.Registers[10])
+			require.Equal(t, c.errCode, state.Registers[11])
+			postRegions := [riscv.MemoryRegionCount]fast.MemoryRegion{code}
+			copy(postRegions[1:], c.postRegions)
+			if c.errCode != 0 {
+				copy(postRegions[1:], c.regions)
+			}
+			require.Equal(t, postRegions, state.MemoryRegions)
+		})
+	}
+
+	t.Run("too few unused regions", func(t *testing.T) {
+		state := &fast.VMState{
+			PC:        0x100,
+			Heap:      0x10_0000,
+			Memory:    fast.NewMemory(),
+			Registers: [32]uint64{17: riscv.SysMmap, 11: 0x1000, 12: protR, 13: anon, 14: ^uint64(0)},
+		}
+		state.MemoryRegions[0] = code
+		for i := 1; i < riscv.MemoryRegionCount-1; i++ {
+			start := 0x1000_0000 + uint64(i)*0x1000
+			state.MemoryRegions[i] = fast.MemoryRegion{Start: start, End: start + 0x1000, Prot: protR}
+		}
+		state.Memory.SetUnaligned(0x100, syscallInsn)
+
+		runAllocStep(t, state)
+		require.Equal(t, ^uint64(0), state.Registers[10])
+		require.Equal(t, uint64(0xc), state.Registers[11]) // ENOMEM
+		require.Equal(t, uint64(0x10_0000), state.Heap)
+	})
+}
+
+func TestStateSyscallMprotectProt(t *testing.T) {
+	code := fast.MemoryRegion{Start: 0x1_0000, End: 0x4_0000, Prot: protRX}
+	const pc = 0x3_f000 // in the code region
+	cases := []struct {
+		name        string
+		addr        uint64
+		length      uint64
+		prot        uint64
+		out         uint64
+		errCode     uint64
+		postRegions []fast.MemoryRegion
+	}{
+		{name: "middle", addr: 0x2_0000, length: 0x1000, prot: protR, postRegions: []fast.MemoryRegion{
+			{Start: 0x1_0000, End: 0x2_0000, Prot: protRX},
+			{Start: 0x2_1000, End: 0x4_0000, Prot: protRX},
+			{Start: 0x2_0000, End: 0x2_1000, Prot: protR},
+		}},
+		{name: "data in the middle", addr: 0x2_0000, length: 0x1000, prot: protRW, postRegions: []fast.MemoryRegion{
+			{Start: 0x1_0000, End: 0x2_0000, Prot: protRX},
+			{Start: 0x2_1000, End: 0x4_0000, Prot: protRX},
+		}},
+		{name: "unaligned length", addr: 0x1_0000, length: 0x1001, prot: protR, postRegions: []fast.MemoryRegion{
+			{Start: 0x1_2000, End: 0x4_0000, Prot: protRX},
+			{Start: 0x1_0000, End: 0x1_2000, Prot: protR},
+		}},
+		{name: "covers region", addr: 0x0_f000, length: 0x3_2000, prot: protR, postRegions: []fast.MemoryRegion{
+			{Start: 0x0_f000, End: 0x4_1000, Prot: protR},
+		}},
+		{name: "data covers region", addr: 0x0_f000, length: 0x3_2000, prot: protRW},
+		{name: "same permissions", addr: 0x2_0000, length: 0x1000, prot: protRX, postRegions: []fast.MemoryRegion{code}},
+		{name: "zero length", addr: 0x2_0000, length: 0, prot: protR, postRegions: []fast.MemoryRegion{code}},
+		{name: "writable and executable", addr: 0x2_0000, length: 0x1000, prot: protRWX,
+			out: ^uint64(0), errCode: 0xd, postRegions: []fast.MemoryRegion{code}},
+		{name: "overflow", addr: 0xFFFF_FFFF_FFFF_F000, length: 0x2000, prot: protR,
+			out: ^uint64(0), errCode: 0xc, postRegions: []fast.MemoryRegion{code}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:        pc,
+				Memory:    fast.NewMemory(),
+				Registers: [32]uint64{17: riscv.SysMprotect, 10: c.addr, 11: c.length, 12: c.prot},
+			}
+			state.MemoryRegions[0] = code
+			state.Memory.SetUnaligned(pc, syscallInsn)
+
+			runAllocStep(t, state)
+			require.Equal(t, uint64(pc+4), state.PC)
+			require.Equal(t, c.out, state.Registers[10])
+			require.Equal(t, c.errCode, state.Registers[11])
+			var postRegions [riscv.MemoryRegionCount]fast.MemoryRegion
+			copy(postRegions[:], c.postRegions)
+			require.Equal(t, postRegions, state.MemoryRegions)
+		})
+	}
+
+	t.Run("no unused region to split", func(t *testing.T) {
+		state := &fast.VMState{
+			PC:        0x1_0000,
+			Memory:    fast.NewMemory(),
+			Registers: [32]uint64{17: riscv.SysMprotect, 10: 0x2_0000, 11: 0x1000, 12: protRW},
+		}
+		for i := range state.MemoryRegions {
+			start := 0x1_0000 + uint64(i)*0x10_0000
+			state.MemoryRegions[i] = fast.MemoryRegion{Start: start, End: start + 0x10_0000, Prot: protRX}
+		}
+		regions := state.MemoryRegions
+		state.Memory.SetUnaligned(0x1_0000, syscallInsn)
+
+		runAllocStep(t, state)
+		require.Equal(t, ^uint64(0), state.Registers[10])
+		require.Equal(t, uint64(0xc), state.Registers[11]) // ENOMEM
+		require.Equal(t, regions, state.MemoryRegions)
+	})
+}
@@ -76,8 +76,6 @@ func TestStateSyscallUnsupported(t *testing.T) {
 	addrs := testAddrs
 	syscalls := []int{
 		riscv.SysPrlimit64,
-		riscv.SysFutex,
-		riscv.SysNanosleep,
 	}
 
 	for _, syscall := range syscalls {
@@ -92,6 +90,7 @@ func TestStateSyscallUnsupported(t *testing.T) {
 				LoadReservation: 0,
 				Registers:       [32]uint64{17: uint64(syscall)},
 				Step:            0,
+				MemoryRegions:   fast.UnprotectedRegions(),
 			}
 			state.Memory.SetUnaligned(pc, syscallInsn)
 
@@ -257,10 +256,11 @@ func TestEVMSysWriteHint(t *testing.T) {
 			oracle := hintTrackingOracle{}
 
 			state := &fast.VMState{
-				PC:        0,
-				Memory:    fast.NewMemory(),
-				Registers: [32]uint64{17: riscv.SysWrite, 10: riscv.FdHintWrite, 11: uint64(tt.memOffset), 12: uint64(tt.bytesToWrite)},
-				LastHint:  tt.lastHint,
+				PC:            0,
+				Memory:        fast.NewMemory(),
+				Registers:     [32]uint64{17: riscv.SysWrite, 10: riscv.FdHintWrite, 11: uint64(tt.memOffset), 12: uint64(tt.bytesToWrite)},
+				LastHint:      tt.lastHint,
+				MemoryRegions: fast.UnprotectedRegions(),
 			}
 
 			err := state.Memory.SetMemoryRange(uint64(tt.memOffset), bytes.NewReader(tt.hintData))
@@ -295,6 +295,7 @@ func FuzzStateSyscallExit(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: uint64(syscall), 10: uint64(exitCode)},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -341,6 +342,7 @@ func FuzzStateSyscallBrk(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysBrk},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -391,7 +393,8 @@ func FuzzStateSyscallMmap(f *testing.F) {
 				13: 32,                    // MAP_ANONYMOUS flag
 				14: 0xFFFF_FFFF_FFFF_FFFF, // fd == -1 (u64 mask)
 			},
-			Step: step,
+			Step:          step,
+			MemoryRegions: fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -411,16 +414,28 @@ func FuzzStateSyscallMmap(f *testing.F) {
 		require.Equal(t, step+1, state.Step) // Step must advance
 
 		newHeap := heap
-		if addr == 0 {
-			expectedRegisters[10] = heap
-			align := length & fast.PageAddrMask
-			if align != 0 {
-				length = length + fast.PageSize - align
+		var expectedFreeRanges []fast.FreeRange
+		length = (length + fast.PageAddrMask) &^ fast.PageAddrMask // overflows to 0
+		end := addr + length
+		if length == 0 {
+			expectedRegisters[10] = 0xFFFF_FFFF_FFFF_FFFF
+			expectedRegisters[11] = 0x16 // EINVAL
+		} else if addr != 0 && addr&fast.PageAddrMask == 0 && addr >= heap && end >= addr {
+			expectedRegisters[10] = addr
+			if addr > heap {
+				expectedFreeRanges = []fast.FreeRange{{Addr: heap, Size: addr - heap}}
 			}
+			newHeap = end
+		} else if heap+length < heap {
+			expectedRegisters[10] = 0xFFFF_FFFF_FFFF_FFFF
+			expectedRegisters[11] = 0xc // ENOMEM
+		} else {
+			expectedRegisters[10] = heap
 			newHeap = heap + length
 		}
 		require.Equal(t, expectedRegisters, state.Registers)
 		require.Equal(t, newHeap, state.Heap)
+		require.Equal(t, expectedFreeRanges, state.FreeRanges)
 
 		fastPost := state.EncodeWitness()
 		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
@@ -443,6 +458,7 @@ func FuzzStateSyscallFcntl(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysFcntl, 10: fd, 11: cmd},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -515,6 +531,7 @@ func FuzzStateSyscallOpenat(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysOpenat},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -546,7 +563,10 @@ func FuzzStateSyscallClockGettime(f *testing.F) {
 	contracts := testContracts(f)
 	addrs := testAddrs
 
-	f.Fuzz(func(t *testing.T, addr, pc, step uint64) {
+	f.Add(uint64(riscv.ClockRealtime), uint64(0x1000), uint64(0), uint64(100), uint64(1_700_000_000_000_000_000), uint64(0))
+	f.Add(uint64(1), uint64(0x101c), uint64(0x2000), uint64(1_000_000_000), uint64(1_700_000_000_000_000_000), uint64(5))
+
+	f.Fuzz(func(t *testing.T, clockID, addr, pc, step, epoch, offset uint64) {
 		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC // align PC
 		state := &fast.VMState{
 			PC:              pc,
@@ -555,12 +575,20 @@ func FuzzStateSyscallClockGettime(f *testing.F) {
 			Exited:          false,
 			Memory:          fast.NewMemory(),
 			LoadReservation: 0,
-			Registers:       [32]uint64{17: riscv.SysClockGettime, 11: addr},
+			Registers:       [32]uint64{17: riscv.SysClockGettime, 10: clockID, 11: addr},
 			Step:            step,
+			ClockEpoch:      epoch,
+			ClockOffset:     offset,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		expectedRegisters := state.Registers
+		expectedRegisters[10] = 0
 		expectedRegisters[11] = 0
+		expectedTime := step + offset // the steps before the syscall, and the time slept
+		if clockID == riscv.ClockRealtime || clockID == riscv.ClockRealtimeCoarse {
+			expectedTime += epoch
+		}
 
 		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
 		stepWitness, err := fastState.Step(true)
@@ -569,10 +597,10 @@ func FuzzStateSyscallClockGettime(f *testing.F) {
 
 		postMemory := fast.NewMemory()
 		postMemory.SetUnaligned(pc, syscallInsn)
-		var bytes [8]byte
-		binary.LittleEndian.PutUint64(bytes[:], 1337)
+		var bytes [16]byte
+		binary.LittleEndian.PutUint64(bytes[:8], expectedTime/riscv.NanosPerSecond)
+		binary.LittleEndian.PutUint64(bytes[8:], expectedTime%riscv.NanosPerSecond)
 		postMemory.SetUnaligned(addr, bytes[:])
-		postMemory.SetUnaligned(addr+8, []byte{42, 0, 0, 0, 0, 0, 0, 0})
 
 		require.Equal(t, pc+4, state.PC) // PC must advance
 		require.Equal(t, uint64(0), state.Heap)
@@ -589,11 +617,78 @@ func FuzzStateSyscallClockGettime(f *testing.F) {
 	})
 }
 
+func FuzzStateSyscallGetrandom(f *testing.F) {
+	contracts := testContracts(f)
+	addrs := testAddrs
+
+	f.Add(uint64(0x1000), uint64(8), uint64(0), uint64(0), uint64(0))
+	f.Add(uint64(0x101c), uint64(32), uint64(0x2000), uint64(10), uint64(0x5eed)) // buffer spans two leaves
+	f.Add(uint64(0x1003), uint64(3), uint64(0x2000), uint64(10), uint64(0x5eed))
+	f.Add(uint64(0x1000), uint64(0), uint64(0x2000), uint64(10), uint64(0x5eed))
+
+	f.Fuzz(func(t *testing.T, addr, count, pc, step, randomState uint64) {
+		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC // align PC
+		state := &fast.VMState{
+			PC:            pc,
+			Memory:        fast.NewMemory(),
+			Registers:     [32]uint64{17: riscv.SysGetRandom, 10: addr, 11: count},
+			Step:          step,
+			RandomState:   randomState,
+			MemoryRegions: fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(pc, syscallInsn)
+		expectedRegisters := state.Registers
+		expectedN := min(count, riscv.RandomMaxBytes)
+		expectedRegisters[10] = expectedN
+		expectedRegisters[11] = 0
+		expectedRandomState := randomState
+		postMemory := fast.NewMemory()
+		postMemory.SetUnaligned(pc, syscallInsn)
+		if expectedN != 0 {
+			expectedRandomState += riscv.RandomGamma
+			var bytes [8]byte
+			binary.LittleEndian.PutUint64(bytes[:], splitMix64(expectedRandomState))
+			postMemory.SetUnaligned(addr, bytes[:expectedN])
+		}
+
+		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		require.False(t, stepWitness.HasPreimage())
+
+		require.Equal(t, pc+4, state.PC) // PC must advance
+		require.Equal(t, state.Memory.MerkleRoot(), postMemory.MerkleRoot())
+		require.Equal(t, step+1, state.Step) // Step must advance
+		require.Equal(t, expectedRegisters, state.Registers)
+		require.Equal(t, expectedRandomState, state.RandomState)
+
+		fastPost := state.EncodeWitness()
+		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+		runSlow(t, stepWitness, fastPost, nil, nil)
+	})
+}
+
+// splitMix64 is the reference output function of the SplitMix64 PRNG, for the state after advancing it
+func splitMix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func TestSplitMix64(t *testing.T) {
+	// the first value of the reference implementation, seeded with 0
+	require.Equal(t, uint64(0xe220a8397b1dcdaf), splitMix64(riscv.RandomGamma))
+}
+
 func FuzzStateSyscallClone(f *testing.F) {
 	contracts := testContracts(f)
 	addrs := testAddrs
 
-	f.Fuzz(func(t *testing.T, pc, step uint64) {
+	f.Add(uint64(riscv.CloneThreadFlags), uint64(0x7000_0000), uint64(0), uint64(0), false)
+	f.Add(uint64(riscv.CloneThreadFlags), uint64(0x7000_0000), uint64(0x1000), uint64(5), true)
+	f.Add(uint64(0x11), uint64(0), uint64(0), uint64(0), false) // SIGCHLD: fork, not supported
+
+	f.Fuzz(func(t *testing.T, flags, stack, pc, step uint64, traverseRight bool) {
 		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC // align PC
 		state := &fast.VMState{
 			PC:              pc,
@@ -602,19 +697,35 @@ func FuzzStateSyscallClone(f *testing.F) {
 			Exited:          false,
 			Memory:          fast.NewMemory(),
 			LoadReservation: 0,
-			Registers:       [32]uint64{17: riscv.SysClone},
+			Registers:       [32]uint64{17: riscv.SysClone, 10: flags, 11: stack, 12: 0xdead},
 			Step:            step,
+			ThreadID:        1,
+			NextThreadID:    2,
+			TraverseRight:   traverseRight,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
 		expectedRegisters := state.Registers
-		expectedRegisters[10] = 1
-		expectedRegisters[11] = 0
+		var expectedThreads []fast.ThreadState
+		if flags == riscv.CloneThreadFlags {
+			expectedRegisters[10] = 2
+			expectedRegisters[11] = 0
+			child := fast.ThreadState{ThreadID: 2, PC: pc + 4, Registers: state.Registers}
+			child.Registers[2] = stack
+			child.Registers[10] = 0
+			child.Registers[11] = 0
+			expectedThreads = []fast.ThreadState{child}
+		} else {
+			expectedRegisters[10] = ^uint64(0)
+			expectedRegisters[11] = 0x16 // EINVAL
+		}
 
 		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
 		stepWitness, err := fastState.Step(true)
 		require.NoError(t, err)
 		require.False(t, stepWitness.HasPreimage())
+		require.Nil(t, stepWitness.ThreadProof)
 
 		require.Equal(t, pc+4, state.PC) // PC must advance
 		require.Equal(t, uint64(0), state.Heap)
@@ -624,6 +735,281 @@ func FuzzStateSyscallClone(f *testing.F) {
 		require.Equal(t, preStateRoot, state.Memory.MerkleRoot())
 		require.Equal(t, step+1, state.Step) // Step must advance
 		require.Equal(t, expectedRegisters, state.Registers)
+		require.Equal(t, uint64(1), state.ThreadID)
+		require.Equal(t, uint64(2+len(expectedThreads)), state.NextThreadID)
+		// the child is pushed onto the stack of threads to run next
+		if traverseRight {
+			require.Equal(t, expectedThreads, state.RightThreads)
+			require.Empty(t, state.LeftThreads)
+		} else {
+			require.Equal(t, expectedThreads, state.LeftThreads)
+			require.Empty(t, state.RightThreads)
+		}
+
+		fastPost := state.EncodeWitness()
+		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+		runSlow(t, stepWitness, fastPost, nil, nil)
+	})
+}
+
+func FuzzStateSyscallFutexWait(f *testing.F) {
+	contracts := testContracts(f)
+	addrs := testAddrs
+
+	testFutexWait := func(t *testing.T, addr, val uint64, memVal uint32, timeout, pc, step uint64) {
+		pc = pc & 0x0F_FF_FF_FF_FF_FF_FF_FC           // align PC
+		addr = addr&0xFF_FF_FF_FF_FF_FF_FF_FC | 1<<63 // align addr, and keep it away from the PC
+		if timeout != 0 {
+			timeout = timeout&^(3<<62) | 1<<62 // keep the zero timespec away from the futex and the PC
+		}
+		state := &fast.VMState{
+			PC:              pc,
+			Heap:            0,
+			ExitCode:        0,
+			Exited:          false,
+			Memory:          fast.NewMemory(),
+			LoadReservation: 0,
+			Registers:       [32]uint64{17: riscv.SysFutex, 10: addr, 11: riscv.FutexWait | 0x80, 12: val, 13: timeout},
+			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(pc, syscallInsn)
+		state.Memory.SetUnaligned(addr, binary.LittleEndian.AppendUint32(nil, memVal))
+		preStateRoot := state.Memory.MerkleRoot()
+		expectedRegisters := state.Registers
+		var expectedFutexAddr, expectedFutexVal, expectedFutexTimeoutStep uint64
+		if memVal == uint32(val) {
+			// the thread blocks, the registers are only set once it wakes up
+			expectedFutexAddr = addr
+			expectedFutexVal = uint64(memVal)
+			expectedFutexTimeoutStep = ^uint64(0)
+			if timeout != 0 {
+				expectedFutexTimeoutStep = step + 1 // the wait times out after the zero timeout
+			}
+		} else {
+			expectedRegisters[10] = ^uint64(0)
+			expectedRegisters[11] = 0xb // EAGAIN
+		}
+
+		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		require.False(t, stepWitness.HasPreimage())
+
+		require.Equal(t, pc+4, state.PC) // PC must advance
+		require.Equal(t, uint64(0), state.Heap)
+		require.Equal(t, uint64(0), state.LoadReservation)
+		require.Equal(t, uint8(0), state.ExitCode)
+		require.Equal(t, false, state.Exited)
+		require.Equal(t, preStateRoot, state.Memory.MerkleRoot())
+		require.Equal(t, step+1, state.Step) // Step must advance
+		require.Equal(t, expectedRegisters, state.Registers)
+		require.Equal(t, expectedFutexAddr, state.FutexAddr)
+		require.Equal(t, expectedFutexVal, state.FutexVal)
+		require.Equal(t, expectedFutexTimeoutStep, state.FutexTimeoutStep)
+
+		fastPost := state.EncodeWitness()
+		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+		runSlow(t, stepWitness, fastPost, nil, nil)
+	}
+
+	f.Fuzz(func(t *testing.T, addr, val uint64, memVal uint32, timeout, pc, step uint64) {
+		testFutexWait(t, addr, val, memVal, timeout, pc, step)
+		testFutexWait(t, addr, val, uint32(val), timeout, pc, step)
+	})
+}
+
+func TestStateSyscallFutex(t *testing.T) {
+	contracts := testContracts(t)
+	addrs := testAddrs
+
+	cases := []struct {
+		name               string
+		addr               uint64
+		op                 uint64
+		timeoutNsec        uint64 // the nanoseconds of the timeout, if the futex is waited on with a timeout
+		expectedRet        uint64
+		expectedErrCode    uint64
+		expectedSchedSteps uint64
+	}{
+		{name: "wait on nil", addr: 0, op: riscv.FutexWait, expectedRet: ^uint64(0), expectedErrCode: 0xe},
+		{name: "wait unaligned", addr: 0x1002, op: riscv.FutexWait, expectedRet: ^uint64(0), expectedErrCode: 0x16},
+		{name: "wait with invalid timeout", addr: 0x1000, op: riscv.FutexWait, timeoutNsec: riscv.NanosPerSecond,
+			expectedRet: ^uint64(0), expectedErrCode: 0x16},
+		{name: "wake", addr: 0x1000, op: riscv.FutexWake, expectedRet: 0, expectedErrCode: 0, expectedSchedSteps: riscv.SchedQuantum},
+		{name: "private wake", addr: 0x1000, op: riscv.FutexWake | 0x80, expectedRet: 0, expectedErrCode: 0, expectedSchedSteps: riscv.SchedQuantum},
+		{name: "requeue", addr: 0x1000, op: 3, expectedRet: ^uint64(0), expectedErrCode: 0x16},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pc := uint64(0)
+			state := &fast.VMState{
+				PC:            pc,
+				Memory:        fast.NewMemory(),
+				Registers:     [32]uint64{17: riscv.SysFutex, 10: c.addr, 11: c.op, 12: 1},
+				MemoryRegions: fast.UnprotectedRegions(),
+			}
+			state.Memory.SetUnaligned(pc, syscallInsn)
+			if c.timeoutNsec != 0 {
+				state.Registers[13] = 0x2000
+				state.Memory.SetUnaligned(c.addr, binary.LittleEndian.AppendUint32(nil, 1))
+				state.Memory.SetUnaligned(0x2008, binary.LittleEndian.AppendUint64(nil, c.timeoutNsec))
+			}
+			expectedRegisters := state.Registers
+			expectedRegisters[10] = c.expectedRet
+			expectedRegisters[11] = c.expectedErrCode
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+
+			require.Equal(t, pc+4, state.PC) // PC must advance
+			require.Equal(t, expectedRegisters, state.Registers)
+			require.Equal(t, uint64(0), state.FutexAddr)                          // must not wait
+			require.Equal(t, c.expectedSchedSteps, state.StepsSinceContextSwitch) // a wake yields to other threads
+
+			fastPost := state.EncodeWitness()
+			runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+			runSlow(t, stepWitness, fastPost, nil, nil)
+		})
+	}
+}
+
+func FuzzStateSyscallYield(f *testing.F) {
+	contracts := testContracts(f)
+	addrs := testAddrs
+
+	syscalls := []int{riscv.SysSchedYield}
+
+	testYield := func(t *testing.T, syscall int, arg uint64, pc uint64, step uint64) {
+		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC // align PC
+		state := &fast.VMState{
+			PC:              pc,
+			Heap:            0,
+			ExitCode:        0,
+			Exited:          false,
+			Memory:          fast.NewMemory(),
+			LoadReservation: 0,
+			Registers:       [32]uint64{17: uint64(syscall), 10: arg},
+			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(pc, syscallInsn)
+		preStateRoot := state.Memory.MerkleRoot()
+		expectedRegisters := state.Registers
+		expectedRegisters[10] = 0
+		expectedRegisters[11] = 0
+
+		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		require.False(t, stepWitness.HasPreimage())
+
+		require.Equal(t, pc+4, state.PC) // PC must advance
+		require.Equal(t, preStateRoot, state.Memory.MerkleRoot())
+		require.Equal(t, step+1, state.Step) // Step must advance
+		require.Equal(t, expectedRegisters, state.Registers)
+		// the thread is preempted at the next step
+		require.Equal(t, uint64(riscv.SchedQuantum), state.StepsSinceContextSwitch)
+
+		fastPost := state.EncodeWitness()
+		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+		runSlow(t, stepWitness, fastPost, nil, nil)
+	}
+
+	f.Fuzz(func(t *testing.T, arg uint64, pc uint64, step uint64) {
+		for _, syscall := range syscalls {
+			testYield(t, syscall, arg, pc, step)
+		}
+	})
+}
+
+func FuzzStateSyscallNanosleep(f *testing.F) {
+	contracts := testContracts(f)
+	addrs := testAddrs
+
+	f.Add(uint64(0x1000), uint64(0), uint64(20_000), uint64(0x2000), uint64(0), uint64(0))
+	f.Add(uint64(0x101c), uint64(1), uint64(999_999_999), uint64(0x2000), uint64(10), uint64(1000)) // seconds span two leaves
+	f.Add(uint64(0x1014), uint64(2), uint64(5), uint64(0x2000), uint64(10), uint64(1000))           // nanoseconds span two leaves
+	f.Add(uint64(0x1000), uint64(0), uint64(riscv.NanosPerSecond), uint64(0x2000), uint64(0), uint64(0))
+	f.Add(uint64(0x1000), ^uint64(0), uint64(0), uint64(0x2000), uint64(0), uint64(0))
+
+	f.Fuzz(func(t *testing.T, addr, sec, nsec, pc, step, offset uint64) {
+		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC     // align PC
+		addr = addr & 0x7F_FF_FF_FF_FF_FF_FF_FF // the timespec must not wrap around the address space
+		state := &fast.VMState{
+			PC:            pc,
+			Memory:        fast.NewMemory(),
+			Registers:     [32]uint64{17: riscv.SysNanosleep, 10: addr},
+			Step:          step,
+			ClockOffset:   offset,
+			MemoryRegions: fast.UnprotectedRegions(),
+		}
+		var timespec [16]byte
+		binary.LittleEndian.PutUint64(timespec[:8], sec)
+		binary.LittleEndian.PutUint64(timespec[8:], nsec)
+		state.Memory.SetUnaligned(addr, timespec[:])
+		state.Memory.SetUnaligned(pc, syscallInsn)
+		// the instruction may overlap with the timespec
+		state.Memory.GetUnaligned(addr, timespec[:])
+		sec = binary.LittleEndian.Uint64(timespec[:8])
+		nsec = binary.LittleEndian.Uint64(timespec[8:])
+		preStateRoot := state.Memory.MerkleRoot()
+
+		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		require.False(t, stepWitness.HasPreimage())
+
+		require.Equal(t, pc+4, state.PC) // PC must advance
+		require.Equal(t, preStateRoot, state.Memory.MerkleRoot())
+		require.Equal(t, step+1, state.Step) // Step must advance
+		if int64(sec) < 0 || nsec >= riscv.NanosPerSecond {
+			require.Equal(t, ^uint64(0), state.Registers[10])
+			require.Equal(t, uint64(0x16), state.Registers[11]) // EINVAL
+			require.Equal(t, offset, state.ClockOffset)
+			require.Equal(t, uint64(0), state.StepsSinceContextSwitch)
+		} else {
+			require.Equal(t, uint64(0), state.Registers[10])
+			require.Equal(t, uint64(0), state.Registers[11])
+			// the clock advances by the duration, and the thread is preempted at the next step
+			require.Equal(t, offset+sec*riscv.NanosPerSecond+nsec, state.ClockOffset)
+			require.Equal(t, uint64(riscv.SchedQuantum), state.StepsSinceContextSwitch)
+		}
+
+		fastPost := state.EncodeWitness()
+		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
+		runSlow(t, stepWitness, fastPost, nil, nil)
+	})
+}
+
+func FuzzStateSyscallGettid(f *testing.F) {
+	contracts := testContracts(f)
+	addrs := testAddrs
+
+	f.Fuzz(func(t *testing.T, threadID, pc, step uint64) {
+		pc = pc & 0xFF_FF_FF_FF_FF_FF_FF_FC // align PC
+		state := &fast.VMState{
+			PC:            pc,
+			Memory:        fast.NewMemory(),
+			Registers:     [32]uint64{17: riscv.SysGettid},
+			Step:          step,
+			ThreadID:      threadID,
+			MemoryRegions: fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(pc, syscallInsn)
+		expectedRegisters := state.Registers
+		expectedRegisters[10] = threadID
+		expectedRegisters[11] = 0
+
+		fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+
+		require.Equal(t, pc+4, state.PC)     // PC must advance
+		require.Equal(t, step+1, state.Step) // Step must advance
+		require.Equal(t, expectedRegisters, state.Registers)
 
 		fastPost := state.EncodeWitness()
 		runEVM(t, contracts, addrs, stepWitness, fastPost, nil)
@@ -646,6 +1032,7 @@ func FuzzStateSyscallGetrlimit(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysGetrlimit, 10: 7, 11: addr},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		expectedRegisters := state.Registers
@@ -690,6 +1077,7 @@ func FuzzStateSyscallGetrlimit(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysGetrlimit, 10: res, 11: addr},
 			Step:            0,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 
@@ -723,10 +1111,8 @@ func FuzzStateSyscallNoop(f *testing.F) {
 
 	syscalls := []int{
 		riscv.SysSchedGetaffinity,
-		riscv.SysSchedYield,
 		riscv.SysRtSigprocmask,
 		riscv.SysSigaltstack,
-		riscv.SysGettid,
 		riscv.SysRtSigaction,
 		riscv.SysMadvise,
 		riscv.SysEpollCreate1,
@@ -750,6 +1136,7 @@ func FuzzStateSyscallNoop(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: uint64(syscall), 10: arg},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -798,6 +1185,7 @@ func FuzzStateSyscallRead(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysRead, 10: fd, 11: addr, 12: count},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -858,6 +1246,7 @@ func FuzzStateHintRead(f *testing.F) {
 			Step:            step,
 			PreimageKey:     preimage.Keccak256Key(crypto.Keccak256Hash(preimageData)).PreimageKey(),
 			PreimageOffset:  preimageOffset,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStatePreimageKey := state.PreimageKey
@@ -910,6 +1299,7 @@ func FuzzStatePreimageRead(f *testing.F) {
 			Step:            step,
 			PreimageKey:     preimage.Keccak256Key(crypto.Keccak256Hash(preimageData)).PreimageKey(),
 			PreimageOffset:  preimageOffset,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStatePreimageKey := state.PreimageKey
@@ -971,6 +1361,7 @@ func FuzzStateSyscallWrite(f *testing.F) {
 			LoadReservation: 0,
 			Registers:       [32]uint64{17: riscv.SysWrite, 10: fd, 11: addr, 12: count},
 			Step:            step,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 		preStateRoot := state.Memory.MerkleRoot()
@@ -1035,7 +1426,8 @@ func FuzzStateHintWrite(f *testing.F) {
 			PreimageKey:     preimage.Keccak256Key(crypto.Keccak256Hash(preimageData)).PreimageKey(),
 			PreimageOffset:  preimageOffset,
 
-			LastHint: nil,
+			LastHint:      nil,
+			MemoryRegions: fast.UnprotectedRegions(),
 		}
 		// Set random data at the target memory range
 		randBytes, err := randomBytes(randSeed, count)
@@ -1100,6 +1492,7 @@ func FuzzStatePreimageWrite(f *testing.F) {
 			Registers:       [32]uint64{17: riscv.SysWrite, 10: riscv.FdPreimageWrite, 11: addr, 12: count},
 			Step:            step,
 			PreimageOffset:  preimageOffset,
+			MemoryRegions:   fast.UnprotectedRegions(),
 		}
 		state.Memory.SetUnaligned(pc, syscallInsn)
 
@@ -0,0 +1,354 @@
+package test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/asterisc/rvgo/fast"
+	"github.com/ethereum-optimism/asterisc/rvgo/riscv"
+	"github.com/ethereum-optimism/asterisc/rvgo/slow"
+)
+
+// testThread returns a suspended thread with some distinct register values
+func testThread(threadID uint64) fast.ThreadState {
+	return fast.ThreadState{
+		ThreadID:    threadID,
+		PC:          0x1000 + threadID*0x100,
+		Registers:   [32]uint64{1: threadID, 2: 0x7000_0000 + threadID*0x1000, 10: threadID << 32},
+		FPRegisters: [32]uint64{3: threadID},
+		FCSR:        threadID & 0x1f,
+	}
+}
+
+// runThreadStep steps the given state, and checks that the fast, slow and EVM implementations agree on the post-state
+func runThreadStep(t *testing.T, state *fast.VMState) *fast.StepWitness {
+	fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+	stepWitness, err := fastState.Step(true)
+	require.NoError(t, err)
+
+	fastPost := state.EncodeWitness()
+	runEVM(t, testContracts(t), testAddrs, stepWitness, fastPost, nil)
+	runSlow(t, stepWitness, fastPost, nil, nil)
+	return stepWitness
+}
+
+func TestStatePreemptThread(t *testing.T) {
+	t.Run("single thread", func(t *testing.T) {
+		for _, traverseRight := range []bool{false, true} {
+			state := &fast.VMState{
+				PC:                      0x100,
+				Memory:                  fast.NewMemory(),
+				Step:                    10,
+				LoadReservation:         0x2000,
+				ThreadID:                1,
+				NextThreadID:            2,
+				StepsSinceContextSwitch: riscv.SchedQuantum,
+				TraverseRight:           traverseRight,
+				MemoryRegions:           fast.UnprotectedRegions(),
+			}
+			state.Memory.SetUnaligned(0x100, nopInsn)
+
+			stepWitness := runThreadStep(t, state)
+			require.Nil(t, stepWitness.ThreadProof)
+
+			// there is no other thread to switch to: the running thread continues
+			require.Equal(t, uint64(0x104), state.PC)
+			require.Equal(t, uint64(11), state.Step)
+			require.Equal(t, uint64(1), state.ThreadID)
+			require.Equal(t, traverseRight, state.TraverseRight)
+			require.Equal(t, uint64(riscv.SchedQuantum), state.StepsSinceContextSwitch)
+			require.Equal(t, uint64(0x2000), state.LoadReservation)
+		}
+	})
+
+	t.Run("switch thread", func(t *testing.T) {
+		for _, traverseRight := range []bool{false, true} {
+			next := testThread(2)
+			other := testThread(3)
+			state := &fast.VMState{
+				PC:                      0x100,
+				Memory:                  fast.NewMemory(),
+				Step:                    10,
+				Registers:               [32]uint64{1: 0x11, 2: 0x22},
+				FPRegisters:             [32]uint64{1: 0x33},
+				FCSR:                    0x5,
+				LoadReservation:         0x2000,
+				ThreadID:                1,
+				NextThreadID:            4,
+				StepsSinceContextSwitch: riscv.SchedQuantum,
+				TraverseRight:           traverseRight,
+				MemoryRegions:           fast.UnprotectedRegions(),
+			}
+			*threadStack(state, traverseRight) = []fast.ThreadState{other, next}
+			preempted := fast.ThreadState{
+				ThreadID:    1,
+				PC:          0x100,
+				Registers:   state.Registers,
+				FPRegisters: state.FPRegisters,
+				FCSR:        state.FCSR,
+			}
+
+			stepWitness := runThreadStep(t, state)
+			require.Len(t, stepWitness.ThreadProof, fast.THREAD_PROOF_SIZE)
+
+			// the next thread runs, and the preempted thread is pushed onto the other stack
+			require.Equal(t, uint64(11), state.Step)
+			require.Equal(t, next.ThreadID, state.ThreadID)
+			require.Equal(t, next.PC, state.PC)
+			require.Equal(t, next.Registers, state.Registers)
+			require.Equal(t, next.FPRegisters, state.FPRegisters)
+			require.Equal(t, next.FCSR, state.FCSR)
+			require.Equal(t, traverseRight, state.TraverseRight)
+			require.Equal(t, []fast.ThreadState{other}, *threadStack(state, traverseRight))
+			require.Equal(t, []fast.ThreadState{preempted}, *threadStack(state, !traverseRight))
+			require.Equal(t, uint64(0), state.StepsSinceContextSwitch)
+			require.Equal(t, uint64(0), state.LoadReservation)
+		}
+	})
+
+	t.Run("flip direction", func(t *testing.T) {
+		next := testThread(2)
+		state := &fast.VMState{
+			PC:                      0x100,
+			Memory:                  fast.NewMemory(),
+			ThreadID:                1,
+			NextThreadID:            3,
+			StepsSinceContextSwitch: riscv.SchedQuantum,
+			RightThreads:            []fast.ThreadState{next},
+			MemoryRegions:           fast.UnprotectedRegions(),
+		}
+		state.Memory.SetUnaligned(next.PC, nopInsn)
+
+		stepWitness := runThreadStep(t, state)
+		require.Len(t, stepWitness.ThreadProof, fast.THREAD_PROOF_SIZE)
+
+		// all threads ran in this direction: the direction is reversed, and the next thread runs
+		require.Equal(t, next.ThreadID, state.ThreadID)
+		require.True(t, state.TraverseRight)
+		require.Empty(t, state.RightThreads)
+		require.Equal(t, []fast.ThreadState{{ThreadID: 1, PC: 0x100}}, state.LeftThreads)
+
+		stepWitness = runThreadStep(t, state)
+		require.Nil(t, stepWitness.ThreadProof) // not preempted yet
+		require.Equal(t, next.PC+4, state.PC)
+		require.Equal(t, uint64(1), state.StepsSinceContextSwitch)
+	})
+}
+
+func TestStateFutexWaitingThread(t *testing.T) {
+	const futexAddr = 0x2000
+	const timeoutAddr = 0x3000
+
+	cases := []struct {
+		name             string
+		memVal           uint32
+		step             uint64
+		otherThreads     bool
+		woken            bool
+		expectedThreadID uint64
+		expectedA0       uint64
+		expectedA1       uint64
+		timeoutNsec      uint64
+		expectedClock    uint64
+	}{
+		{name: "woken up", memVal: 2, step: 10, woken: true, expectedThreadID: 1, expectedA0: 0, expectedA1: 0},
+		// the clock jumps ahead by the rest of the timeout of 2.5s, the steps of the wait make up the rest
+		{name: "timed out", memVal: 1, step: 100, woken: true, expectedThreadID: 1, expectedA0: ^uint64(0), expectedA1: 0x6e,
+			expectedClock: 2_500_000_000 - riscv.FutexTimeoutSteps},
+		// the steps of the wait make up a timeout shorter than FutexTimeoutSteps
+		{name: "timed out without clock jump", memVal: 1, step: 100, woken: true, expectedThreadID: 1, expectedA0: ^uint64(0),
+			expectedA1: 0x6e, timeoutNsec: 50},
+		{name: "still waiting", memVal: 1, step: 10, expectedThreadID: 1, expectedA0: futexAddr, expectedA1: 0x80},
+		{name: "switch while waiting", memVal: 1, step: 10, otherThreads: true, expectedThreadID: 2,
+			expectedA0: testThread(2).Registers[10], expectedA1: testThread(2).Registers[11]},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:               0x104,
+				Memory:           fast.NewMemory(),
+				Step:             c.step,
+				Registers:        [32]uint64{10: futexAddr, 11: riscv.FutexWait | 0x80, 12: 1, 13: timeoutAddr},
+				ThreadID:         1,
+				NextThreadID:     3,
+				FutexAddr:        futexAddr,
+				FutexVal:         1,
+				FutexTimeoutStep: 99,
+				MemoryRegions:    fast.UnprotectedRegions(),
+			}
+			if c.otherThreads {
+				state.LeftThreads = []fast.ThreadState{testThread(2)}
+			}
+			state.Memory.SetUnaligned(futexAddr, binary.LittleEndian.AppendUint32(nil, c.memVal))
+			timeout := binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, 2), 500_000_000)
+			if c.timeoutNsec != 0 {
+				timeout = binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, 0), c.timeoutNsec)
+			}
+			state.Memory.SetUnaligned(timeoutAddr, timeout)
+			preStateRoot := state.Memory.MerkleRoot()
+
+			runThreadStep(t, state)
+
+			require.Equal(t, c.step+1, state.Step)
+			require.Equal(t, preStateRoot, state.Memory.MerkleRoot())
+			require.Equal(t, c.expectedThreadID, state.ThreadID)
+			require.Equal(t, c.expectedA0, state.Registers[10])
+			require.Equal(t, c.expectedA1, state.Registers[11])
+			require.Equal(t, c.expectedClock, state.ClockOffset)
+			if c.woken {
+				require.Equal(t, uint64(0x104), state.PC) // no instruction is executed
+				require.Equal(t, uint64(0), state.FutexAddr)
+				require.Equal(t, uint64(0), state.FutexVal)
+				require.Equal(t, uint64(0), state.FutexTimeoutStep)
+			} else if c.otherThreads {
+				// the waiting thread is suspended with its futex
+				require.Equal(t, uint64(futexAddr), state.RightThreads[0].FutexAddr)
+			} else {
+				require.Equal(t, uint64(futexAddr), state.FutexAddr)
+			}
+		})
+	}
+}
+
+func TestStateFutexWakeAfterTimeSlice(t *testing.T) {
+	const futexAddr = 0x4000
+	const timeoutAddr = 0x5000
+
+	// the waiting thread waits with a timeout of 1s, the other thread loops for a while and yields,
+	// so that the waiting thread checks its futex, before it wakes the waiting thread
+	a := riscv.NewAssembler(0x1000)
+	a.Syscall(riscv.SysFutex, futexAddr, riscv.FutexWait|0x80, 0, timeoutAddr)
+	a.Li(riscv.RegA7, riscv.SysExitGroup) // exit with the return value of the wait
+	a.Ecall()
+	a.Label("waker")
+	a.Li(riscv.RegT0, 20_000)
+	a.Label("loop")
+	a.Addi(riscv.RegT0, riscv.RegT0, -1)
+	a.Bnez(riscv.RegT0, "loop")
+	a.Syscall(riscv.SysSchedYield)
+	a.Li(riscv.RegT1, 1)
+	a.Li(riscv.RegT2, futexAddr)
+	a.Sw(riscv.RegT1, riscv.RegT2, 0)
+	a.Syscall(riscv.SysFutex, futexAddr, riscv.FutexWake|0x80, 1)
+	a.Label("spin")
+	a.Jump("spin")
+	wakerPC, _ := a.Addr("waker")
+
+	state := &fast.VMState{
+		PC:            0x1000,
+		Memory:        fast.NewMemory(),
+		ThreadID:      1,
+		NextThreadID:  3,
+		LeftThreads:   []fast.ThreadState{{ThreadID: 2, PC: wakerPC}},
+		MemoryRegions: fast.UnprotectedRegions(),
+	}
+	require.NoError(t, a.WriteMemory(state.Memory))
+	state.Memory.SetUnaligned(timeoutAddr, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, 1), 0))
+
+	contracts := testContracts(t)
+	fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+	for !state.Exited {
+		require.Less(t, state.Step, uint64(riscv.SchedQuantum), "program does not exit")
+		waiting := state.FutexAddr != 0
+		stepWitness, err := fastState.Step(true)
+		require.NoError(t, err)
+		fastPost := state.EncodeWitness()
+		runSlow(t, stepWitness, fastPost, nil, nil)
+		if waiting && contracts != nil { // check the steps that check the futex of the waiting thread
+			runEVM(t, contracts, testAddrs, stepWitness, fastPost, nil)
+		}
+	}
+	require.Greater(t, state.Step, uint64(40_000))
+	require.Equal(t, uint64(1), state.ThreadID)
+	require.Equal(t, uint8(0), state.ExitCode) // woken up, not timed out
+	require.Equal(t, uint64(0), state.ClockOffset)
+}
+
+func TestStateSyscallExitThread(t *testing.T) {
+	for _, traverseRight := range []bool{false, true} {
+		// the next thread is on the stack of threads to run, or only on the other stack
+		for _, flip := range []bool{false, true} {
+			next := testThread(2)
+			state := &fast.VMState{
+				PC:            0x100,
+				Memory:        fast.NewMemory(),
+				Registers:     [32]uint64{17: riscv.SysExit, 10: 3},
+				ThreadID:      1,
+				NextThreadID:  3,
+				TraverseRight: traverseRight,
+				MemoryRegions: fast.UnprotectedRegions(),
+			}
+			*threadStack(state, traverseRight != flip) = []fast.ThreadState{next}
+			state.Memory.SetUnaligned(0x100, syscallInsn)
+
+			stepWitness := runThreadStep(t, state)
+			require.Len(t, stepWitness.ThreadProof, fast.THREAD_PROOF_SIZE)
+
+			require.False(t, state.Exited) // the program continues with the other thread
+			require.Equal(t, next.ThreadID, state.ThreadID)
+			require.Equal(t, next.PC, state.PC)
+			require.Equal(t, next.Registers, state.Registers)
+			require.Equal(t, traverseRight != flip, state.TraverseRight)
+			require.Equal(t, 1, state.ThreadCount())
+		}
+	}
+}
+
+func TestStateBadThreadProof(t *testing.T) {
+	contracts := testContracts(t)
+	addrs := testAddrs
+
+	cases := []struct {
+		name   string
+		modify func(threadProof []byte) []byte
+	}{
+		{name: "missing", modify: func(threadProof []byte) []byte { return nil }},
+		{name: "bad thread", modify: func(threadProof []byte) []byte {
+			threadProof[fast.THREAD_WITNESS_SIZE-1] ^= 1
+			return threadProof
+		}},
+		{name: "bad stack root", modify: func(threadProof []byte) []byte {
+			threadProof[fast.THREAD_PROOF_SIZE-1] ^= 1
+			return threadProof
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := &fast.VMState{
+				PC:                      0x100,
+				Memory:                  fast.NewMemory(),
+				ThreadID:                1,
+				NextThreadID:            4,
+				StepsSinceContextSwitch: riscv.SchedQuantum,
+				LeftThreads:             []fast.ThreadState{testThread(3), testThread(2)},
+				MemoryRegions:           fast.UnprotectedRegions(),
+			}
+
+			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
+			stepWitness, err := fastState.Step(true)
+			require.NoError(t, err)
+			stepWitness.ThreadProof = c.modify(stepWitness.ThreadProof)
+
+			input, err := stepWitness.EncodeStepInput(fast.LocalContext{})
+			require.NoError(t, err)
+			_, err = slow.Step(input, nil)
+			require.ErrorContains(t, err, "revert badf00d2")
+
+			runEVM(t, contracts, addrs, stepWitness, nil, errCodeToByte32(riscv.ErrBadThreadProof))
+		})
+	}
+}
+
+var nopInsn = []byte{0x13, 0x00, 0x00, 0x00} // addi x0, x0, 0
+
+func threadStack(state *fast.VMState, right bool) *[]fast.ThreadState {
+	if right {
+		return &state.RightThreads
+	}
+	return &state.LeftThreads
+}
@@ -18,11 +18,9 @@ import (
 )
 
 func forEachTestSuite(t *testing.T, path string, callItem func(t *testing.T, path string)) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		t.Skipf("missing tests: %s", path)
-	} else {
-		require.NoError(t, err, "failed to stat path")
-	}
+	// a missing category fails rather than skips, so that a suite cannot silently stop running
+	_, err := os.Stat(path)
+	require.NoError(t, err, "missing tests: %s", path)
 	items, err := os.ReadDir(path)
 	require.NoError(t, err, "failed to read dir items")
 	require.NotEmpty(t, items, "expected at least one test suite binary")
@@ -36,13 +34,24 @@ func forEachTestSuite(t *testing.T, path string, callItem func(t *testing.T, pat
 	}
 }
 
-func runFastTestSuite(t *testing.T, path string) {
+// loadTestSuite loads the VM state of a test suite ELF binary.
+// The fence_i test executes code that it writes to its data segment, which W^X forbids:
+// it runs unprotected, with all memory readable, writable and executable.
+func loadTestSuite(t *testing.T, path string) *fast.VMState {
 	testSuiteELF, err := elf.Open(path)
 	require.NoError(t, err)
 	defer testSuiteELF.Close()
 
 	vmState, err := fast.LoadELF(testSuiteELF)
 	require.NoError(t, err, "must load test suite ELF binary")
+	if strings.HasSuffix(path, "-fence_i") {
+		vmState.MemoryRegions = fast.UnprotectedRegions()
+	}
+	return vmState
+}
+
+func runFastTestSuite(t *testing.T, path string) {
+	vmState := loadTestSuite(t, path)
 
 	inState := fast.NewInstrumentedState(vmState, nil, os.Stdout, os.Stderr)
 
@@ -62,13 +71,36 @@ func runFastTestSuite(t *testing.T, path string) {
 	}
 }
 
-func runSlowTestSuite(t *testing.T, path string) {
-	testSuiteELF, err := elf.Open(path)
+// runFastTestSuiteV1 runs a test suite with the VM of StateVersionV1, which ignores the memory regions,
+// and checks that the witnesses have the layout of that version
+func runFastTestSuiteV1(t *testing.T, path string) {
+	vmState := loadTestSuite(t, path)
+	vmState.MemoryRegions = fast.UnprotectedRegions()
+	vs := &fast.VersionedState{Version: fast.StateVersionV1, VMState: vmState}
+
+	inState := vs.CreateVM(nil, os.Stdout, os.Stderr)
+
+	for i := 0; i < 10_000; i++ {
+		wit, err := inState.Step(true)
+		if err != nil {
+			t.Fatalf("VM err at step %d, PC %x: %v", i, vmState.PC, err)
+		}
+		require.Len(t, wit.State, fast.STATE_WITNESS_SIZE_V1)
+		if vmState.Exited {
+			break
+		}
+	}
+	require.True(t, vmState.Exited, "ran out of steps")
+	if vmState.ExitCode != 0 {
+		testCaseNum := vmState.ExitCode >> 1
+		t.Fatalf("failed at test case %d", testCaseNum)
+	}
+	_, err := vs.EncodeWitness().StateHash()
 	require.NoError(t, err)
-	defer testSuiteELF.Close()
+}
 
-	vmState, err := fast.LoadELF(testSuiteELF)
-	require.NoError(t, err, "must load test suite ELF binary")
+func runSlowTestSuite(t *testing.T, path string) {
+	vmState := loadTestSuite(t, path)
 
 	instState := fast.NewInstrumentedState(vmState, nil, nil, nil)
 
@@ -109,12 +141,7 @@ func runEVMTestSuite(t *testing.T, path string) {
 	env := newEVMEnv(t, contracts, addrs)
 	//addTracer(t, env, addrs, contracts)
 
-	testSuiteELF, err := elf.Open(path)
-	require.NoError(t, err)
-	defer testSuiteELF.Close()
-
-	vmState, err := fast.LoadELF(testSuiteELF)
-	require.NoError(t, err, "must load test suite ELF binary")
+	vmState := loadTestSuite(t, path)
 
 	instState := fast.NewInstrumentedState(vmState, nil, nil, nil)
 
@@ -162,9 +189,28 @@ func TestFastStep(t *testing.T) {
 	runTestCategory("rv64ui-p")
 	runTestCategory("rv64um-p")
 	runTestCategory("rv64ua-p")
+	runTestCategory("rv64uc-p")
+	runTestCategory("rv64uf-p")
+	runTestCategory("rv64ud-p")
+	runTestCategory("rv64uzba-p")
+	runTestCategory("rv64uzbb-p")
+	runTestCategory("rv64uzbs-p")
 	//runTestCategory("benchmarks")  TODO benchmarks (fix ELF bench data loading and wrap in Go benchmark?) https://github.com/ethereum-optimism/asterisc/issues/89
 }
 
+// TestFastStepV1 runs the test suites of the extensions that StateVersionV1 supports
+func TestFastStepV1(t *testing.T) {
+	testsPath := filepath.FromSlash("../../tests/riscv-tests")
+	runTestCategory := func(name string) {
+		t.Run(name, func(t *testing.T) {
+			forEachTestSuite(t, filepath.Join(testsPath, name), runFastTestSuiteV1)
+		})
+	}
+	runTestCategory("rv64ui-p")
+	runTestCategory("rv64um-p")
+	runTestCategory("rv64ua-p")
+}
+
 func TestSlowStep(t *testing.T) {
 	testsPath := filepath.FromSlash("../../tests/riscv-tests")
 	runTestCategory := func(name string) {
@@ -175,6 +221,12 @@ func TestSlowStep(t *testing.T) {
 	runTestCategory("rv64ui-p")
 	runTestCategory("rv64um-p")
 	runTestCategory("rv64ua-p")
+	runTestCategory("rv64uc-p")
+	runTestCategory("rv64uf-p")
+	runTestCategory("rv64ud-p")
+	runTestCategory("rv64uzba-p")
+	runTestCategory("rv64uzbb-p")
+	runTestCategory("rv64uzbs-p")
 	//runTestCategory("benchmarks")  TODO benchmarks (fix ELF bench data loading and wrap in Go benchmark?) https://github.com/ethereum-optimism/asterisc/issues/89
 }
 
@@ -188,6 +240,12 @@ func TestEVMStep(t *testing.T) {
 	runTestCategory("rv64ui-p")
 	runTestCategory("rv64um-p")
 	runTestCategory("rv64ua-p")
+	runTestCategory("rv64uc-p")
+	runTestCategory("rv64uf-p")
+	runTestCategory("rv64ud-p")
+	runTestCategory("rv64uzba-p")
+	runTestCategory("rv64uzbb-p")
+	runTestCategory("rv64uzbs-p")
 	//runTestCategory("benchmarks")  TODO benchmarks (fix ELF bench data loading and wrap in Go benchmark?) https://github.com/ethereum-optimism/asterisc/issues/89
 }
 
@@ -227,6 +285,15 @@ func TestVMProofSizes(t *testing.T) {
 			revertCode:       []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xba\xdf\x00\xd1"),
 			expectedEVMPost:  "0x",
 		},
+		{
+			// Revert after proof size checking due to invalid proof, with a thread proof appended
+			name:             "MemProof of length 60*32 with thread proof, revert <nil>",
+			memProof:         make([]byte, 60*32+fast.THREAD_PROOF_SIZE),
+			expectedSlowErr:  "revert badf00d1: revert: bad memory proof, got mem root: 35cd541162972205c2a30d6a7d172f1e8b4584eef5d15a46f835cc3c90492137, expected 14af5385bcbb1e4738bbae8106046e6e2fca42875aa5c000c582587742bcc748",
+			expectedSlowHash: common.Hash{},
+			revertCode:       []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xba\xdf\x00\xd1"),
+			expectedEVMPost:  "0x",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -246,6 +313,7 @@ func TestVMProofSizes(t *testing.T) {
 				LoadReservation: 0,
 				Registers:       [32]uint64{17: uint64(riscv.SysFutex)},
 				Step:            0,
+				MemoryRegions:   fast.UnprotectedRegions(),
 			}
 
 			fastState := fast.NewInstrumentedState(state, nil, os.Stdout, os.Stderr)
@@ -3,6 +3,7 @@ pragma solidity 0.8.25;
 
 import { IPreimageOracle } from "@optimism/src/cannon/interfaces/IPreimageOracle.sol";
 import { IBigStepper } from "@optimism/src/dispute/interfaces/IBigStepper.sol";
+import { RISCVFloat } from "src/RISCVFloat.sol";
 
 /// @title RISCV
 /// @notice The RISCV contract emulates a single RISCV hart cycle statelessly, using memory proofs to verify the
@@ -13,13 +14,17 @@ contract RISCV is IBigStepper {
     /// @notice The preimage oracle contract.
     IPreimageOracle public oracle;
 
+    /// @notice The contract that emulates the floating point arithmetic.
+    RISCVFloat internal fpu;
+
     /// @notice The version of the contract.
-    /// @custom:semver 1.2.0-rc.1
-    string public constant version = "1.2.0-rc.1";
+    /// @custom:semver 1.3.0-rc.1
+    string public constant version = "1.3.0-rc.1";
 
     /// @param _oracle The preimage oracle contract.
     constructor(IPreimageOracle _oracle) {
         oracle = _oracle;
+        fpu = new RISCVFloat();
     }
 
     /// @inheritdoc IBigStepper
@@ -35,6 +40,11 @@ contract RISCV is IBigStepper {
                 out := 0
             }
 
+            function floatPos() -> out {
+                // slot of fpu field
+                out := 1
+            }
+
             //
             // Yul64 - functions to do 64 bit math - see yul64.go
             //
@@ -280,6 +290,55 @@ contract RISCV is IBigStepper {
             function stateSizeRegisters() -> out {
                 out := mul(8, 32)
             }
+            function stateSizeFPRegisters() -> out {
+                out := mul(8, 32)
+            }
+            function stateSizeFCSR() -> out {
+                out := 8
+            }
+            function stateSizeThreadID() -> out {
+                out := 8
+            }
+            function stateSizeFutexAddr() -> out {
+                out := 8
+            }
+            function stateSizeFutexVal() -> out {
+                out := 8
+            }
+            function stateSizeFutexTimeoutStep() -> out {
+                out := 8
+            }
+            function stateSizeStepsSinceContextSwitch() -> out {
+                out := 8
+            }
+            function stateSizeNextThreadID() -> out {
+                out := 8
+            }
+            function stateSizeClockEpoch() -> out {
+                out := 8
+            }
+            function stateSizeClockOffset() -> out {
+                out := 8
+            }
+            function stateSizeRandomState() -> out {
+                out := 8
+            }
+            function stateSizeTraverseRight() -> out {
+                out := 1
+            }
+            function stateSizeLeftThreadStack() -> out {
+                out := 32
+            }
+            function stateSizeRightThreadStack() -> out {
+                out := 32
+            }
+            function stateSizeFreeRangeStack() -> out {
+                out := 32
+            }
+            function stateSizeMemoryRegions() -> out {
+                out := 136 // 17 * 8
+                    //                out := mul(memoryRegionSize(), 8)
+            }
 
             function stateOffsetMemRoot() -> out {
                 out := 0
@@ -320,10 +379,112 @@ contract RISCV is IBigStepper {
                 out := 106 // 98 + 8
                     //                out := add(stateOffsetLoadReservation(), stateSizeLoadReservation())
             }
-            function stateSize() -> out {
+            function stateOffsetFPRegisters() -> out {
                 out := 362 // 106 + 256
                     //                out := add(stateOffsetRegisters(), stateSizeRegisters())
             }
+            function stateOffsetFCSR() -> out {
+                out := 618 // 362 + 256
+                    //                out := add(stateOffsetFPRegisters(), stateSizeFPRegisters())
+            }
+            function stateOffsetThreadID() -> out {
+                out := 626 // 618 + 8
+                    //                out := add(stateOffsetFCSR(), stateSizeFCSR())
+            }
+            function stateOffsetFutexAddr() -> out {
+                out := 634 // 626 + 8
+                    //                out := add(stateOffsetThreadID(), stateSizeThreadID())
+            }
+            function stateOffsetFutexVal() -> out {
+                out := 642 // 634 + 8
+                    //                out := add(stateOffsetFutexAddr(), stateSizeFutexAddr())
+            }
+            function stateOffsetFutexTimeoutStep() -> out {
+                out := 650 // 642 + 8
+                    //                out := add(stateOffsetFutexVal(), stateSizeFutexVal())
+            }
+            function stateOffsetStepsSinceContextSwitch() -> out {
+                out := 658 // 650 + 8
+                    //                out := add(stateOffsetFutexTimeoutStep(), stateSizeFutexTimeoutStep())
+            }
+            function stateOffsetNextThreadID() -> out {
+                out := 666 // 658 + 8
+                    //                out := add(stateOffsetStepsSinceContextSwitch(),
+                    //                    stateSizeStepsSinceContextSwitch())
+            }
+            function stateOffsetClockEpoch() -> out {
+                out := 674 // 666 + 8
+                    //                out := add(stateOffsetNextThreadID(), stateSizeNextThreadID())
+            }
+            function stateOffsetClockOffset() -> out {
+                out := 682 // 674 + 8
+                    //                out := add(stateOffsetClockEpoch(), stateSizeClockEpoch())
+            }
+            function stateOffsetRandomState() -> out {
+                out := 690 // 682 + 8
+                    //                out := add(stateOffsetClockOffset(), stateSizeClockOffset())
+            }
+            function stateOffsetTraverseRight() -> out {
+                out := 698 // 690 + 8
+                    //                out := add(stateOffsetRandomState(), stateSizeRandomState())
+            }
+            function stateOffsetLeftThreadStack() -> out {
+                out := 699 // 698 + 1
+                    //                out := add(stateOffsetTraverseRight(), stateSizeTraverseRight())
+            }
+            function stateOffsetRightThreadStack() -> out {
+                out := 731 // 699 + 32
+                    //                out := add(stateOffsetLeftThreadStack(), stateSizeLeftThreadStack())
+            }
+            function stateOffsetFreeRangeStack() -> out {
+                out := 763 // 731 + 32
+                    //                out := add(stateOffsetRightThreadStack(), stateSizeRightThreadStack())
+            }
+            function stateOffsetMemoryRegions() -> out {
+                out := 795 // 763 + 32
+                    //                out := add(stateOffsetFreeRangeStack(), stateSizeFreeRangeStack())
+            }
+            function stateSize() -> out {
+                out := 931 // 795 + 136
+                    //                out := add(stateOffsetMemoryRegions(), stateSizeMemoryRegions())
+            }
+
+            // A suspended thread is encoded as ThreadID, FutexAddr, FutexVal, FutexTimeoutStep, PC,
+            // Registers, FPRegisters and FCSR: the same fields as the running thread in the state,
+            // but with the PC moved.
+            function threadOffsetPC() -> out {
+                out := 32
+            }
+            function threadOffsetRegisters() -> out {
+                out := 40 // 32 + 8
+            }
+            function threadSize() -> out {
+                out := 560 // 40 + 256 + 256 + 8
+            }
+            function threadProofSize() -> out {
+                // the thread, followed by the root of the thread stack below it
+                out := 592 // 560 + 32
+            }
+
+            // A free range is encoded as Addr and Size.
+            function freeRangeSize() -> out {
+                out := 16 // 8 + 8
+            }
+            function freeRangeProofSize() -> out {
+                // the free range, followed by the root of the free range stack below it
+                out := 48 // 16 + 32
+            }
+
+            // A memory region is encoded as Start, End and Prot.
+            function memoryRegionOffsetEnd() -> out {
+                out := 8
+            }
+            function memoryRegionOffsetProt() -> out {
+                out := 16 // 8 + 8
+            }
+            function memoryRegionSize() -> out {
+                out := 17 // 16 + 1
+            }
 
             //
             // Initial EVM memory / calldata checks
@@ -351,16 +512,26 @@ contract RISCV is IBigStepper {
             }
             function proofContentOffset() -> out {
                 // since we can't reference proof.offset in functions, blame Yul
-                // 132+362+(32-362%32)+32=548
-                out := 548
+                // 132+931+(32-931%32)+32=1124
+                out := 1124
             }
             if iszero(eq(_proof.offset, proofContentOffset())) { revert(0, 0) }
 
-            if mod(calldataload(sub(proofContentOffset(), 32)), mul(60, 32)) {
-                // proof offset must be stateContentOffset+paddedStateSize+32
-                // proof size: 64-5+1=60 * 32 byte leaf,
-                // so the proofSize must be a multiple of 60*32
-                revert(0, 0)
+            {
+                let proofSizeMod := mod(calldataload(sub(proofContentOffset(), 32)), mul(60, 32))
+                if and(
+                    and(iszero(iszero(proofSizeMod)), iszero(eq(proofSizeMod, threadProofSize()))),
+                    and(
+                        iszero(eq(proofSizeMod, freeRangeProofSize())),
+                        iszero(eq(proofSizeMod, mul(2, freeRangeProofSize())))
+                    )
+                ) {
+                    // proof offset must be stateContentOffset+paddedStateSize+32
+                    // proof size: 64-5+1=60 * 32 byte leaf,
+                    // so the proofSize must be a multiple of 60*32,
+                    // optionally followed by a thread proof or one or two free range proofs
+                    revert(0, 0)
+                }
             }
 
             //
@@ -369,8 +540,24 @@ contract RISCV is IBigStepper {
             function memStateOffset() -> out {
                 out := 0x80
             }
+            // scratch memory for the instruction fetch, allocated after the state
+            function memInstrLenSlot() -> out {
+                out := add(memStateOffset(), paddedLen(stateSize()))
+            }
+            function memProofOffsetSlot() -> out {
+                out := add(memInstrLenSlot(), 32)
+            }
+            // scratch memory to encode a thread, rounded up to whole words past the 17 words of registers
+            function memThreadOffset() -> out {
+                out := add(memProofOffsetSlot(), 32)
+            }
+            // scratch memory to count the free ranges that the step popped
+            function memFreeRangePopsSlot() -> out {
+                out := add(memThreadOffset(), 608)
+            }
             // copy the state calldata into memory, so we can mutate it
-            mstore(0x40, add(memStateOffset(), stateSize())) // alloc, update free mem pointer
+            mstore(0x40, add(memFreeRangePopsSlot(), 32)) // alloc, update free mem pointer
+            mstore(memFreeRangePopsSlot(), 0)
             calldatacopy(memStateOffset(), _stateData.offset, stateSize()) // same format in memory as in calldata
 
             //
@@ -473,6 +660,121 @@ contract RISCV is IBigStepper {
                 writeState(offset, 8, v)
             }
 
+            function getFPRegister(reg) -> out {
+                if gt64(reg, toU64(31)) { revertWithCode(0xbad4e9) } // cannot load invalid floating point register
+
+                let offset := add64(toU64(stateOffsetFPRegisters()), mul64(reg, toU64(8)))
+                out := readState(offset, 8)
+            }
+            function setFPRegister(reg, v) {
+                if gt64(reg, toU64(31)) { revertWithCode(0xbad4e9) } // unknown floating point register
+
+                let offset := add64(toU64(stateOffsetFPRegisters()), mul64(reg, toU64(8)))
+                writeState(offset, 8, v)
+            }
+
+            function getFCSR() -> out {
+                out := readState(stateOffsetFCSR(), stateSizeFCSR())
+            }
+            function setFCSR(v) {
+                writeState(stateOffsetFCSR(), stateSizeFCSR(), v)
+            }
+
+            function getThreadID() -> out {
+                out := readState(stateOffsetThreadID(), stateSizeThreadID())
+            }
+
+            function getFutexAddr() -> out {
+                out := readState(stateOffsetFutexAddr(), stateSizeFutexAddr())
+            }
+            function setFutexAddr(addr) {
+                writeState(stateOffsetFutexAddr(), stateSizeFutexAddr(), addr)
+            }
+
+            function getFutexVal() -> out {
+                out := readState(stateOffsetFutexVal(), stateSizeFutexVal())
+            }
+            function setFutexVal(v) {
+                writeState(stateOffsetFutexVal(), stateSizeFutexVal(), v)
+            }
+
+            function getFutexTimeoutStep() -> out {
+                out := readState(stateOffsetFutexTimeoutStep(), stateSizeFutexTimeoutStep())
+            }
+            function setFutexTimeoutStep(v) {
+                writeState(stateOffsetFutexTimeoutStep(), stateSizeFutexTimeoutStep(), v)
+            }
+
+            function getStepsSinceContextSwitch() -> out {
+                out := readState(stateOffsetStepsSinceContextSwitch(), stateSizeStepsSinceContextSwitch())
+            }
+            function setStepsSinceContextSwitch(v) {
+                writeState(stateOffsetStepsSinceContextSwitch(), stateSizeStepsSinceContextSwitch(), v)
+            }
+
+            function getNextThreadID() -> out {
+                out := readState(stateOffsetNextThreadID(), stateSizeNextThreadID())
+            }
+            function setNextThreadID(v) {
+                writeState(stateOffsetNextThreadID(), stateSizeNextThreadID(), v)
+            }
+
+            function getClockEpoch() -> out {
+                out := readState(stateOffsetClockEpoch(), stateSizeClockEpoch())
+            }
+
+            function getClockOffset() -> out {
+                out := readState(stateOffsetClockOffset(), stateSizeClockOffset())
+            }
+            function setClockOffset(v) {
+                writeState(stateOffsetClockOffset(), stateSizeClockOffset(), v)
+            }
+
+            function getRandomState() -> out {
+                out := readState(stateOffsetRandomState(), stateSizeRandomState())
+            }
+            function setRandomState(v) {
+                writeState(stateOffsetRandomState(), stateSizeRandomState(), v)
+            }
+
+            function getTraverseRight() -> out {
+                out := readState(stateOffsetTraverseRight(), stateSizeTraverseRight())
+            }
+            function setTraverseRight(right) {
+                writeState(stateOffsetTraverseRight(), stateSizeTraverseRight(), right)
+            }
+
+            function getThreadStackRoot(right) -> out {
+                switch right
+                case 0 { out := readState(stateOffsetLeftThreadStack(), stateSizeLeftThreadStack()) }
+                default { out := readState(stateOffsetRightThreadStack(), stateSizeRightThreadStack()) }
+            }
+            function setThreadStackRoot(right, v) {
+                switch right
+                case 0 { writeState(stateOffsetLeftThreadStack(), stateSizeLeftThreadStack(), v) }
+                default { writeState(stateOffsetRightThreadStack(), stateSizeRightThreadStack(), v) }
+            }
+
+            function getFreeRangeStackRoot() -> out {
+                out := readState(stateOffsetFreeRangeStack(), stateSizeFreeRangeStack())
+            }
+            function setFreeRangeStackRoot(v) {
+                writeState(stateOffsetFreeRangeStack(), stateSizeFreeRangeStack(), v)
+            }
+
+            function getMemoryRegion(i) -> start, end, prot {
+                let offset := add(stateOffsetMemoryRegions(), mul(i, memoryRegionSize()))
+                start := readState(offset, 8)
+                end := readState(add(offset, memoryRegionOffsetEnd()), 8)
+                prot := readState(add(offset, memoryRegionOffsetProt()), 1)
+            }
+            function setMemoryRegion(i, start, end, prot) {
+                let offset := add(stateOffsetMemoryRegions(), mul(i, memoryRegionSize()))
+                writeState(offset, 8, start)
+                writeState(add(offset, memoryRegionOffsetEnd()), 8, end)
+                writeState(add(offset, memoryRegionOffsetProt()), 1, prot)
+            }
+
             //
             // State output
             //
@@ -574,12 +876,663 @@ contract RISCV is IBigStepper {
                 out := shr64(toU64(25), instr)
             }
 
+            function parseRs3(instr) -> out {
+                out := shr64(toU64(27), instr)
+            }
+
+            //
+            // Compressed - functions to expand compressed RISC-V instructions - see compressed.go
+            //
+            function moveBits(v, from, width, to) -> out {
+                out := shl64(to, and64(shr64(from, v), sub64(shl64(width, toU64(1)), toU64(1))))
+            }
+
+            function parseCRegPrime(instr, from) -> out {
+                out := add64(toU64(8), moveBits(instr, from, toU64(3), toU64(0)))
+            }
+
+            function encodeTypeR(opcode, rd, funct3, rs1, rs2, funct7) -> out {
+                out :=
+                    or64(
+                        or64(
+                            or64(shl64(toU64(25), funct7), shl64(toU64(20), rs2)),
+                            or64(shl64(toU64(15), rs1), shl64(toU64(12), funct3))
+                        ),
+                        or64(shl64(toU64(7), rd), opcode)
+                    )
+            }
+
+            function encodeTypeI(opcode, rd, funct3, rs1, imm) -> out {
+                out :=
+                    or64(
+                        or64(
+                            moveBits(imm, toU64(0), toU64(12), toU64(20)),
+                            or64(shl64(toU64(15), rs1), shl64(toU64(12), funct3))
+                        ),
+                        or64(shl64(toU64(7), rd), opcode)
+                    )
+            }
+
+            function encodeTypeS(opcode, funct3, rs1, rs2, imm) -> out {
+                out :=
+                    or64(
+                        or64(
+                            or64(moveBits(imm, toU64(5), toU64(7), toU64(25)), shl64(toU64(20), rs2)),
+                            or64(shl64(toU64(15), rs1), shl64(toU64(12), funct3))
+                        ),
+                        or64(moveBits(imm, toU64(0), toU64(5), toU64(7)), opcode)
+                    )
+            }
+
+            function encodeTypeB(opcode, funct3, rs1, rs2, imm) -> out {
+                out :=
+                    or64(
+                        or64(
+                            or64(
+                                moveBits(imm, toU64(12), toU64(1), toU64(31)),
+                                moveBits(imm, toU64(5), toU64(6), toU64(25))
+                            ),
+                            or64(shl64(toU64(20), rs2), shl64(toU64(15), rs1))
+                        ),
+                        or64(
+                            or64(shl64(toU64(12), funct3), moveBits(imm, toU64(1), toU64(4), toU64(8))),
+                            or64(moveBits(imm, toU64(11), toU64(1), toU64(7)), opcode)
+                        )
+                    )
+            }
+
+            function encodeTypeU(opcode, rd, imm) -> out {
+                out := or64(moveBits(imm, toU64(0), toU64(20), toU64(12)), or64(shl64(toU64(7), rd), opcode))
+            }
+
+            function encodeTypeJ(opcode, rd, imm) -> out {
+                out :=
+                    or64(
+                        or64(
+                            or64(
+                                moveBits(imm, toU64(20), toU64(1), toU64(31)),
+                                moveBits(imm, toU64(1), toU64(10), toU64(21))
+                            ),
+                            or64(
+                                moveBits(imm, toU64(11), toU64(1), toU64(20)),
+                                moveBits(imm, toU64(12), toU64(8), toU64(12))
+                            )
+                        ),
+                        or64(shl64(toU64(7), rd), opcode)
+                    )
+            }
+
+            // Reserved encodings expand to 0, which is not a valid instruction.
+            function expandCompressed(instr) -> out {
+                switch and64(instr, toU64(3))
+                case 0 { out := expandCompressedQ0(instr) }
+                case 1 { out := expandCompressedQ1(instr) }
+                case 2 { out := expandCompressedQ2(instr) }
+            }
+
+            function expandCompressedQ0(instr) -> out {
+                let rs1 := parseCRegPrime(instr, toU64(7))
+                let rd := parseCRegPrime(instr, toU64(2)) // rd' for loads, rs2' for stores
+                // unsigned offset for word loads and stores: uimm[5:3|2|6]
+                let immW :=
+                    or64(
+                        moveBits(instr, toU64(10), toU64(3), toU64(3)),
+                        or64(
+                            moveBits(instr, toU64(6), toU64(1), toU64(2)),
+                            moveBits(instr, toU64(5), toU64(1), toU64(6))
+                        )
+                    )
+                // unsigned offset for double-word loads and stores: uimm[5:3|7:6]
+                let immD :=
+                    or64(moveBits(instr, toU64(10), toU64(3), toU64(3)), moveBits(instr, toU64(5), toU64(2), toU64(6)))
+                switch moveBits(instr, toU64(13), toU64(3), toU64(0))
+                case 0 {
+                    // C.ADDI4SPN = addi rd', x2, nzuimm[5:4|9:6|2|3]
+                    let imm :=
+                        or64(
+                            or64(
+                                moveBits(instr, toU64(11), toU64(2), toU64(4)),
+                                moveBits(instr, toU64(7), toU64(4), toU64(6))
+                            ),
+                            or64(
+                                moveBits(instr, toU64(6), toU64(1), toU64(2)),
+                                moveBits(instr, toU64(5), toU64(1), toU64(3))
+                            )
+                        )
+                    if iszero(iszero64(imm)) {
+                        // nzuimm=0 is reserved
+                        out := encodeTypeI(toU64(0x13), rd, toU64(0), toU64(2), imm)
+                    }
+                }
+                case 1 {
+                    // C.FLD = fld rd', uimm(rs1')
+                    out := encodeTypeI(toU64(0x07), rd, toU64(3), rs1, immD)
+                }
+                case 2 {
+                    // C.LW = lw rd', uimm(rs1')
+                    out := encodeTypeI(toU64(0x03), rd, toU64(2), rs1, immW)
+                }
+                case 3 {
+                    // C.LD = ld rd', uimm(rs1')
+                    out := encodeTypeI(toU64(0x03), rd, toU64(3), rs1, immD)
+                }
+                case 5 {
+                    // C.FSD = fsd rs2', uimm(rs1')
+                    out := encodeTypeS(toU64(0x27), toU64(3), rs1, rd, immD)
+                }
+                case 6 {
+                    // C.SW = sw rs2', uimm(rs1')
+                    out := encodeTypeS(toU64(0x23), toU64(2), rs1, rd, immW)
+                }
+                case 7 {
+                    // C.SD = sd rs2', uimm(rs1')
+                    out := encodeTypeS(toU64(0x23), toU64(3), rs1, rd, immD)
+                }
+            }
+
+            function expandCompressedQ1(instr) -> out {
+                let rd := moveBits(instr, toU64(7), toU64(5), toU64(0))
+                let rdPrime := parseCRegPrime(instr, toU64(7))
+                // signed immediate: imm[5|4:0]
+                let imm :=
+                    signExtend64(
+                        or64(
+                            moveBits(instr, toU64(12), toU64(1), toU64(5)),
+                            moveBits(instr, toU64(2), toU64(5), toU64(0))
+                        ),
+                        toU64(5)
+                    )
+                switch moveBits(instr, toU64(13), toU64(3), toU64(0))
+                case 0 {
+                    // C.ADDI = addi rd, rd, imm (C.NOP if rd is x0)
+                    out := encodeTypeI(toU64(0x13), rd, toU64(0), rd, imm)
+                }
+                case 1 {
+                    // C.ADDIW = addiw rd, rd, imm
+                    if iszero(iszero64(rd)) {
+                        // rd=x0 is reserved
+                        out := encodeTypeI(toU64(0x1B), rd, toU64(0), rd, imm)
+                    }
+                }
+                case 2 {
+                    // C.LI = addi rd, x0, imm
+                    out := encodeTypeI(toU64(0x13), rd, toU64(0), toU64(0), imm)
+                }
+                case 3 {
+                    switch rd
+                    case 2 {
+                        // C.ADDI16SP = addi x2, x2, nzimm[9|4|6|8:7|5]
+                        let imm16 := parseCImmAddi16sp(instr)
+                        if iszero(iszero64(imm16)) {
+                            // nzimm=0 is reserved
+                            out := encodeTypeI(toU64(0x13), toU64(2), toU64(0), toU64(2), imm16)
+                        }
+                    }
+                    default {
+                        // C.LUI = lui rd, nzimm[17|16:12]
+                        if iszero(iszero64(imm)) {
+                            // nzimm=0 is reserved
+                            out := encodeTypeU(toU64(0x37), rd, imm)
+                        }
+                    }
+                }
+                case 4 { out := expandCompressedArith(instr, rdPrime, imm) }
+                case 5 {
+                    // C.J = jal x0, offset[11|4|9:8|10|6|7|3:1|5]
+                    out := encodeTypeJ(toU64(0x6F), toU64(0), parseCImmTypeJ(instr))
+                }
+                case 6 {
+                    // C.BEQZ = beq rs1', x0, offset
+                    out := encodeTypeB(toU64(0x63), toU64(0), rdPrime, toU64(0), parseCImmTypeB(instr))
+                }
+                case 7 {
+                    // C.BNEZ = bne rs1', x0, offset
+                    out := encodeTypeB(toU64(0x63), toU64(1), rdPrime, toU64(0), parseCImmTypeB(instr))
+                }
+            }
+
+            // expands the C.SRLI, C.SRAI, C.ANDI and register-register arithmetic instructions
+            function expandCompressedArith(instr, rdPrime, imm) -> out {
+                let rs2Prime := parseCRegPrime(instr, toU64(2))
+                // shift amount: shamt[5|4:0]
+                let shamt := and64(imm, toU64(0x3F))
+                switch moveBits(instr, toU64(10), toU64(2), toU64(0))
+                case 0 {
+                    // C.SRLI = srli rd', rd', shamt
+                    out := encodeTypeI(toU64(0x13), rdPrime, toU64(5), rdPrime, shamt)
+                }
+                case 1 {
+                    // C.SRAI = srai rd', rd', shamt
+                    out := encodeTypeI(toU64(0x13), rdPrime, toU64(5), rdPrime, or64(shamt, shortToU64(0x400)))
+                }
+                case 2 {
+                    // C.ANDI = andi rd', rd', imm
+                    out := encodeTypeI(toU64(0x13), rdPrime, toU64(7), rdPrime, imm)
+                }
+                case 3 {
+                    // bit 12 selects the word variants, bits[6:5] the operation
+                    switch or64(
+                        moveBits(instr, toU64(12), toU64(1), toU64(2)),
+                        moveBits(instr, toU64(5), toU64(2), toU64(0))
+                    )
+                    case 0 {
+                        // C.SUB = sub rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x33), rdPrime, toU64(0), rdPrime, rs2Prime, toU64(0x20))
+                    }
+                    case 1 {
+                        // C.XOR = xor rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x33), rdPrime, toU64(4), rdPrime, rs2Prime, toU64(0))
+                    }
+                    case 2 {
+                        // C.OR = or rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x33), rdPrime, toU64(6), rdPrime, rs2Prime, toU64(0))
+                    }
+                    case 3 {
+                        // C.AND = and rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x33), rdPrime, toU64(7), rdPrime, rs2Prime, toU64(0))
+                    }
+                    case 4 {
+                        // C.SUBW = subw rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x3B), rdPrime, toU64(0), rdPrime, rs2Prime, toU64(0x20))
+                    }
+                    case 5 {
+                        // C.ADDW = addw rd', rd', rs2'
+                        out := encodeTypeR(toU64(0x3B), rdPrime, toU64(0), rdPrime, rs2Prime, toU64(0))
+                    }
+                }
+            }
+
+            // parses the signed immediate of C.ADDI16SP: nzimm[9|4|6|8:7|5]
+            function parseCImmAddi16sp(instr) -> out {
+                out :=
+                    signExtend64(
+                        or64(
+                            or64(
+                                moveBits(instr, toU64(12), toU64(1), toU64(9)),
+                                moveBits(instr, toU64(6), toU64(1), toU64(4))
+                            ),
+                            or64(
+                                or64(
+                                    moveBits(instr, toU64(5), toU64(1), toU64(6)),
+                                    moveBits(instr, toU64(3), toU64(2), toU64(7))
+                                ),
+                                moveBits(instr, toU64(2), toU64(1), toU64(5))
+                            )
+                        ),
+                        toU64(9)
+                    )
+            }
+
+            // parses the signed jump offset of C.J: offset[11|4|9:8|10|6|7|3:1|5]
+            function parseCImmTypeJ(instr) -> out {
+                out :=
+                    signExtend64(
+                        or64(
+                            or64(
+                                or64(
+                                    moveBits(instr, toU64(12), toU64(1), toU64(11)),
+                                    moveBits(instr, toU64(11), toU64(1), toU64(4))
+                                ),
+                                or64(
+                                    moveBits(instr, toU64(9), toU64(2), toU64(8)),
+                                    moveBits(instr, toU64(8), toU64(1), toU64(10))
+                                )
+                            ),
+                            or64(
+                                or64(
+                                    moveBits(instr, toU64(7), toU64(1), toU64(6)),
+                                    moveBits(instr, toU64(6), toU64(1), toU64(7))
+                                ),
+                                or64(
+                                    moveBits(instr, toU64(3), toU64(3), toU64(1)),
+                                    moveBits(instr, toU64(2), toU64(1), toU64(5))
+                                )
+                            )
+                        ),
+                        toU64(11)
+                    )
+            }
+
+            // parses the signed branch offset of C.BEQZ and C.BNEZ: offset[8|4:3|7:6|2:1|5]
+            function parseCImmTypeB(instr) -> out {
+                out :=
+                    signExtend64(
+                        or64(
+                            or64(
+                                moveBits(instr, toU64(12), toU64(1), toU64(8)),
+                                moveBits(instr, toU64(10), toU64(2), toU64(3))
+                            ),
+                            or64(
+                                or64(
+                                    moveBits(instr, toU64(5), toU64(2), toU64(6)),
+                                    moveBits(instr, toU64(3), toU64(2), toU64(1))
+                                ),
+                                moveBits(instr, toU64(2), toU64(1), toU64(5))
+                            )
+                        ),
+                        toU64(8)
+                    )
+            }
+
+            function expandCompressedQ2(instr) -> out {
+                let rd := moveBits(instr, toU64(7), toU64(5), toU64(0)) // rd/rs1
+                let rs2 := moveBits(instr, toU64(2), toU64(5), toU64(0))
+                // unsigned offset for double-word stack loads: uimm[5|4:3|8:6]
+                let immLoadD :=
+                    or64(
+                        moveBits(instr, toU64(12), toU64(1), toU64(5)),
+                        or64(
+                            moveBits(instr, toU64(5), toU64(2), toU64(3)),
+                            moveBits(instr, toU64(2), toU64(3), toU64(6))
+                        )
+                    )
+                // unsigned offset for double-word stack stores: uimm[5:3|8:6]
+                let immStoreD :=
+                    or64(moveBits(instr, toU64(10), toU64(3), toU64(3)), moveBits(instr, toU64(7), toU64(3), toU64(6)))
+                switch moveBits(instr, toU64(13), toU64(3), toU64(0))
+                case 0 {
+                    // C.SLLI = slli rd, rd, shamt[5|4:0]
+                    out :=
+                        encodeTypeI(
+                            toU64(0x13),
+                            rd,
+                            toU64(1),
+                            rd,
+                            or64(moveBits(instr, toU64(12), toU64(1), toU64(5)), rs2)
+                        )
+                }
+                case 1 {
+                    // C.FLDSP = fld rd, uimm(x2)
+                    out := encodeTypeI(toU64(0x07), rd, toU64(3), toU64(2), immLoadD)
+                }
+                case 2 {
+                    // C.LWSP = lw rd, uimm[5|4:2|7:6](x2)
+                    if iszero(iszero64(rd)) {
+                        // rd=x0 is reserved
+                        let imm :=
+                            or64(
+                                moveBits(instr, toU64(12), toU64(1), toU64(5)),
+                                or64(
+                                    moveBits(instr, toU64(4), toU64(3), toU64(2)),
+                                    moveBits(instr, toU64(2), toU64(2), toU64(6))
+                                )
+                            )
+                        out := encodeTypeI(toU64(0x03), rd, toU64(2), toU64(2), imm)
+                    }
+                }
+                case 3 {
+                    // C.LDSP = ld rd, uimm(x2)
+                    if iszero(iszero64(rd)) {
+                        // rd=x0 is reserved
+                        out := encodeTypeI(toU64(0x03), rd, toU64(3), toU64(2), immLoadD)
+                    }
+                }
+                case 4 {
+                    switch moveBits(instr, toU64(12), toU64(1), toU64(0))
+                    case 0 {
+                        switch rs2
+                        case 0 {
+                            // C.JR = jalr x0, 0(rs1)
+                            if iszero(iszero64(rd)) {
+                                // rs1=x0 is reserved
+                                out := encodeTypeI(toU64(0x67), toU64(0), toU64(0), rd, toU64(0))
+                            }
+                        }
+                        default {
+                            // C.MV = add rd, x0, rs2
+                            out := encodeTypeR(toU64(0x33), rd, toU64(0), toU64(0), rs2, toU64(0))
+                        }
+                    }
+                    case 1 {
+                        switch rs2
+                        case 0 {
+                            switch rd
+                            case 0 {
+                                // C.EBREAK = ebreak
+                                out := encodeTypeI(toU64(0x73), toU64(0), toU64(0), toU64(0), toU64(1))
+                            }
+                            default {
+                                // C.JALR = jalr x1, 0(rs1)
+                                out := encodeTypeI(toU64(0x67), toU64(1), toU64(0), rd, toU64(0))
+                            }
+                        }
+                        default {
+                            // C.ADD = add rd, rd, rs2
+                            out := encodeTypeR(toU64(0x33), rd, toU64(0), rd, rs2, toU64(0))
+                        }
+                    }
+                }
+                case 5 {
+                    // C.FSDSP = fsd rs2, uimm(x2)
+                    out := encodeTypeS(toU64(0x27), toU64(3), toU64(2), rs2, immStoreD)
+                }
+                case 6 {
+                    // C.SWSP = sw rs2, uimm[5:2|7:6](x2)
+                    let imm :=
+                        or64(
+                            moveBits(instr, toU64(9), toU64(4), toU64(2)),
+                            moveBits(instr, toU64(7), toU64(2), toU64(6))
+                        )
+                    out := encodeTypeS(toU64(0x23), toU64(2), toU64(2), rs2, imm)
+                }
+                case 7 {
+                    // C.SDSP = sd rs2, uimm(x2)
+                    out := encodeTypeS(toU64(0x23), toU64(3), toU64(2), rs2, immStoreD)
+                }
+            }
+
+            //
+            // Bit manipulation - functions to emulate the Zbb and Zbs extensions - see bitmanip.go
+            //
+
+            // returns the index of the most significant set bit of a non-zero value
+            function msb64(x) -> n {
+                for { let i := 32 } gt(i, 0) { i := shr(1, i) } {
+                    if shr64(toU64(i), x) {
+                        x := shr64(toU64(i), x)
+                        n := add64(n, toU64(i))
+                    }
+                }
+            }
+
+            // returns the number of leading zero bits, 64 if x is zero
+            function clz64(x) -> out {
+                switch x
+                case 0 { out := toU64(64) }
+                default { out := sub64(toU64(63), msb64(x)) }
+            }
+
+            // returns the number of trailing zero bits, 64 if x is zero
+            function ctz64(x) -> out {
+                switch x
+                case 0 { out := toU64(64) }
+                default { out := msb64(and64(x, sub64(toU64(0), x))) } // x & -x isolates the lowest set bit
+            }
+
+            // returns the number of leading zero bits of the lower 32 bits, 32 if those are zero
+            function clz32(x) -> out {
+                out := sub64(clz64(and64(x, u32Mask())), toU64(32))
+            }
+
+            // returns the number of trailing zero bits of the lower 32 bits, 32 if those are zero
+            function ctz32(x) -> out {
+                out := ctz64(or64(x, shl64(toU64(32), toU64(1))))
+            }
+
+            // returns the number of set bits
+            function cpop64(x) -> n {
+                for { let i := 0 } lt(i, 64) { i := add(i, 1) } {
+                    n := add64(n, and64(shr64(toU64(i), x), toU64(1)))
+                }
+            }
+
+            // sets each byte to all ones if any of its bits are set, and to zero otherwise
+            function orcb64(x) -> out {
+                for { let i := 0 } lt(i, 64) { i := add(i, 8) } {
+                    if and64(shr64(toU64(i), x), toU64(0xff)) { out := or64(out, shl64(toU64(i), toU64(0xff))) }
+                }
+            }
+
+            // reverses the order of the bytes
+            function rev864(x) -> out {
+                for { let i := 0 } lt(i, 64) { i := add(i, 8) } {
+                    out := or64(out, shl64(toU64(sub(56, i)), and64(shr64(toU64(i), x), toU64(0xff))))
+                }
+            }
+
+            // rotates x left by the lower 6 bits of n
+            function rol64(x, n) -> out {
+                n := and64(n, toU64(0x3F))
+                out := or64(shl64(n, x), shr64(sub64(toU64(64), n), x))
+            }
+
+            // rotates x right by the lower 6 bits of n
+            function ror64(x, n) -> out {
+                n := and64(n, toU64(0x3F))
+                out := or64(shr64(n, x), shl64(sub64(toU64(64), n), x))
+            }
+
+            // rotates the lower 32 bits of x left by the lower 5 bits of n, and sign-extends the result
+            function rol32(x, n) -> out {
+                x := and64(x, u32Mask())
+                n := and64(n, toU64(0x1F))
+                out := mask32Signed64(or64(shl64(n, x), shr64(sub64(toU64(32), n), x)))
+            }
+
+            // rotates the lower 32 bits of x right by the lower 5 bits of n, and sign-extends the result
+            function ror32(x, n) -> out {
+                x := and64(x, u32Mask())
+                n := and64(n, toU64(0x1F))
+                out := mask32Signed64(or64(shr64(n, x), shl64(sub64(toU64(32), n), x)))
+            }
+
+            // returns a mask with only the bit at the lower 6 bits of n set
+            function bit64(n) -> out {
+                out := shl64(and64(n, toU64(0x3F)), toU64(1))
+            }
+
+            //
+            // Memory permissions - see vm.go
+            //
+            // Memory is readable and writable, except in the memory regions of the state.
+            // The regions are page-aligned and do not overlap, and unused regions are zero.
+            //
+            function protDefault() -> out {
+                out := 3 // PROT_READ | PROT_WRITE
+            }
+
+            // uses the first unused memory region for the given range. There must be an unused region.
+            function addMemoryRegion(start, end, prot) {
+                for { let i := 0 } lt(i, 8) { i := add(i, 1) } {
+                    let rStart, rEnd, rProt := getMemoryRegion(i)
+                    if iszero(lt64(rStart, rEnd)) {
+                        setMemoryRegion(i, start, end, prot)
+                        leave
+                    }
+                }
+            }
+
+            // returns the permissions of the memory at the given address
+            function getProt(addr) -> out {
+                out := protDefault()
+                for { let i := 0 } lt(i, 8) { i := add(i, 1) } {
+                    let start, end, prot := getMemoryRegion(i)
+                    if and(iszero(lt64(addr, start)), lt64(addr, end)) {
+                        out := prot
+                        leave
+                    }
+                }
+            }
+
+            // ends the program with a fault, unless the size bytes at addr all have the given permissions.
+            // Regions are page-aligned, so it is enough to check the first and the last byte.
+            function checkMemAccess(addr, size, prot) {
+                let last := add64(addr, sub64(size, toU64(1)))
+                if or(iszero(eq(and(getProt(addr), prot), prot)), iszero(eq(and(getProt(last), prot), prot))) {
+                    setExitCode(139) // as of a process killed by SIGSEGV
+                    setExited()
+                    mstore(0, computeStateHash())
+                    return(0, 0x20)
+                }
+            }
+
+            // sets the permissions of the non-empty page-aligned range [start, end).
+            // Regions that overlap the range are cut back, and a region that extends on both sides of the range is
+            // split. It returns false, without any change, if there are not enough unused regions.
+            function protectRange(start, end, prot) -> ok {
+                let available := 0
+                let needed := iszero(eq(prot, protDefault()))
+                for { let i := 0 } lt(i, 8) { i := add(i, 1) } {
+                    let rStart, rEnd, rProt := getMemoryRegion(i)
+                    switch or(iszero(lt64(rStart, rEnd)), and(iszero(lt64(rStart, start)), iszero(lt64(end, rEnd))))
+                    case 1 {
+                        // unused, or covered
+                        available := add(available, 1)
+                    }
+                    default {
+                        if and(iszero(lt64(start, rStart)), iszero(lt64(rEnd, end))) {
+                            // the region contains the range
+                            if eq(rProt, prot) {
+                                ok := 1
+                                leave
+                            }
+                            if and(lt64(rStart, start), lt64(end, rEnd)) { needed := add(needed, 1) }
+                        }
+                    }
+                }
+                if lt(available, needed) { leave }
+                // a split region only gets its upper part back after the covered regions are cleared
+                let splitEnd := 0
+                let splitProt := 0
+                for { let i := 0 } lt(i, 8) { i := add(i, 1) } {
+                    let rStart, rEnd, rProt := getMemoryRegion(i)
+                    if and(lt64(rStart, end), lt64(start, rEnd)) {
+                        switch lt64(rStart, start)
+                        case 1 {
+                            setMemoryRegion(i, rStart, start, rProt)
+                            if lt64(end, rEnd) {
+                                splitEnd := rEnd
+                                splitProt := rProt
+                            }
+                        }
+                        default {
+                            switch lt64(end, rEnd)
+                            case 1 { setMemoryRegion(i, end, rEnd, rProt) }
+                            default { setMemoryRegion(i, 0, 0, 0) }
+                        }
+                    }
+                }
+                if splitEnd { addMemoryRegion(end, splitEnd, splitProt) }
+                if iszero(eq(prot, protDefault())) { addMemoryRegion(start, end, prot) }
+                ok := 1
+            }
+
+            // returns the number of unused memory regions
+            function unusedMemoryRegions() -> out {
+                for { let i := 0 } lt(i, 8) { i := add(i, 1) } {
+                    let start, end, prot := getMemoryRegion(i)
+                    if iszero(lt64(start, end)) { out := add(out, 1) }
+                }
+            }
+
+            // returns the permissions for the prot argument of mmap and mprotect.
+            // PROT_NONE only reserves memory, which gets the default permissions of data.
+            function mapProt(prot) -> out {
+                out := and64(prot, toU64(7)) // PROT_READ | PROT_WRITE | PROT_EXEC
+                if iszero64(out) { out := protDefault() }
+            }
+
+            // returns whether the permissions allow both writes and execution, which W^X forbids
+            function isWritableExec(prot) -> out {
+                out := eq(and64(prot, toU64(6)), toU64(6)) // PROT_WRITE | PROT_EXEC
+            }
+
             //
             // Memory functions
             //
             function proofOffset(proofIndex) -> offset {
                 // proof size: 64-5+1=60 (a 64-bit mem-address branch to 32 byte leaf, incl leaf itself), all 32 bytes
-                offset := mul64(mul64(toU64(proofIndex), toU64(60)), toU64(32))
+                offset := mul64(mul64(add64(toU64(proofIndex), getMemProofOffset()), toU64(60)), toU64(32))
                 offset := add64(offset, proofContentOffset())
             }
 
@@ -641,6 +1594,7 @@ contract RISCV is IBigStepper {
             // load unaligned, optionally signed, little-endian, integer of 1 ... 8 bytes from memory
             function loadMem(addr, size, signed, proofIndexL, proofIndexR) -> out {
                 if gt(size, 8) { revertWithCode(0xbad512e0) } // cannot load more than 8 bytes
+                checkMemAccess(addr, size, 1) // PROT_READ
                 // load/verify left part
                 let leftAddr := and64(addr, not64(toU64(31)))
                 let left := b32asBEWord(getMemoryB32(leftAddr, proofIndexL))
@@ -729,6 +1683,7 @@ contract RISCV is IBigStepper {
 
             function storeMemUnaligned(addr, size, value, proofIndexL, proofIndexR) {
                 if gt(size, 32) { revertWithCode(0xbad512e1) } // cannot store more than 32 bytes
+                checkMemAccess(addr, size, 2) // PROT_WRITE
 
                 let leftAddr := and64(addr, not64(toU64(31)))
                 let rightAddr := and64(add64(addr, sub64(size, toU64(1))), not64(toU64(31)))
@@ -760,6 +1715,291 @@ contract RISCV is IBigStepper {
                 storeMemUnaligned(addr, size, u64ToU256(value), proofIndexL, proofIndexR)
             }
 
+            // loads the seconds and nanoseconds of a timespec struct, starting at the given proof index.
+            // The nanoseconds are loaded with the memory proofs after the ones used for the seconds.
+            function loadTimespec(addr, proofIndex) -> sec, nsec {
+                sec := loadMem(addr, toU64(8), false, proofIndex, add(proofIndex, 1))
+                if iszero(eq(and64(add64(addr, toU64(7)), not64(toU64(31))), and64(addr, not64(toU64(31))))) {
+                    proofIndex := add(proofIndex, 1) // the seconds span two leaves
+                }
+                nsec := loadMem(add64(addr, toU64(8)), toU64(8), false, add(proofIndex, 1), add(proofIndex, 2))
+            }
+
+            // returns whether the seconds and nanoseconds of a timespec struct are a valid duration
+            function validTimespec(sec, nsec) -> out {
+                out := and(iszero64(shr64(toU64(63), sec)), lt64(nsec, toU64(1000000000))) // NanosPerSecond
+            }
+
+            // returns the number of steps a FUTEX_WAIT with the given timeout of a timespec struct waits,
+            // one step per nanosecond of the virtual clock, up to FutexTimeoutSteps.
+            // The clock jumps over the rest of the timeout once the wait times out.
+            function futexWaitSteps(sec, nsec) -> out {
+                out := add64(mul64(sec, toU64(1000000000)), nsec) // NanosPerSecond
+                if iszero64(lt64(out, toU64(100000))) { out := toU64(100000) } // FutexTimeoutSteps
+            }
+
+            // zeroes the aligned block of 2**sizeBits bytes at the given address, a block of at least a page.
+            // The memory proof of the first leaf of the block also proves the block: the siblings above it are the
+            // same.
+            function zeroMemoryBlock(addr, sizeBits, proofIndex) {
+                pop(getMemoryB32(addr, proofIndex)) // verify the memory proof
+                let levels := sub(sizeBits, 5) // the levels of the tree within the block
+                // skip the leaf, and the siblings within the block
+                let offset := add64(proofOffset(proofIndex), toU64(mul(32, add(levels, 1))))
+                let path := shr64(sizeBits, addr)
+                let node := 0xffd70157e48063fc33c97a050f7f640233bf646cc98d9524c6b92bcf3ab56f83 // a page of zeroes
+                for { let i := 12 } lt(i, sizeBits) { i := add(i, 1) } { node := hashPair(node, node) }
+                for { let i := 0 } lt(i, sub(59, levels)) { i := add(i, 1) } {
+                    let sibling := calldataload(offset)
+                    offset := add64(offset, toU64(32))
+                    switch and64(shr64(toU64(i), path), toU64(1))
+                    case 0 { node := hashPair(node, sibling) }
+                    case 1 { node := hashPair(sibling, node) }
+                }
+                setMemRoot(node) // store new memRoot
+            }
+
+            //
+            // Memory allocation
+            //
+            // mmap allocates from the free range at the top of the free range stack if it fits, and grows the heap
+            // otherwise. munmap releases the largest aligned block of the range per step, and pushes the block onto the
+            // free range stack, or extends the range at the top of the stack if the block directly follows it.
+            //
+            // MAP_FIXED below the heap carves its range out of the free range at the top of the stack, and pushes a
+            // mapped range, marked with the low bit of its address, between them: the free ranges below a mapped range
+            // may overlap it. mmap carves a mapped range out of the free range below it before it allocates, one range
+            // per step, and mapped ranges that meet on the stack merge into the range that spans them both.
+            //
+            function freeRangeStackEmpty() -> out {
+                out := iszero(getFreeRangeStackRoot())
+            }
+
+            function freeRangeHash(addr, size) -> out {
+                mstore(0, shl(192, addr))
+                mstore(8, shl(192, size))
+                out := keccak256(0, freeRangeSize())
+            }
+
+            function pushFreeRange(addr, size) {
+                setFreeRangeStackRoot(hashPair(getFreeRangeStackRoot(), freeRangeHash(addr, size)))
+            }
+
+            // removes the range at the top of the free range stack.
+            // The range and the root of the stack below it are provided by the free range proof, at the end of the
+            // proof. A step pops at most two ranges, the proof of the second pop follows the proof of the first.
+            function popFreeRange() -> addr, size {
+                let proofSize := calldataload(sub(proofContentOffset(), 32))
+                let proofSizeMod := mod(proofSize, mul(60, 32))
+                let pops := mload(memFreeRangePopsSlot())
+                if or(
+                    and(
+                        iszero(eq(proofSizeMod, freeRangeProofSize())),
+                        iszero(eq(proofSizeMod, mul(2, freeRangeProofSize())))
+                    ),
+                    lt(proofSizeMod, mul(add(pops, 1), freeRangeProofSize()))
+                ) {
+                    revertWithCode(0xbadf00d3) // missing free range proof
+                }
+                let offset :=
+                    add(sub(add(proofContentOffset(), proofSize), proofSizeMod), mul(pops, freeRangeProofSize()))
+                mstore(memFreeRangePopsSlot(), add(pops, 1))
+                addr := shr(192, calldataload(offset))
+                size := shr(192, calldataload(add(offset, 8)))
+                let innerRoot := calldataload(add(offset, freeRangeSize()))
+                if iszero(eq(hashPair(innerRoot, freeRangeHash(addr, size)), getFreeRangeStackRoot())) {
+                    revertWithCode(0xbadf00d3) // bad free range proof
+                }
+                setFreeRangeStackRoot(innerRoot)
+            }
+
+            // maps the page-aligned range at the given address.
+            // If the range ends above the heap, the heap grows to its end, and any gap below the range becomes free.
+            function mapRange(addr, length) {
+                let heap := getHeap()
+                let end := add64(addr, length)
+                if lt64(heap, end) {
+                    if lt64(heap, addr) { pushFreeRange(heap, sub64(addr, heap)) }
+                    setHeap(end)
+                }
+            }
+
+            function isMappedRange(addr) -> out {
+                out := and64(addr, toU64(1))
+            }
+
+            // pushes the mapped range from addr to end, merged with the mapped range at mergeAddr and mergeEnd
+            function pushMappedRange(addr, end, mergeAddr, mergeEnd) {
+                if lt64(mergeAddr, addr) { addr := mergeAddr }
+                if lt64(end, mergeEnd) { end := mergeEnd }
+                pushFreeRange(or64(addr, toU64(1)), sub64(end, addr))
+            }
+
+            // pushes what remains of the free range at rangeAddr with rangeSize, without the range from addr to end
+            function pushCarvedRange(rangeAddr, rangeSize, addr, end) {
+                let rangeEnd := add64(rangeAddr, rangeSize)
+                if lt64(rangeAddr, addr) {
+                    let leftEnd := addr
+                    if lt64(rangeEnd, addr) { leftEnd := rangeEnd }
+                    pushFreeRange(rangeAddr, sub64(leftEnd, rangeAddr))
+                }
+                if lt64(end, rangeEnd) {
+                    let rightAddr := end
+                    if lt64(end, rangeAddr) { rightAddr := rangeAddr }
+                    pushFreeRange(rightAddr, sub64(rangeEnd, rightAddr))
+                }
+            }
+
+            // carves the range from addr to end, that MAP_FIXED maps, out of the free ranges below the heap
+            function carveFixedRange(addr, end) {
+                let heap := getHeap()
+                if or(iszero64(lt64(addr, heap)), freeRangeStackEmpty()) { leave }
+                if lt64(heap, end) { end := heap } // all memory above the heap is free, and not on the stack
+                let rangeAddr, rangeSize := popFreeRange()
+                if isMappedRange(rangeAddr) {
+                    rangeAddr := xor64(rangeAddr, toU64(1))
+                    pushMappedRange(addr, end, rangeAddr, add64(rangeAddr, rangeSize))
+                    leave
+                }
+                // the free ranges further below are carved when mmap reaches them
+                if iszero(freeRangeStackEmpty()) { pushMappedRange(addr, end, addr, end) }
+                pushCarvedRange(rangeAddr, rangeSize, addr, end)
+            }
+
+            // allocates a page-aligned range of the given length, and returns its address.
+            // If a mapped range is at the top of the free range stack, it carves that out of the range below it
+            // instead, and returns retry: the syscall has to run again.
+            function allocRange(length) -> addr, errCode, retry {
+                if iszero(freeRangeStackEmpty()) {
+                    let rangeAddr, rangeSize := popFreeRange()
+                    if isMappedRange(rangeAddr) {
+                        rangeAddr := xor64(rangeAddr, toU64(1))
+                        let rangeEnd := add64(rangeAddr, rangeSize)
+                        // a mapped range at the bottom of the stack is dropped
+                        if iszero(freeRangeStackEmpty()) {
+                            let belowAddr, belowSize := popFreeRange()
+                            switch isMappedRange(belowAddr)
+                            case 0 {
+                                if iszero(freeRangeStackEmpty()) {
+                                    pushMappedRange(rangeAddr, rangeEnd, rangeAddr, rangeEnd)
+                                }
+                                pushCarvedRange(belowAddr, belowSize, rangeAddr, rangeEnd)
+                            }
+                            default {
+                                belowAddr := xor64(belowAddr, toU64(1))
+                                pushMappedRange(rangeAddr, rangeEnd, belowAddr, add64(belowAddr, belowSize))
+                            }
+                        }
+                        addr := u64Mask()
+                        errCode := toU64(0)
+                        retry := 1
+                        leave
+                    }
+                    if iszero64(lt64(rangeSize, length)) {
+                        // the range fits, the remainder stays free
+                        if iszero(eq64(rangeSize, length)) {
+                            pushFreeRange(add64(rangeAddr, length), sub64(rangeSize, length))
+                        }
+                        addr := rangeAddr
+                        errCode := toU64(0)
+                        leave
+                    }
+                    pushFreeRange(rangeAddr, rangeSize) // too small, keep it for smaller allocations
+                }
+                let heap := getHeap()
+                if lt64(add64(heap, length), heap) {
+                    addr := u64Mask()
+                    errCode := toU64(0xc) // ENOMEM
+                    leave
+                }
+                setHeap(add64(heap, length))
+                addr := heap
+                errCode := toU64(0)
+            }
+
+            // maps the page-aligned range of the given length without MAP_FIXED: at the hinted address if
+            // nothing is mapped there, or else where it allocates the range
+            function mmapHinted(addr, length, prot) -> out, errCode, retry {
+                out := addr
+                let end := add64(addr, length)
+                switch lt(unusedMemoryRegions(), 2)
+                case 1 {
+                    // the range may split a memory region: keep an unused region for that, and one for the range
+                    out := u64Mask()
+                    errCode := toU64(0xc) // ENOMEM
+                }
+                default {
+                    switch and(
+                        and(iszero64(iszero64(addr)), iszero64(and64(addr, shortToU64(4095)))),
+                        and(iszero64(lt64(addr, getHeap())), iszero64(lt64(end, addr)))
+                    )
+                    case 1 {
+                        // the hint is above the heap, where nothing is mapped: allow the hinted address
+                        mapRange(addr, length)
+                    }
+                    default {
+                        // No usable hint, allocate it ourselves, by as much as the requested length.
+                        out, errCode, retry := allocRange(length)
+                    }
+                    // the check above kept enough unused regions for this
+                    if and(iszero64(errCode), iszero(retry)) {
+                        pop(protectRange(out, add64(out, length), prot))
+                    }
+                }
+            }
+
+            // maps the page-aligned range of the given length at exactly the given address, for MAP_FIXED
+            function mmapFixed(addr, length, prot) -> out, errCode {
+                out := addr
+                let end := add64(addr, length)
+                // Any existing mapping is replaced, but keeps its contents: the Go runtime only maps fixed ranges
+                // that it reserved before, and that are still zero.
+                switch or(and64(addr, shortToU64(4095)), lt64(end, addr))
+                case 0 {
+                    switch protectRange(addr, end, prot)
+                    case 1 {
+                        carveFixedRange(addr, end)
+                        mapRange(addr, length)
+                    }
+                    default {
+                        out := u64Mask()
+                        errCode := toU64(0xc) // ENOMEM
+                    }
+                }
+                default {
+                    out := u64Mask()
+                    errCode := toU64(0x16) // EINVAL
+                }
+            }
+
+            // makes the unmapped page-aligned range at the given address free, as far as it is below the heap
+            function freeRange(addr, size) {
+                let heap := getHeap()
+                if iszero64(lt64(addr, heap)) { leave } // all memory above the heap is free already
+                if lt64(sub64(heap, addr), size) { size := sub64(heap, addr) }
+                if iszero(freeRangeStackEmpty()) {
+                    let rangeAddr, rangeSize := popFreeRange()
+                    // a mapped range has an odd address, and never matches
+                    if eq64(add64(rangeAddr, rangeSize), addr) {
+                        pushFreeRange(rangeAddr, add64(rangeSize, size))
+                        leave
+                    }
+                    pushFreeRange(rangeAddr, rangeSize)
+                }
+                pushFreeRange(addr, size)
+            }
+
+            // returns the size bits of the block that munmap releases in a step: the largest aligned block at the
+            // page-aligned address that fits in the length, or the page at the address if the length is less than a
+            // page.
+            function unmapBlockBits(addr, length) -> bits {
+                bits := 12
+                for { } lt(bits, 63) { bits := add(bits, 1) } {
+                    let next := shl64(toU64(add(bits, 1)), toU64(1))
+                    if or(and64(addr, sub64(next, toU64(1))), lt64(length, next)) { break }
+                }
+            }
+
             //
             // Preimage oracle interactions
             //
@@ -769,6 +2009,7 @@ contract RISCV is IBigStepper {
                 let maxData := sub64(toU64(32), alignment)
                 if gt64(count, maxData) { count := maxData }
 
+                checkMemAccess(addr, toU64(1), 1) // PROT_READ, the leaf is within a page
                 let dat := b32asBEWord(getMemoryB32(sub64(addr, alignment), 1))
                 // shift out leading bits
                 dat := shl(u64ToU256(shl64(toU64(3), alignment)), dat)
@@ -835,6 +2076,7 @@ contract RISCV is IBigStepper {
                     out := toU64(0)
                     leave
                 }
+                checkMemAccess(addr, toU64(1), 2) // PROT_WRITE, the leaf is within a page
                 let alignment := and64(addr, toU64(31)) // how many bytes addr is offset from being left-aligned
                 let maxData := sub64(toU64(32), alignment) // higher alignment leaves less room for data this step
                 if gt64(count, maxData) { count := maxData }
@@ -863,6 +2105,164 @@ contract RISCV is IBigStepper {
                 setMemoryB32(sub64(addr_, alignment), beWordAsB32(dat), 1)
             }
 
+            //
+            // Clock
+            //
+
+            // returns the time of the virtual clock in nanoseconds:
+            // one nanosecond for every step before the current one, plus the time that threads slept.
+            function getMonotonicTime() -> out {
+                out := add64(sub64(getStep(), toU64(1)), getClockOffset())
+            }
+
+            //
+            // Random - the SplitMix64 PRNG that getrandom draws from - see random.go
+            //
+
+            // advances the PRNG state, to draw the next value
+            function nextRandomState(state) -> out {
+                out := add64(state, toU64(0x9e3779b97f4a7c15)) // RandomGamma
+            }
+
+            // mixes the PRNG state into a pseudo-random value
+            function randomValue(state) -> out {
+                let z := mul64(xor64(state, shr64(toU64(30), state)), toU64(0xbf58476d1ce4e5b9)) // RandomMix1
+                z := mul64(xor64(z, shr64(toU64(27), z)), toU64(0x94d049bb133111eb)) // RandomMix2
+                out := xor64(z, shr64(toU64(31), z))
+            }
+
+            //
+            // Threads
+            //
+            // The running thread is part of the state. All other threads are suspended on two stacks:
+            // the scheduler pops the next thread to run from one stack, and pushes the preempted thread onto the other.
+            // Once the stack of threads to run is empty, the stacks swap roles by flipping the traversal direction.
+            // Each stack is committed to as a hash onion: pushing a thread hashes the root with the hash of the thread.
+            //
+            function threadStackEmpty(right) -> out {
+                out := iszero(getThreadStackRoot(right))
+            }
+
+            // encodes the running thread into the thread scratch memory
+            function encodeActiveThread() {
+                let p := memThreadOffset()
+                // ThreadID, FutexAddr, FutexVal and FutexTimeoutStep
+                mstore(p, mload(add(memStateOffset(), stateOffsetThreadID())))
+                mstore(add(p, threadOffsetPC()), shl(192, getPC()))
+                // Registers, FPRegisters and FCSR
+                for { let i := 0 } lt(i, sub(threadSize(), threadOffsetRegisters())) { i := add(i, 32) } {
+                    mstore(
+                        add(add(p, threadOffsetRegisters()), i),
+                        mload(add(add(memStateOffset(), stateOffsetRegisters()), i))
+                    )
+                }
+            }
+
+            // overwrites a big-endian field of the thread in the thread scratch memory
+            function writeThread(offset, length, data) {
+                let memOffset := add(memThreadOffset(), offset)
+                let mask := shl(shl(3, sub(32, length)), not(0))
+                let prev := mload(memOffset)
+                data := shl(shl(3, sub(32, length)), data)
+                mstore(memOffset, or(and(prev, not(mask)), data))
+            }
+
+            function threadHash() -> out {
+                out := keccak256(memThreadOffset(), threadSize())
+            }
+
+            function pushThread(right, h) {
+                setThreadStackRoot(right, hashPair(getThreadStackRoot(right), h))
+            }
+
+            // resumes the thread at the top of the given stack, replacing the running thread.
+            // The thread and the root of the stack below it are provided by the thread proof, at the end of the proof.
+            function popThread(right) {
+                let proofSize := calldataload(sub(proofContentOffset(), 32))
+                if iszero(eq(mod(proofSize, mul(60, 32)), threadProofSize())) {
+                    revertWithCode(0xbadf00d2) // missing thread proof
+                }
+                let offset := sub(add(proofContentOffset(), proofSize), threadProofSize())
+                calldatacopy(memThreadOffset(), offset, threadSize())
+                let innerRoot := calldataload(add(offset, threadSize()))
+                if iszero(eq(hashPair(innerRoot, threadHash()), getThreadStackRoot(right))) {
+                    revertWithCode(0xbadf00d2) // bad thread proof
+                }
+                setThreadStackRoot(right, innerRoot)
+                // ThreadID, FutexAddr, FutexVal and FutexTimeoutStep
+                calldatacopy(add(memStateOffset(), stateOffsetThreadID()), offset, threadOffsetPC())
+                setPC(shr(192, mload(add(memThreadOffset(), threadOffsetPC()))))
+                // Registers, FPRegisters and FCSR
+                calldatacopy(
+                    add(memStateOffset(), stateOffsetRegisters()),
+                    add(offset, threadOffsetRegisters()),
+                    sub(threadSize(), threadOffsetRegisters())
+                )
+            }
+
+            // suspends the running thread, and resumes the next thread, if there is any other thread.
+            // If there is no thread left to run in the current traversal direction, the direction is flipped first.
+            function preemptThread() {
+                let right := getTraverseRight()
+                if threadStackEmpty(right) {
+                    // the only thread keeps running
+                    if threadStackEmpty(iszero(right)) { leave }
+                    right := iszero(right)
+                    setTraverseRight(right)
+                }
+                encodeActiveThread()
+                pushThread(iszero(right), threadHash())
+                popThread(right)
+                setStepsSinceContextSwitch(toU64(0))
+                setLoadReservation(toU64(0))
+            }
+
+            // drops the running thread, and resumes the next thread. There must be another thread.
+            function exitThread() {
+                let right := getTraverseRight()
+                if threadStackEmpty(right) {
+                    right := iszero(right)
+                    setTraverseRight(right)
+                }
+                popThread(right)
+                setStepsSinceContextSwitch(toU64(0))
+                setLoadReservation(toU64(0))
+            }
+
+            // makes the running thread get preempted at the start of the next step
+            function yieldThread() {
+                setStepsSinceContextSwitch(toU64(100000)) // SchedQuantum
+            }
+
+            // ends the FUTEX_WAIT of the running thread, with the given syscall return values
+            function wakeFutex(ret, errCode) {
+                setFutexAddr(toU64(0))
+                setFutexVal(toU64(0))
+                setFutexTimeoutStep(toU64(0))
+                setRegister(toU64(10), ret)
+                setRegister(toU64(11), errCode)
+            }
+
+            // returns the error code of a FUTEX_WAIT, or 0 if the thread blocks
+            function futexWaitErr(addr, val, timeout) -> errCode {
+                switch iszero64(addr)
+                case 1 { errCode := toU64(0xe) } // EFAULT
+                default {
+                    switch and64(addr, toU64(3))
+                    case 0 {
+                        switch eq64(loadMem(addr, toU64(4), false, 1, 0xff), and64(val, u32Mask()))
+                        case 0 { errCode := toU64(0xb) } // EAGAIN
+                        default {
+                            if iszero64(iszero64(timeout)) {
+                                let sec, nsec := loadTimespec(timeout, 2)
+                                if iszero(validTimespec(sec, nsec)) { errCode := toU64(0x16) } // EINVAL
+                            }
+                        }
+                    }
+                    default { errCode := toU64(0x16) } // EINVAL
+                }
+            }
+
             //
             // Syscall handling
             //
@@ -870,11 +2270,16 @@ contract RISCV is IBigStepper {
                 let a7 := getRegister(toU64(17))
                 switch a7
                 case 93 {
-                    // exit the calling thread. No multi-thread support yet, so just exit.
-                    let a0 := getRegister(toU64(10))
-                    setExitCode(and(a0, 0xff))
-                    setExited()
-                    // program stops here, no need to change registers.
+                    // exit the calling thread
+                    switch and(threadStackEmpty(0), threadStackEmpty(1))
+                    case 1 {
+                        // the last thread exits the program
+                        let a0 := getRegister(toU64(10))
+                        setExitCode(and(a0, 0xff))
+                        setExited()
+                        // program stops here, no need to change registers.
+                    }
+                    default { exitThread() }
                 }
                 case 94 {
                     // exit-group
@@ -898,7 +2303,8 @@ contract RISCV is IBigStepper {
                     let addr := getRegister(toU64(10))
                     // A1 = n (length)
                     let length := getRegister(toU64(11))
-                    // A2 = prot (memory protection type, can ignore)
+                    // A2 = prot (memory permissions)
+                    let prot := mapProt(getRegister(toU64(12)))
                     // A3 = flags (shared with other process and or written back to file)
                     let flags := getRegister(toU64(13))
                     // A4 = fd (file descriptor, can ignore because we support anon memory only)
@@ -906,29 +2312,114 @@ contract RISCV is IBigStepper {
                     // A5 = offset (offset in file, we don't support any non-anon memory, so we can ignore this)
 
                     let errCode := 0
-                    // ensure MAP_ANONYMOUS is set and fd == -1
+                    let retry := 0
+
+                    // Increase the length to align it with the page size if necessary.
+                    // A length that overflows when aligned becomes 0, and is invalid.
+                    length := and64(add64(length, shortToU64(4095)), not64(shortToU64(4095)))
                     switch or(iszero(and(flags, 0x20)), iszero(eq(fd, u64Mask())))
                     case 1 {
+                        // ensure MAP_ANONYMOUS is set and fd == -1
                         addr := u64Mask()
-                        errCode := toU64(0x4d)
+                        errCode := toU64(0x4d) // EBADF
                     }
                     default {
-                        switch addr
-                        case 0 {
-                            // No hint, allocate it ourselves, by as much as the requested length.
-                            // Increase the length to align it with desired page size if necessary.
-                            let align := and64(length, shortToU64(4095))
-                            if align { length := add64(length, sub64(shortToU64(4096), align)) }
-                            let prevHeap := getHeap()
-                            addr := prevHeap
-                            setHeap(add64(prevHeap, length)) // increment heap with length
+                        switch iszero64(length)
+                        case 1 {
+                            addr := u64Mask()
+                            errCode := toU64(0x16) // EINVAL
                         }
                         default {
-                            // allow hinted memory address (leave it in A0 as return argument)
+                            switch isWritableExec(prot)
+                            case 1 {
+                                addr := u64Mask()
+                                errCode := toU64(0xd) // EACCES
+                            }
+                            default {
+                                switch and(flags, 0x10)
+                                case 0 { addr, errCode, retry := mmapHinted(addr, length, prot) }
+                                default { addr, errCode := mmapFixed(addr, length, prot) }
+                            }
                         }
                     }
 
-                    setRegister(toU64(10), addr)
+                    switch retry
+                    case 0 {
+                        setRegister(toU64(10), addr)
+                        setRegister(toU64(11), errCode)
+                    }
+                    default {
+                        // a mapped range was carved out of the free ranges: run the ecall again, with the same
+                        // arguments
+                        setPC(sub64(getPC(), toU64(4)))
+                    }
+                }
+                case 215 {
+                    // munmap - releases one aligned block per step, the syscall restarts until the range is released
+                    let addr := getRegister(toU64(10)) // A0 = addr
+                    let length := getRegister(toU64(11)) // A1 = length
+                    // the end of the range, aligned up. It is not above addr if the length is zero, or if the range
+                    // overflows.
+                    let end := and64(add64(add64(addr, length), shortToU64(4095)), not64(shortToU64(4095)))
+                    switch or(and64(addr, shortToU64(4095)), iszero64(lt64(addr, end)))
+                    case 0 {
+                        // the released range gets the permissions of data again, which may split a region.
+                        // When the syscall restarts, the rest of the range has them already.
+                        switch protectRange(addr, end, protDefault())
+                        case 0 {
+                            setRegister(toU64(10), u64Mask())
+                            setRegister(toU64(11), toU64(0xc)) // ENOMEM
+                        }
+                        default {
+                            let sizeBits := unmapBlockBits(addr, length)
+                            let size := shl64(toU64(sizeBits), toU64(1))
+                            zeroMemoryBlock(addr, sizeBits, 1)
+                            freeRange(addr, size)
+                            switch lt64(size, length)
+                            case 0 {
+                                setRegister(toU64(10), toU64(0))
+                                setRegister(toU64(11), toU64(0))
+                            }
+                            default {
+                                // continue with the next block: run the ecall again, with the remaining range
+                                setRegister(toU64(10), add64(addr, size))
+                                setRegister(toU64(11), sub64(length, size))
+                                setPC(sub64(getPC(), toU64(4)))
+                            }
+                        }
+                    }
+                    default {
+                        setRegister(toU64(10), u64Mask())
+                        setRegister(toU64(11), toU64(0x16)) // EINVAL
+                    }
+                }
+                case 226 {
+                    // mprotect
+                    let addr := getRegister(toU64(10)) // A0 = addr
+                    let length := getRegister(toU64(11)) // A1 = length
+                    let prot := mapProt(getRegister(toU64(12))) // A2 = prot
+                    let alignedLength := and64(add64(length, shortToU64(4095)), not64(shortToU64(4095)))
+                    let end := add64(addr, alignedLength)
+                    let errCode := 0
+                    switch and64(addr, shortToU64(4095))
+                    case 0 {
+                        switch isWritableExec(prot)
+                        case 1 { errCode := toU64(0xd) } // EACCES
+                        default {
+                            switch or(lt64(end, addr), lt64(alignedLength, length))
+                            case 1 { errCode := toU64(0xc) } // ENOMEM: the range overflows
+                            default {
+                                // and() does not short-circuit: an empty range must not reach protectRange
+                                if iszero64(iszero64(alignedLength)) {
+                                    if iszero(protectRange(addr, end, prot)) { errCode := toU64(0xc) } // ENOMEM
+                                }
+                            }
+                        }
+                    }
+                    default { errCode := toU64(0x16) } // EINVAL
+                    switch errCode
+                    case 0 { setRegister(toU64(10), toU64(0)) }
+                    default { setRegister(toU64(10), u64Mask()) }
                     setRegister(toU64(11), errCode)
                 }
                 case 63 {
@@ -1092,17 +2583,41 @@ contract RISCV is IBigStepper {
                 }
                 case 113 {
                     // clock_gettime
-                    let addr := getRegister(toU64(11)) // addr of timespec struct
-                    // write 1337s + 42ns as time
-                    let value := or(shortToU256(1337), shl(shortToU256(64), toU256(42)))
+                    let clockID := getRegister(toU64(10)) // A0 = clock ID
+                    let addr := getRegister(toU64(11)) // A1 = addr of timespec struct
+                    let t := getMonotonicTime()
+                    // ClockRealtime, ClockRealtimeCoarse
+                    if or(eq64(clockID, toU64(0)), eq64(clockID, toU64(5))) { t := add64(t, getClockEpoch()) }
+                    // write the seconds, and the nanoseconds within the second
+                    let sec := div64(t, toU64(1000000000)) // NanosPerSecond
+                    let nsec := mod64(t, toU64(1000000000))
+                    let value := or(u64ToU256(sec), shl(toU256(64), u64ToU256(nsec)))
                     storeMemUnaligned(addr, toU64(16), value, 1, 2)
                     setRegister(toU64(10), toU64(0))
                     setRegister(toU64(11), toU64(0))
                 }
                 case 220 {
-                    // clone - not supported
-                    setRegister(toU64(10), toU64(1))
-                    setRegister(toU64(11), toU64(0))
+                    // clone - only threads are supported, with the flags that the Go runtime uses
+                    let flags := getRegister(toU64(10)) // A0 = flags
+                    let stack := getRegister(toU64(11)) // A1 = stack pointer of the new thread
+                    switch eq64(flags, toU64(0x50f00)) // CloneThreadFlags
+                    case 0 {
+                        setRegister(toU64(10), u64Mask())
+                        setRegister(toU64(11), toU64(0x16)) // EINVAL
+                    }
+                    default {
+                        // the child continues after the ecall, like the parent, but on the new stack
+                        let childID := getNextThreadID()
+                        encodeActiveThread()
+                        writeThread(0, 8, childID)
+                        writeThread(add(threadOffsetRegisters(), 16), 8, stack)
+                        writeThread(add(threadOffsetRegisters(), 80), 16, 0) // the child sees clone return 0
+                        // the child runs next, it is pushed onto the stack of threads to run
+                        pushThread(getTraverseRight(), threadHash())
+                        setNextThreadID(add64(childID, toU64(1)))
+                        setRegister(toU64(10), childID)
+                        setRegister(toU64(11), toU64(0))
+                    }
                 }
                 case 163 {
                     // getrlimit
@@ -1125,13 +2640,89 @@ contract RISCV is IBigStepper {
                     // prlimit64 -- unsupported, we have getrlimit, is prlimit64 even called?
                     revertWithCode(0xf001ca11) // unsupported system call
                 }
-                case 422 {
-                    // futex - not supported, for now
-                    revertWithCode(0xf001ca11) // unsupported system call
+                case 98 {
+                    // futex - only wait and wake are supported
+                    let addr := getRegister(toU64(10)) // A0 = *uaddr
+                    let op := getRegister(toU64(11)) // A1 = futex_op
+                    let val := getRegister(toU64(12)) // A2 = val
+                    let timeout := getRegister(toU64(13)) // A3 = *timeout, or 0 to wait without timeout
+                    switch and64(op, toU64(0x7f)) // FutexCmdMask
+                    case 0 {
+                        // FUTEX_WAIT
+                        let errCode := futexWaitErr(addr, val, timeout)
+                        switch errCode
+                        case 0 {
+                            // the thread blocks: the return values are set once it is woken up
+                            setFutexAddr(addr)
+                            setFutexVal(and64(val, u32Mask()))
+                            switch iszero64(timeout)
+                            case 1 { setFutexTimeoutStep(u64Mask()) }
+                            default {
+                                let sec, nsec := loadTimespec(timeout, 2)
+                                setFutexTimeoutStep(add64(getStep(), futexWaitSteps(sec, nsec)))
+                            }
+                        }
+                        default {
+                            setRegister(toU64(10), u64Mask())
+                            setRegister(toU64(11), errCode)
+                        }
+                    }
+                    case 1 {
+                        // FUTEX_WAKE
+                        // waiting threads check their futex when they are scheduled, yield to let them run
+                        setRegister(toU64(10), toU64(0))
+                        setRegister(toU64(11), toU64(0))
+                        yieldThread()
+                    }
+                    default {
+                        setRegister(toU64(10), u64Mask())
+                        setRegister(toU64(11), toU64(0x16)) // EINVAL
+                    }
                 }
                 case 101 {
-                    // nanosleep - not supported, for now
-                    revertWithCode(0xf001ca11) // unsupported system call
+                    // nanosleep - advance the clock by the duration, and yield to other threads
+                    // threads are interleaved on a single hart: waiting for the clock to reach the end of the sleep
+                    // would only spend steps, the clock jumps ahead instead.
+                    // A0 = addr of timespec struct with the duration
+                    let sec, nsec := loadTimespec(getRegister(toU64(10)), 1)
+                    switch validTimespec(sec, nsec)
+                    case 1 {
+                        setClockOffset(add64(getClockOffset(), add64(mul64(sec, toU64(1000000000)), nsec)))
+                        setRegister(toU64(10), toU64(0))
+                        setRegister(toU64(11), toU64(0))
+                        yieldThread()
+                    }
+                    default {
+                        setRegister(toU64(10), u64Mask())
+                        setRegister(toU64(11), toU64(0x16)) // EINVAL
+                    }
+                }
+                case 124 {
+                    // sched_yield
+                    setRegister(toU64(10), toU64(0))
+                    setRegister(toU64(11), toU64(0))
+                    yieldThread()
+                }
+                case 278 {
+                    // getrandom - fill the buffer with the next value of the PRNG
+                    let addr := getRegister(toU64(10)) // A0 = *buf addr
+                    let count := getRegister(toU64(11)) // A1 = count
+                    // A2 = flags, can ignore: the PRNG never blocks
+                    // fill at most one value, the caller retries for the remaining bytes, like with a partial read
+                    let n := count
+                    if lt64(toU64(8), n) { n := toU64(8) } // RandomMaxBytes
+                    if iszero(iszero64(n)) {
+                        let state := nextRandomState(getRandomState())
+                        setRandomState(state)
+                        storeMem(addr, n, randomValue(state), 1, 2)
+                    }
+                    setRegister(toU64(10), n)
+                    setRegister(toU64(11), toU64(0))
+                }
+                case 178 {
+                    // gettid
+                    setRegister(toU64(10), getThreadID())
+                    setRegister(toU64(11), toU64(0))
                 }
                 default {
                     // Ignore(no-op) unsupported system calls
@@ -1140,6 +2731,151 @@ contract RISCV is IBigStepper {
                 }
             }
 
+            //
+            // Floating point - the arithmetic is emulated in software by the RISCVFloat contract
+            //
+
+            // sets the given exception flags in the fflags field of fcsr
+            function accrueFPFlags(flags) {
+                setFCSR(or64(getFCSR(), flags))
+            }
+
+            // executes an OP-FP instruction, or one of FMADD, FMSUB, FNMSUB and FNMADD
+            function execFloat(instr) {
+                let addr := sload(floatPos()) // calling RISCVFloat.execute(uint64,uint64,uint64,uint64,uint64,uint64)
+                let memPtr := mload(0x40) // get pointer to free memory for the call
+                mstore(memPtr, shl(224, 0xf921ce75)) // (32-4)*8=224: right-pad the function selector
+                mstore(add(memPtr, 0x04), instr)
+                mstore(add(memPtr, 0x24), getFPRegister(parseRs1(instr)))
+                mstore(add(memPtr, 0x44), getFPRegister(parseRs2(instr)))
+                mstore(add(memPtr, 0x64), getFPRegister(parseRs3(instr)))
+                mstore(add(memPtr, 0x84), getRegister(parseRs1(instr)))
+                mstore(add(memPtr, 0xa4), getFCSR())
+                if iszero(staticcall(gas(), addr, memPtr, 0xc4, memPtr, 0x60)) {
+                    // an invalid instruction reverts with the same code as the other instructions
+                    returndatacopy(0, 0, returndatasize())
+                    revert(0, returndatasize())
+                }
+                if iszero(eq(returndatasize(), 0x60)) { revertWithCode(0xbadf10a7) } // no RISCVFloat contract
+                switch mload(add(memPtr, 0x40))
+                case 0 { setFPRegister(parseRd(instr), mload(memPtr)) }
+                default { setRegister(parseRd(instr), mload(memPtr)) }
+                accrueFPFlags(mload(add(memPtr, 0x20)))
+            }
+
+            //
+            // CSRs - only the user-level CSRs have a state, all others read as zero and ignore writes
+            //
+
+            function readCSR(num) -> out {
+                switch num
+                case 0x001 {
+                    // fflags
+                    out := and64(getFCSR(), toU64(0x1f))
+                }
+                case 0x002 {
+                    // frm
+                    out := and64(shr64(toU64(5), getFCSR()), toU64(7))
+                }
+                case 0x003 {
+                    // fcsr
+                    out := and64(getFCSR(), toU64(0xff))
+                }
+                // every step executes one instruction, which takes one cycle.
+                // The counters do not include the current instruction, the step counter does.
+                case 0xC00 {
+                    // cycle
+                    out := sub64(getStep(), toU64(1))
+                }
+                case 0xC01 {
+                    // time: the virtual clock, the timer ticks every nanosecond
+                    out := getMonotonicTime()
+                }
+                case 0xC02 {
+                    // instret
+                    out := sub64(getStep(), toU64(1))
+                }
+                case 0xF14 {
+                    // mhartid: always hart 0, threads are interleaved on a single hart
+                    out := toU64(0)
+                }
+                default { out := toU64(0) }
+            }
+
+            function writeCSR(num, v) {
+                // CSRs with the top 2 bits set are read-only
+                if eq64(shr64(toU64(10), num), toU64(3)) { revertWithCode(0xbadc0de) } // cannot write read-only CSR
+                switch num
+                case 0x001 {
+                    // fflags
+                    setFCSR(or64(and64(getFCSR(), toU64(0xe0)), and64(v, toU64(0x1f))))
+                }
+                case 0x002 {
+                    // frm
+                    setFCSR(or64(and64(getFCSR(), toU64(0x1f)), shl64(toU64(5), and64(v, toU64(7)))))
+                }
+                case 0x003 {
+                    // fcsr
+                    setFCSR(and64(v, toU64(0xff)))
+                }
+            }
+
+            //
+            // Instruction fetch
+            //
+            function getInstrLen() -> out {
+                out := mload(memInstrLenSlot())
+            }
+            function setInstrLen(v) {
+                mstore(memInstrLenSlot(), v)
+            }
+
+            function getMemProofOffset() -> out {
+                out := mload(memProofOffsetSlot())
+            }
+            function setMemProofOffset(v) {
+                mstore(memProofOffsetSlot(), v)
+            }
+
+            // reads the little-endian halfword at the given byte offset within a 32-byte leaf
+            function leafHalfword(leaf, alignment) -> out {
+                let v := u256ToU64(shr(u64ToU256(shl64(toU64(3), sub64(toU64(30), alignment))), b32asBEWord(leaf)))
+                out := or64(shl64(toU64(8), and64(v, toU64(0xff))), and64(shr64(toU64(8), v), toU64(0xff)))
+            }
+
+            // loads the instruction at the given PC, and expands it if it is a compressed instruction
+            function fetchInstr(_pc) -> out {
+                if and64(_pc, toU64(1)) {
+                    // quick PC alignment check
+                    revertWithCode(0xbad10ad0) // pc not aligned with 2 bytes
+                }
+                checkMemAccess(_pc, toU64(2), 4) // PROT_EXEC
+                let leftAddr := and64(_pc, not64(toU64(31)))
+                let alignment := sub64(_pc, leftAddr)
+                let left := getMemoryB32(leftAddr, 0)
+                out := leafHalfword(left, alignment) // an aligned halfword never crosses a leaf
+                // the lowest 2 bits are 11 for all but compressed instructions
+                switch eq64(and64(out, toU64(3)), toU64(3))
+                case 0 {
+                    setInstrLen(toU64(2))
+                    out := expandCompressed(out)
+                    if iszero64(out) { revertWithCode(0xbadc0de) } // reserved compressed instruction encoding
+                }
+                default {
+                    setInstrLen(toU64(4))
+                    checkMemAccess(add64(_pc, toU64(2)), toU64(2), 4) // PROT_EXEC
+                    let upper := 0
+                    switch alignment
+                    case 30 {
+                        // the upper half of the instruction is in the next leaf
+                        upper := leafHalfword(getMemoryB32(add64(leftAddr, toU64(32)), 1), toU64(0))
+                        setMemProofOffset(toU64(1))
+                    }
+                    default { upper := leafHalfword(left, add64(alignment, toU64(2))) }
+                    out := or64(out, shl64(toU64(16), upper))
+                }
+            }
+
             //
             // Instruction execution
             //
@@ -1150,8 +2886,40 @@ contract RISCV is IBigStepper {
             }
             setStep(add64(getStep(), toU64(1)))
 
+            // a thread that waits on a futex does not run until it is woken up, this step only checks the futex
+            if getFutexAddr() {
+                switch eq64(loadMem(getFutexAddr(), toU64(4), false, 0, 0xff), getFutexVal())
+                case 0 { wakeFutex(toU64(0), toU64(0)) }
+                default {
+                    switch gt64(getStep(), getFutexTimeoutStep())
+                    case 0 { preemptThread() }
+                    default {
+                        // the steps of the wait advanced the clock by up to FutexTimeoutSteps, like nanosleep the
+                        // clock jumps ahead by the rest of the timeout, that the thread still points to with A3
+                        let sec, nsec := loadTimespec(getRegister(toU64(13)), 1)
+                        let timeout := add64(mul64(sec, toU64(1000000000)), nsec) // NanosPerSecond
+                        setClockOffset(add64(getClockOffset(), sub64(timeout, futexWaitSteps(sec, nsec))))
+                        wakeFutex(u64Mask(), toU64(0x6e)) // ETIMEDOUT
+                    }
+                }
+                mstore(0, computeStateHash())
+                return(0, 0x20)
+            }
+
+            // if there are other threads, the running thread is preempted once it used up its time slice,
+            // this step then only switches threads
+            if iszero(and(threadStackEmpty(0), threadStackEmpty(1))) {
+                if iszero64(lt64(getStepsSinceContextSwitch(), toU64(100000))) {
+                    // SchedQuantum
+                    preemptThread()
+                    mstore(0, computeStateHash())
+                    return(0, 0x20)
+                }
+                setStepsSinceContextSwitch(add64(getStepsSinceContextSwitch(), toU64(1)))
+            }
+
             let _pc := getPC()
-            let instr := loadMem(_pc, toU64(4), false, 0, 0xff) // raw instruction
+            let instr := fetchInstr(_pc) // raw instruction, expanded if compressed
 
             // these fields are ignored if not applicable to the instruction type / opcode
             let opcode := parseOpcode(instr)
@@ -1177,7 +2945,7 @@ contract RISCV is IBigStepper {
                 let memIndex := add64(rs1Value, signExtend64(imm, toU64(11)))
                 let rdValue := loadMem(memIndex, size, signed, 1, 2)
                 setRegister(rd, rdValue)
-                setPC(add64(pc_, toU64(4)))
+                setPC(add64(pc_, getInstrLen()))
             }
             case 0x23 {
                 let pc_ := _pc
@@ -1189,7 +2957,7 @@ contract RISCV is IBigStepper {
                 let rs1Value := getRegister(rs1)
                 let memIndex := add64(rs1Value, signExtend64(imm, toU64(11)))
                 storeMem(memIndex, size, value, 1, 2)
-                setPC(add64(pc_, toU64(4)))
+                setPC(add64(pc_, getInstrLen()))
             }
             case 0x63 {
                 // 110_0011: branching
@@ -1222,7 +2990,7 @@ contract RISCV is IBigStepper {
                     branchHit := and64(not64(lt64(rs1Value, rs2Value)), toU64(1))
                 }
                 switch branchHit
-                case 0 { _pc := add64(_pc, toU64(4)) }
+                case 0 { _pc := add64(_pc, getInstrLen()) }
                 default {
                     let imm := parseImmTypeB(instr)
                     // imm12 is a signed offset, in multiples of 2 bytes.
@@ -1230,8 +2998,8 @@ contract RISCV is IBigStepper {
                     _pc := add64(_pc, imm)
                 }
 
-                // The PC must be aligned to 4 bytes.
-                if and64(_pc, toU64(3)) { revertWithCode(0xbad10ad0) } // target not aligned with 4 bytes
+                // The PC must be aligned to 2 bytes, since compressed instructions are supported.
+                if and64(_pc, toU64(1)) { revertWithCode(0xbad10ad0) } // target not aligned with 2 bytes
 
                 // not like the other opcodes: nothing to write to rd register, and PC has already changed
                 setPC(_pc)
@@ -1247,8 +3015,51 @@ contract RISCV is IBigStepper {
                     rdValue := add64(rs1Value, imm)
                 }
                 case 1 {
-                    // 001 = SLLI
-                    rdValue := shl64(and64(imm, toU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
+                    // 001 = SLLI and Zbb/Zbs ops
+                    switch shr64(toU64(6), imm)
+                    // in rv64i the top 6 bits select the shift type
+                    case 0x00 {
+                        // 000000 = SLLI
+                        rdValue := shl64(and64(imm, toU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
+                    }
+                    case 0x0A {
+                        // 001010 = BSETI
+                        rdValue := or64(rs1Value, bit64(imm))
+                    }
+                    case 0x12 {
+                        // 010010 = BCLRI
+                        rdValue := and64(rs1Value, not64(bit64(imm)))
+                    }
+                    case 0x1A {
+                        // 011010 = BINVI
+                        rdValue := xor64(rs1Value, bit64(imm))
+                    }
+                    case 0x18 {
+                        // 011000 = Zbb unary ops, selected by the lower 6 bits
+                        switch and64(imm, toU64(0x3F))
+                        case 0 {
+                            // 000000 = CLZ
+                            rdValue := clz64(rs1Value)
+                        }
+                        case 1 {
+                            // 000001 = CTZ
+                            rdValue := ctz64(rs1Value)
+                        }
+                        case 2 {
+                            // 000010 = CPOP
+                            rdValue := cpop64(rs1Value)
+                        }
+                        case 4 {
+                            // 000100 = SEXT.B
+                            rdValue := signExtend64(and64(rs1Value, toU64(0xFF)), toU64(7))
+                        }
+                        case 5 {
+                            // 000101 = SEXT.H
+                            rdValue := signExtend64(and64(rs1Value, shortToU64(0xFFFF)), toU64(15))
+                        }
+                        default { revertWithCode(0xbadc0de) }
+                    }
+                    default { revertWithCode(0xbadc0de) }
                 }
                 case 2 {
                     // 010 = SLTI
@@ -1274,6 +3085,24 @@ contract RISCV is IBigStepper {
                         // 010000 = SRAI
                         rdValue := sar64(and64(imm, toU64(0x3F)), rs1Value) // lower 6 bits in 64 bit mode
                     }
+                    case 0x12 {
+                        // 010010 = BEXTI
+                        rdValue := and64(shr64(and64(imm, toU64(0x3F)), rs1Value), toU64(1))
+                    }
+                    case 0x18 {
+                        // 011000 = RORI
+                        rdValue := ror64(rs1Value, imm)
+                    }
+                    case 0x0A {
+                        // 001010 = ORC.B
+                        if iszero(eq(and64(imm, toU64(0x3F)), 0x07)) { revertWithCode(0xbadc0de) }
+                        rdValue := orcb64(rs1Value)
+                    }
+                    case 0x1A {
+                        // 011010 = REV8
+                        if iszero(eq(and64(imm, toU64(0x3F)), 0x38)) { revertWithCode(0xbadc0de) }
+                        rdValue := rev864(rs1Value)
+                    }
                     default { revertWithCode(0xbadc0de) }
                 }
                 case 6 {
@@ -1286,7 +3115,7 @@ contract RISCV is IBigStepper {
                 }
                 default { revertWithCode(0xbadc0de) }
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x1B {
                 // 001_1011: immediate arithmetic and logic signed 32 bit
@@ -1299,14 +3128,41 @@ contract RISCV is IBigStepper {
                     rdValue := mask32Signed64(add64(rs1Value, imm))
                 }
                 case 1 {
-                    // 001 = SLLIW
+                    // 001 = SLLIW and Zba/Zbb ops
+                    switch shr64(toU64(6), imm)
+                    // top 6 bits select the operation
+                    case 0x00 {
+                        // 000000 = SLLIW
 
-                    // SLLIW where imm[5] != 0 is reserved
-                    if and64(imm, toU64(0x20)) { revertWithCode(0xbadc0de) }
-                    rdValue := mask32Signed64(shl64(and64(imm, toU64(0x1F)), rs1Value))
+                        // SLLIW where imm[5] != 0 is reserved
+                        if and64(imm, toU64(0x20)) { revertWithCode(0xbadc0de) }
+                        rdValue := mask32Signed64(shl64(and64(imm, toU64(0x1F)), rs1Value))
+                    }
+                    case 0x02 {
+                        // 000010 = SLLI.UW
+                        rdValue := shl64(and64(imm, toU64(0x3F)), and64(rs1Value, u32Mask()))
+                    }
+                    case 0x18 {
+                        // 011000 = Zbb unary ops on 32 bits, selected by the lower 6 bits
+                        switch and64(imm, toU64(0x3F))
+                        case 0 {
+                            // 000000 = CLZW
+                            rdValue := clz32(rs1Value)
+                        }
+                        case 1 {
+                            // 000001 = CTZW
+                            rdValue := ctz32(rs1Value)
+                        }
+                        case 2 {
+                            // 000010 = CPOPW
+                            rdValue := cpop64(and64(rs1Value, u32Mask()))
+                        }
+                        default { revertWithCode(0xbadc0de) }
+                    }
+                    default { revertWithCode(0xbadc0de) }
                 }
                 case 5 {
-                    // SRLIW and SRAIW where imm[5] != 0 is reserved
+                    // SRLIW, SRAIW and RORIW where imm[5] != 0 is reserved
                     if and64(imm, toU64(0x20)) { revertWithCode(0xbadc0de) }
 
                     // 101 = SR~
@@ -1321,11 +3177,15 @@ contract RISCV is IBigStepper {
                         // 0100000 = SRAIW
                         rdValue := signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), sub64(toU64(31), shamt))
                     }
+                    case 0x30 {
+                        // 0110000 = RORIW
+                        rdValue := ror32(rs1Value, shamt)
+                    }
                     default { revertWithCode(0xbadc0de) }
                 }
                 default { revertWithCode(0xbadc0de) }
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x33 {
                 // 011_0011: register arithmetic and logic
@@ -1395,24 +3255,77 @@ contract RISCV is IBigStepper {
                         default { revertWithCode(0xbadc0de) }
                     }
                     case 1 {
-                        // 001 = SLL
-                        rdValue := shl64(and64(rs2Value, toU64(0x3F)), rs1Value) // only the low 6 bits are consider in
-                            // RV6VI
+                        // 001 = SLL and Zbb/Zbs ops
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = SLL
+                            rdValue := shl64(and64(rs2Value, toU64(0x3F)), rs1Value) // only the low 6 bits are
+                                // consider in RV6VI
+                        }
+                        case 0x14 {
+                            // 0010100 = BSET
+                            rdValue := or64(rs1Value, bit64(rs2Value))
+                        }
+                        case 0x24 {
+                            // 0100100 = BCLR
+                            rdValue := and64(rs1Value, not64(bit64(rs2Value)))
+                        }
+                        case 0x34 {
+                            // 0110100 = BINV
+                            rdValue := xor64(rs1Value, bit64(rs2Value))
+                        }
+                        case 0x30 {
+                            // 0110000 = ROL
+                            rdValue := rol64(rs1Value, rs2Value)
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 2 {
-                        // 010 = SLT
-                        rdValue := slt64(rs1Value, rs2Value)
+                        // 010 = SLT and SH1ADD
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = SLT
+                            rdValue := slt64(rs1Value, rs2Value)
+                        }
+                        case 0x10 {
+                            // 0010000 = SH1ADD
+                            rdValue := add64(shl64(toU64(1), rs1Value), rs2Value)
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 3 {
                         // 011 = SLTU
-                        rdValue := lt64(rs1Value, rs2Value)
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = SLTU
+                            rdValue := lt64(rs1Value, rs2Value)
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 4 {
-                        // 100 = XOR
-                        rdValue := xor64(rs1Value, rs2Value)
+                        // 100 = XOR, and Zba/Zbb ops
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = XOR
+                            rdValue := xor64(rs1Value, rs2Value)
+                        }
+                        case 0x20 {
+                            // 0100000 = XNOR
+                            rdValue := not64(xor64(rs1Value, rs2Value))
+                        }
+                        case 0x10 {
+                            // 0010000 = SH2ADD
+                            rdValue := add64(shl64(toU64(2), rs1Value), rs2Value)
+                        }
+                        case 0x05 {
+                            // 0000101 = MIN
+                            rdValue := rs1Value
+                            if slt64(rs2Value, rs1Value) { rdValue := rs2Value }
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 5 {
-                        // 101 = SR~
+                        // 101 = SR~, and Zbb/Zbs ops
                         switch funct7
                         case 0x00 {
                             // 0000000 = SRL
@@ -1422,20 +3335,65 @@ contract RISCV is IBigStepper {
                             // 0100000 = SRA
                             rdValue := sar64(and64(rs2Value, toU64(0x3F)), rs1Value) // arithmetic: sign bit is extended
                         }
+                        case 0x24 {
+                            // 0100100 = BEXT
+                            rdValue := and64(shr64(and64(rs2Value, toU64(0x3F)), rs1Value), toU64(1))
+                        }
+                        case 0x30 {
+                            // 0110000 = ROR
+                            rdValue := ror64(rs1Value, rs2Value)
+                        }
+                        case 0x05 {
+                            // 0000101 = MINU
+                            rdValue := rs1Value
+                            if lt64(rs2Value, rs1Value) { rdValue := rs2Value }
+                        }
                         default { revertWithCode(0xbadc0de) }
                     }
                     case 6 {
-                        // 110 = OR
-                        rdValue := or64(rs1Value, rs2Value)
+                        // 110 = OR, and Zba/Zbb ops
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = OR
+                            rdValue := or64(rs1Value, rs2Value)
+                        }
+                        case 0x20 {
+                            // 0100000 = ORN
+                            rdValue := or64(rs1Value, not64(rs2Value))
+                        }
+                        case 0x10 {
+                            // 0010000 = SH3ADD
+                            rdValue := add64(shl64(toU64(3), rs1Value), rs2Value)
+                        }
+                        case 0x05 {
+                            // 0000101 = MAX
+                            rdValue := rs1Value
+                            if sgt64(rs2Value, rs1Value) { rdValue := rs2Value }
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 7 {
-                        // 111 = AND
-                        rdValue := and64(rs1Value, rs2Value)
+                        // 111 = AND, and Zbb ops
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = AND
+                            rdValue := and64(rs1Value, rs2Value)
+                        }
+                        case 0x20 {
+                            // 0100000 = ANDN
+                            rdValue := and64(rs1Value, not64(rs2Value))
+                        }
+                        case 0x05 {
+                            // 0000101 = MAXU
+                            rdValue := rs1Value
+                            if gt64(rs2Value, rs1Value) { rdValue := rs2Value }
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     default { revertWithCode(0xbadc0de) }
                 }
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x3B {
                 // 011_1011: register arithmetic and logic in 32 bits
@@ -1487,7 +3445,7 @@ contract RISCV is IBigStepper {
                 default {
                     switch funct3
                     case 0 {
-                        // 000 = ADDW/SUBW
+                        // 000 = ADDW/SUBW/ADD.UW
                         switch funct7
                         case 0x00 {
                             // 0000000 = ADDW
@@ -1497,14 +3455,51 @@ contract RISCV is IBigStepper {
                             // 0100000 = SUBW
                             rdValue := mask32Signed64(sub64(and64(rs1Value, u32Mask()), and64(rs2Value, u32Mask())))
                         }
+                        case 0x04 {
+                            // 0000100 = ADD.UW
+                            rdValue := add64(and64(rs1Value, u32Mask()), getRegister(rs2)) // rs2 is used in full, not
+                                // truncated
+                        }
                         default { revertWithCode(0xbadc0de) }
                     }
                     case 1 {
-                        // 001 = SLLW
-                        rdValue := mask32Signed64(shl64(and64(rs2Value, toU64(0x1F)), rs1Value))
+                        // 001 = SLLW/ROLW
+                        switch funct7
+                        case 0x00 {
+                            // 0000000 = SLLW
+                            rdValue := mask32Signed64(shl64(and64(rs2Value, toU64(0x1F)), rs1Value))
+                        }
+                        case 0x30 {
+                            // 0110000 = ROLW
+                            rdValue := rol32(rs1Value, rs2Value)
+                        }
+                        default { revertWithCode(0xbadc0de) }
+                    }
+                    case 2 {
+                        // 010 = SH1ADD.UW
+                        switch funct7
+                        case 0x10 {
+                            // 0010000 = SH1ADD.UW
+                            rdValue := add64(shl64(toU64(1), and64(rs1Value, u32Mask())), getRegister(rs2))
+                        }
+                        default { revertWithCode(0xbadc0de) }
+                    }
+                    case 4 {
+                        // 100 = SH2ADD.UW/ZEXT.H
+                        switch funct7
+                        case 0x10 {
+                            // 0010000 = SH2ADD.UW
+                            rdValue := add64(shl64(toU64(2), and64(rs1Value, u32Mask())), getRegister(rs2))
+                        }
+                        case 0x04 {
+                            // 0000100 = ZEXT.H, only with rs2 = 0
+                            if rs2 { revertWithCode(0xbadc0de) }
+                            rdValue := and64(rs1Value, shortToU64(0xFFFF))
+                        }
+                        default { revertWithCode(0xbadc0de) }
                     }
                     case 5 {
-                        // 101 = SR~
+                        // 101 = SR~/RORW
                         let shamt := and64(rs2Value, toU64(0x1F))
                         switch funct7
                         case 0x00 {
@@ -1515,37 +3510,50 @@ contract RISCV is IBigStepper {
                             // 0100000 = SRAW
                             rdValue := signExtend64(shr64(shamt, and64(rs1Value, u32Mask())), sub64(toU64(31), shamt))
                         }
+                        case 0x30 {
+                            // 0110000 = RORW
+                            rdValue := ror32(rs1Value, shamt)
+                        }
+                        default { revertWithCode(0xbadc0de) }
+                    }
+                    case 6 {
+                        // 110 = SH3ADD.UW
+                        switch funct7
+                        case 0x10 {
+                            // 0010000 = SH3ADD.UW
+                            rdValue := add64(shl64(toU64(3), and64(rs1Value, u32Mask())), getRegister(rs2))
+                        }
                         default { revertWithCode(0xbadc0de) }
                     }
                     default { revertWithCode(0xbadc0de) }
                 }
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x37 {
                 // 011_0111: LUI = Load upper immediate
                 let imm := parseImmTypeU(instr)
                 let rdValue := shl64(toU64(12), imm)
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x17 {
                 // 001_0111: AUIPC = Add upper immediate to PC
                 let imm := parseImmTypeU(instr)
                 let rdValue := add64(_pc, signExtend64(shl64(toU64(12), imm), toU64(31)))
                 setRegister(rd, rdValue)
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x6F {
                 // 110_1111: JAL = Jump and link
                 let imm := parseImmTypeJ(instr)
-                let rdValue := add64(_pc, toU64(4))
+                let rdValue := add64(_pc, getInstrLen())
                 setRegister(rd, rdValue)
 
                 let newPC := add64(_pc, signExtend64(shl64(toU64(1), imm), toU64(20)))
-                if and64(newPC, toU64(3)) {
+                if and64(newPC, toU64(1)) {
                     // quick target alignment check
-                    revertWithCode(0xbad10ad0) // target not aligned with 4 bytes
+                    revertWithCode(0xbad10ad0) // target not aligned with 2 bytes
                 }
                 setPC(newPC) // signed offset in multiples of 2
                     // bytes (last bit is there, but ignored)
@@ -1554,15 +3562,12 @@ contract RISCV is IBigStepper {
                 // 110_0111: JALR = Jump and link register
                 let rs1Value := getRegister(rs1)
                 let imm := parseImmTypeI(instr)
-                let rdValue := add64(_pc, toU64(4))
+                let rdValue := add64(_pc, getInstrLen())
                 setRegister(rd, rdValue)
 
+                // the least significant bit is set to 0, which keeps the target aligned to 2 bytes
                 let newPC := and64(add64(rs1Value, signExtend64(imm, toU64(11))), xor64(u64Mask(), toU64(1)))
-                if and64(newPC, toU64(3)) {
-                    // quick target alignment check
-                    revertWithCode(0xbad10ad0) // target not aligned with 4 bytes
-                }
-                setPC(newPC) // least significant bit is set to 0
+                setPC(newPC)
             }
             case 0x73 {
                 // 111_0011: environment things
@@ -1573,18 +3578,41 @@ contract RISCV is IBigStepper {
                     // I-type, top 12 bits
                     case 0 {
                         // imm12 = 000000000000 ECALL
+                        // the PC is updated first: the syscall may switch to another thread, or clone this one
+                        setPC(add64(_pc, getInstrLen()))
                         sysCall(_localContext)
-                        setPC(add64(_pc, toU64(4)))
                     }
                     default {
                         // imm12 = 000000000001 EBREAK
-                        setPC(add64(_pc, toU64(4))) // ignore breakpoint
+                        setPC(add64(_pc, getInstrLen())) // ignore breakpoint
                     }
                 }
+                case 4 {
+                    // 100 = reserved
+                    revertWithCode(0xbadc0de) // invalid funct3 value for opcode 0x73
+                }
                 default {
-                    // CSR instructions
-                    setRegister(rd, toU64(0)) // ignore CSR instructions
-                    setPC(add64(_pc, toU64(4)))
+                    // CSRRW, CSRRS, CSRRC and their immediate variants
+                    let num := shr64(toU64(20), instr) // I-type, top 12 bits
+                    // funct3 bit 2 selects the immediate variant: the rs1 field is a 5 bit unsigned immediate
+                    let v := rs1
+                    if iszero64(and64(funct3, toU64(4))) { v := getRegister(rs1) }
+                    let old := readCSR(num)
+                    switch and64(funct3, toU64(3))
+                    case 1 {
+                        // 01 = CSRRW: always writes
+                        writeCSR(num, v)
+                    }
+                    case 2 {
+                        // 10 = CSRRS: sets the bits of v, does not write if rs1 is x0 or the immediate is 0
+                        if rs1 { writeCSR(num, or64(old, v)) }
+                    }
+                    default {
+                        // 11 = CSRRC: clears the bits of v, does not write if rs1 is x0 or the immediate is 0
+                        if rs1 { writeCSR(num, and64(old, not64(v))) }
+                    }
+                    setRegister(rd, old)
+                    setPC(add64(_pc, getInstrLen()))
                 }
             }
             case 0x2F {
@@ -1677,26 +3705,74 @@ contract RISCV is IBigStepper {
                     storeMem(addr, size, v, 1, 3) // after overwriting 1, proof 2 is no longer valid
                     setRegister(rd, rdValue)
                 }
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x0F {
                 // 000_1111: fence
                 // Used to impose additional ordering constraints; flushing the mem operation pipeline.
                 // This VM doesn't have a pipeline, nor additional harts, so this is a no-op.
                 // FENCE / FENCE.TSO / FENCE.I all no-op: there's nothing to synchronize.
-                setPC(add64(_pc, toU64(4)))
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x07 {
-                // FLW/FLD: floating point load word/double
-                setPC(add64(_pc, toU64(4))) // no-op this.
+                let pc_ := _pc
+                // 000_0111: floating point memory loading
+                // FLW, FLD
+                let imm := parseImmTypeI(instr)
+                let rs1Value := getRegister(rs1)
+                let memIndex := add64(rs1Value, signExtend64(imm, toU64(11)))
+                switch funct3
+                case 2 {
+                    // 010 = FLW
+                    // single precision values are NaN-boxed: the upper 32 bits are all set
+                    let value := loadMem(memIndex, toU64(4), false, 1, 2)
+                    setFPRegister(rd, or64(value, shl64(toU64(32), u32Mask())))
+                }
+                case 3 {
+                    // 011 = FLD
+                    setFPRegister(rd, loadMem(memIndex, toU64(8), false, 1, 2))
+                }
+                default { revertWithCode(0xbadc0de) } // invalid funct3 value for opcode 0x07
+                setPC(add64(pc_, getInstrLen()))
             }
             case 0x27 {
-                // FSW/FSD: floating point store word/double
-                setPC(add64(_pc, toU64(4))) // no-op this.
+                let pc_ := _pc
+                // 010_0111: floating point memory storing
+                // FSW, FSD
+                // 010 = FSW, 011 = FSD
+                if iszero64(eq64(shr64(toU64(1), funct3), toU64(1))) { revertWithCode(0xbadc0de) }
+                let imm := parseImmTypeS(instr)
+                let size := shl64(funct3, toU64(1))
+                let value := getFPRegister(rs2)
+                let rs1Value := getRegister(rs1)
+                let memIndex := add64(rs1Value, signExtend64(imm, toU64(11)))
+                storeMem(memIndex, size, value, 1, 2)
+                setPC(add64(pc_, getInstrLen()))
+            }
+            case 0x43 {
+                // 100_0011: FMADD
+                execFloat(instr)
+                setPC(add64(_pc, getInstrLen()))
+            }
+            case 0x47 {
+                // 100_0111: FMSUB
+                execFloat(instr)
+                setPC(add64(_pc, getInstrLen()))
+            }
+            case 0x4B {
+                // 100_1011: FNMSUB
+                execFloat(instr)
+                setPC(add64(_pc, getInstrLen()))
+            }
+            case 0x4F {
+                // 100_1111: FNMADD
+                execFloat(instr)
+                setPC(add64(_pc, getInstrLen()))
             }
             case 0x53 {
-                // FADD etc. no-op is enough to pass Go runtime check
-                setPC(add64(_pc, toU64(4))) // no-op this.
+                // 101_0011: floating point arithmetic
+                execFloat(instr)
+                setPC(add64(_pc, getInstrLen()))
             }
             default { revertWithCode(0xf001c0de) } // unknown instruction opcode
 
@@ -0,0 +1,1062 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.25;
+
+/// @title RISCVFloat
+/// @notice The RISCVFloat contract emulates the floating point arithmetic of the F and D extensions in software, for
+///         the RISCV contract. It is stateless: RISCV reads the operands from the state, and writes back the result
+///         and the exception flags. It is a separate contract to keep RISCV within the contract size limit.
+/// @dev https://github.com/ethereum-optimism/asterisc
+contract RISCVFloat {
+    /// @notice Executes an OP-FP instruction, or one of FMADD, FMSUB, FNMSUB and FNMADD.
+    /// @param _instr The instruction.
+    /// @param _frs1Value The value of floating point register rs1.
+    /// @param _frs2Value The value of floating point register rs2.
+    /// @param _frs3Value The value of floating point register rs3, used by the fused multiply-add instructions.
+    /// @param _rs1Value The value of integer register rs1, used by the moves and conversions from integers.
+    /// @param _fcsr The floating point control and status register, for the dynamic rounding mode.
+    /// @return out_ The result of the instruction.
+    /// @return flags_ The exception flags that the instruction raised.
+    /// @return toInt_ Whether the result is written to integer register rd, instead of floating point register rd.
+    function execute(
+        uint64 _instr,
+        uint64 _frs1Value,
+        uint64 _frs2Value,
+        uint64 _frs3Value,
+        uint64 _rs1Value,
+        uint64 _fcsr
+    )
+        external
+        pure
+        returns (uint64 out_, uint64 flags_, bool toInt_)
+    {
+        assembly {
+            function revertWithCode(code) {
+                mstore(0, code)
+                revert(0, 0x20)
+            }
+
+            //
+            // Yul64 - functions to do 64 bit math - see yul64.go
+            //
+            function u64Mask() -> out {
+                // max uint64
+                out := shr(192, not(0)) // 256-64 = 192
+            }
+
+            function u32Mask() -> out {
+                out := U64(shr(toU256(224), not(0))) // 256-32 = 224
+            }
+
+            function toU64(v) -> out {
+                out := v
+            }
+
+            function shortToU64(v) -> out {
+                out := v
+            }
+
+            function shortToU256(v) -> out {
+                out := v
+            }
+
+            function longToU256(v) -> out {
+                out := v
+            }
+
+            function u256ToU64(v) -> out {
+                out := and(v, U256(u64Mask()))
+            }
+
+            function u64ToU256(v) -> out {
+                out := v
+            }
+
+            function mask32Signed64(v) -> out {
+                out := signExtend64(and64(v, u32Mask()), toU64(31))
+            }
+
+            function u64Mod() -> out {
+                // 1 << 64
+                out := shl(toU256(64), toU256(1))
+            }
+
+            function u64TopBit() -> out {
+                // 1 << 63
+                out := shl(toU256(63), toU256(1))
+            }
+
+            function signExtend64(v, bit) -> out {
+                switch and(v, shl(bit, 1))
+                case 0 {
+                    // fill with zeroes, by masking
+                    out := U64(and(U256(v), shr(sub(toU256(63), bit), U256(u64Mask()))))
+                }
+                default {
+                    // fill with ones, by or-ing
+                    out := U64(or(U256(v), shl(bit, shr(bit, U256(u64Mask())))))
+                }
+            }
+
+            function signExtend64To256(v) -> out {
+                switch and(U256(v), u64TopBit())
+                case 0 { out := v }
+                default { out := or(shl(toU256(64), not(0)), v) }
+            }
+
+            function add64(x, y) -> out {
+                out := U64(mod(add(U256(x), U256(y)), u64Mod()))
+            }
+
+            function sub64(x, y) -> out {
+                out := U64(mod(sub(U256(x), U256(y)), u64Mod()))
+            }
+
+            function mul64(x, y) -> out {
+                out := u256ToU64(mul(U256(x), U256(y)))
+            }
+
+            function div64(x, y) -> out {
+                out := u256ToU64(div(U256(x), U256(y)))
+            }
+
+            function sdiv64(x, y) -> out {
+                // note: signed overflow semantics are the same between Go and EVM assembly
+                out := u256ToU64(sdiv(signExtend64To256(x), signExtend64To256(y)))
+            }
+
+            function mod64(x, y) -> out {
+                out := U64(mod(U256(x), U256(y)))
+            }
+
+            function smod64(x, y) -> out {
+                out := u256ToU64(smod(signExtend64To256(x), signExtend64To256(y)))
+            }
+
+            function not64(x) -> out {
+                out := u256ToU64(not(U256(x)))
+            }
+
+            function lt64(x, y) -> out {
+                out := U64(lt(U256(x), U256(y)))
+            }
+
+            function gt64(x, y) -> out {
+                out := U64(gt(U256(x), U256(y)))
+            }
+
+            function slt64(x, y) -> out {
+                out := U64(slt(signExtend64To256(x), signExtend64To256(y)))
+            }
+
+            function sgt64(x, y) -> out {
+                out := U64(sgt(signExtend64To256(x), signExtend64To256(y)))
+            }
+
+            function eq64(x, y) -> out {
+                out := U64(eq(U256(x), U256(y)))
+            }
+
+            function iszero64(x) -> out {
+                out := iszero(U256(x))
+            }
+
+            function and64(x, y) -> out {
+                out := U64(and(U256(x), U256(y)))
+            }
+
+            function or64(x, y) -> out {
+                out := U64(or(U256(x), U256(y)))
+            }
+
+            function xor64(x, y) -> out {
+                out := U64(xor(U256(x), U256(y)))
+            }
+
+            function shl64(x, y) -> out {
+                out := u256ToU64(shl(U256(x), U256(y)))
+            }
+
+            function shr64(x, y) -> out {
+                out := U64(shr(U256(x), U256(y)))
+            }
+
+            function sar64(x, y) -> out {
+                out := u256ToU64(sar(U256(x), signExtend64To256(y)))
+            }
+
+            // type casts, no-op in yul
+            function b32asBEWord(v) -> out {
+                out := v
+            }
+            function beWordAsB32(v) -> out {
+                out := v
+            }
+            function U64(v) -> out {
+                out := v
+            }
+            function U256(v) -> out {
+                out := v
+            }
+            function toU256(v) -> out {
+                out := v
+            }
+
+
+            //
+            // Parse - functions to parse RISC-V instructions - see parse.go
+            //
+            function parseOpcode(instr) -> out {
+                out := and64(instr, toU64(0x7F))
+            }
+
+            function parseRd(instr) -> out {
+                out := and64(shr64(toU64(7), instr), toU64(0x1F))
+            }
+
+            function parseFunct3(instr) -> out {
+                out := and64(shr64(toU64(12), instr), toU64(0x7))
+            }
+
+            function parseRs1(instr) -> out {
+                out := and64(shr64(toU64(15), instr), toU64(0x1F))
+            }
+
+            function parseRs2(instr) -> out {
+                out := and64(shr64(toU64(20), instr), toU64(0x1F))
+            }
+
+            function parseFunct7(instr) -> out {
+                out := shr64(toU64(25), instr)
+            }
+
+            function parseRs3(instr) -> out {
+                out := shr64(toU64(27), instr)
+            }
+
+            //
+            // Floating point - functions to emulate the F and D extensions in software - see softfloat.go
+            //
+            function fpFracBits(d) -> out {
+                switch d
+                case 0 { out := toU64(23) }
+                default { out := toU64(52) }
+            }
+
+            function fpExpMask(d) -> out {
+                switch d
+                case 0 { out := toU64(0xff) }
+                default { out := shortToU64(0x7ff) }
+            }
+
+            function fpBias(d) -> out {
+                switch d
+                case 0 { out := toU64(127) }
+                default { out := shortToU64(1023) }
+            }
+
+            function fpSignShift(d) -> out {
+                switch d
+                case 0 { out := toU64(31) }
+                default { out := toU64(63) }
+            }
+
+            function fpCanonicalNaN(d) -> out {
+                out := or64(shl64(fpFracBits(d), fpExpMask(d)), shl64(sub64(fpFracBits(d), toU64(1)), toU64(1)))
+            }
+
+            function fpInf(sign, d) -> out {
+                out := or64(shl64(fpSignShift(d), sign), shl64(fpFracBits(d), fpExpMask(d)))
+            }
+
+            function fpZero(sign, d) -> out {
+                out := shl64(fpSignShift(d), sign)
+            }
+
+            // NaN-boxes a single precision value, to store it in a 64 bit floating point register
+            function fpBox(v, d) -> out {
+                switch d
+                case 0 { out := or64(v, shl64(toU64(32), u32Mask())) }
+                default { out := v }
+            }
+
+            // reads a value of the given format from a 64 bit floating point register,
+            // single precision values that are not properly NaN-boxed are read as the canonical NaN
+            function fpUnbox(v, d) -> out {
+                out := v
+                if iszero64(d) {
+                    switch eq64(shr64(toU64(32), v), u32Mask())
+                    case 0 { out := fpCanonicalNaN(d) }
+                    default { out := and64(v, u32Mask()) }
+                }
+            }
+
+            function fpSign(v, d) -> out {
+                out := and64(shr64(fpSignShift(d), v), toU64(1))
+            }
+
+            function fpExp(v, d) -> out {
+                out := and64(shr64(fpFracBits(d), v), fpExpMask(d))
+            }
+
+            function fpFrac(v, d) -> out {
+                out := and64(v, sub64(shl64(fpFracBits(d), toU64(1)), toU64(1)))
+            }
+
+            function fpIsNaN(v, d) -> out {
+                out := and64(eq64(fpExp(v, d), fpExpMask(d)), gt64(fpFrac(v, d), toU64(0)))
+            }
+
+            function fpIsSNaN(v, d) -> out {
+                // signaling NaNs have the most significant fraction bit unset
+                out := and64(fpIsNaN(v, d), iszero64(shr64(sub64(fpFracBits(d), toU64(1)), fpFrac(v, d))))
+            }
+
+            function fpIsInf(v, d) -> out {
+                out := and64(eq64(fpExp(v, d), fpExpMask(d)), eq64(fpFrac(v, d), toU64(0)))
+            }
+
+            function fpIsZero(v, d) -> out {
+                out := eq64(and64(v, not64(shl64(fpSignShift(d), toU64(1)))), toU64(0))
+            }
+
+            // returns the invalid-operation flag if any of the given values is a signaling NaN
+            function fpInvalidIfSNaN(x, y, d) -> out {
+                out := shl64(toU64(4), or64(fpIsSNaN(x, d), fpIsSNaN(y, d)))
+            }
+
+            // returns the index of the most significant set bit of a non-zero value
+            function msb64(x) -> n {
+                for { let i := 32 } gt(i, 0) { i := shr(1, i) } {
+                    if shr64(toU64(i), x) {
+                        x := shr64(toU64(i), x)
+                        n := add64(n, toU64(i))
+                    }
+                }
+            }
+
+            // returns the index of the most significant set bit of a non-zero value
+            function msb256(x) -> n {
+                for { let i := 128 } gt(i, 0) { i := shr(1, i) } {
+                    if shr(toU256(i), x) {
+                        x := shr(toU256(i), x)
+                        n := add64(n, toU64(i))
+                    }
+                }
+            }
+
+            // shifts x right by n bits, and sets the lowest bit if any of the shifted out bits were set
+            function shiftRightJam64(x, n) -> out {
+                switch lt64(n, toU64(64))
+                case 0 { out := gt64(x, toU64(0)) }
+                default { out := or64(shr64(n, x), gt64(shl64(sub64(toU64(64), n), x), toU64(0))) }
+            }
+
+            // shifts x right by n bits, and sets the lowest bit if any of the shifted out bits were set
+            function shiftRightJam256(x, n) -> out {
+                switch lt64(n, shortToU64(256))
+                case 0 { out := gt(x, toU256(0)) }
+                default { out := or(shr(u64ToU256(n), x), gt(shl(u64ToU256(sub64(shortToU64(256), n)), x), toU256(0))) }
+            }
+
+            // returns the exponent and significand of a finite non-zero value, normalized to a leading bit at bit 62
+            function fpUnpack(v, d) -> e, sig {
+                sig := fpFrac(v, d)
+                switch fpExp(v, d)
+                case 0 {
+                    // subnormal
+                    e := sub64(toU64(1), fpBias(d))
+                }
+                default {
+                    e := sub64(fpExp(v, d), fpBias(d))
+                    sig := or64(sig, shl64(fpFracBits(d), toU64(1)))
+                }
+                let n := msb64(sig)
+                e := sub64(add64(e, n), fpFracBits(d))
+                sig := shl64(sub64(toU64(62), n), sig)
+            }
+
+            // returns what to add to a value before truncating the bits in mask, to round it
+            function fpRoundIncrement(rm, sign, mask) -> inc {
+                switch rm
+                case 0 {
+                    // RNE
+                    inc := add64(shr64(toU64(1), mask), toU64(1))
+                }
+                case 2 {
+                    // RDN
+                    if sign { inc := mask }
+                }
+                case 3 {
+                    // RUP
+                    if iszero64(sign) { inc := mask }
+                }
+                case 4 {
+                    // RMM
+                    inc := add64(shr64(toU64(1), mask), toU64(1))
+                }
+            }
+
+            // shifts sig right by n bits (1 <= n <= 63, sig < 2**63), rounding the result with the given rounding mode.
+            // The inexact flag is returned if any of the shifted out bits were set.
+            function fpRoundShift(sig, n, rm, sign) -> out, inexact {
+                let mask := sub64(shl64(n, toU64(1)), toU64(1))
+                out := shr64(n, add64(sig, fpRoundIncrement(rm, sign, mask)))
+                if and64(iszero64(rm), eq64(and64(sig, mask), add64(shr64(toU64(1), mask), toU64(1)))) {
+                    out := and64(out, not64(toU64(1))) // ties to even
+                }
+                inexact := gt64(and64(sig, mask), toU64(0))
+            }
+
+            // returns 1 if an overflow rounds to the largest finite number instead of infinity
+            function fpRoundsToMax(rm, sign) -> out {
+                switch rm
+                case 1 {
+                    // RTZ
+                    out := toU64(1)
+                }
+                case 2 {
+                    // RDN
+                    out := iszero64(sign)
+                }
+                case 3 {
+                    // RUP
+                    out := sign
+                }
+            }
+
+            // returns the underflow flag if a subnormal result is tiny:
+            // tininess is detected after rounding, as if the exponent range was unbounded.
+            // be is the biased exponent minus one, and negative for subnormal results.
+            function fpTiny(sign, be, sig, rm, d) -> out {
+                if slt64(be, u64Mask()) {
+                    // more than one binade below the normal range
+                    out := toU64(2)
+                    leave
+                }
+                let inc := fpRoundIncrement(rm, sign, sub64(shl64(sub64(toU64(62), fpFracBits(d)), toU64(1)), toU64(1)))
+                out := shl64(toU64(1), lt64(add64(sig, inc), shl64(toU64(63), toU64(1))))
+            }
+
+            // rounds the value sig * 2**(e-62), with the leading significand bit at bit 62, to the given format
+            function fpRoundPack(sign, e, sig, rm, d) -> out, flags {
+                // the biased exponent, minus one:
+                // the leading significand bit is added to the exponent field when packing
+                let be := sub64(add64(e, fpBias(d)), toU64(1))
+                if slt64(be, toU64(0)) {
+                    // subnormal
+                    flags := fpTiny(sign, be, sig, rm, d)
+                    sig := shiftRightJam64(sig, sub64(toU64(0), be))
+                    be := toU64(0)
+                }
+                let inexact := 0
+                sig, inexact := fpRoundShift(sig, sub64(toU64(62), fpFracBits(d)), rm, sign)
+                if iszero64(inexact) {
+                    // underflow is only signaled if the result is also inexact
+                    flags := toU64(0)
+                }
+                flags := or64(flags, inexact)
+                out := add64(shl64(fpFracBits(d), be), sig)
+                if gt64(shr64(fpFracBits(d), out), sub64(fpExpMask(d), toU64(1))) {
+                    // overflow
+                    flags := toU64(0x05) // OF | NX
+                    out := sub64(fpInf(toU64(0), d), fpRoundsToMax(rm, sign))
+                }
+                out := or64(out, fpZero(sign, d))
+            }
+
+            // rounds the non-zero value sig * 2**(e-124) to the given format
+            function fpRoundPack256(sign, e, sig, rm, d) -> out, flags {
+                let n := msb256(sig)
+                e := sub64(add64(e, n), toU64(124))
+                switch gt64(n, toU64(62))
+                case 0 { sig := shl(u64ToU256(sub64(toU64(62), n)), sig) }
+                default { sig := shiftRightJam256(sig, sub64(n, toU64(62))) }
+                out, flags := fpRoundPack(sign, e, u256ToU64(sig), rm, d)
+            }
+
+            // adds the non-zero values sig * 2**(e-124) and z with the given sign, and rounds the result
+            function fpAddSig(sign, e, sig, z, rm, d) -> out, flags {
+                let eZ, sigZ := fpUnpack(z, d)
+                sigZ := shl(toU256(62), u64ToU256(sigZ))
+                // align the value with the smallest exponent to the other value
+                switch slt64(e, eZ)
+                case 0 { sigZ := shiftRightJam256(sigZ, sub64(e, eZ)) }
+                default {
+                    sig := shiftRightJam256(sig, sub64(eZ, e))
+                    e := eZ
+                }
+                switch eq64(sign, fpSign(z, d))
+                case 1 { sig := add(sig, sigZ) }
+                default {
+                    switch u256ToU64(lt(sig, sigZ))
+                    case 0 { sig := sub(sig, sigZ) }
+                    default {
+                        sign := fpSign(z, d)
+                        sig := sub(sigZ, sig)
+                    }
+                }
+                if iszero(sig) {
+                    // exact zero: negative only when rounding down
+                    out := fpZero(eq64(rm, toU64(2)), d)
+                    leave
+                }
+                out, flags := fpRoundPack256(sign, e, sig, rm, d)
+            }
+
+            // returns x + y
+            function fpAdd(x, y, rm, d) -> out, flags {
+                if or64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    out := fpCanonicalNaN(d)
+                    flags := fpInvalidIfSNaN(x, y, d)
+                    leave
+                }
+                if fpIsInf(x, d) {
+                    out := x
+                    if and64(fpIsInf(y, d), xor64(fpSign(x, d), fpSign(y, d))) {
+                        // inf - inf
+                        out := fpCanonicalNaN(d)
+                        flags := toU64(0x10)
+                    }
+                    leave
+                }
+                if fpIsInf(y, d) {
+                    out := y
+                    leave
+                }
+                if fpIsZero(x, d) {
+                    out := y
+                    if and64(fpIsZero(y, d), xor64(fpSign(x, d), fpSign(y, d))) {
+                        // zeroes of opposite sign
+                        out := fpZero(eq64(rm, toU64(2)), d)
+                    }
+                    leave
+                }
+                if fpIsZero(y, d) {
+                    out := x
+                    leave
+                }
+                let e, sig := fpUnpack(x, d)
+                out, flags := fpAddSig(fpSign(x, d), e, shl(toU256(62), u64ToU256(sig)), y, rm, d)
+            }
+
+            // returns the exact product of the finite non-zero values x and y, as sig * 2**(e-124)
+            function fpMulSig(x, y, d) -> e, sig {
+                let eX, sigX := fpUnpack(x, d)
+                let eY, sigY := fpUnpack(y, d)
+                e := add64(eX, eY)
+                sig := mul(u64ToU256(sigX), u64ToU256(sigY))
+            }
+
+            // returns x * y
+            function fpMul(x, y, rm, d) -> out, flags {
+                if or64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    out := fpCanonicalNaN(d)
+                    flags := fpInvalidIfSNaN(x, y, d)
+                    leave
+                }
+                let sign := xor64(fpSign(x, d), fpSign(y, d))
+                if or64(fpIsInf(x, d), fpIsInf(y, d)) {
+                    out := fpInf(sign, d)
+                    if or64(fpIsZero(x, d), fpIsZero(y, d)) {
+                        // inf * 0
+                        out := fpCanonicalNaN(d)
+                        flags := toU64(0x10)
+                    }
+                    leave
+                }
+                if or64(fpIsZero(x, d), fpIsZero(y, d)) {
+                    out := fpZero(sign, d)
+                    leave
+                }
+                let e, sig := fpMulSig(x, y, d)
+                out, flags := fpRoundPack256(sign, e, sig, rm, d)
+            }
+
+            // returns the quotient of the finite non-zero values x and y, as sig * 2**(e-124).
+            // The quotient has at least 123 bits, and the lowest bit is set if the division is inexact.
+            function fpDivSig(x, y, d) -> e, sig {
+                let eX, sigX := fpUnpack(x, d)
+                let eY, sigY := fpUnpack(y, d)
+                let num := shl(toU256(124), u64ToU256(sigX))
+                sig := or(div(num, u64ToU256(sigY)), gt(mod(num, u64ToU256(sigY)), toU256(0)))
+                e := sub64(eX, eY)
+            }
+
+            // returns x / y
+            function fpDiv(x, y, rm, d) -> out, flags {
+                if or64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    out := fpCanonicalNaN(d)
+                    flags := fpInvalidIfSNaN(x, y, d)
+                    leave
+                }
+                let sign := xor64(fpSign(x, d), fpSign(y, d))
+                if fpIsInf(x, d) {
+                    out := fpInf(sign, d)
+                    if fpIsInf(y, d) {
+                        // inf / inf
+                        out := fpCanonicalNaN(d)
+                        flags := toU64(0x10)
+                    }
+                    leave
+                }
+                if fpIsInf(y, d) {
+                    out := fpZero(sign, d)
+                    leave
+                }
+                if fpIsZero(y, d) {
+                    out := fpInf(sign, d)
+                    flags := toU64(0x08)
+                    if fpIsZero(x, d) {
+                        // 0 / 0
+                        out := fpCanonicalNaN(d)
+                        flags := toU64(0x10)
+                    }
+                    leave
+                }
+                if fpIsZero(x, d) {
+                    out := fpZero(sign, d)
+                    leave
+                }
+                let e, sig := fpDivSig(x, y, d)
+                out, flags := fpRoundPack256(sign, e, sig, rm, d)
+            }
+
+            // returns the integer square root of x < 2**252, with the lowest bit set if the root is inexact
+            function isqrt256(x) -> out {
+                for { let i := 126 } gt(i, 0) { i := sub(i, 1) } {
+                    let t := or(out, shl(toU256(sub(i, 1)), toU256(1)))
+                    if iszero(gt(mul(t, t), x)) { out := t }
+                }
+                out := or(out, gt(sub(x, mul(out, out)), toU256(0)))
+            }
+
+            // returns the square root of x
+            function fpSqrt(x, rm, d) -> out, flags {
+                if fpIsNaN(x, d) {
+                    out := fpCanonicalNaN(d)
+                    flags := fpInvalidIfSNaN(x, x, d)
+                    leave
+                }
+                if fpIsZero(x, d) {
+                    out := x
+                    leave
+                }
+                if fpSign(x, d) {
+                    // negative, including -inf
+                    out := fpCanonicalNaN(d)
+                    flags := toU64(0x10)
+                    leave
+                }
+                if fpIsInf(x, d) {
+                    out := x
+                    leave
+                }
+                let e, sig := fpUnpack(x, d)
+                // scale the significand such that the remaining exponent is even,
+                // and the root has its leading bit at bit 124
+                let shift := add64(toU64(186), and64(e, toU64(1)))
+                e := add64(toU64(124), sar64(toU64(1), sub64(sub64(e, toU64(62)), shift)))
+                out, flags := fpRoundPack256(toU64(0), e, isqrt256(shl(u64ToU256(shift), u64ToU256(sig))), rm, d)
+            }
+
+            // returns x * y + z, with a single rounding.
+            // The negated variants are computed by flipping the sign of x and/or z.
+            function fpMulAdd(x, y, z, rm, d) -> out, flags {
+                if or64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    out := fpCanonicalNaN(d)
+                    flags := or64(fpInvalidIfSNaN(x, y, d), fpInvalidIfSNaN(z, z, d))
+                    leave
+                }
+                if or64(and64(fpIsInf(x, d), fpIsZero(y, d)), and64(fpIsZero(x, d), fpIsInf(y, d))) {
+                    // inf * 0
+                    out := fpCanonicalNaN(d)
+                    flags := toU64(0x10)
+                    leave
+                }
+                if fpIsNaN(z, d) {
+                    out := fpCanonicalNaN(d)
+                    flags := fpInvalidIfSNaN(z, z, d)
+                    leave
+                }
+                let sign := xor64(fpSign(x, d), fpSign(y, d))
+                if or64(fpIsInf(x, d), fpIsInf(y, d)) {
+                    out := fpInf(sign, d)
+                    if and64(fpIsInf(z, d), xor64(sign, fpSign(z, d))) {
+                        // inf - inf
+                        out := fpCanonicalNaN(d)
+                        flags := toU64(0x10)
+                    }
+                    leave
+                }
+                if fpIsInf(z, d) {
+                    out := z
+                    leave
+                }
+                if or64(fpIsZero(x, d), fpIsZero(y, d)) {
+                    out := z
+                    if and64(fpIsZero(z, d), xor64(sign, fpSign(z, d))) {
+                        // zeroes of opposite sign
+                        out := fpZero(eq64(rm, toU64(2)), d)
+                    }
+                    leave
+                }
+                let e, sig := fpMulSig(x, y, d)
+                if fpIsZero(z, d) {
+                    out, flags := fpRoundPack256(sign, e, sig, rm, d)
+                    leave
+                }
+                out, flags := fpAddSig(sign, e, sig, z, rm, d)
+            }
+
+            // returns 1 if x < y, for non-NaN values. If orderZeroes is set, -0 is considered less than +0.
+            function fpLess(x, y, orderZeroes, d) -> out {
+                if and64(fpIsZero(x, d), fpIsZero(y, d)) {
+                    out := and64(orderZeroes, gt64(fpSign(x, d), fpSign(y, d)))
+                    leave
+                }
+                if xor64(fpSign(x, d), fpSign(y, d)) {
+                    out := fpSign(x, d)
+                    leave
+                }
+                switch fpSign(x, d)
+                case 0 { out := lt64(x, y) }
+                default { out := gt64(x, y) }
+            }
+
+            // returns the minimum of x and y, or the maximum if takeMax is set
+            function fpMinMax(x, y, takeMax, d) -> out, flags {
+                flags := fpInvalidIfSNaN(x, y, d)
+                if and64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    out := fpCanonicalNaN(d)
+                    leave
+                }
+                if fpIsNaN(x, d) {
+                    out := y
+                    leave
+                }
+                if fpIsNaN(y, d) {
+                    out := x
+                    leave
+                }
+                out := x
+                if eq64(fpLess(x, y, toU64(1), d), takeMax) { out := y }
+            }
+
+            // returns the result of x == y (op 2), x < y (op 1) or x <= y (op 0).
+            // Equality is a quiet comparison, the other comparisons signal an invalid operation on any NaN input.
+            function fpCompare(x, y, op, d) -> out, flags {
+                if or64(fpIsNaN(x, d), fpIsNaN(y, d)) {
+                    switch op
+                    case 2 { flags := fpInvalidIfSNaN(x, y, d) }
+                    default { flags := toU64(0x10) }
+                    leave
+                }
+                let equal := or64(eq64(x, y), and64(fpIsZero(x, d), fpIsZero(y, d)))
+                switch op
+                case 2 { out := equal }
+                case 1 { out := fpLess(x, y, toU64(0), d) }
+                default { out := or64(fpLess(x, y, toU64(0), d), equal) }
+            }
+
+            // returns the class of x, as a 10 bit mask. The bits, from low to high, are set for:
+            // -inf, negative normal, negative subnormal, -0, +0, positive subnormal, positive normal, +inf,
+            // signaling NaN, quiet NaN.
+            function fpClass(x, d) -> out {
+                let n := toU64(6) // normal
+                if iszero64(fpExp(x, d)) { n := sub64(toU64(5), fpIsZero(x, d)) } // subnormal or zero
+                if fpIsInf(x, d) { n := toU64(7) }
+                if fpSign(x, d) {
+                    // the negative classes mirror the positive classes
+                    n := sub64(toU64(7), n)
+                }
+                if fpIsNaN(x, d) { n := sub64(toU64(9), fpIsSNaN(x, d)) }
+                out := shl64(n, toU64(1))
+            }
+
+            // returns x with the sign of y (op 0), the negated sign of y (op 1), or the xor of both signs (op 2)
+            function fpSignInject(x, y, op, d) -> out {
+                let sign := fpSign(y, d)
+                switch op
+                case 1 { sign := xor64(sign, toU64(1)) }
+                case 2 { sign := xor64(sign, fpSign(x, d)) }
+                out := or64(and64(x, not64(fpZero(toU64(1), d))), fpZero(sign, d))
+            }
+
+            // converts x from the given source format to the other format
+            function fpConvert(x, rm, from) -> out, flags {
+                let to := xor64(from, toU64(1))
+                if fpIsNaN(x, from) {
+                    out := fpCanonicalNaN(to)
+                    flags := fpInvalidIfSNaN(x, x, from)
+                    leave
+                }
+                if fpIsInf(x, from) {
+                    out := fpInf(fpSign(x, from), to)
+                    leave
+                }
+                if fpIsZero(x, from) {
+                    out := fpZero(fpSign(x, from), to)
+                    leave
+                }
+                let e, sig := fpUnpack(x, from)
+                out, flags := fpRoundPack(fpSign(x, from), e, sig, rm, to)
+            }
+
+            // returns the magnitude of the largest integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3)
+            function fpIntMaxMag(op) -> out {
+                switch op
+                case 0 { out := shr64(toU64(33), u64Mask()) }
+                case 1 { out := u32Mask() }
+                case 2 { out := shr64(toU64(1), u64Mask()) }
+                default { out := u64Mask() }
+            }
+
+            // returns the magnitude of the smallest integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3)
+            function fpIntMinMag(op) -> out {
+                switch op
+                case 0 { out := shl64(toU64(31), toU64(1)) }
+                case 2 { out := shl64(toU64(63), toU64(1)) }
+            }
+
+            // sign-extends the 32 bit results of integer types W (op 0) and WU (op 1)
+            function mask32Signed64IfW(v, op) -> out {
+                switch shr64(toU64(1), op)
+                case 0 { out := mask32Signed64(v) }
+                default { out := v }
+            }
+
+            // rounds the magnitude of the finite non-zero value x to an integer.
+            // The overflow flag is returned if the magnitude does not fit in 64 bits.
+            function fpRoundToInt(x, rm, d) -> mag, inexact, overflow {
+                let e, sig := fpUnpack(x, d)
+                switch slt64(e, toU64(62))
+                case 0 {
+                    // no fraction bits
+                    overflow := gt64(e, toU64(63))
+                    mag := shl64(and64(sub64(e, toU64(62)), toU64(1)), sig)
+                }
+                default {
+                    let n := sub64(toU64(62), e) // number of fraction bits
+                    if gt64(n, toU64(63)) {
+                        sig := toU64(1) // less than a half: only remember that the value is not zero
+                        n := toU64(63)
+                    }
+                    mag, inexact := fpRoundShift(sig, n, rm, fpSign(x, d))
+                }
+            }
+
+            // converts x to an integer of type W (op 0), WU (op 1), L (op 2) or LU (op 3).
+            // 32 bit results are sign-extended, NaN and out of range inputs saturate.
+            function fpToInt(x, rm, op, d) -> out, flags {
+                if fpIsNaN(x, d) {
+                    out := mask32Signed64IfW(fpIntMaxMag(op), op)
+                    flags := toU64(0x10)
+                    leave
+                }
+                if fpIsZero(x, d) { leave }
+                let overflow := fpIsInf(x, d)
+                let mag := toU64(0)
+                if iszero64(overflow) { mag, flags, overflow := fpRoundToInt(x, rm, d) }
+                switch fpSign(x, d)
+                case 0 {
+                    if or64(overflow, gt64(mag, fpIntMaxMag(op))) {
+                        out := mask32Signed64IfW(fpIntMaxMag(op), op)
+                        flags := toU64(0x10)
+                        leave
+                    }
+                    out := mag
+                }
+                default {
+                    if or64(overflow, gt64(mag, fpIntMinMag(op))) {
+                        out := mask32Signed64IfW(sub64(toU64(0), fpIntMinMag(op)), op)
+                        flags := toU64(0x10)
+                        leave
+                    }
+                    out := sub64(toU64(0), mag)
+                }
+                out := mask32Signed64IfW(out, op)
+            }
+
+            // converts the integer v of type W (op 0), WU (op 1), L (op 2) or LU (op 3) to the given format
+            function fpFromInt(v, rm, op, d) -> out, flags {
+                switch op
+                case 0 { v := mask32Signed64(v) }
+                case 1 { v := and64(v, u32Mask()) }
+                let sign := toU64(0)
+                if and64(iszero64(and64(op, toU64(1))), shr64(toU64(63), v)) {
+                    // negative signed integer
+                    sign := toU64(1)
+                    v := sub64(toU64(0), v)
+                }
+                if iszero64(v) { leave }
+                out, flags := fpRoundPack256(sign, toU64(124), u64ToU256(v), rm, d)
+            }
+
+            //
+            // Instruction execution
+            //
+            //
+            // Operands - the functions cannot access the arguments, which are kept in memory
+            //
+
+            function getFPRs1() -> out {
+                out := mload(0x80) // _frs1Value
+            }
+
+            function getFPRs2() -> out {
+                out := mload(0xa0) // _frs2Value
+            }
+
+            function getFPRs3() -> out {
+                out := mload(0xc0) // _frs3Value
+            }
+
+            function getRs1() -> out {
+                out := mload(0xe0) // _rs1Value
+            }
+
+            function getFCSR() -> out {
+                out := mload(0x100) // _fcsr
+            }
+
+            // returns the rounding mode of an instruction, reading the dynamic rounding mode (7) from fcsr
+
+            function getRoundingMode(rm) -> out {
+                out := rm
+                if eq64(out, toU64(7)) { out := and64(shr64(toU64(5), getFCSR()), toU64(7)) } // frm
+                if gt64(out, toU64(4)) { revertWithCode(0xbadc0de) } // invalid rounding mode
+            }
+
+            function getFPFormat(funct7) -> out {
+                out := and64(funct7, toU64(3)) // 00 = S, 01 = D
+                if gt64(out, toU64(1)) { revertWithCode(0xbadc0de) } // unsupported floating point format
+            }
+
+            // executes FMADD, FMSUB, FNMSUB and FNMADD
+            function execFloatMulAdd(instr) -> out, flags {
+                let fpFmt := getFPFormat(parseFunct7(instr))
+                let rm := getRoundingMode(parseFunct3(instr))
+                // the opcode bits 3:2 select the variant: bit 2 negates the addend, bit 3 negates the product
+                let x := xor64(
+                    fpUnbox(getFPRs1(), fpFmt),
+                    fpZero(and64(shr64(toU64(3), instr), toU64(1)), fpFmt)
+                )
+                let z := xor64(
+                    fpUnbox(getFPRs3(), fpFmt),
+                    fpZero(and64(shr64(toU64(2), instr), toU64(1)), fpFmt)
+                )
+                out, flags := fpMulAdd(x, fpUnbox(getFPRs2(), fpFmt), z, rm, fpFmt)
+                out := fpBox(out, fpFmt)
+            }
+
+            // executes the OP-FP instructions: arithmetic, conversions, comparisons and moves.
+            // The result is for integer register rd if toInt is set, and for floating point register rd otherwise.
+            function execFloatOp(instr) -> out, flags, toInt {
+                let funct3 := parseFunct3(instr) // rounding mode, or the variant of the operation
+                let rs2 := parseRs2(instr)
+                let fpFmt := getFPFormat(parseFunct7(instr))
+                let x := fpUnbox(getFPRs1(), fpFmt)
+                let y := fpUnbox(getFPRs2(), fpFmt)
+                switch shr64(toU64(2), parseFunct7(instr))
+                case 0x00 {
+                    // 00000 = FADD
+                    out, flags := fpAdd(x, y, getRoundingMode(funct3), fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x01 {
+                    // 00001 = FSUB
+                    out, flags := fpAdd(x, xor64(y, fpZero(toU64(1), fpFmt)), getRoundingMode(funct3), fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x02 {
+                    // 00010 = FMUL
+                    out, flags := fpMul(x, y, getRoundingMode(funct3), fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x03 {
+                    // 00011 = FDIV
+                    out, flags := fpDiv(x, y, getRoundingMode(funct3), fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x0B {
+                    // 01011 = FSQRT
+                    if rs2 { revertWithCode(0xbadc0de) } // reserved instruction encoding
+                    out, flags := fpSqrt(x, getRoundingMode(funct3), fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x04 {
+                    // 00100 = FSGNJ, FSGNJN, FSGNJX
+                    if gt64(funct3, toU64(2)) { revertWithCode(0xbadc0de) } // invalid funct3 value for FSGNJ
+                    out := fpBox(fpSignInject(x, y, funct3, fpFmt), fpFmt)
+                }
+                case 0x05 {
+                    // 00101 = FMIN, FMAX
+                    if gt64(funct3, toU64(1)) { revertWithCode(0xbadc0de) } // invalid funct3 value for FMIN/FMAX
+                    out, flags := fpMinMax(x, y, funct3, fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x08 {
+                    // 01000 = FCVT.S.D, FCVT.D.S
+                    // rs2 selects the source format, which must be the other format
+                    if iszero64(eq64(xor64(rs2, fpFmt), toU64(1))) {
+                        revertWithCode(0xbadc0de) // reserved instruction encoding
+                    }
+                    x := fpUnbox(getFPRs1(), rs2)
+                    out, flags := fpConvert(x, getRoundingMode(funct3), rs2)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x14 {
+                    // 10100 = FLE, FLT, FEQ
+                    if gt64(funct3, toU64(2)) { revertWithCode(0xbadc0de) } // invalid funct3 value for comparison
+                    out, flags := fpCompare(x, y, funct3, fpFmt)
+                    toInt := 1
+                }
+                case 0x18 {
+                    // 11000 = FCVT.W, FCVT.WU, FCVT.L, FCVT.LU: rs2 selects the integer type
+                    if gt64(rs2, toU64(3)) { revertWithCode(0xbadc0de) } // reserved instruction encoding
+                    out, flags := fpToInt(x, getRoundingMode(funct3), rs2, fpFmt)
+                    toInt := 1
+                }
+                case 0x1A {
+                    // 11010 = FCVT from W, WU, L, LU: rs2 selects the integer type
+                    if gt64(rs2, toU64(3)) { revertWithCode(0xbadc0de) } // reserved instruction encoding
+                    out, flags := fpFromInt(getRs1(), getRoundingMode(funct3), rs2, fpFmt)
+                    out := fpBox(out, fpFmt)
+                }
+                case 0x1C {
+                    // 11100 = FMV.X.W, FMV.X.D, FCLASS
+                    if rs2 { revertWithCode(0xbadc0de) } // reserved instruction encoding
+                    switch funct3
+                    case 0 {
+                        // 000 = FMV.X.W, FMV.X.D: move the raw bits, single precision values are sign-extended
+                        out := getFPRs1()
+                        if iszero64(fpFmt) { out := mask32Signed64(out) }
+                        toInt := 1
+                    }
+                    case 1 {
+                        // 001 = FCLASS
+                        out := fpClass(x, fpFmt)
+                        toInt := 1
+                    }
+                    default { revertWithCode(0xbadc0de) } // invalid funct3 value for FMV/FCLASS
+                }
+                case 0x1E {
+                    // 11110 = FMV.W.X, FMV.D.X
+                    if or64(rs2, funct3) { revertWithCode(0xbadc0de) } // reserved instruction encoding
+                    out := fpBox(getRs1(), fpFmt)
+                }
+                default { revertWithCode(0xbadc0de) } // invalid funct7 value for opcode 0x53
+            }
+
+            mstore(0x80, _frs1Value)
+            mstore(0xa0, _frs2Value)
+            mstore(0xc0, _frs3Value)
+            mstore(0xe0, _rs1Value)
+            mstore(0x100, _fcsr)
+
+            switch parseOpcode(_instr)
+            case 0x53 { out_, flags_, toInt_ := execFloatOp(_instr) }
+            default { out_, flags_ := execFloatMulAdd(_instr) }
+        }
+    }
+}
@@ -10,8 +10,16 @@ import { CommonTest } from "./CommonTest.sol";
 import "@optimism/src/dispute/lib/Types.sol";
 
 contract RISCV_Test is CommonTest {
+    /// @notice A page-aligned range of memory [start, end) with the permissions prot.
+    struct MemoryRegion {
+        uint64 start;
+        uint64 end;
+        uint8 prot;
+    }
+
     /// @notice Stores the VM state.
-    ///         Total state size: 32 + 32 + 8 * 2 + 1 * 2 + 8 * 3 + 32 * 8 = 362 bytes
+    ///         Total state size: 32 + 32 + 8 * 2 + 1 * 2 + 8 * 3 + 32 * 8 + 32 * 8 + 8 + 8 * 6 + 8 * 3 + 1 + 32 * 3
+    ///         + 17 * 8 = 931 bytes
     ///         Note that struct is not used for step execution and used only for testing
     //          Struct size may be larger than total state size due to memory layouts
     struct State {
@@ -25,6 +33,22 @@ contract RISCV_Test is CommonTest {
         uint64 heap;
         uint64 loadReservation;
         uint64[32] registers;
+        uint64[32] fpRegisters;
+        uint64 fcsr;
+        uint64 threadID;
+        uint64 futexAddr;
+        uint64 futexVal;
+        uint64 futexTimeoutStep;
+        uint64 stepsSinceContextSwitch;
+        uint64 nextThreadID;
+        uint64 clockEpoch;
+        uint64 clockOffset;
+        uint64 randomState;
+        bool traverseRight;
+        bytes32 leftThreadStack;
+        bytes32 rightThreadStack;
+        bytes32 freeRangeStack;
+        MemoryRegion[8] memoryRegions;
     }
 
     IBigStepper internal riscv;
@@ -44,6 +68,8 @@ contract RISCV_Test is CommonTest {
         // state and proof from first step of `simple` binary
         uint64[32] memory registers;
         registers[2] = 0x1000000000000000;
+        uint64[32] memory fpRegisters;
+        MemoryRegion[8] memory memoryRegions;
         State memory state = State({
             memRoot: hex"f0df7f266aed88bde90ed121f0de6865f3fa88bf67d3a4657dad876038393b2c",
             preimageKey: bytes32(0),
@@ -54,7 +80,20 @@ contract RISCV_Test is CommonTest {
             step: 1,
             heap: 0x7f0000000000,
             loadReservation: 0,
-            registers: registers
+            registers: registers,
+            fpRegisters: fpRegisters,
+            fcsr: 0,
+            threadID: 1,
+            futexAddr: 0,
+            futexVal: 0,
+            futexTimeoutStep: 0,
+            stepsSinceContextSwitch: 0,
+            nextThreadID: 2,
+            traverseRight: false,
+            leftThreadStack: bytes32(0),
+            rightThreadStack: bytes32(0),
+            freeRangeStack: bytes32(0),
+            memoryRegions: memoryRegions
         });
         bytes memory proof =
             hex"67800f0000000000971f000067800fb40000000000000000033501009305810083348102033401028333810103330101833281008330011d833f01001301811d3c68dba488488bae6478015e476f03a8d0b8f27f087b388bc41ed6c40c492b8ddb41e1d33c6d417324675080ecc5eea5b78f9f539896eb892480de2d33425b20420848eec624fdddc1dac146378ea52a5f03ebb2406d89e01d6304eea742033b42251ce9146b8e43af396434ba823722b4b9977c7062ef2322e5aeb382aefed453b602acc24b2b7d34a8ff2517b7499c9b20510277c2ae05f9cb5fd208ae88a62487d85a07577b9b2c16090488dcfc1fd6ade786ce75056d078abb377db79b211ed2e42c800d3dbb0340afd72bbf760305c444b999a6c6c6d32ee6e9673249d1730c967c62d92e2699234529fa4b749784620a21a0c1a4b2ad81da6507e4fb66fca30cbd5a4da0f9cd5636ab0fc223d399af831578c83d4c10c38972964ba0d670bed1afb5ffc60a2d4dde7e36f5a498f0671d880973cabeeca428a627c5a04b16268248aef083470b7c9e91aeeb49da103cd6519718cca728fda79218038f29e70762ff98d65de0e69f568fa353d115bbf9b5b42dc397706afdcf6d2ff2a68153e7f911d48d5c6292883912b3ee8852e64b8229080b8888b1e9f61524aee439bcdbaf59170f519ccef13111146b601aeba12c990e5f484ea70a617f5ea2f38c538635459bf00023877e777e6c3041df40cfb93eb8637d06ea44eb1f88a91e0adf644bb7710c751982cbbb32a4003bc655cc26cbea017bdd9dcd192c860eff71e1d3b5c807b281e4683cc6d6315cf95b9ade8641defcb32372f1c126e398ef7a5a2dce0a8a7f68bb74560f8f71837c2c2ebbcbf7fffb42ae1896f13f7c7479a0b46a28b6f55540f89444f63de0378e3d121be09e06cc9ded1c20e65876d36aa0c65e9645644786b620e2dd2ad648ddfcbf4a7e5b1a3a4ecfe7f64667a3f0b7e2f4418588ed35a2458cffeb39b93d26f18d2ab13bdce6aee58e7b99359ec2dfd95a9c16dc00d6ef18b7933a6f8dc65ccb55667138776f7dea101070dc8796e3774df84f40ae0c8229d0d6069e5c8f39a7c299677a09d367fc7b05e3bc380ee652cdc72595f74c7b1043d0e1ffbab734648c838dfb0527d971b602bc216c9619ef0abf5ac974a1ed57f4050aa510dd9c74f508277b39d7973bb2dfccc5eeb0618db8cd74046ff337f0a7bf2c8e03e10f642c1886798d71806ab1e888d9e5ee87d0838c5655cb21c6cb83313b5a631175dff4963772cce9108188b34ac87c81c41e662ee4dd2dd7b2bc707961b1e646c4047669dcb6584f0d8d770daf5d7e7deb2e388ab20e2573d171a88108e79d820e98f26c0b84aa8b2f4aa4968dbb818ea32293237c50ba75ee485f4c22adf2f741400bdf8d6a9cc7df7ecae576221665d7358448818bb4ae4562849e949e17ac16e0be16688e156b5cf15e098c627c0056a927ae5ba08d7291c96c8cbddcc148bf48a6d68c7974b94356f53754ef6171d757bf558bebd2ceec7f3c5dce04a4782f88c2c6036ae78ee206d0bc5289d20461a2e21908c2968c0699040a6fd866a577a99a9d2ec88745c815fd4a472c789244daae824d72ddc272aab68a8c3022e36f10454437c1886f3ff9927b64f232df414f27e429a4bef3083bc31a671d046ea5c1f5b8c3094d72868d9dfdc12c7334ac5f743cc5c365a9a6a15c1f240ac25880c7a9d1de290696cb766074a1d83d9278164adcf616c3bfabf63999a01966c998b7bb572774035a63ead49da73b5987f34775786645d0c5dd7c04a2f8a75dcae085213652f5bce3ea8b9b9bedd1cab3c5e9b88b152c9b8a7b79637d35911848b0c41e7cc7cca2ab4fe9a15f9c38bb4bb9390c4e2d8ce834ffd7a6cd85d7113d4521abb857774845c4291e6f6d010d97e3185bc799d83e3bb31501b3da786680df30fbc18eb41cbce611e8c0e9c72f69571ca10d3ef857d04d9c03ead7c6317d797a090fa1271ad9c7addfbcb412e9643d4fb33b1809c42623f474055fa9400a2027a7a885c8dfa4efe20666b4ee27d7529c134d7f28d53f175f6bf4b62faa2110d5b76f0f770c15e628181c1fcc18f970a9c34d24b2fc8c50ca9c07a7156ef4e5ff4bdf002eda0b11c1d359d0b59a54680704dbb9db631457879b27e0dfdbe50158fd9cf9b4cf77605c4ac4c95bd65fc9f6f9295a686647cb999090819cda700820c282c613cedcd218540bbc6f37b01c6567c4a1ea624f092a3a5cca2d6f0f0db231972fce627f0ecca0dee60f17551c5f8fdaeb5ab560b2ceb781cdb339361a0fbee1b9dffad59115138c8d6a70dda9ccc1bf0bbdd7fee15764845db875f6432559ff8dbc9055324431bc34e5b93d15da307317849eccd90c0c7b98870b9317c15a5959dcfb84c76dcc908c4fe6ba92126339bf06e458f6646df5e83ba7c3d35bc263b3222c8e9040068847749ca8e8f95045e4342aeb521eb3a5587ec268ed3aa6faf32b62b0bc41a9d549521f406fc3ec7d4dabb75e0d3e144d7cc882372d13746b6dcd481b1b229bcaec9f7422cdfb84e35c5d92171376cae5c86300822d729cd3a8479583bef09527027dba5f11263c5cbbeb3834b7a5c1cba9aa5fee0c95ec3f17a33ec3d8047fff799187f5ae2040bbe913c226c34c9fbe4389dd728984257a816892b3cae3e43191dd291f0eb50000000000000000420000000000000035000000000000000000000000000000060000000000000000100000000000001900000000000000480000000000001050edbc06b4bfc3ee108b66f7a8f772ca4d90e1a085f4a8398505920f7465bb44b4c11951957c6f8f642c4af61cd6b24640fec6dc7fc607ee8206a99e92410d3021ddb9a356815c3fac1026b6dec5df3124afbadb485c9ba5a3e3398a04b7ba85e58769b32a1beaf1ea27375a44095a0d1fb664ce2dd358e7fcbfb78c26a193440eb01ebfc9ed27500cd4dfc979272d1f0913cc9f66540d7e8005811109e1cf2d887c22bd8750d34016ac3c66b5ff102dacdd73f6b014e710b51e8022af9a1968ffd70157e48063fc33c97a050f7f640233bf646cc98d9524c6b92bcf3ab56f839867cc5f7f196b93bae1e27e6320742445d290f2263827498b54fec539f756afcefad4e508c098b9a7e1d8feb19955fb02ba9675585078710969d3440f5054e0f9dc3e7fe016e050eff260334f18a5d4fe391d82092319f5964f2e2eb7c1c3a5f8b13a49e282f609c317a833fb8d976d11517c571d1221a265d25af778ecf8923490c6ceeb450aecdc82e28293031d10c7d73bf85e57bf041a97360aa2c5d99cc1df82d9c4b87413eae2ef048f94b4d3554cea73d92b0f7af96e0271c691e2bb5c67add7c6caf302256adedf7ab114da0acfe870d449a3a489f781d659e8beccda7bce9f4e8618b6bd2f4132ce798cdc7a60e7e1460a7299e3c6342a579626d22733e50f526ec2fa19a22b31e8ed50f23cd1fdf94c9154ed3a7609a2f1ff981fe1d3b5c807b281e4683cc6d6315cf95b9ade8641defcb32372f1c126e398ef7a5a2dce0a8a7f68bb74560f8f71837c2c2ebbcbf7fffb42ae1896f13f7c7479a0b46a28b6f55540f89444f63de0378e3d121be09e06cc9ded1c20e65876d36aa0c65e9645644786b620e2dd2ad648ddfcbf4a7e5b1a3a4ecfe7f64667a3f0b7e2f4418588ed35a2458cffeb39b93d26f18d2ab13bdce6aee58e7b99359ec2dfd95a9c16dc00d6ef18b7933a6f8dc65ccb55667138776f7dea101070dc8796e3774df84f40ae0c8229d0d6069e5c8f39a7c299677a09d367fc7b05e3bc380ee652cdc72595f74c7b1043d0e1ffbab734648c838dfb0527d971b602bc216c9619ef0abf5ac974a1ed57f4050aa510dd9c74f508277b39d7973bb2dfccc5eeb0618db8cd74046ff337f0a7bf2c8e03e10f642c1886798d71806ab1e888d9e5ee87d0838c5655cb21c6cb83313b5a631175dff4963772cce9108188b34ac87c81c41e662ee4dd2dd7b2bc707961b1e646c4047669dcb6584f0d8d770daf5d7e7deb2e388ab20e2573d171a88108e79d820e98f26c0b84aa8b2f4aa4968dbb818ea32293237c50ba75ee485f4c22adf2f741400bdf8d6a9cc7df7ecae576221665d7358448818bb4ae4562849e949e17ac16e0be16688e156b5cf15e098c627c0056a927ae5ba08d7291c96c8cbddcc148bf48a6d68c7974b94356f53754ef6171d757bf558bebd2ceec7f3c5dce04a4782f88c2c6036ae78ee206d0bc5289d20461a2e21908c2968c0699040a6fd866a577a99a9d2ec88745c815fd4a472c789244daae824d72ddc272aab68a8c3022e36f10454437c1886f3ff9927b64f232df414f27e429a4bef3083bc31a671d046ea5c1f5b8c3094d72868d9dfdc12c7334ac5f743cc5c365a9a6a15c1f240ac25880c7a9d1de290696cb766074a1d83d9278164adcf616c3bfabf63999a01966c998b7bb572774035a63ead49da73b5987f34775786645d0c5dd7c04a2f8a75dcae085213652f5bce3ea8b9b9bedd1cab3c5e9b88b152c9b8a7b79637d35911848b0c41e7cc7cca2ab4fe9a15f9c38bb4bb9390c4e2d8ce834ffd7a6cd85d7113d4521abb857774845c4291e6f6d010d97e3185bc799d83e3bb31501b3da786680df30fbc18eb41cbce611e8c0e9c72f69571ca10d3ef857d04d9c03ead7c6317d797a090fa1271ad9c7addfbcb412e9643d4fb33b1809c42623f474055fa9400a2027a7a885c8dfa4efe20666b4ee27d7529c134d7f28d53f175f6bf4b62faa2110d5b76f0f770c15e628181c1fcc18f970a9c34d24b2fc8c50ca9c07a7156ef4e5ff4bdf002eda0b11c1d359d0b59a54680704dbb9db631457879b27e0dfdbe50158fd9cf9b4cf77605c4ac4c95bd65fc9f6f9295a686647cb999090819cda700820c282c613cedcd218540bbc6f37b01c6567c4a1ea624f092a3a5cca2d6f0f0db231972fce627f0ecca0dee60f17551c5f8fdaeb5ab560b2ceb781cdb339361a0fbee1b9dffad59115138c8d6a70dda9ccc1bf0bbdd7fee15764845db875f6432559ff8dbc9055324431bc34e5b93d15da307317849eccd90c0c7b98870b9317c15a5959dcfb84c76dcc908c4fe6ba92126339bf06e458f6646df5e83ba7c3d35bc263b3222c8e9040068847749ca8e8f95045e4342aeb521eb3a5587ec268ed3aa6faf32b62b0bc41a9d549521f406fc3bbdff18e513dcd75f7e478e4acb5c91463476a9d83b6b77b4c56ecfe549280ab84e35c5d92171376cae5c86300822d729cd3a8479583bef09527027dba5f11263c5cbbeb3834b7a5c1cba9aa5fee0c95ec3f17a33ec3d8047fff799187f5ae2040bbe913c226c34c9fbe4389dd728984257a816892b3cae3e43191dd291f0eb5";
@@ -72,6 +111,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -91,6 +131,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -110,6 +151,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -129,6 +171,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -148,6 +191,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -167,6 +211,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -186,6 +231,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -206,6 +252,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -230,6 +277,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -249,6 +297,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -268,6 +317,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -287,6 +337,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -306,6 +357,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -325,6 +377,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -345,6 +398,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -370,6 +424,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -390,6 +445,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -410,6 +466,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -430,6 +487,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -450,6 +508,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -469,6 +528,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -488,6 +548,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -507,6 +568,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -526,6 +588,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -550,6 +613,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -572,6 +636,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -593,6 +658,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -615,6 +681,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -634,6 +701,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -659,6 +727,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -686,6 +755,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, rs2ValueBytes32);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -716,6 +786,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of rs2
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, rs2ValueBytes32);
         expect.pc = state.pc + 4;
@@ -747,6 +818,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] + x[rs2]
         bytes32 result = uint256ToBytes32(
             uint256(
@@ -784,6 +856,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] ^ x[rs2]
         bytes32 result = uint256ToBytes32(
             uint256(
@@ -821,6 +894,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] & x[rs2]
         bytes32 result = uint256ToBytes32(
             uint256(
@@ -857,6 +931,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] | x[rs2]
         bytes32 result = uint256ToBytes32(
             uint256(
@@ -894,6 +969,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of min(M[x[rs1]], x[rs2])
         bytes32 result = int32(int64(rs2ValueU64)) < int32(int64(memValueU64)) ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -926,6 +1002,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of max(M[x[rs1]], x[rs2])
         bytes32 result = int32(int64(rs2ValueU64)) > int32(int64(memValueU64)) ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -958,6 +1035,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of min(unsigned M[x[rs1]], unsigned x[rs2])
         bytes32 result =
             uint32(int32(int64(rs2ValueU64))) < uint32(int32(int64(memValueU64))) ? rs2ValueBytes32 : memValueBytes32;
@@ -991,6 +1069,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of max(unsigned M[x[rs1]], unsigned x[rs2])
         bytes32 result =
             uint32(int32(int64(rs2ValueU64))) > uint32(int32(int64(memValueU64))) ? rs2ValueBytes32 : memValueBytes32;
@@ -1018,6 +1097,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1045,6 +1125,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, rs2ValueBytes32);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1074,6 +1155,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of rs2
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, rs2ValueBytes32);
         expect.pc = state.pc + 4;
@@ -1105,6 +1187,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] + x[rs2]
         bytes32 result = uint256ToBytes32(uint256(uint128(int128(int64(rs2ValueU64)) + int128(int64(memValueU64)))));
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1137,6 +1220,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] ^ x[rs2]
         bytes32 result = uint256ToBytes32(uint256(rs2ValueU64 ^ memValueU64));
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1169,6 +1253,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] & x[rs2]
         bytes32 result = uint256ToBytes32(uint256(rs2ValueU64 & memValueU64));
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1200,6 +1285,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] | x[rs2]
         bytes32 result = uint256ToBytes32(uint256(rs2ValueU64 | memValueU64));
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1232,6 +1318,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of min(M[x[rs1]], x[rs2])
         bytes32 result = int64(rs2ValueU64) < int64(memValueU64) ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1264,6 +1351,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of max(M[x[rs1]], x[rs2])
         bytes32 result = int64(rs2ValueU64) > int64(memValueU64) ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1296,6 +1384,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of min(unsigned M[x[rs1]], unsigned x[rs2])
         bytes32 result = rs2ValueU64 < memValueU64 ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1328,6 +1417,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of max(unsigned M[x[rs1]], unsigned x[rs2])
         bytes32 result = rs2ValueU64 > memValueU64 ? rs2ValueBytes32 : memValueBytes32;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -1352,6 +1442,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1370,6 +1461,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1388,6 +1480,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1406,6 +1499,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1424,6 +1518,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1442,6 +1537,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1462,6 +1558,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1485,6 +1582,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1503,6 +1601,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1521,6 +1620,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1540,6 +1640,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1559,6 +1660,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1579,6 +1681,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1605,6 +1708,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.registers[15] = state.pc + 4;
         expect.pc = state.registers[3] + imm;
@@ -1618,8 +1722,8 @@ contract RISCV_Test is CommonTest {
     }
 
     function test_ecall_succeeds() public {
-        // some syscalls are not supported
-        // lets choose unsupported syscall clone just for testing functionality
+        // clone only supports the flags that the Go runtime uses to create threads,
+        // lets choose clone without flags just for testing functionality
         uint16 imm = 0x0;
         uint32 insn = encodeIType(0x73, 0, 0, 0, imm); // ecall
         uint64 pc = 0x1337;
@@ -1628,10 +1732,58 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.registers[10] = type(uint64).max;
+        expect.registers[11] = 0x16; // EINVAL
+        expect.registers[17] = state.registers[17];
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_ecall_gettid_succeeds() public {
+        uint16 imm = 0x0;
+        uint32 insn = encodeIType(0x73, 0, 0, 0, imm); // ecall
+        uint64 pc = 0x4000;
+        (State memory state, bytes memory proof) = constructRISCVState(pc, insn);
+        state.registers[17] = 178; // syscall number of gettid
+        state.threadID = 7;
+        state.nextThreadID = 8;
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.threadID = state.threadID;
+        expect.nextThreadID = state.nextThreadID;
+        expect.registers[10] = state.threadID;
+        expect.registers[11] = 0;
+        expect.registers[17] = state.registers[17];
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_ecall_sched_yield_succeeds() public {
+        uint16 imm = 0x0;
+        uint32 insn = encodeIType(0x73, 0, 0, 0, imm); // ecall
+        uint64 pc = 0x4000;
+        (State memory state, bytes memory proof) = constructRISCVState(pc, insn);
+        state.registers[17] = 124; // syscall number of sched_yield
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[10] = 1;
+        expect.stepsSinceContextSwitch = 100000; // the thread is preempted on the next step
+        expect.registers[10] = 0;
         expect.registers[11] = 0;
         expect.registers[17] = state.registers[17];
 
@@ -1648,6 +1800,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1667,6 +1820,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1694,6 +1848,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1721,6 +1876,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1747,6 +1903,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1768,6 +1925,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1788,6 +1946,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1808,6 +1967,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1826,10 +1986,11 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[13] = 0; // CSR is not supported
+        expect.registers[13] = 0; // unsupported CSRs read as zero
         expect.registers[2] = state.registers[2];
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
@@ -1844,10 +2005,11 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[7] = 0; // CSR is not supported
+        expect.registers[7] = 0; // unsupported CSRs read as zero
         expect.registers[10] = state.registers[10];
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
@@ -1862,10 +2024,11 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[1] = 0; // CSR is not supported
+        expect.registers[1] = 0; // unsupported CSRs read as zero
         expect.registers[25] = state.registers[25];
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
@@ -1880,10 +2043,11 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[31] = 0; // CSR is not supported
+        expect.registers[31] = 0; // unsupported CSRs read as zero
         expect.registers[29] = state.registers[29];
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
@@ -1892,17 +2056,20 @@ contract RISCV_Test is CommonTest {
 
     function test_csrrsi_succeeds() public {
         uint16 imm = 0x1;
-        uint32 insn = encodeIType(0x73, 17, 6, 22, imm); // csrrsi x17, 0x1, x22
+        uint32 insn = encodeIType(0x73, 17, 6, 22, imm); // csrrsi x17, fflags, 22
         (State memory state, bytes memory proof) = constructRISCVState(0, insn);
         state.registers[22] = 0x856a;
+        state.fcsr = 0x41; // frm = RDN, NX
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[17] = 0; // CSR is not supported
+        expect.registers[17] = 0x01; // NX
         expect.registers[22] = state.registers[22];
+        expect.fcsr = 0x57; // OF, UF and NV are set
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
         assertEq(postState, outputState(expect), "unexpected post state");
@@ -1916,16 +2083,45 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
-        expect.registers[23] = 0; // CSR is not supported
+        expect.registers[23] = 0; // unsupported CSRs read as zero
         expect.registers[18] = state.registers[18];
 
         bytes32 postState = riscv.step(encodedState, proof, 0);
         assertEq(postState, outputState(expect), "unexpected post state");
     }
 
+    function test_rdcycle_succeeds() public {
+        uint16 imm = 0xc00;
+        uint32 insn = encodeIType(0x73, 5, 2, 0, imm); // csrrs x5, cycle, x0
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        state.step = 0x1234;
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.registers[5] = 0x1234; // the instructions before this one
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_revert_write_read_only_csr() public {
+        uint16 imm = 0xc02;
+        uint32 insn = encodeIType(0x73, 5, 1, 6, imm); // csrrw x5, instret, x6
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        bytes memory encodedState = encodeState(state);
+
+        vm.expectRevert(hex"000000000000000000000000000000000000000000000000000000000badc0de");
+        riscv.step(encodedState, proof, 0);
+    }
+
     /* S Type instructions */
 
     function test_sb_succeeds() public {
@@ -1948,6 +2144,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, target);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -1978,6 +2175,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, target);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -2008,6 +2206,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, target);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -2038,6 +2237,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, target);
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -2059,6 +2259,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (state.registers[23] == state.registers[20]) {
@@ -2087,6 +2288,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (state.registers[20] != state.registers[26]) {
@@ -2115,6 +2317,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (int64(state.registers[9]) < int64(state.registers[19])) {
@@ -2143,6 +2346,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (int64(state.registers[27]) >= int64(state.registers[11])) {
@@ -2171,6 +2375,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (state.registers[13] < state.registers[22]) {
@@ -2199,6 +2404,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc;
         if (state.registers[7] >= state.registers[16]) {
@@ -2227,6 +2433,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -2248,6 +2455,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.pc = state.pc + 4;
         expect.step = state.step + 1;
@@ -2271,6 +2479,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         expect.memRoot = state.memRoot;
         expect.step = state.step + 1;
         uint64 offsetSignExtended = (imm & ((1 << 21) - 1)) - (imm & 1);
@@ -2285,6 +2494,107 @@ contract RISCV_Test is CommonTest {
         assertEq(postState, outputState(expect), "unexpected post state");
     }
 
+    /* Compressed */
+
+    function test_c_addi_succeeds() public {
+        uint32 insn = 0x0515; // c.addi x10, 5
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        state.registers[10] = 0xedf0;
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 2;
+        expect.step = state.step + 1;
+        expect.registers[10] = state.registers[10] + 5;
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_revert_reserved_compressed_instruction() public {
+        uint32 insn = 0x0000; // c.addi4spn with a zero immediate is reserved
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        bytes memory encodedState = encodeState(state);
+
+        vm.expectRevert(hex"000000000000000000000000000000000000000000000000000000000badc0de");
+        riscv.step(encodedState, proof, 0);
+    }
+
+    /* Floating point */
+
+    function test_fadd_d_succeeds() public {
+        uint32 insn = encodeRType(0x53, 3, 7, 1, 2, 0x01); // fadd.d f3, f1, f2 (dynamic rounding mode)
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        state.fpRegisters[1] = 0x3ff0000000000000; // 1.0
+        state.fpRegisters[2] = 0x3fb999999999999a; // 0.1
+        state.fcsr = 0x60; // frm = RUP
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.fpRegisters[1] = state.fpRegisters[1];
+        expect.fpRegisters[2] = state.fpRegisters[2];
+        expect.fpRegisters[3] = 0x3ff199999999999a; // 1.1, rounded up
+        expect.fcsr = 0x61; // NX
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_fdiv_s_by_zero_succeeds() public {
+        uint32 insn = encodeRType(0x53, 3, 0, 1, 2, 0x0c); // fdiv.s f3, f1, f2
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        state.fpRegisters[1] = 0xffffffffbf800000; // -1.0
+        state.fpRegisters[2] = 0xffffffff00000000; // +0.0
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.fpRegisters[1] = state.fpRegisters[1];
+        expect.fpRegisters[2] = state.fpRegisters[2];
+        expect.fpRegisters[3] = 0xffffffffff800000; // -inf, NaN-boxed
+        expect.fcsr = 0x08; // DZ
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_fcvt_l_d_succeeds() public {
+        uint32 insn = encodeRType(0x53, 10, 1, 1, 2, 0x61); // fcvt.l.d x10, f1, rtz
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        state.fpRegisters[1] = 0xc004000000000000; // -2.5
+        bytes memory encodedState = encodeState(state);
+
+        State memory expect;
+        expect.memoryRegions = state.memoryRegions;
+        expect.memRoot = state.memRoot;
+        expect.pc = state.pc + 4;
+        expect.step = state.step + 1;
+        expect.registers[10] = 0xfffffffffffffffe; // -2
+        expect.fpRegisters[1] = state.fpRegisters[1];
+        expect.fcsr = 0x01; // NX
+
+        bytes32 postState = riscv.step(encodedState, proof, 0);
+        assertEq(postState, outputState(expect), "unexpected post state");
+    }
+
+    function test_revert_invalid_rounding_mode() public {
+        uint32 insn = encodeRType(0x53, 3, 5, 1, 2, 0x01); // fadd.d f3, f1, f2 with reserved rounding mode 5
+        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+        bytes memory encodedState = encodeState(state);
+
+        vm.expectRevert(hex"000000000000000000000000000000000000000000000000000000000badc0de");
+        riscv.step(encodedState, proof, 0);
+    }
+
     /* Syscalls */
 
     function test_preimage_read_succeeds() public {
@@ -2458,6 +2768,7 @@ contract RISCV_Test is CommonTest {
         bytes memory encodedState = encodeState(state);
 
         State memory expect;
+        expect.memoryRegions = state.memoryRegions;
         // check memory stores value of M[x[rs1]] + x[rs2]
         bytes32 result = uint256ToBytes32(uint256(uint128(int128(int64(rs2ValueU64)) + int128(int64(memValueU64)))));
         (expect.memRoot,) = ffi.getAsteriscMemoryProof(0, insn, addr, result);
@@ -2519,11 +2830,10 @@ contract RISCV_Test is CommonTest {
         riscv.step(encodedState, proof, 0);
     }
 
-    function test_revert_unaligned_jal_instruction() public {
-        // 0xbef054ae % 4 != 0
-        uint32 imm = 0xbef054ae;
-        uint32 insn = encodeJType(0x6f, 5, imm); // jal x5, imm
-        (State memory state, bytes memory proof) = constructRISCVState(0, insn);
+    function test_revert_unaligned_pc() public {
+        // 0x1 % 2 != 0
+        uint32 insn = encodeIType(0x13, 26, 0, 25, 0x373); // addi x26, x25, 0x373
+        (State memory state, bytes memory proof) = constructRISCVState(1, insn);
         bytes memory encodedState = encodeState(state);
 
         vm.expectRevert(hex"00000000000000000000000000000000000000000000000000000000bad10ad0");
@@ -2537,6 +2847,15 @@ contract RISCV_Test is CommonTest {
         for (uint256 i = 0; i < state.registers.length; i++) {
             registers = bytes.concat(registers, abi.encodePacked(state.registers[i]));
         }
+        bytes memory fpRegisters;
+        for (uint256 i = 0; i < state.fpRegisters.length; i++) {
+            fpRegisters = bytes.concat(fpRegisters, abi.encodePacked(state.fpRegisters[i]));
+        }
+        bytes memory memoryRegions;
+        for (uint256 i = 0; i < state.memoryRegions.length; i++) {
+            MemoryRegion memory r = state.memoryRegions[i];
+            memoryRegions = bytes.concat(memoryRegions, abi.encodePacked(r.start, r.end, r.prot));
+        }
         bytes memory stateData = abi.encodePacked(
             state.memRoot,
             state.preimageKey,
@@ -2547,7 +2866,23 @@ contract RISCV_Test is CommonTest {
             state.step,
             state.heap,
             state.loadReservation,
-            registers
+            registers,
+            fpRegisters,
+            state.fcsr,
+            state.threadID,
+            state.futexAddr,
+            state.futexVal,
+            state.futexTimeoutStep,
+            state.stepsSinceContextSwitch,
+            state.nextThreadID,
+            state.clockEpoch,
+            state.clockOffset,
+            state.randomState,
+            state.traverseRight,
+            state.leftThreadStack,
+            state.rightThreadStack,
+            state.freeRangeStack,
+            memoryRegions
         );
         return stateData;
     }
@@ -2573,11 +2908,17 @@ contract RISCV_Test is CommonTest {
         bytes memory enc = encodeState(state);
         VMStatus status = vmStatus(state);
         assembly {
-            out_ := keccak256(add(enc, 0x20), 362)
+            out_ := keccak256(add(enc, 0x20), 931)
             out_ := or(and(not(shl(248, 0xFF)), out_), shl(248, status))
         }
     }
 
+    /// @dev The memory regions of a state without memory protection: all memory but the last page has all
+    ///      permissions.
+    function unprotectedRegions() internal pure returns (MemoryRegion[8] memory regions_) {
+        regions_[0] = MemoryRegion({ start: 0, end: type(uint64).max & ~uint64(0xfff), prot: 7 });
+    }
+
     function constructRISCVState(
         uint64 pc,
         uint32 insn,
@@ -2589,11 +2930,15 @@ contract RISCV_Test is CommonTest {
     {
         (state.memRoot, proof) = ffi.getAsteriscMemoryProof(pc, insn, addr, val);
         state.pc = pc;
+        // memory outside any region is not executable: run unprotected
+        state.memoryRegions = unprotectedRegions();
     }
 
     function constructRISCVState(uint64 pc, uint32 insn) internal returns (State memory state, bytes memory proof) {
         (state.memRoot, proof) = ffi.getAsteriscMemoryProof(pc, insn);
         state.pc = pc;
+        // memory outside any region is not executable: run unprotected
+        state.memoryRegions = unprotectedRegions();
     }
 
     function encodeRType(
@@ -0,0 +1,70 @@
+// The test environment of the test sources: the user-level counterpart of the "p" environment of riscv-tests.
+// Asterisc has no privileged mode or traps, so the code starts in user mode with the registers cleared,
+// and reports the result with the exit syscall, like the fail and pass code of the riscv-tests vectors.
+
+#ifndef _ENV_ASTERISC_TEST_H
+#define _ENV_ASTERISC_TEST_H
+
+#define TESTNUM gp
+
+#define RVTEST_RV64U                                                    \
+  .macro init;                                                          \
+  .endm
+
+#define RVTEST_RV64UF                                                   \
+  .macro init;                                                          \
+  csrwi fcsr, 0;                                                        \
+  .endm
+
+#define INIT_XREG                                                       \
+  li x1, 0; li x2, 0; li x3, 0; li x4, 0; li x5, 0; li x6, 0;           \
+  li x7, 0; li x8, 0; li x9, 0; li x10, 0; li x11, 0; li x12, 0;        \
+  li x13, 0; li x14, 0; li x15, 0; li x16, 0; li x17, 0; li x18, 0;     \
+  li x19, 0; li x20, 0; li x21, 0; li x22, 0; li x23, 0; li x24, 0;     \
+  li x25, 0; li x26, 0; li x27, 0; li x28, 0; li x29, 0; li x30, 0;     \
+  li x31, 0
+
+#define RVTEST_CODE_BEGIN                                               \
+  .section .text.init, "ax", @progbits;                                 \
+  .option norelax;                                                      \
+  .align 6;                                                             \
+  .globl _start;                                                        \
+_start:                                                                 \
+  INIT_XREG;                                                            \
+  li TESTNUM, 0;                                                        \
+  init;
+
+#define RVTEST_CODE_END                                                 \
+  unimp
+
+#define RVTEST_PASS                                                     \
+  fence;                                                                \
+  li TESTNUM, 1;                                                        \
+  li a7, 93;                                                            \
+  li a0, 0;                                                             \
+  ecall
+
+#define RVTEST_FAIL                                                     \
+  fence;                                                                \
+1:beqz TESTNUM, 1b;                                                     \
+  sll TESTNUM, TESTNUM, 1;                                              \
+  or TESTNUM, TESTNUM, 1;                                               \
+  li a7, 93;                                                            \
+  addi a0, TESTNUM, 0;                                                  \
+  ecall
+
+#define EXTRA_DATA
+
+#define RVTEST_DATA_BEGIN                                               \
+  EXTRA_DATA                                                            \
+  .section .data, "aw", @progbits;                                      \
+  .align 4;                                                             \
+  .globl begin_signature;                                               \
+begin_signature:
+
+#define RVTEST_DATA_END                                                 \
+  .align 4;                                                             \
+  .globl end_signature;                                                 \
+end_signature:
+
+#endif
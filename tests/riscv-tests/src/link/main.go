@@ -0,0 +1,328 @@
+// link links the relocatable object of a test source into a test vector:
+// an ELF executable with .text.init at 0x80000000 and .data on the page after it,
+// in the layout of the riscv-tests vectors.
+//
+// The sources are assembled without linker relaxation, so that the assembler resolves all branches and jumps,
+// and only the PC-relative addressing of .data from .text.init, and absolute data words, are left to relocate.
+//
+// Usage: go run ./link <object> <output>
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	textAddr = 0x80000000
+	pageSize = 0x1000
+)
+
+// section is an output section, with the index of the input section that it is copied from
+type section struct {
+	name  string
+	in    int
+	addr  uint64
+	data  []byte
+	flags elf.SectionFlag
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: link <object> <output>")
+		os.Exit(2)
+	}
+	if err := link(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintf(os.Stderr, "link %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func link(inPath, outPath string) error {
+	f, err := elf.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if f.Type != elf.ET_REL || f.Machine != elf.EM_RISCV || f.Class != elf.ELFCLASS64 {
+		return fmt.Errorf("not a relocatable RV64 object")
+	}
+
+	var sections []*section
+	addr := uint64(textAddr)
+	for _, name := range []string{".text.init", ".data"} {
+		in := f.Section(name)
+		if in == nil || in.Size == 0 {
+			if name == ".text.init" {
+				return fmt.Errorf("missing .text.init section")
+			}
+			continue
+		}
+		data, err := in.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		addr = (addr + pageSize - 1) &^ (pageSize - 1)
+		sections = append(sections, &section{name: name, in: sectionIndex(f, in), addr: addr, data: data, flags: in.Flags})
+		addr += uint64(len(data))
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Size != 0 && s.Name != ".text.init" && s.Name != ".data" {
+			return fmt.Errorf("unsupported section %s, the code must be in .text.init and the data in .data", s.Name)
+		}
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		return fmt.Errorf("failed to read symbols: %w", err)
+	}
+	symAddr := func(sym elf.Symbol) (uint64, error) {
+		if sym.Section == elf.SHN_ABS {
+			return sym.Value, nil
+		}
+		for _, s := range sections {
+			if int(sym.Section) == s.in {
+				return s.addr + sym.Value, nil
+			}
+		}
+		return 0, fmt.Errorf("symbol %q is not defined in .text.init or .data", sym.Name)
+	}
+
+	for _, s := range sections {
+		if err := relocate(f, s, syms, symAddr); err != nil {
+			return fmt.Errorf("failed to relocate %s: %w", s.name, err)
+		}
+	}
+
+	out, err := write(sections, syms, symAddr)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, out, 0o755)
+}
+
+func sectionIndex(f *elf.File, s *elf.Section) int {
+	for i, other := range f.Sections {
+		if other == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// relocate applies the relocations of the section
+func relocate(f *elf.File, s *section, syms []elf.Symbol, symAddr func(elf.Symbol) (uint64, error)) error {
+	rela := f.Section(".rela" + s.name)
+	if rela == nil {
+		return nil
+	}
+	data, err := rela.Data()
+	if err != nil {
+		return err
+	}
+	relocs := make([]elf.Rela64, len(data)/24)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, relocs); err != nil {
+		return err
+	}
+
+	// the value of the PCREL_HI20 relocation at each address, which the PCREL_LO12 relocations refer to
+	hi20 := make(map[uint64]int64)
+	// the HI20 relocations are resolved first, the LO12 relocations may come before their HI20 relocation
+	sort.SliceStable(relocs, func(i, j int) bool {
+		return elf.R_RISCV(elf.R_TYPE64(relocs[i].Info)) == elf.R_RISCV_PCREL_HI20 &&
+			elf.R_RISCV(elf.R_TYPE64(relocs[j].Info)) != elf.R_RISCV_PCREL_HI20
+	})
+	for _, r := range relocs {
+		typ := elf.R_RISCV(elf.R_TYPE64(r.Info))
+		if typ == elf.R_RISCV_RELAX {
+			continue
+		}
+		symIndex := int(elf.R_SYM64(r.Info))
+		if symIndex == 0 || symIndex > len(syms) {
+			return fmt.Errorf("%s at %#x has invalid symbol index %d", typ, r.Off, symIndex)
+		}
+		sym := syms[symIndex-1]
+		target, err := symAddr(sym)
+		if err != nil {
+			return err
+		}
+		size := uint64(4)
+		if typ == elf.R_RISCV_64 {
+			size = 8
+		}
+		if r.Off+size > uint64(len(s.data)) {
+			return fmt.Errorf("%s at %#x is out of range", typ, r.Off)
+		}
+		at := s.data[r.Off:]
+		pc := s.addr + r.Off
+		instr := binary.LittleEndian.Uint32(at)
+		switch typ {
+		case elf.R_RISCV_64:
+			binary.LittleEndian.PutUint64(at, target+uint64(r.Addend))
+		case elf.R_RISCV_32:
+			binary.LittleEndian.PutUint32(at, uint32(target+uint64(r.Addend)))
+		case elf.R_RISCV_PCREL_HI20:
+			v := int64(target) + r.Addend - int64(pc)
+			hi20[pc] = v
+			binary.LittleEndian.PutUint32(at, instr&0xfff|uint32((v+0x800)>>12)<<12)
+		case elf.R_RISCV_PCREL_LO12_I, elf.R_RISCV_PCREL_LO12_S:
+			// the symbol is the label of the auipc instruction of the HI20 relocation
+			v, ok := hi20[target]
+			if !ok {
+				return fmt.Errorf("%s at %#x refers to %q without a PCREL_HI20 relocation", typ, r.Off, sym.Name)
+			}
+			lo := uint32(v - ((v + 0x800) >> 12 << 12))
+			if typ == elf.R_RISCV_PCREL_LO12_I {
+				instr = instr&0xfffff | lo<<20
+			} else {
+				instr = instr&0x1fff07f | (lo>>5)<<25 | (lo&0x1f)<<7
+			}
+			binary.LittleEndian.PutUint32(at, instr)
+		default:
+			return fmt.Errorf("unsupported relocation %s at %#x to %q, assemble with -mattr=-relax and branch to local labels", typ, r.Off, sym.Name)
+		}
+	}
+	return nil
+}
+
+// write writes the executable: the sections in PT_LOAD segments, and the symbols
+func write(sections []*section, syms []elf.Symbol, symAddr func(elf.Symbol) (uint64, error)) ([]byte, error) {
+	var strtab, shstrtab bytes.Buffer
+	addString := func(b *bytes.Buffer, s string) uint32 {
+		if b.Len() == 0 {
+			b.WriteByte(0)
+		}
+		if s == "" {
+			return 0
+		}
+		off := uint32(b.Len())
+		b.WriteString(s)
+		b.WriteByte(0)
+		return off
+	}
+	addString(&strtab, "")
+	addString(&shstrtab, "")
+
+	// the local symbols come before the global ones, assembler temporaries are left out
+	outSyms := []elf.Sym64{{}}
+	var globals []elf.Sym64
+	for _, sym := range syms {
+		if strings.HasPrefix(sym.Name, ".L") || elf.ST_TYPE(sym.Info) == elf.STT_SECTION {
+			continue
+		}
+		shndx := uint16(elf.SHN_ABS)
+		value := sym.Value
+		if sym.Section != elf.SHN_ABS {
+			found := false
+			for i, s := range sections {
+				if int(sym.Section) == s.in {
+					shndx, found = uint16(i+1), true
+				}
+			}
+			if !found {
+				continue
+			}
+			addr, err := symAddr(sym)
+			if err != nil {
+				return nil, err
+			}
+			value = addr
+		}
+		out := elf.Sym64{Name: addString(&strtab, sym.Name), Info: sym.Info, Other: sym.Other, Shndx: shndx, Value: value, Size: sym.Size}
+		if elf.ST_BIND(sym.Info) == elf.STB_LOCAL {
+			outSyms = append(outSyms, out)
+		} else {
+			globals = append(globals, out)
+		}
+	}
+	firstGlobal := len(outSyms)
+	outSyms = append(outSyms, globals...)
+	var symtab bytes.Buffer
+	if err := binary.Write(&symtab, binary.LittleEndian, outSyms); err != nil {
+		return nil, err
+	}
+
+	const (
+		headerSize = 64
+		progSize   = 56
+		sectSize   = 64
+	)
+	var out bytes.Buffer
+	pad := func(align int) {
+		for out.Len()%align != 0 {
+			out.WriteByte(0)
+		}
+	}
+	out.Write(make([]byte, headerSize+progSize*len(sections)))
+
+	// the file offsets of the segments are congruent to their addresses modulo the page size
+	var progs []elf.Prog64
+	var sects []elf.Section64
+	sects = append(sects, elf.Section64{})
+	for _, s := range sections {
+		pad(pageSize)
+		off := uint64(out.Len())
+		out.Write(s.data)
+		flags := elf.PF_R
+		if s.flags&elf.SHF_EXECINSTR != 0 {
+			flags |= elf.PF_X
+		}
+		if s.flags&elf.SHF_WRITE != 0 {
+			flags |= elf.PF_W
+		}
+		progs = append(progs, elf.Prog64{
+			Type: uint32(elf.PT_LOAD), Flags: uint32(flags), Off: off, Vaddr: s.addr, Paddr: s.addr,
+			Filesz: uint64(len(s.data)), Memsz: uint64(len(s.data)), Align: pageSize,
+		})
+		sects = append(sects, elf.Section64{
+			Name: addString(&shstrtab, s.name), Type: uint32(elf.SHT_PROGBITS), Flags: uint64(s.flags),
+			Addr: s.addr, Off: off, Size: uint64(len(s.data)), Addralign: 64,
+		})
+	}
+	symtabIndex := len(sects)
+	for _, t := range []struct {
+		name string
+		typ  elf.SectionType
+		data []byte
+	}{{".symtab", elf.SHT_SYMTAB, symtab.Bytes()}, {".strtab", elf.SHT_STRTAB, strtab.Bytes()}} {
+		pad(8)
+		sects = append(sects, elf.Section64{Name: addString(&shstrtab, t.name), Type: uint32(t.typ), Off: uint64(out.Len()), Size: uint64(len(t.data)), Addralign: 8})
+		out.Write(t.data)
+	}
+	sects[symtabIndex].Link = uint32(symtabIndex + 1)
+	sects[symtabIndex].Info = uint32(firstGlobal)
+	sects[symtabIndex].Entsize = 24
+	shstrtabName := addString(&shstrtab, ".shstrtab")
+	sects = append(sects, elf.Section64{Name: shstrtabName, Type: uint32(elf.SHT_STRTAB), Off: uint64(out.Len()), Size: uint64(shstrtab.Len()), Addralign: 1})
+	out.Write(shstrtab.Bytes())
+	pad(8)
+	shoff := uint64(out.Len())
+	if err := binary.Write(&out, binary.LittleEndian, sects); err != nil {
+		return nil, err
+	}
+
+	header := elf.Header64{
+		Type: uint16(elf.ET_EXEC), Machine: uint16(elf.EM_RISCV), Version: uint32(elf.EV_CURRENT),
+		Entry: textAddr, Phoff: headerSize, Shoff: shoff, Ehsize: headerSize,
+		Phentsize: progSize, Phnum: uint16(len(progs)), Shentsize: sectSize, Shnum: uint16(len(sects)), Shstrndx: uint16(len(sects) - 1),
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var head bytes.Buffer
+	if err := binary.Write(&head, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&head, binary.LittleEndian, progs); err != nil {
+		return nil, err
+	}
+	b := out.Bytes()
+	copy(b, head.Bytes())
+	return b, nil
+}